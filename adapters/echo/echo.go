@@ -0,0 +1,65 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Package echolog provides an echo middleware logging requests with a
+// log.HTTPMiddleware.
+package echolog
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/exograd/go-log"
+	"github.com/labstack/echo/v4"
+)
+
+// Return a middleware logging requests and recovering from panics in the
+// same way as the net/http middleware. It replaces both middleware.Logger
+// and middleware.Recover.
+func Middleware(m *log.HTTPMiddleware) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			r := m.StartRequest(c.Request())
+			res := c.Response()
+
+			defer func() {
+				if value := recover(); value != nil {
+					if value == http.ErrAbortHandler {
+						panic(value)
+					}
+
+					incidentId := r.Panic(value)
+
+					if !res.Committed {
+						res.Header().Set(m.Cfg.IncidentIdHeader, incidentId)
+						err = c.String(http.StatusInternalServerError,
+							fmt.Sprintf("internal server error (incident %s)\n",
+								incidentId))
+					}
+				}
+
+				r.Finish(res.Status, int(res.Size))
+			}()
+
+			// Errors are handled here so that the status of the response is
+			// known when the request is logged; the error handler of echo
+			// does nothing for responses which have already been sent.
+			if err = next(c); err != nil {
+				c.Error(err)
+			}
+
+			return err
+		}
+	}
+}
@@ -0,0 +1,22 @@
+module github.com/exograd/go-log/adapters/echo
+
+go 1.18
+
+require (
+	github.com/exograd/go-log v0.0.0
+	github.com/labstack/echo/v4 v4.9.1
+)
+
+require (
+	github.com/labstack/gommon v0.4.0 // indirect
+	github.com/mattn/go-colorable v0.1.11 // indirect
+	github.com/mattn/go-isatty v0.0.14 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/valyala/fasttemplate v1.2.1 // indirect
+	golang.org/x/crypto v0.0.0-20210817164053-32db794688a5 // indirect
+	golang.org/x/net v0.0.0-20211015210444-4f30a5c0130f // indirect
+	golang.org/x/sys v0.13.0 // indirect
+	golang.org/x/text v0.3.7 // indirect
+)
+
+replace github.com/exograd/go-log => ../..
@@ -0,0 +1,73 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Package fiberlog provides a fiber middleware logging requests with a
+// log.HTTPMiddleware.
+package fiberlog
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/exograd/go-log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// Return a middleware logging requests and recovering from panics in the
+// same way as the net/http middleware. It replaces both the logger and the
+// recover middlewares of fiber.
+func Middleware(m *log.HTTPMiddleware) fiber.Handler {
+	return func(c *fiber.Ctx) (err error) {
+		// Strings returned by fiber are only valid until the handler
+		// returns, and messages can be retained by backends.
+		req := &http.Request{
+			Method:     utils.CopyString(c.Method()),
+			URL:        &url.URL{Path: utils.CopyString(c.Path())},
+			RemoteAddr: c.Context().RemoteAddr().String(),
+			Header:     make(http.Header),
+		}
+
+		c.Request().Header.VisitAll(func(key, value []byte) {
+			req.Header.Add(string(key), string(value))
+		})
+
+		r := m.StartRequest(req)
+
+		defer func() {
+			if value := recover(); value != nil {
+				incidentId := r.Panic(value)
+
+				c.Set(m.Cfg.IncidentIdHeader, incidentId)
+				err = c.Status(http.StatusInternalServerError).SendString(
+					fmt.Sprintf("internal server error (incident %s)\n",
+						incidentId))
+			}
+
+			res := c.Response()
+			r.Finish(res.StatusCode(), len(res.Body()))
+		}()
+
+		// Errors are handled here so that the status of the response is
+		// known when the request is logged.
+		if chainErr := c.Next(); chainErr != nil {
+			if err := c.App().ErrorHandler(c, chainErr); err != nil {
+				c.SendStatus(http.StatusInternalServerError)
+			}
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Package ginlog provides a gin middleware logging requests with a
+// log.HTTPMiddleware.
+package ginlog
+
+import (
+	"net/http"
+
+	"github.com/exograd/go-log"
+	"github.com/gin-gonic/gin"
+)
+
+// Return a middleware logging requests and recovering from panics in the
+// same way as the net/http middleware. It replaces both gin.Logger and
+// gin.Recovery.
+func Middleware(m *log.HTTPMiddleware) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r := m.StartRequest(c.Request)
+
+		defer func() {
+			if value := recover(); value != nil {
+				if value == http.ErrAbortHandler {
+					panic(value)
+				}
+
+				incidentId := r.Panic(value)
+
+				if !c.Writer.Written() {
+					c.Header(m.Cfg.IncidentIdHeader, incidentId)
+					c.String(http.StatusInternalServerError,
+						"internal server error (incident %s)\n", incidentId)
+				}
+
+				c.Abort()
+			}
+
+			r.Finish(c.Writer.Status(), c.Writer.Size())
+		}()
+
+		c.Next()
+	}
+}
@@ -0,0 +1,12 @@
+module github.com/exograd/go-log/adapters/lambda
+
+go 1.18
+
+require (
+	github.com/aws/aws-lambda-go v1.41.0
+	github.com/exograd/go-log v0.0.0
+)
+
+require golang.org/x/sys v0.13.0 // indirect
+
+replace github.com/exograd/go-log => ../..
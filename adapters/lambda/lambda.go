@@ -0,0 +1,109 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Package lambdalog provides a handler wrapper for AWS Lambda functions.
+//
+// Functions should use a JSON backend with the CloudWatch encoder option,
+// writing to the standard output:
+//
+//	{"type": "json", "backend": {"encoder": {"cloudwatch": true}}}
+package lambdalog
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/exograd/go-log"
+)
+
+type contextKey struct{}
+
+var coldStart int32 = 1
+
+type handler struct {
+	logger  *log.Logger
+	handler lambda.Handler
+}
+
+// Wrap a handler so that each invocation uses a child logger, available in
+// the context with Logger, whose messages contain the request id and
+// whether the invocation is a cold start. The backend of the logger is
+// flushed before the invocation returns since the execution environment can
+// be frozen right after.
+//
+// Typed handler functions can be wrapped with lambda.NewHandler.
+func Wrap(logger *log.Logger, h lambda.Handler) lambda.Handler {
+	return &handler{
+		logger:  logger,
+		handler: h,
+	}
+}
+
+// Start the Lambda runtime loop with a wrapped handler.
+func Start(logger *log.Logger, h lambda.Handler) {
+	lambda.StartHandler(Wrap(logger, h))
+}
+
+func (h *handler) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	data := log.Data{
+		"cold_start": atomic.SwapInt32(&coldStart, 0) == 1,
+	}
+
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		data["request_id"] = lc.AwsRequestID
+		ctx = log.WithRequestId(ctx, lc.AwsRequestID)
+	}
+
+	if lambdacontext.FunctionName != "" {
+		data["function_name"] = lambdacontext.FunctionName
+	}
+
+	logger := h.logger.Child("", data)
+	ctx = context.WithValue(ctx, contextKey{}, logger)
+
+	defer func() {
+		if value := recover(); value != nil {
+			logger.ErrorData(log.Data{
+				"stack_trace": log.CaptureStack(2).String(),
+			}, "panic in lambda handler: %v", value)
+
+			flush(logger)
+			panic(value)
+		}
+	}()
+
+	res, err := h.handler.Invoke(ctx, payload)
+	if err != nil {
+		logger.Error("invocation failed: %v", err)
+	}
+
+	flush(logger)
+
+	return res, err
+}
+
+// Return the logger of the current invocation, or nil if the context was
+// not created by a wrapped handler.
+func Logger(ctx context.Context) *log.Logger {
+	logger, _ := ctx.Value(contextKey{}).(*log.Logger)
+	return logger
+}
+
+func flush(logger *log.Logger) {
+	if backend, ok := logger.Backend.(interface{ Flush() error }); ok {
+		backend.Flush()
+	}
+}
@@ -0,0 +1,12 @@
+module github.com/exograd/go-log/adapters/logrus
+
+go 1.18
+
+require (
+	github.com/exograd/go-log v0.0.0
+	github.com/sirupsen/logrus v1.9.4
+)
+
+require golang.org/x/sys v0.13.0 // indirect
+
+replace github.com/exograd/go-log => ../..
@@ -0,0 +1,148 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Package logruscompat allows the use of logrus hooks and formatters with
+// loggers, so that programs can migrate from logrus without losing their
+// custom extensions.
+package logruscompat
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/exograd/go-log"
+	"github.com/sirupsen/logrus"
+)
+
+// Formatters and hooks can access the logger of entries; they are given a
+// logger which does not write anything.
+var entryLogger = &logrus.Logger{
+	Out:       io.Discard,
+	Formatter: new(logrus.TextFormatter),
+	Hooks:     make(logrus.LevelHooks),
+	Level:     logrus.TraceLevel,
+}
+
+// Return a logrus entry for a message. The domain of the message, if there is
+// one, is stored in the "domain" field. Debug messages whose debug level is
+// strictly greater than 1 have the trace level.
+func Entry(msg log.Message) *logrus.Entry {
+	fields := make(logrus.Fields, len(msg.Data)+1)
+	for k, v := range msg.Data {
+		fields[k] = v
+	}
+
+	if domain := msg.Domain(); domain != "" {
+		fields["domain"] = domain
+	}
+
+	entry := logrus.NewEntry(entryLogger)
+	entry.Data = fields
+	entry.Level = Level(msg)
+	entry.Message = msg.Message
+
+	if msg.Time != nil {
+		entry.Time = *msg.Time
+	}
+
+	return entry
+}
+
+func Level(msg log.Message) logrus.Level {
+	switch msg.Level {
+	case log.LevelDebug:
+		if msg.DebugLevel > 1 {
+			return logrus.TraceLevel
+		}
+
+		return logrus.DebugLevel
+
+	case log.LevelError:
+		return logrus.ErrorLevel
+
+	default:
+		return logrus.InfoLevel
+	}
+}
+
+// Encoder is a log encoder using a logrus formatter.
+type Encoder struct {
+	Formatter logrus.Formatter
+}
+
+func NewEncoder(formatter logrus.Formatter) *Encoder {
+	return &Encoder{
+		Formatter: formatter,
+	}
+}
+
+func (e *Encoder) EncodeMessage(msg log.Message, buf *bytes.Buffer) error {
+	data, err := e.Formatter.Format(Entry(msg))
+	if err != nil {
+		return err
+	}
+
+	// Logrus formatters terminate entries with a newline character, log
+	// encoders do not.
+	buf.Write(bytes.TrimSuffix(data, []byte{'\n'}))
+
+	return nil
+}
+
+// HookBackend fires logrus hooks for each message before passing it to
+// another backend. Hook errors are reported as write failures.
+type HookBackend struct {
+	Backend       log.Backend
+	Hooks         logrus.LevelHooks
+	WriteFailures *log.WriteFailureReporter
+}
+
+const BackendTypeLogrusHook log.BackendType = "logrus_hook"
+
+func NewHookBackend(backend log.Backend, hooks ...logrus.Hook) *HookBackend {
+	b := &HookBackend{
+		Backend: backend,
+		Hooks:   make(logrus.LevelHooks),
+		WriteFailures: log.NewWriteFailureReporter(BackendTypeLogrusHook,
+			"", nil),
+	}
+
+	for _, hook := range hooks {
+		b.Hooks.Add(hook)
+	}
+
+	return b
+}
+
+func (b *HookBackend) Log(msg log.Message) {
+	if hooks := b.Hooks[Level(msg)]; len(hooks) > 0 {
+		entry := Entry(msg)
+
+		var failed bool
+		for _, hook := range hooks {
+			if err := hook.Fire(entry); err != nil {
+				err = fmt.Errorf("cannot fire logrus hook: %w", err)
+				b.WriteFailures.Failure(err)
+				failed = true
+			}
+		}
+
+		if !failed {
+			b.WriteFailures.Success()
+		}
+	}
+
+	b.Backend.Log(msg)
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The adaptive debug controller raises the debug level of a domain for a
+// limited duration once this domain has logged a number of errors during a
+// period, so that detailed messages are available when problems occur. The
+// raised level also applies to subdomains. Level changes are reported in the
+// internal domain.
+type AdaptiveDebugCfg struct {
+	// The number of errors logged during the period which triggers the
+	// debug level change; 5 errors per minute by default.
+	ErrorThreshold int           `json:"error_threshold"`
+	Period         time.Duration `json:"period"`
+
+	// The debug level used during the raise, 1 by default, and the
+	// duration of the raise, 5 minutes by default. Errors logged while the
+	// level is raised do not extend the duration.
+	DebugLevel int           `json:"debug_level"`
+	Duration   time.Duration `json:"duration"`
+
+	// If set, only domains matching one of the patterns (see path.Match)
+	// are controlled.
+	Domains []string `json:"domains"`
+}
+
+type adaptiveDebug struct {
+	// The number of domains whose debug level is currently raised, accessed
+	// atomically so that the common case does not require locking. It must
+	// stay 64 bit aligned on 32 bit platforms.
+	nbRaised int64
+
+	Cfg AdaptiveDebugCfg
+
+	mut     sync.Mutex
+	domains map[string]*adaptiveDebugDomain
+}
+
+type adaptiveDebugDomain struct {
+	controlled bool
+
+	periodStart time.Time
+	nbErrors    int
+
+	raised bool
+}
+
+func newAdaptiveDebug(cfg AdaptiveDebugCfg) (*adaptiveDebug, error) {
+	for _, pattern := range cfg.Domains {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid domain pattern %q: %w",
+				pattern, err)
+		}
+	}
+
+	if cfg.ErrorThreshold <= 0 {
+		cfg.ErrorThreshold = 5
+	}
+
+	if cfg.Period <= 0 {
+		cfg.Period = time.Minute
+	}
+
+	if cfg.DebugLevel <= 0 {
+		cfg.DebugLevel = 1
+	}
+
+	if cfg.Duration <= 0 {
+		cfg.Duration = 5 * time.Minute
+	}
+
+	a := adaptiveDebug{
+		Cfg: cfg,
+
+		domains: make(map[string]*adaptiveDebugDomain),
+	}
+
+	return &a, nil
+}
+
+// Return the debug level raised for a domain or one of its parents, or -1 if
+// there is none.
+func (a *adaptiveDebug) debugLevel(domain string) int {
+	if atomic.LoadInt64(&a.nbRaised) == 0 {
+		return -1
+	}
+
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	for {
+		if d := a.domains[domain]; d != nil && d.raised {
+			return a.Cfg.DebugLevel
+		}
+
+		idx := strings.LastIndexByte(domain, '.')
+		if idx < 0 {
+			return -1
+		}
+
+		domain = domain[:idx]
+	}
+}
+
+// Count an error logged in a domain and raise its debug level if the
+// threshold is reached. Level changes are logged with the backend.
+func (a *adaptiveDebug) countError(domain string, now time.Time, backend Backend) {
+	a.mut.Lock()
+
+	d := a.domains[domain]
+	if d == nil {
+		d = &adaptiveDebugDomain{
+			controlled: a.controlled(domain),
+		}
+
+		a.domains[domain] = d
+	}
+
+	if !d.controlled || d.raised {
+		a.mut.Unlock()
+		return
+	}
+
+	if now.Sub(d.periodStart) >= a.Cfg.Period {
+		d.periodStart = now
+		d.nbErrors = 0
+	}
+
+	d.nbErrors++
+
+	if d.nbErrors < a.Cfg.ErrorThreshold {
+		a.mut.Unlock()
+		return
+	}
+
+	d.nbErrors = 0
+	d.raised = true
+	atomic.AddInt64(&a.nbRaised, 1)
+
+	a.mut.Unlock()
+
+	time.AfterFunc(a.Cfg.Duration, func() {
+		a.mut.Lock()
+		d.raised = false
+		d.periodStart = time.Time{}
+		atomic.AddInt64(&a.nbRaised, -1)
+		a.mut.Unlock()
+
+		a.report(backend, domain,
+			"debug level of domain %q restored after %v", domain,
+			a.Cfg.Duration)
+	})
+
+	a.report(backend, domain,
+		"debug level of domain %q raised to %d for %v after %d errors",
+		domain, a.Cfg.DebugLevel, a.Cfg.Duration, a.Cfg.ErrorThreshold)
+}
+
+func (a *adaptiveDebug) controlled(domain string) bool {
+	if len(a.Cfg.Domains) == 0 {
+		return true
+	}
+
+	for _, pattern := range a.Cfg.Domains {
+		if ok, _ := path.Match(pattern, domain); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *adaptiveDebug) report(backend Backend, domain string, format string, args ...interface{}) {
+	t := time.Now().UTC()
+
+	backend.Log(Message{
+		Time:    &t,
+		Level:   LevelInfo,
+		Message: fmt.Sprintf(format, args...),
+		Data: Data{
+			"controlled_domain": domain,
+			"debug_level":       a.Cfg.DebugLevel,
+		},
+
+		domain: InternalDomain,
+	})
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The admin handler exposes a small HTTP API used to inspect a logger at run
+// time. It is meant to be mounted on an internal listener, using
+// http.StripPrefix if necessary.
+type AdminHandler struct {
+	Logger *Logger
+}
+
+type AdminMessage struct {
+	Time       time.Time         `json:"time"`
+	Level      Level             `json:"level"`
+	DebugLevel int               `json:"debug_level,omitempty"`
+	Domain     string            `json:"domain,omitempty"`
+	Message    string            `json:"message"`
+	Data       map[string]string `json:"data,omitempty"`
+}
+
+type AdminDebugLevel struct {
+	DebugLevel int `json:"debug_level"`
+}
+
+// The boost duration is a number of nanoseconds, like durations in
+// configurations.
+type AdminDebugBoost struct {
+	DebugLevel int           `json:"debug_level"`
+	Duration   time.Duration `json:"duration"`
+}
+
+type AdminHealth struct {
+	Status          string                `json:"status"`
+	DebugLevel      int                   `json:"debug_level"`
+	DebugBoost      *DebugBoost           `json:"debug_boost,omitempty"`
+	Messages        MessageCounts         `json:"messages"`
+	DeliveryLatency *DeliveryLatencyStats `json:"delivery_latency,omitempty"`
+}
+
+func NewAdminHandler(logger *Logger) *AdminHandler {
+	return &AdminHandler{
+		Logger: logger,
+	}
+}
+
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := strings.TrimSuffix(req.URL.Path, "/")
+
+	switch path {
+	case "/capture":
+		h.serveCapture(w, req)
+
+	case "/debug_level":
+		h.serveDebugLevel(w, req)
+
+	case "/debug_boost":
+		h.serveDebugBoost(w, req)
+
+	case "/health":
+		h.serveHealth(w, req)
+
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (h *AdminHandler) serveCapture(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		adminMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	messages := h.Logger.CapturedMessages()
+
+	adminMessages := make([]AdminMessage, len(messages))
+	for i, msg := range messages {
+		adminMessages[i] = newAdminMessage(msg)
+	}
+
+	adminReply(w, http.StatusOK, adminMessages)
+}
+
+func (h *AdminHandler) serveDebugLevel(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+
+	case http.MethodPut:
+		var value AdminDebugLevel
+		if err := json.NewDecoder(req.Body).Decode(&value); err != nil {
+			http.Error(w, "invalid request body: "+err.Error(),
+				http.StatusBadRequest)
+			return
+		}
+
+		if value.DebugLevel < 0 {
+			http.Error(w, "invalid negative debug level",
+				http.StatusBadRequest)
+			return
+		}
+
+		h.Logger.SetDebugLevel(value.DebugLevel)
+
+	case http.MethodDelete:
+		h.Logger.ResetDebugLevel()
+
+	default:
+		adminMethodNotAllowed(w, http.MethodGet, http.MethodPut,
+			http.MethodDelete)
+		return
+	}
+
+	value := AdminDebugLevel{
+		DebugLevel: h.Logger.CurrentDebugLevel(),
+	}
+
+	adminReply(w, http.StatusOK, value)
+}
+
+func (h *AdminHandler) serveDebugBoost(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+
+	case http.MethodPut:
+		var value AdminDebugBoost
+		if err := json.NewDecoder(req.Body).Decode(&value); err != nil {
+			http.Error(w, "invalid request body: "+err.Error(),
+				http.StatusBadRequest)
+			return
+		}
+
+		if value.DebugLevel < 0 {
+			http.Error(w, "invalid negative debug level",
+				http.StatusBadRequest)
+			return
+		}
+
+		if value.Duration <= 0 {
+			http.Error(w, "invalid duration", http.StatusBadRequest)
+			return
+		}
+
+		h.Logger.BoostDebug(value.DebugLevel, value.Duration)
+
+	case http.MethodDelete:
+		h.Logger.CancelDebugBoost()
+
+	default:
+		adminMethodNotAllowed(w, http.MethodGet, http.MethodPut,
+			http.MethodDelete)
+		return
+	}
+
+	adminReply(w, http.StatusOK, h.Logger.DebugBoost())
+}
+
+func (h *AdminHandler) serveHealth(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		adminMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	health := AdminHealth{
+		Status:          "ok",
+		DebugLevel:      h.Logger.CurrentDebugLevel(),
+		DebugBoost:      h.Logger.DebugBoost(),
+		Messages:        h.Logger.MessageCounts(),
+		DeliveryLatency: h.Logger.DeliveryLatency(),
+	}
+
+	adminReply(w, http.StatusOK, health)
+}
+
+func newAdminMessage(msg Message) AdminMessage {
+	adminMsg := AdminMessage{
+		Level:      msg.Level,
+		DebugLevel: msg.DebugLevel,
+		Domain:     msg.domain,
+		Message:    msg.Message,
+	}
+
+	if msg.Time != nil {
+		adminMsg.Time = *msg.Time
+	}
+
+	if len(msg.Data) > 0 {
+		adminMsg.Data = make(map[string]string, len(msg.Data))
+		for k, v := range msg.Data {
+			adminMsg.Data[k] = formatDatum2(v)
+		}
+	}
+
+	return adminMsg
+}
+
+func adminMethodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+}
+
+func adminReply(w http.ResponseWriter, status int, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		http.Error(w, "cannot encode response: "+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"encoding/hex"
+	"hash/fnv"
+	"runtime"
+	"strings"
+)
+
+// The data key which can be used to set the aggregation key of a message
+// explicitly; loggers do not add it to messages.
+const AggregationKeyDataKey = "aggregation_key"
+
+// AggregationKey returns the key used to group error messages which describe
+// the same problem, e.g. to build Sentry fingerprints. It is called by
+// backends for each error message whose data do not contain an aggregation
+// key, and can be replaced by applications before any message is logged.
+// Returning an empty string disables aggregation for the message.
+var AggregationKey func(msg Message) string = DefaultAggregationKey
+
+// The default aggregation key is a hash of the domain of the message, of its
+// normalized text (see NormalizeMessage), and of the function at the top of
+// the stack, either the one of a Stack datum or the one which called the
+// logger.
+func DefaultAggregationKey(msg Message) string {
+	h := fnv.New64a()
+
+	h.Write([]byte(msg.domain))
+	h.Write([]byte{0})
+	h.Write([]byte(NormalizeMessage(msg.Message)))
+	h.Write([]byte{0})
+	h.Write([]byte(msg.topFunction()))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Return the aggregation key of a message, computing it unless it was set
+// explicitly in the data of the message.
+func messageAggregationKey(msg Message) string {
+	if key, ok := msg.Data[AggregationKeyDataKey].(string); ok {
+		return key
+	}
+
+	return AggregationKey(msg)
+}
+
+func (msg Message) topFunction() string {
+	for _, datum := range msg.Data {
+		if stack, ok := datum.(Stack); ok && len(stack) > 0 {
+			return stack[0].Function
+		}
+	}
+
+	if msg.callSite == 0 {
+		return ""
+	}
+
+	frame, _ := runtime.CallersFrames([]uintptr{msg.callSite}).Next()
+	return frame.Function
+}
+
+// NormalizeMessage replaces the variable parts of a message, i.e. quoted
+// strings and words made of digits, hexadecimal digits and dashes (numbers,
+// identifiers, UUIDs...), by "*", so that messages produced by the same
+// format string are identical.
+func NormalizeMessage(s string) string {
+	var buf strings.Builder
+	buf.Grow(len(s))
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(s[i+1:], c)
+			if end == -1 {
+				buf.WriteString(s[i:])
+				return buf.String()
+			}
+
+			buf.WriteByte(c)
+			buf.WriteByte('*')
+			buf.WriteByte(c)
+			i += end + 2
+
+		case isWordChar(c):
+			start := i
+			for i < len(s) && isWordChar(s[i]) {
+				i++
+			}
+
+			word := s[start:i]
+			if isVariableWord(word) {
+				buf.WriteByte('*')
+			} else {
+				buf.WriteString(word)
+			}
+
+		default:
+			buf.WriteByte(c)
+			i++
+		}
+	}
+
+	return buf.String()
+}
+
+func isWordChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+		(c >= '0' && c <= '9') || c == '-' || c == '_'
+}
+
+func isVariableWord(word string) bool {
+	if strings.HasPrefix(word, "0x") || strings.HasPrefix(word, "0X") {
+		word = word[2:]
+	}
+
+	hasDigit := false
+
+	for i := 0; i < len(word); i++ {
+		c := word[i]
+
+		switch {
+		case c >= '0' && c <= '9':
+			hasDigit = true
+		case (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') || c == '-':
+		default:
+			return false
+		}
+	}
+
+	return hasDigit
+}
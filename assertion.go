@@ -0,0 +1,50 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import "fmt"
+
+// Log an error with the current stack trace if the condition is false. In
+// strict assertion mode, the function then panics.
+func (l *Logger) Assert(cond bool, format string, args ...interface{}) {
+	if cond {
+		return
+	}
+
+	l.assertionFailure("assertion failed: "+format, args...)
+}
+
+// Log an error with the current stack trace, signaling that code which should
+// never be executed was reached. In strict assertion mode, the function then
+// panics.
+func (l *Logger) Unreachable(format string, args ...interface{}) {
+	l.assertionFailure("unreachable code reached: "+format, args...)
+}
+
+func (l *Logger) assertionFailure(format string, args ...interface{}) {
+	text := fmt.Sprintf(format, args...)
+
+	l.log(Message{
+		Level:   LevelError,
+		Message: text,
+		Data: Data{
+			"stack_trace": CaptureStack(2).String(),
+		},
+	}, 2)
+
+	if l.Cfg.StrictAssertions {
+		panic(text)
+	}
+}
@@ -14,13 +14,612 @@
 
 package log
 
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
 type BackendType string
 
 const (
 	BackendTypeTerminal BackendType = "terminal"
 	BackendTypeSyslog   BackendType = "syslog"
+	BackendTypeJournald BackendType = "journald"
+	BackendTypeEventLog BackendType = "eventlog"
+	BackendTypeFile     BackendType = "file"
+	BackendTypeJSON     BackendType = "json"
+
+	BackendTypeRotatingFile  BackendType = "rotating_file"
+	BackendTypeElasticsearch BackendType = "elasticsearch"
+	BackendTypeRedis         BackendType = "redis"
+	BackendTypeMQTT          BackendType = "mqtt"
+	BackendTypeFluentd       BackendType = "fluentd"
+	BackendTypeLogstash      BackendType = "logstash"
+	BackendTypeDatadog       BackendType = "datadog"
+	BackendTypeGCP           BackendType = "gcp"
+	BackendTypeSentry        BackendType = "sentry"
+	BackendTypeNotification  BackendType = "notification"
+	BackendTypeWebhook       BackendType = "webhook"
+	BackendTypeSQLite        BackendType = "sqlite"
+	BackendTypePostgreSQL    BackendType = "postgresql"
+	BackendTypeClickHouse    BackendType = "clickhouse"
+	BackendTypeS3            BackendType = "s3"
+	BackendTypeRing          BackendType = "ring"
+	BackendTypeWriter        BackendType = "writer"
+	BackendTypeFailover      BackendType = "failover"
+	BackendTypeQueue         BackendType = "queue"
+	BackendTypeRateLimit     BackendType = "rate_limit"
+	BackendTypeSampling      BackendType = "sampling"
+	BackendTypeFilter        BackendType = "filter"
+	BackendTypeDedup         BackendType = "dedup"
+	BackendTypeHoneycomb     BackendType = "honeycomb"
 )
 
+type BackendCfg struct {
+	Type    BackendType      `json:"type"`
+	Data    *json.RawMessage `json:"backend,omitempty"`
+	Backend interface{}      `json:"-"`
+
+	// Data returned by injectors are added to messages sent to this backend
+	// only; see FieldInjector.
+	Injectors []FieldInjector `json:"-"`
+
+	// If set, the handler is called for each write failure of the backend,
+	// in addition to the handler of its own configuration if there is one.
+	failureHandler func(WriteFailure)
+}
+
 type Backend interface {
 	Log(Message)
 }
+
+// Backends able to write several messages at once, without any other message
+// being written in between, implement the BatchBackend interface.
+type BatchBackend interface {
+	Backend
+
+	LogBatch([]Message)
+}
+
+// Backends which do not implement BatchBackend receive the messages of a
+// batch one by one while this lock is held, so that batches are at least not
+// interleaved with each other.
+var batchFallbackMut sync.Mutex
+
+// Write several messages contiguously if the backend supports it.
+func logBatch(backend Backend, msgs []Message) {
+	if batchBackend, ok := backend.(BatchBackend); ok {
+		batchBackend.LogBatch(msgs)
+		return
+	}
+
+	batchFallbackMut.Lock()
+	defer batchFallbackMut.Unlock()
+
+	for _, msg := range msgs {
+		backend.Log(msg)
+	}
+}
+
+func unsupportedBackendError(backendType BackendType) error {
+	return fmt.Errorf("%s backend is not supported on %s",
+		backendType, runtime.GOOS)
+}
+
+// Decorator backends write messages to another backend created from their own
+// configuration.
+func isDecoratorBackendType(backendType BackendType) bool {
+	switch backendType {
+	case BackendTypeQueue, BackendTypeRateLimit, BackendTypeSampling,
+		BackendTypeFilter, BackendTypeDedup:
+		return true
+	}
+
+	return false
+}
+
+// Close a backend if it supports it. Errors are ignored: the function is used
+// to release backends which are being discarded.
+func closeBackend(backend Backend) {
+	if closer, ok := backend.(interface{ Close() error }); ok {
+		closer.Close()
+	}
+}
+
+func newBackend(cfg BackendCfg, dryRun bool) (Backend, error) {
+	var backend Backend
+
+	backendCfg := func(cfgObj interface{}) (interface{}, error) {
+		switch {
+		case cfg.Backend != nil:
+			cfgObj = cfg.Backend
+
+		case cfg.Data != nil:
+			if err := json.Unmarshal(*cfg.Data, cfgObj); err != nil {
+				return nil,
+					fmt.Errorf("invalid backend configuration: %w", err)
+			}
+		}
+
+		if cfg.failureHandler != nil {
+			var ok bool
+			cfgObj, ok = withWriteFailureHandler(cfgObj, cfg.failureHandler)
+
+			// Decorators pass the handler to the backend they decorate.
+			if !ok && !isDecoratorBackendType(cfg.Type) {
+				return nil, fmt.Errorf("%s backend cannot report write "+
+					"failures", cfg.Type)
+			}
+		}
+
+		return cfgObj, nil
+	}
+
+	switch cfg.Type {
+	case BackendTypeTerminal:
+		bcfg, err := backendCfg(&TerminalBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*TerminalBackendCfg)
+		if err := bcfg2.check(); err != nil {
+			return nil, err
+		}
+		backend = NewTerminalBackend(*bcfg2)
+
+	case BackendTypeSyslog:
+		bcfg, err := backendCfg(&SyslogBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*SyslogBackendCfg)
+		if dryRun {
+			backend = newDryRunBackend(BackendTypeSyslog, bcfg2.Addr)
+			break
+		}
+		backend, err = NewSyslogBackend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create syslog backend: %w", err)
+		}
+
+	case BackendTypeJournald:
+		bcfg, err := backendCfg(&JournaldBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*JournaldBackendCfg)
+		if dryRun {
+			backend = newDryRunBackend(BackendTypeJournald, bcfg2.SocketPath)
+			break
+		}
+		backend, err = NewJournaldBackend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create journald backend: %w", err)
+		}
+
+	case BackendTypeEventLog:
+		bcfg, err := backendCfg(&EventLogBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*EventLogBackendCfg)
+		if dryRun {
+			backend = newDryRunBackend(BackendTypeEventLog, bcfg2.Source)
+			break
+		}
+		backend, err = NewEventLogBackend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create eventlog backend: %w", err)
+		}
+
+	case BackendTypeFile:
+		bcfg, err := backendCfg(&FileBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*FileBackendCfg)
+		if dryRun {
+			backend = newDryRunBackend(BackendTypeFile, bcfg2.Path)
+			break
+		}
+		backend, err = NewFileBackend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create file backend: %w", err)
+		}
+
+	case BackendTypeJSON:
+		bcfg, err := backendCfg(&JSONBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*JSONBackendCfg)
+		backend, err = NewJSONBackend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create json backend: %w", err)
+		}
+
+	case BackendTypeRotatingFile:
+		bcfg, err := backendCfg(&RotatingFileBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*RotatingFileBackendCfg)
+		if dryRun {
+			backend = newDryRunBackend(BackendTypeRotatingFile, bcfg2.Path)
+			break
+		}
+		backend, err = NewRotatingFileBackend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create rotating file backend: %w",
+				err)
+		}
+
+	case BackendTypeElasticsearch:
+		bcfg, err := backendCfg(&ElasticsearchBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*ElasticsearchBackendCfg)
+		if dryRun {
+			backend = newDryRunBackend(BackendTypeElasticsearch, bcfg2.URL)
+			break
+		}
+		backend, err = NewElasticsearchBackend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create elasticsearch backend: %w",
+				err)
+		}
+
+	case BackendTypeRedis:
+		bcfg, err := backendCfg(&RedisBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*RedisBackendCfg)
+		if dryRun {
+			backend = newDryRunBackend(BackendTypeRedis, bcfg2.Addr)
+			break
+		}
+		backend, err = NewRedisBackend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create redis backend: %w", err)
+		}
+
+	case BackendTypeMQTT:
+		bcfg, err := backendCfg(&MQTTBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*MQTTBackendCfg)
+		if dryRun {
+			backend = newDryRunBackend(BackendTypeMQTT, bcfg2.Addr)
+			break
+		}
+		backend, err = NewMQTTBackend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create mqtt backend: %w", err)
+		}
+
+	case BackendTypeFluentd:
+		bcfg, err := backendCfg(&FluentdBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*FluentdBackendCfg)
+		if dryRun {
+			backend = newDryRunBackend(BackendTypeFluentd, bcfg2.Addr)
+			break
+		}
+		backend, err = NewFluentdBackend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create fluentd backend: %w", err)
+		}
+
+	case BackendTypeLogstash:
+		bcfg, err := backendCfg(&LogstashBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*LogstashBackendCfg)
+		if dryRun {
+			backend = newDryRunBackend(BackendTypeLogstash, bcfg2.Addr)
+			break
+		}
+		backend, err = NewLogstashBackend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create logstash backend: %w", err)
+		}
+
+	case BackendTypeDatadog:
+		bcfg, err := backendCfg(&DatadogBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*DatadogBackendCfg)
+		if dryRun {
+			backend = newDryRunBackend(BackendTypeDatadog, bcfg2.URL)
+			break
+		}
+		backend, err = NewDatadogBackend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create datadog backend: %w", err)
+		}
+
+	case BackendTypeGCP:
+		bcfg, err := backendCfg(&GCPBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*GCPBackendCfg)
+		if dryRun {
+			backend = newDryRunBackend(BackendTypeGCP, bcfg2.LogName)
+			break
+		}
+		backend, err = NewGCPBackend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create gcp backend: %w", err)
+		}
+
+	case BackendTypeSentry:
+		bcfg, err := backendCfg(&SentryBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*SentryBackendCfg)
+		if dryRun {
+			backend = newDryRunBackend(BackendTypeSentry, "")
+			break
+		}
+		backend, err = NewSentryBackend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create sentry backend: %w", err)
+		}
+
+	case BackendTypeNotification:
+		bcfg, err := backendCfg(&NotificationBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*NotificationBackendCfg)
+		if dryRun {
+			backend = newDryRunBackend(BackendTypeNotification,
+				string(bcfg2.Service))
+			break
+		}
+		backend, err = NewNotificationBackend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create notification backend: %w",
+				err)
+		}
+
+	case BackendTypeWebhook:
+		bcfg, err := backendCfg(&WebhookBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*WebhookBackendCfg)
+		if dryRun {
+			backend = newDryRunBackend(BackendTypeWebhook, bcfg2.URL)
+			break
+		}
+		backend, err = NewWebhookBackend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create webhook backend: %w", err)
+		}
+
+	case BackendTypeSQLite:
+		bcfg, err := backendCfg(&SQLiteBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*SQLiteBackendCfg)
+		if dryRun {
+			backend = newDryRunBackend(BackendTypeSQLite, bcfg2.Path)
+			break
+		}
+		backend, err = NewSQLiteBackend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create sqlite backend: %w", err)
+		}
+
+	case BackendTypePostgreSQL:
+		bcfg, err := backendCfg(&PostgreSQLBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*PostgreSQLBackendCfg)
+		if dryRun {
+			backend = newDryRunBackend(BackendTypePostgreSQL,
+				redactURI(bcfg2.URI))
+			break
+		}
+		backend, err = NewPostgreSQLBackend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create postgresql backend: %w", err)
+		}
+
+	case BackendTypeClickHouse:
+		bcfg, err := backendCfg(&ClickHouseBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*ClickHouseBackendCfg)
+		if dryRun {
+			backend = newDryRunBackend(BackendTypeClickHouse, bcfg2.URL)
+			break
+		}
+		backend, err = NewClickHouseBackend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create clickhouse backend: %w", err)
+		}
+
+	case BackendTypeS3:
+		bcfg, err := backendCfg(&S3BackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*S3BackendCfg)
+		if dryRun {
+			backend = newDryRunBackend(BackendTypeS3, bcfg2.Bucket)
+			break
+		}
+		backend, err = NewS3Backend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create s3 backend: %w", err)
+		}
+
+	case BackendTypeRing:
+		bcfg, err := backendCfg(&RingBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*RingBackendCfg)
+		backend = NewRingBackend(*bcfg2)
+
+	case BackendTypeWriter:
+		bcfg, err := backendCfg(&WriterBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*WriterBackendCfg)
+		backend, err = NewWriterBackend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create writer backend: %w", err)
+		}
+
+	case BackendTypeFailover:
+		bcfg, err := backendCfg(&FailoverBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*FailoverBackendCfg)
+		if dryRun {
+			backend = newDryRunBackend(BackendTypeFailover,
+				string(bcfg2.Primary.Type))
+			break
+		}
+		backend, err = NewFailoverBackend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create failover backend: %w", err)
+		}
+
+	case BackendTypeQueue:
+		bcfg, err := backendCfg(&QueueBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*QueueBackendCfg)
+		childCfg := bcfg2.Backend
+		childCfg.failureHandler = cfg.failureHandler
+		child, err := newBackend(childCfg, dryRun)
+		if err != nil {
+			return nil, err
+		}
+		backend, err = NewQueueBackend(child, *bcfg2)
+		if err != nil {
+			closeBackend(child)
+			return nil, fmt.Errorf("cannot create queue backend: %w", err)
+		}
+
+	case BackendTypeRateLimit:
+		bcfg, err := backendCfg(&RateLimitBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*RateLimitBackendCfg)
+		childCfg := bcfg2.Backend
+		childCfg.failureHandler = cfg.failureHandler
+		child, err := newBackend(childCfg, dryRun)
+		if err != nil {
+			return nil, err
+		}
+		backend, err = NewRateLimitBackend(child, *bcfg2)
+		if err != nil {
+			closeBackend(child)
+			return nil, fmt.Errorf("cannot create rate limit backend: %w", err)
+		}
+
+	case BackendTypeSampling:
+		bcfg, err := backendCfg(&SamplingBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*SamplingBackendCfg)
+		childCfg := bcfg2.Backend
+		childCfg.failureHandler = cfg.failureHandler
+		child, err := newBackend(childCfg, dryRun)
+		if err != nil {
+			return nil, err
+		}
+		backend, err = NewSamplingBackend(child, *bcfg2)
+		if err != nil {
+			closeBackend(child)
+			return nil, fmt.Errorf("cannot create sampling backend: %w", err)
+		}
+
+	case BackendTypeFilter:
+		bcfg, err := backendCfg(&FilterBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*FilterBackendCfg)
+		childCfg := bcfg2.Backend
+		childCfg.failureHandler = cfg.failureHandler
+		child, err := newBackend(childCfg, dryRun)
+		if err != nil {
+			return nil, err
+		}
+		backend, err = NewFilterBackend(child, *bcfg2)
+		if err != nil {
+			closeBackend(child)
+			return nil, fmt.Errorf("cannot create filter backend: %w", err)
+		}
+
+	case BackendTypeDedup:
+		bcfg, err := backendCfg(&DedupBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*DedupBackendCfg)
+		childCfg := bcfg2.Backend
+		childCfg.failureHandler = cfg.failureHandler
+		child, err := newBackend(childCfg, dryRun)
+		if err != nil {
+			return nil, err
+		}
+		backend, err = NewDedupBackend(child, *bcfg2)
+		if err != nil {
+			closeBackend(child)
+			return nil, fmt.Errorf("cannot create dedup backend: %w", err)
+		}
+
+	case BackendTypeHoneycomb:
+		bcfg, err := backendCfg(&HoneycombBackendCfg{})
+		if err != nil {
+			return nil, err
+		}
+		bcfg2 := bcfg.(*HoneycombBackendCfg)
+		if dryRun {
+			backend = newDryRunBackend(BackendTypeHoneycomb, bcfg2.Dataset)
+			break
+		}
+		backend, err = NewHoneycombBackend(*bcfg2)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create honeycomb backend: %w", err)
+		}
+
+	case "":
+		return nil, fmt.Errorf("missing or empty backend type")
+
+	default:
+		return nil, fmt.Errorf("invalid backend type %q", cfg.Type)
+	}
+
+	if len(cfg.Injectors) > 0 {
+		backend = NewFieldInjectionBackend(backend, cfg.Injectors...)
+	}
+
+	return backend, nil
+}
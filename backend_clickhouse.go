@@ -0,0 +1,333 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The ClickHouse backend inserts messages in batches using the HTTP
+// interface of ClickHouse and the JSONEachRow format. The table is expected
+// to contain the following columns:
+//
+//	time        DateTime64(9, 'UTC')
+//	level       LowCardinality(String)
+//	debug_level UInt8
+//	domain      LowCardinality(String)
+//	message     String
+//	data        Map(String, String)
+//
+// Data values are stored as strings, formatted the same way as in text
+// output.
+type ClickHouseBackendCfg struct {
+	URL      string `json:"url"` // http://localhost:8123 by default
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	// If set, the table is created when the backend is created, with a
+	// MergeTree engine partitioned by day. Messages are deleted once they
+	// are older than the TTL if it is set.
+	CreateTable bool `json:"create_table"`
+	TTLDays     int  `json:"ttl_days"`
+
+	DisableCompression bool          `json:"disable_compression"`
+	Timeout            time.Duration `json:"timeout"`
+
+	Batching BatchingCfg `json:"batching"`
+
+	MaxRetries     int           `json:"max_retries"`
+	InitialBackoff time.Duration `json:"initial_backoff"`
+	MaxBackoff     time.Duration `json:"max_backoff"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg ClickHouseBackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
+}
+
+type ClickHouseBackend struct {
+	Cfg ClickHouseBackendCfg
+
+	tableName     string
+	insertURI     string
+	client        *http.Client
+	batcher       *batcher
+	writeFailures *writeFailureReporter
+}
+
+const clickHouseTimeLayout = "2006-01-02 15:04:05.000000000"
+
+func NewClickHouseBackend(cfg ClickHouseBackendCfg) (*ClickHouseBackend, error) {
+	if cfg.URL == "" {
+		cfg.URL = "http://localhost:8123"
+	}
+
+	uri, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+
+	if cfg.Table == "" {
+		cfg.Table = "log_messages"
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 5
+	}
+
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 500 * time.Millisecond
+	}
+
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+
+	tableName := quoteClickHouseIdentifier(cfg.Table)
+	if cfg.Database != "" {
+		tableName = quoteClickHouseIdentifier(cfg.Database) + "." + tableName
+	}
+
+	query := uri.Query()
+	query.Set("query", "INSERT INTO "+tableName+
+		" (time, level, debug_level, domain, message, data) FORMAT JSONEachRow")
+	uri.RawQuery = query.Encode()
+
+	b := &ClickHouseBackend{
+		Cfg: cfg,
+
+		tableName: tableName,
+		insertURI: uri.String(),
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+		writeFailures: newWriteFailureReporter(BackendTypeClickHouse,
+			uri.Host, cfg.WriteFailures),
+	}
+
+	if cfg.CreateTable {
+		if err := b.createTable(); err != nil {
+			return nil, err
+		}
+	}
+
+	b.batcher = newBatcher(cfg.Batching, b.insert)
+
+	return b, nil
+}
+
+func (b *ClickHouseBackend) Log(msg Message) {
+	b.batcher.add(msg)
+}
+
+func (b *ClickHouseBackend) LogBatch(msgs []Message) {
+	b.batcher.addBatch(msgs)
+}
+
+// Insert all pending messages.
+func (b *ClickHouseBackend) Flush() error {
+	b.batcher.flush()
+	return nil
+}
+
+// Insert all pending messages and stop the backend.
+func (b *ClickHouseBackend) Close() error {
+	b.batcher.close()
+	return nil
+}
+
+// Check that the server accepts connections.
+func (b *ClickHouseBackend) Probe() error {
+	return probeURL(b.Cfg.URL, b.Cfg.Timeout)
+}
+
+func (b *ClickHouseBackend) createTable() error {
+	query := `CREATE TABLE IF NOT EXISTS ` + b.tableName + ` (
+  time DateTime64(9, 'UTC'),
+  level LowCardinality(String),
+  debug_level UInt8,
+  domain LowCardinality(String),
+  message String,
+  data Map(String, String)
+)
+ENGINE = MergeTree
+PARTITION BY toDate(time)
+ORDER BY (domain, level, time)`
+
+	if b.Cfg.TTLDays > 0 {
+		query += "\nTTL toDateTime(time) + INTERVAL " +
+			strconv.Itoa(b.Cfg.TTLDays) + " DAY"
+	}
+
+	req, err := http.NewRequest("POST", b.Cfg.URL, strings.NewReader(query))
+	if err != nil {
+		return fmt.Errorf("cannot create http request: %w", err)
+	}
+
+	if _, err := b.sendRequest(req); err != nil {
+		return fmt.Errorf("cannot create table: %w", err)
+	}
+
+	return nil
+}
+
+func (b *ClickHouseBackend) insert(msgs []Message) {
+	if dropped := b.batcher.takeDropped(); dropped > 0 {
+		err := fmt.Errorf("%d messages dropped because too many messages "+
+			"were pending", dropped)
+		b.writeFailures.failure(err)
+	}
+
+	body, err := b.encodeBody(msgs)
+	if err != nil {
+		b.writeFailures.failureMessages(err, msgs)
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequest("POST", b.insertURI,
+			bytes.NewReader(body))
+		if err != nil {
+			b.writeFailures.failureMessages(
+				fmt.Errorf("cannot create http request: %w", err), msgs)
+			return
+		}
+
+		if !b.Cfg.DisableCompression {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+
+		retry, err := b.sendRequest(req)
+		if err == nil {
+			b.writeFailures.success()
+			return
+		}
+
+		if !retry || attempt > b.Cfg.MaxRetries {
+			b.writeFailures.failureMessages(err, msgs)
+			return
+		}
+
+		b.batcher.sleep(retryDelay(attempt, b.Cfg.InitialBackoff,
+			b.Cfg.MaxBackoff))
+	}
+}
+
+func (b *ClickHouseBackend) encodeBody(msgs []Message) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for _, msg := range msgs {
+		t := time.Now().UTC()
+		if msg.Time != nil {
+			t = msg.Time.UTC()
+		}
+
+		buf.WriteString(`{"time":"`)
+		buf.WriteString(t.Format(clickHouseTimeLayout))
+		buf.WriteString(`","level":`)
+		writeJSONString(&buf, string(msg.Level))
+		buf.WriteString(`,"debug_level":`)
+		if msg.Level == LevelDebug {
+			buf.WriteString(strconv.Itoa(msg.DebugLevel))
+		} else {
+			buf.WriteByte('0')
+		}
+		buf.WriteString(`,"domain":`)
+		writeJSONString(&buf, msg.domain)
+		buf.WriteString(`,"message":`)
+		writeJSONString(&buf, msg.Message)
+
+		buf.WriteString(`,"data":{`)
+		i := 0
+		for k, v := range msg.Data {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(&buf, k)
+			buf.WriteByte(':')
+			writeJSONString(&buf, formatDatum2(v))
+			i++
+		}
+		buf.WriteString("}}\n")
+	}
+
+	if b.Cfg.DisableCompression {
+		return buf.Bytes(), nil
+	}
+
+	var zbuf bytes.Buffer
+
+	zw := gzip.NewWriter(&zbuf)
+	if _, err := zw.Write(buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("cannot compress request body: %w", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("cannot compress request body: %w", err)
+	}
+
+	return zbuf.Bytes(), nil
+}
+
+// Send a request and indicate whether it can be retried in case of failure.
+func (b *ClickHouseBackend) sendRequest(req *http.Request) (bool, error) {
+	if b.Cfg.Username != "" {
+		req.Header.Set("X-ClickHouse-User", b.Cfg.Username)
+		req.Header.Set("X-ClickHouse-Key", b.Cfg.Password)
+	}
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("cannot send http request: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return true, fmt.Errorf("cannot read http response: %w", err)
+	}
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+
+	err = fmt.Errorf("request failed with status %d: %s", res.StatusCode,
+		bytes.TrimSpace(resBody))
+
+	// ClickHouse uses status 500 for most errors, including invalid
+	// queries, but also when the server is overloaded.
+	return res.StatusCode == 429 || res.StatusCode >= 500, err
+}
+
+func quoteClickHouseIdentifier(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "`" + strings.ReplaceAll(s, "`", "\\`") + "`"
+}
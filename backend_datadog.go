@@ -0,0 +1,345 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The Datadog backend sends messages in batches to the Datadog logs intake
+// API. Message data are sent as attributes, except for keys used by the
+// backend itself.
+//
+// https://docs.datadoghq.com/api/latest/logs/#send-logs
+type DatadogBackendCfg struct {
+	// The site is used to build the URL of the intake API unless the URL is
+	// set; the default site is "datadoghq.com".
+	Site   string `json:"site"`
+	URL    string `json:"url"`
+	APIKey string `json:"api_key"`
+
+	// If the service is not set, it is the first component of the domain of
+	// each message. The default source is "go".
+	Service  string   `json:"service"`
+	Source   string   `json:"source"`
+	Hostname string   `json:"hostname"`
+	Tags     []string `json:"tags"`
+
+	DisableCompression bool          `json:"disable_compression"`
+	Timeout            time.Duration `json:"timeout"`
+
+	Batching BatchingCfg `json:"batching"`
+
+	// Requests rejected with status 429 or with a server error are retried
+	// with exponential backoff.
+	MaxRetries     int           `json:"max_retries"`
+	InitialBackoff time.Duration `json:"initial_backoff"`
+	MaxBackoff     time.Duration `json:"max_backoff"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg DatadogBackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
+}
+
+// The maximum number of entries in a single request accepted by the API.
+const datadogMaxBatchSize = 1000
+
+var datadogReservedKeys = map[string]struct{}{
+	"ddsource":    {},
+	"ddtags":      {},
+	"hostname":    {},
+	"service":     {},
+	"status":      {},
+	"message":     {},
+	"date":        {},
+	"logger.name": {},
+	"debug_level": {},
+}
+
+type DatadogBackend struct {
+	Cfg DatadogBackendCfg
+
+	uri           string
+	client        *http.Client
+	batcher       *batcher
+	writeFailures *writeFailureReporter
+}
+
+func NewDatadogBackend(cfg DatadogBackendCfg) (*DatadogBackend, error) {
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("missing or empty api key")
+	}
+
+	if cfg.Site == "" {
+		cfg.Site = "datadoghq.com"
+	}
+
+	if cfg.URL == "" {
+		cfg.URL = "https://http-intake.logs." + cfg.Site + "/api/v2/logs"
+	}
+
+	if cfg.Source == "" {
+		cfg.Source = "go"
+	}
+
+	if cfg.Hostname == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("cannot obtain hostname: %w", err)
+		}
+
+		cfg.Hostname = hostname
+	}
+
+	if cfg.Batching.BatchSize <= 0 ||
+		cfg.Batching.BatchSize > datadogMaxBatchSize {
+		cfg.Batching.BatchSize = datadogMaxBatchSize
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 5
+	}
+
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 500 * time.Millisecond
+	}
+
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+
+	b := &DatadogBackend{
+		Cfg: cfg,
+
+		uri: cfg.URL,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+		writeFailures: newWriteFailureReporter(BackendTypeDatadog, cfg.URL,
+			cfg.WriteFailures),
+	}
+
+	b.batcher = newBatcher(cfg.Batching, b.send)
+
+	return b, nil
+}
+
+func (b *DatadogBackend) Log(msg Message) {
+	b.batcher.add(msg)
+}
+
+func (b *DatadogBackend) LogBatch(msgs []Message) {
+	b.batcher.addBatch(msgs)
+}
+
+// Send all pending messages.
+func (b *DatadogBackend) Flush() error {
+	b.batcher.flush()
+	return nil
+}
+
+// Send all pending messages and stop the backend.
+func (b *DatadogBackend) Close() error {
+	b.batcher.close()
+	return nil
+}
+
+// Check that the server accepts connections.
+func (b *DatadogBackend) Probe() error {
+	return probeURL(b.Cfg.URL, b.Cfg.Timeout)
+}
+
+func (b *DatadogBackend) send(msgs []Message) {
+	if dropped := b.batcher.takeDropped(); dropped > 0 {
+		err := fmt.Errorf("%d messages dropped because too many messages "+
+			"were pending", dropped)
+		b.writeFailures.failure(err)
+	}
+
+	body, err := b.encodeBody(msgs)
+	if err != nil {
+		b.writeFailures.failureMessages(err, msgs)
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry, err := b.sendRequest(body)
+		if err == nil {
+			b.writeFailures.success()
+			return
+		}
+
+		if !retry || attempt > b.Cfg.MaxRetries {
+			b.writeFailures.failureMessages(err, msgs)
+			return
+		}
+
+		b.batcher.sleep(retryDelay(attempt, b.Cfg.InitialBackoff,
+			b.Cfg.MaxBackoff))
+	}
+}
+
+func (b *DatadogBackend) encodeBody(msgs []Message) ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteByte('[')
+	for i, msg := range msgs {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		b.encodeEntry(msg, &buf)
+	}
+	buf.WriteByte(']')
+
+	if b.Cfg.DisableCompression {
+		return buf.Bytes(), nil
+	}
+
+	var zbuf bytes.Buffer
+
+	zw := gzip.NewWriter(&zbuf)
+	if _, err := zw.Write(buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("cannot compress request body: %w", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("cannot compress request body: %w", err)
+	}
+
+	return zbuf.Bytes(), nil
+}
+
+func (b *DatadogBackend) encodeEntry(msg Message, buf *bytes.Buffer) {
+	t := time.Now()
+	if msg.Time != nil {
+		t = *msg.Time
+	}
+
+	tags := make([]string, 0, len(b.Cfg.Tags)+1)
+	tags = append(tags, b.Cfg.Tags...)
+	if msg.domain != "" {
+		tags = append(tags, "domain:"+msg.domain)
+	}
+
+	field := func(key, value string) {
+		writeJSONString(buf, key)
+		buf.WriteByte(':')
+		writeJSONString(buf, value)
+		buf.WriteByte(',')
+	}
+
+	buf.WriteByte('{')
+
+	field("ddsource", b.Cfg.Source)
+	field("ddtags", strings.Join(tags, ","))
+	field("hostname", b.Cfg.Hostname)
+	field("service", b.service(msg))
+	field("status", string(msg.Level))
+	field("date", t.UTC().Format(time.RFC3339Nano))
+
+	if msg.domain != "" {
+		field("logger.name", msg.domain)
+	}
+
+	if msg.Level == LevelDebug {
+		fmt.Fprintf(buf, `"debug_level":%d,`, msg.DebugLevel)
+	}
+
+	keys := make([]string, 0, len(msg.Data))
+	for k := range msg.Data {
+		if _, found := datadogReservedKeys[k]; !found {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		writeJSONString(buf, k)
+		buf.WriteByte(':')
+		writeJSONDatum(buf, msg.Data[k])
+		buf.WriteByte(',')
+	}
+
+	writeJSONString(buf, "message")
+	buf.WriteByte(':')
+	writeJSONString(buf, msg.Message)
+
+	buf.WriteByte('}')
+}
+
+func (b *DatadogBackend) service(msg Message) string {
+	if b.Cfg.Service != "" {
+		return b.Cfg.Service
+	}
+
+	service := msg.domain
+	if idx := strings.IndexByte(service, '.'); idx >= 0 {
+		service = service[:idx]
+	}
+
+	return service
+}
+
+// Send a request and indicate whether it can be retried in case of failure.
+func (b *DatadogBackend) sendRequest(body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", b.uri, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("cannot create http request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("DD-API-KEY", b.Cfg.APIKey)
+
+	if !b.Cfg.DisableCompression {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("cannot send http request: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return true, fmt.Errorf("cannot read http response: %w", err)
+	}
+
+	if res.StatusCode == 429 || res.StatusCode >= 500 {
+		return true, fmt.Errorf("request failed with status %d",
+			res.StatusCode)
+	} else if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return false, fmt.Errorf("request failed with status %d: %s",
+			res.StatusCode, resBody)
+	}
+
+	return false, nil
+}
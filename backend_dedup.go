@@ -0,0 +1,185 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The deduplication backend decorates another backend, collapsing identical
+// consecutive messages as classic syslog daemons do. The first message is
+// written immediately; identical messages following it during the window are
+// counted instead of being written, and a single message annotated with the
+// number of repetitions ("repeat_count") is written when a different message
+// arrives or when the window ends.
+//
+// Messages are identical if they have the same level, domain, text and data
+// (see Data.Hash).
+type DedupBackendCfg struct {
+	// The backend messages are written to, when the deduplication backend
+	// is created from a configuration.
+	Backend BackendCfg `json:"backend"`
+
+	// The window, starting with the first occurrence of a message, during
+	// which repetitions are collapsed; 30s by default.
+	Window time.Duration `json:"window"`
+
+	// Only compare the level, domain and text of messages.
+	IgnoreData bool `json:"ignore_data"`
+}
+
+type DedupBackend struct {
+	Cfg     DedupBackendCfg
+	Backend Backend
+
+	mut         sync.Mutex
+	lastKey     string
+	windowStart time.Time
+	lastRepeat  Message
+	nbRepeats   int
+
+	sched scheduler
+	stop  func()
+}
+
+func NewDedupBackend(backend Backend, cfg DedupBackendCfg) (*DedupBackend, error) {
+	if backend == nil {
+		return nil, fmt.Errorf("missing backend")
+	}
+
+	if cfg.Window <= 0 {
+		cfg.Window = 30 * time.Second
+	}
+
+	b := &DedupBackend{
+		Cfg:     cfg,
+		Backend: backend,
+
+		sched: getScheduler(),
+	}
+
+	_, b.stop = b.sched.loop(string(BackendTypeDedup), cfg.Window/2,
+		func() { b.flushSummary(true) })
+
+	return b, nil
+}
+
+func (b *DedupBackend) Log(msg Message) {
+	key := b.key(msg)
+	now := b.sched.now()
+
+	b.mut.Lock()
+
+	if key == b.lastKey && now.Sub(b.windowStart) < b.Cfg.Window {
+		b.lastRepeat = msg
+		b.nbRepeats++
+		b.mut.Unlock()
+		return
+	}
+
+	summary, hasSummary := b.takeSummary()
+
+	b.lastKey = key
+	b.windowStart = now
+
+	b.mut.Unlock()
+
+	if hasSummary {
+		b.Backend.Log(summary)
+	}
+
+	b.Backend.Log(msg)
+}
+
+// Write the pending repetition summary if there is one, then flush the
+// decorated backend if it supports it.
+func (b *DedupBackend) Flush() error {
+	b.flushSummary(false)
+
+	if flusher, ok := b.Backend.(interface{ Flush() error }); ok {
+		return flusher.Flush()
+	}
+
+	return nil
+}
+
+// Write the pending repetition summary if there is one and stop the backend.
+// The decorated backend is closed if it supports it.
+func (b *DedupBackend) Close() error {
+	b.stop()
+
+	b.flushSummary(false)
+
+	if closer, ok := b.Backend.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// Write the pending repetition summary, only if the window has ended when
+// expiredOnly is set.
+func (b *DedupBackend) flushSummary(expiredOnly bool) {
+	b.mut.Lock()
+
+	if expiredOnly && b.sched.now().Sub(b.windowStart) < b.Cfg.Window {
+		b.mut.Unlock()
+		return
+	}
+
+	summary, hasSummary := b.takeSummary()
+	if hasSummary || !expiredOnly {
+		// The next occurrence of the message starts a new window
+		b.lastKey = ""
+	}
+
+	b.mut.Unlock()
+
+	if hasSummary {
+		b.Backend.Log(summary)
+	}
+}
+
+// The function is unsafe and MUST be called with b.mut held.
+func (b *DedupBackend) takeSummary() (Message, bool) {
+	if b.nbRepeats == 0 {
+		return Message{}, false
+	}
+
+	summary := b.lastRepeat
+
+	summary.Data = make(Data, len(b.lastRepeat.Data)+1)
+	for k, v := range b.lastRepeat.Data {
+		summary.Data[k] = v
+	}
+	summary.Data["repeat_count"] = b.nbRepeats
+
+	b.lastRepeat = Message{}
+	b.nbRepeats = 0
+
+	return summary, true
+}
+
+func (b *DedupBackend) key(msg Message) string {
+	key := string(msg.Level) + "\x00" + msg.domain + "\x00" + msg.Message
+
+	if !b.Cfg.IgnoreData {
+		key += "\x00" + msg.Data.Hash()
+	}
+
+	return key
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-log"
+	"github.com/exograd/go-log/logtest"
+)
+
+func newTestDedup(t *testing.T, cfg log.DedupBackendCfg) (*log.DedupBackend, *logtest.Backend, *log.SimScheduler) {
+	sched := log.NewSimScheduler(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	t.Cleanup(log.SetSimScheduler(sched))
+
+	backend := logtest.NewBackend()
+
+	dedup, err := log.NewDedupBackend(backend, cfg)
+	if err != nil {
+		t.Fatalf("cannot create dedup backend: %v", err)
+	}
+
+	t.Cleanup(func() { dedup.Close() })
+
+	return dedup, backend, sched
+}
+
+func repeatCounts(msgs []log.Message) []interface{} {
+	counts := make([]interface{}, len(msgs))
+	for i, msg := range msgs {
+		counts[i] = msg.Data["repeat_count"]
+	}
+
+	return counts
+}
+
+func TestDedupBackend(t *testing.T) {
+	dedup, backend, _ := newTestDedup(t, log.DedupBackendCfg{
+		Window: 10 * time.Second,
+	})
+
+	for _, s := range []string{"a", "a", "a", "b", "a"} {
+		dedup.Log(log.Message{Message: s})
+	}
+
+	dedup.Log(log.Message{Message: "a", Data: log.Data{"x": 1}})
+
+	expected := []string{"a", "a", "b", "a", "a"}
+	if texts := messageTexts(backend.Entries()); !reflect.DeepEqual(texts,
+		expected) {
+		t.Errorf("expected messages %v, got %v", expected, texts)
+	}
+
+	expectedCounts := []interface{}{nil, 2, nil, nil, nil}
+	if counts := repeatCounts(backend.Entries()); !reflect.DeepEqual(counts,
+		expectedCounts) {
+		t.Errorf("expected repeat counts %v, got %v", expectedCounts, counts)
+	}
+}
+
+func TestDedupBackendWindow(t *testing.T) {
+	dedup, backend, sched := newTestDedup(t, log.DedupBackendCfg{
+		Window:     10 * time.Second,
+		IgnoreData: true,
+	})
+
+	dedup.Log(log.Message{Message: "a", Data: log.Data{"x": 1}})
+	dedup.Log(log.Message{Message: "a", Data: log.Data{"x": 2}})
+	dedup.Log(log.Message{Message: "a", Data: log.Data{"x": 3}})
+
+	sched.Advance(5 * time.Second)
+	if n := len(backend.Entries()); n != 1 {
+		t.Fatalf("expected the summary to wait for the end of the window, "+
+			"got %d messages", n)
+	}
+
+	sched.Advance(5 * time.Second)
+
+	entries := backend.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected a summary at the end of the window, got %v",
+			entries)
+	}
+
+	if n := entries[1].Data["repeat_count"]; n != 2 {
+		t.Errorf("expected a repeat count of 2, got %v", n)
+	}
+
+	if x := entries[1].Data["x"]; x != 3 {
+		t.Errorf("expected the summary to contain the data of the last "+
+			"repetition, got %v", x)
+	}
+
+	dedup.Log(log.Message{Message: "a"})
+	dedup.Log(log.Message{Message: "a"})
+	dedup.Close()
+
+	if counts := repeatCounts(backend.Entries()[2:]); !reflect.DeepEqual(
+		counts, []interface{}{nil, 1}) {
+		t.Errorf("expected the pending summary to be written on close, "+
+			"got %v", backend.Entries()[2:])
+	}
+}
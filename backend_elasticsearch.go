@@ -0,0 +1,308 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The Elasticsearch backend indexes messages with the bulk API; it is also
+// compatible with OpenSearch. Messages are encoded with the JSON encoder.
+type ElasticsearchBackendCfg struct {
+	URL string `json:"url"`
+
+	// The name of the index can contain time layouts between curly braces
+	// (see the time package), which are replaced using the time of each
+	// message, e.g. "logs-{2006.01.02}".
+	Index string `json:"index"`
+
+	Username string            `json:"username"`
+	Password string            `json:"password"`
+	APIKey   string            `json:"api_key"`
+	Headers  map[string]string `json:"headers"`
+	Timeout  time.Duration     `json:"timeout"`
+
+	Batching BatchingCfg `json:"batching"`
+
+	// Requests and documents rejected with status 429 or with a server error
+	// are retried with exponential backoff.
+	MaxRetries     int           `json:"max_retries"`
+	InitialBackoff time.Duration `json:"initial_backoff"`
+	MaxBackoff     time.Duration `json:"max_backoff"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg ElasticsearchBackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
+}
+
+type ElasticsearchBackend struct {
+	Cfg ElasticsearchBackendCfg
+
+	bulkURI       string
+	client        *http.Client
+	encoder       *JSONEncoder
+	batcher       *batcher
+	writeFailures *writeFailureReporter
+}
+
+type elasticsearchBulkResponse struct {
+	Errors bool                               `json:"errors"`
+	Items  []map[string]elasticsearchBulkItem `json:"items"`
+}
+
+type elasticsearchBulkItem struct {
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error"`
+}
+
+func NewElasticsearchBackend(cfg ElasticsearchBackendCfg) (*ElasticsearchBackend, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("missing or empty url")
+	}
+
+	uri, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	uri.Path = strings.TrimSuffix(uri.Path, "/") + "/_bulk"
+
+	if cfg.Index == "" {
+		return nil, fmt.Errorf("missing or empty index")
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 5
+	}
+
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 500 * time.Millisecond
+	}
+
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+
+	b := &ElasticsearchBackend{
+		Cfg: cfg,
+
+		bulkURI: uri.String(),
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+		encoder: NewJSONEncoder(JSONEncoderCfg{}),
+		writeFailures: newWriteFailureReporter(BackendTypeElasticsearch,
+			cfg.URL, cfg.WriteFailures),
+	}
+
+	b.batcher = newBatcher(cfg.Batching, b.index)
+
+	return b, nil
+}
+
+func (b *ElasticsearchBackend) Log(msg Message) {
+	b.batcher.add(msg)
+}
+
+func (b *ElasticsearchBackend) LogBatch(msgs []Message) {
+	b.batcher.addBatch(msgs)
+}
+
+// Index all pending messages.
+func (b *ElasticsearchBackend) Flush() error {
+	b.batcher.flush()
+	return nil
+}
+
+// Index all pending messages and stop the backend.
+func (b *ElasticsearchBackend) Close() error {
+	b.batcher.close()
+	return nil
+}
+
+// Check that the server accepts connections.
+func (b *ElasticsearchBackend) Probe() error {
+	return probeURL(b.Cfg.URL, b.Cfg.Timeout)
+}
+
+func (b *ElasticsearchBackend) index(msgs []Message) {
+	if dropped := b.batcher.takeDropped(); dropped > 0 {
+		err := fmt.Errorf("%d messages dropped because too many messages "+
+			"were pending", dropped)
+		b.writeFailures.failure(err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		retryMsgs, err := b.sendBulkRequest(msgs)
+		if err == nil && len(retryMsgs) == 0 {
+			b.writeFailures.success()
+			return
+		}
+
+		if err == nil {
+			err = fmt.Errorf("%d documents rejected", len(retryMsgs))
+		}
+
+		if len(retryMsgs) == 0 || attempt > b.Cfg.MaxRetries {
+			failedMsgs := retryMsgs
+			if len(failedMsgs) == 0 {
+				failedMsgs = msgs
+			}
+
+			b.writeFailures.failureMessages(err, failedMsgs)
+			return
+		}
+
+		msgs = retryMsgs
+
+		b.batcher.sleep(retryDelay(attempt, b.Cfg.InitialBackoff,
+			b.Cfg.MaxBackoff))
+	}
+}
+
+// Send a bulk request and return the list of messages which can be retried.
+func (b *ElasticsearchBackend) sendBulkRequest(msgs []Message) ([]Message, error) {
+	var body bytes.Buffer
+
+	for _, msg := range msgs {
+		body.WriteString(`{"index":{"_index":`)
+		writeJSONString(&body, b.indexName(msg))
+		body.WriteString("}}\n")
+
+		b.encoder.EncodeMessage(msg, &body)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequest("POST", b.bulkURI, &body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create http request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	if b.Cfg.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+b.Cfg.APIKey)
+	} else if b.Cfg.Username != "" {
+		req.SetBasicAuth(b.Cfg.Username, b.Cfg.Password)
+	}
+
+	for name, value := range b.Cfg.Headers {
+		req.Header.Set(name, value)
+	}
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		return msgs, fmt.Errorf("cannot send bulk request: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return msgs, fmt.Errorf("cannot read bulk response: %w", err)
+	}
+
+	if res.StatusCode == 429 || res.StatusCode >= 500 {
+		return msgs, fmt.Errorf("bulk request failed with status %d",
+			res.StatusCode)
+	} else if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, fmt.Errorf("bulk request failed with status %d: %s",
+			res.StatusCode, resBody)
+	}
+
+	var bulkRes elasticsearchBulkResponse
+	if err := json.Unmarshal(resBody, &bulkRes); err != nil {
+		return nil, fmt.Errorf("cannot decode bulk response: %w", err)
+	}
+
+	if !bulkRes.Errors {
+		return nil, nil
+	}
+
+	var retryMsgs []Message
+	var nbErrors int
+	var lastError json.RawMessage
+
+	for i, item := range bulkRes.Items {
+		if i >= len(msgs) {
+			break
+		}
+
+		for _, result := range item {
+			switch {
+			case result.Status == 429 || result.Status >= 500:
+				retryMsgs = append(retryMsgs, msgs[i])
+			case result.Status >= 300:
+				nbErrors++
+				lastError = result.Error
+			}
+		}
+	}
+
+	if nbErrors > 0 {
+		err := fmt.Errorf("%d documents rejected: %s", nbErrors, lastError)
+		return retryMsgs, err
+	}
+
+	return retryMsgs, nil
+}
+
+func (b *ElasticsearchBackend) indexName(msg Message) string {
+	t := time.Now().UTC()
+	if msg.Time != nil {
+		t = msg.Time.UTC()
+	}
+
+	return expandTimeTemplate(b.Cfg.Index, t)
+}
+
+// Replace time layouts between curly braces by the formatted time.
+func expandTimeTemplate(s string, t time.Time) string {
+	var buf strings.Builder
+
+	for {
+		start := strings.IndexByte(s, '{')
+		if start == -1 {
+			break
+		}
+
+		end := strings.IndexByte(s[start:], '}')
+		if end == -1 {
+			break
+		}
+		end += start
+
+		buf.WriteString(s[:start])
+		buf.WriteString(t.Format(s[start+1 : end]))
+
+		s = s[end+1:]
+	}
+
+	buf.WriteString(s)
+
+	return buf.String()
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type EventLogBackendCfg struct {
+	Source  string `json:"source"`
+	EventId uint32 `json:"event_id"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg EventLogBackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
+}
+
+func formatEventLogMessage(msg Message) string {
+	var buf strings.Builder
+
+	buf.WriteString(msg.Message)
+
+	if msg.domain != "" {
+		fmt.Fprintf(&buf, "\r\n\r\ndomain: %s", msg.domain)
+	}
+
+	keys := make([]string, 0, len(msg.Data))
+	for k := range msg.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "\r\n%s: %s", k, formatDatum2(msg.Data[k]))
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build windows
+// +build windows
+
+package log
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// https://learn.microsoft.com/en-us/windows/win32/eventlog/event-types
+const (
+	eventLogErrorType       = 0x0001
+	eventLogInformationType = 0x0004
+)
+
+var (
+	advapi32 = syscall.NewLazyDLL("advapi32.dll")
+
+	procRegisterEventSourceW  = advapi32.NewProc("RegisterEventSourceW")
+	procDeregisterEventSource = advapi32.NewProc("DeregisterEventSource")
+	procReportEventW          = advapi32.NewProc("ReportEventW")
+)
+
+type EventLogBackend struct {
+	Cfg EventLogBackendCfg
+
+	handle        syscall.Handle
+	writeFailures *writeFailureReporter
+}
+
+func NewEventLogBackend(cfg EventLogBackendCfg) (*EventLogBackend, error) {
+	if cfg.Source == "" {
+		return nil, fmt.Errorf("missing or empty event source")
+	}
+
+	source, err := syscall.UTF16PtrFromString(cfg.Source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event source: %w", err)
+	}
+
+	handle, _, err := procRegisterEventSourceW.Call(0,
+		uintptr(unsafe.Pointer(source)))
+	if handle == 0 {
+		return nil, fmt.Errorf("cannot register event source: %w", err)
+	}
+
+	b := &EventLogBackend{
+		Cfg: cfg,
+
+		handle: syscall.Handle(handle),
+
+		writeFailures: newWriteFailureReporter(BackendTypeEventLog,
+			cfg.Source, cfg.WriteFailures),
+	}
+
+	return b, nil
+}
+
+func (b *EventLogBackend) Close() error {
+	ret, _, err := procDeregisterEventSource.Call(uintptr(b.handle))
+	if ret == 0 {
+		return fmt.Errorf("cannot deregister event source: %w", err)
+	}
+
+	return nil
+}
+
+func (b *EventLogBackend) Log(msg Message) {
+	eventType := eventLogInformationType
+	if msg.Level == LevelError {
+		eventType = eventLogErrorType
+	}
+
+	text, err := syscall.UTF16PtrFromString(formatEventLogMessage(msg))
+	if err != nil {
+		// The message contains a null character
+		text, _ = syscall.UTF16PtrFromString("invalid log message")
+	}
+
+	strings := []*uint16{text}
+
+	ret, _, err := procReportEventW.Call(uintptr(b.handle),
+		uintptr(eventType), 0, uintptr(b.Cfg.EventId), 0, 1, 0,
+		uintptr(unsafe.Pointer(&strings[0])), 0)
+	if ret == 0 {
+		b.writeFailures.failure(err)
+	} else {
+		b.writeFailures.success()
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// The failover backend sends messages to a primary backend and switches to a
+// secondary backend, e.g. a local file, when the primary backend reports
+// write failures. The primary backend is then probed at regular intervals,
+// and messages are sent to it again as soon as a probe succeeds.
+//
+// Messages the primary backend reports as not written (see
+// WriteFailure.Messages) are written to the secondary backend. The primary
+// backend, or the backend it decorates, must report write failures.
+//
+// If the primary backend reports a write failure while it is being created,
+// e.g. because the syslog daemon cannot be reached, the backend starts in
+// failover mode whatever the failure threshold.
+//
+// Primary backends implementing ProbeBackend, as network backends do, are
+// probed with their Probe method. Other backends are considered healthy
+// again at the next probe, and messages go back to the
+// secondary backend if they keep failing.
+type FailoverBackendCfg struct {
+	Primary   BackendCfg `json:"primary"`
+	Secondary BackendCfg `json:"secondary"`
+
+	// The number of consecutive write failures of the primary backend
+	// triggering the switch to the secondary backend, 1 by default.
+	FailureThreshold int `json:"failure_threshold"`
+
+	// The interval between probes of the primary backend, 30s by default.
+	ProbeInterval time.Duration `json:"probe_interval"`
+}
+
+// Backends able to check whether they can write messages, e.g. by connecting
+// to a server, implement the ProbeBackend interface.
+type ProbeBackend interface {
+	Backend
+
+	Probe() error
+}
+
+// Check that the server of a URL accepts TCP connections.
+func probeURL(uri string, timeout time.Duration) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return fmt.Errorf("cannot connect to %s: %w", addr, err)
+	}
+
+	conn.Close()
+
+	return nil
+}
+
+type FailoverBackend struct {
+	Cfg FailoverBackendCfg
+
+	primary   Backend
+	secondary Backend
+
+	sched     scheduler
+	stopProbe func()
+
+	mut      sync.Mutex
+	started  bool
+	failover bool
+}
+
+func NewFailoverBackend(cfg FailoverBackendCfg) (*FailoverBackend, error) {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 1
+	}
+
+	if cfg.ProbeInterval <= 0 {
+		cfg.ProbeInterval = 30 * time.Second
+	}
+
+	b := &FailoverBackend{
+		Cfg: cfg,
+
+		sched: getScheduler(),
+	}
+
+	// The secondary backend is created first since the primary backend can
+	// report write failures as soon as it is created.
+	secondary, err := newBackend(cfg.Secondary, false)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create secondary backend: %w", err)
+	}
+
+	b.secondary = secondary
+
+	primaryCfg := cfg.Primary
+	primaryCfg.failureHandler = b.primaryFailure
+
+	primary, err := newBackend(primaryCfg, false)
+	if err != nil {
+		closeBackend(secondary)
+		return nil, fmt.Errorf("cannot create primary backend: %w", err)
+	}
+
+	b.primary = primary
+
+	b.mut.Lock()
+	b.started = true
+	b.mut.Unlock()
+
+	_, b.stopProbe = b.sched.loop("failover", cfg.ProbeInterval, b.probe)
+
+	return b, nil
+}
+
+func (b *FailoverBackend) Log(msg Message) {
+	b.backend().Log(msg)
+}
+
+func (b *FailoverBackend) LogBatch(msgs []Message) {
+	backend := b.backend()
+
+	logBatch(backend, msgs)
+}
+
+// Return whether messages are currently sent to the secondary backend.
+func (b *FailoverBackend) FailedOver() bool {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	return b.failover
+}
+
+// Flush both backends if they support it, returning the first error.
+func (b *FailoverBackend) Flush() error {
+	return NewMultiBackend(b.primary, b.secondary).Flush()
+}
+
+// Stop probing the primary backend and close both backends if they support
+// it, returning the first error.
+func (b *FailoverBackend) Close() error {
+	b.stopProbe()
+
+	var firstErr error
+
+	for _, backend := range []Backend{b.primary, b.secondary} {
+		if closer, ok := backend.(interface{ Close() error }); ok {
+			if err := closer.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+func (b *FailoverBackend) backend() Backend {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if b.failover {
+		return b.secondary
+	}
+
+	return b.primary
+}
+
+func (b *FailoverBackend) primaryFailure(failure WriteFailure) {
+	// Messages the primary backend could not write are not lost, even if
+	// the failure threshold has not been reached yet.
+	b.writeToSecondary(failure.Messages)
+
+	b.mut.Lock()
+	if b.failover || (b.started &&
+		failure.ConsecutiveFailures < b.Cfg.FailureThreshold) {
+		b.mut.Unlock()
+		return
+	}
+
+	b.failover = true
+	b.mut.Unlock()
+
+	now := b.sched.now().UTC()
+
+	b.secondary.Log(Message{
+		Time:    &now,
+		Level:   LevelError,
+		Message: "switching to the secondary backend",
+		Data: Data{
+			"backend":              string(failure.BackendType),
+			"consecutive_failures": failure.ConsecutiveFailures,
+			"error":                failure.Err.Error(),
+		},
+
+		domain: InternalDomain,
+	})
+}
+
+// Write failure handlers can be called while the batch fallback lock is held,
+// so we must not use logBatch.
+func (b *FailoverBackend) writeToSecondary(msgs []Message) {
+	if len(msgs) == 0 {
+		return
+	}
+
+	if batchBackend, ok := b.secondary.(BatchBackend); ok {
+		batchBackend.LogBatch(msgs)
+		return
+	}
+
+	for _, msg := range msgs {
+		b.secondary.Log(msg)
+	}
+}
+
+// Called at each probe interval; the primary backend is only probed while
+// messages are sent to the secondary backend.
+func (b *FailoverBackend) probe() {
+	if !b.FailedOver() {
+		return
+	}
+
+	if probeBackend, ok := b.primary.(ProbeBackend); ok {
+		if err := probeBackend.Probe(); err != nil {
+			return
+		}
+	}
+
+	b.mut.Lock()
+	b.failover = false
+	b.mut.Unlock()
+
+	now := b.sched.now().UTC()
+
+	b.primary.Log(Message{
+		Time:    &now,
+		Level:   LevelInfo,
+		Message: "switching back to the primary backend",
+
+		domain: InternalDomain,
+	})
+}
@@ -0,0 +1,301 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-log"
+	"github.com/exograd/go-log/logtest"
+)
+
+// A writer which can be switched to failing mode.
+type testFailingWriter struct {
+	mut     sync.Mutex
+	buf     bytes.Buffer
+	failing bool
+}
+
+func (w *testFailingWriter) Write(data []byte) (int, error) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+
+	if w.failing {
+		return 0, errors.New("write failure")
+	}
+
+	return w.buf.Write(data)
+}
+
+func (w *testFailingWriter) setFailing(failing bool) {
+	w.mut.Lock()
+	w.failing = failing
+	w.mut.Unlock()
+}
+
+// Return the message of each line written with the JSON encoder.
+func (w *testFailingWriter) messages(t *testing.T) []string {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+
+	var messages []string
+
+	decoder := json.NewDecoder(&w.buf)
+	for decoder.More() {
+		var value struct {
+			Message string `json:"message"`
+		}
+
+		if err := decoder.Decode(&value); err != nil {
+			t.Fatalf("cannot decode message: %v", err)
+		}
+
+		messages = append(messages, value.Message)
+	}
+
+	return messages
+}
+
+func newTestFailingWriterCfg(w *testFailingWriter, failures log.Backend) log.BackendCfg {
+	return log.BackendCfg{
+		Type: log.BackendTypeWriter,
+		Backend: &log.WriterBackendCfg{
+			Writer:        w,
+			EncoderType:   log.EncoderTypeJSON,
+			WriteFailures: &log.WriteFailureCfg{Backend: failures},
+		},
+	}
+}
+
+func TestFailoverBackend(t *testing.T) {
+	sched := log.NewSimScheduler(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	t.Cleanup(log.SetSimScheduler(sched))
+
+	var primary, secondary testFailingWriter
+
+	failures := logtest.NewBackend()
+
+	failover, err := log.NewFailoverBackend(log.FailoverBackendCfg{
+		Primary:          newTestFailingWriterCfg(&primary, failures),
+		Secondary:        newTestFailingWriterCfg(&secondary, failures),
+		FailureThreshold: 2,
+		ProbeInterval:    10 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("cannot create failover backend: %v", err)
+	}
+
+	t.Cleanup(func() { failover.Close() })
+
+	logTestMessages(failover, 0, 1)
+
+	// Messages the primary backend fails to write go to the secondary
+	// backend, and the backend fails over once the threshold is reached.
+	primary.setFailing(true)
+
+	logTestMessages(failover, 1, 2)
+	if failover.FailedOver() {
+		t.Fatalf("failed over before reaching the failure threshold")
+	}
+
+	logTestMessages(failover, 2, 3)
+	if !failover.FailedOver() {
+		t.Fatalf("did not fail over after reaching the failure threshold")
+	}
+
+	logTestMessages(failover, 3, 4)
+
+	if len(failures.Entries()) != 2 {
+		t.Errorf("expected 2 write failure reports, got %v",
+			failures.Entries())
+	}
+
+	// The primary backend is used again after the next probe.
+	primary.setFailing(false)
+
+	sched.Advance(10 * time.Second)
+	if failover.FailedOver() {
+		t.Fatalf("did not switch back to the primary backend")
+	}
+
+	logTestMessages(failover, 4, 5)
+
+	expected := []string{"m0", "switching back to the primary backend", "m4"}
+	if messages := primary.messages(t); !reflect.DeepEqual(messages,
+		expected) {
+		t.Errorf("expected primary messages %v, got %v", expected, messages)
+	}
+
+	expected = []string{"m1", "m2", "switching to the secondary backend",
+		"m3"}
+	if messages := secondary.messages(t); !reflect.DeepEqual(messages,
+		expected) {
+		t.Errorf("expected secondary messages %v, got %v", expected,
+			messages)
+	}
+}
+
+// Accept a single connection and send the frames received on a channel.
+func acceptTestSyslogFrames(t *testing.T, listener net.Listener) (<-chan net.Conn, <-chan string) {
+	connChan := make(chan net.Conn, 1)
+	frameChan := make(chan string, 100)
+
+	go func() {
+		defer close(frameChan)
+
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		connChan <- conn
+
+		r := bufio.NewReader(conn)
+		for {
+			sizeString, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+
+			size, _ := strconv.Atoi(strings.TrimSpace(sizeString))
+
+			frame := make([]byte, size)
+			if _, err := io.ReadFull(r, frame); err != nil {
+				return
+			}
+
+			frameChan <- string(frame)
+		}
+	}()
+
+	return connChan, frameChan
+}
+
+func receiveTestSyslogFrame(t *testing.T, frameChan <-chan string) string {
+	select {
+	case frame := <-frameChan:
+		return frame
+	case <-time.After(10 * time.Second):
+		t.Fatalf("no syslog frame received")
+		return ""
+	}
+}
+
+func TestFailoverBackendSyslog(t *testing.T) {
+	sched := log.NewSimScheduler(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	t.Cleanup(log.SetSimScheduler(sched))
+
+	// The syslog daemon is not running when the backend is created.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+
+	addr := listener.Addr().String()
+	listener.Close()
+
+	var secondary testFailingWriter
+
+	failures := logtest.NewBackend()
+
+	failover, err := log.NewFailoverBackend(log.FailoverBackendCfg{
+		Primary: log.BackendCfg{
+			Type: log.BackendTypeSyslog,
+			Backend: &log.SyslogBackendCfg{
+				Addr:          addr,
+				Transport:     log.SyslogTransportTCP,
+				WriteFailures: &log.WriteFailureCfg{Backend: failures},
+			},
+		},
+		Secondary:        newTestFailingWriterCfg(&secondary, failures),
+		FailureThreshold: 2,
+		ProbeInterval:    10 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("cannot create failover backend: %v", err)
+	}
+
+	t.Cleanup(func() { failover.Close() })
+
+	if !failover.FailedOver() {
+		t.Fatalf("did not start in failover mode")
+	}
+
+	logTestMessages(failover, 0, 1)
+
+	// The primary backend is used again once the syslog daemon is running.
+	listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	defer listener.Close()
+
+	connChan, frameChan := acceptTestSyslogFrames(t, listener)
+
+	sched.Advance(10 * time.Second)
+	if failover.FailedOver() {
+		t.Fatalf("did not switch back to the primary backend")
+	}
+
+	logTestMessages(failover, 1, 2)
+
+	for _, msg := range []string{"switching back to the primary backend",
+		"m1"} {
+		frame := receiveTestSyslogFrame(t, frameChan)
+		if !strings.HasSuffix(frame, "\ufeff"+msg) {
+			t.Errorf("unexpected frame %q for message %q", frame, msg)
+		}
+	}
+
+	// Messages which cannot be written to the syslog daemon go to the
+	// secondary backend, including the one triggering the switch.
+	listener.Close()
+
+	conn := <-connChan
+	conn.(*net.TCPConn).SetLinger(0)
+	conn.Close()
+
+	for i := 2; i < 4; i++ {
+		logTestMessages(failover, i, i+1)
+
+		if failedOver := failover.FailedOver(); failedOver != (i == 3) {
+			t.Fatalf("unexpected failover state %v after message %d",
+				failedOver, i)
+		}
+	}
+
+	expected := []string{"switching to the secondary backend", "m0", "m2",
+		"m3", "switching to the secondary backend"}
+	if messages := secondary.messages(t); !reflect.DeepEqual(messages,
+		expected) {
+		t.Errorf("expected secondary messages %v, got %v", expected,
+			messages)
+	}
+
+	if n := len(failures.Entries()); n != 3 {
+		t.Errorf("expected 3 write failure reports, got %d", n)
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type FileBackendCfg struct {
+	Path string `json:"path"`
+
+	// The permissions of the file if it has to be created, as an octal
+	// string. The default value is "0644".
+	Mode string `json:"mode"`
+
+	// By default, messages are appended to the file if it already exists.
+	Truncate bool `json:"truncate"`
+
+	// If the buffer size is strictly positive, writes are buffered and the
+	// buffer is flushed when it is full and at regular intervals.
+	BufferSize    int           `json:"buffer_size"`
+	FlushInterval time.Duration `json:"flush_interval"`
+
+	// The encoder used to format messages. The text encoder is used by
+	// default.
+	EncoderType EncoderType      `json:"encoder_type"`
+	EncoderData *json.RawMessage `json:"encoder,omitempty"`
+	Encoder     Encoder          `json:"-"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg FileBackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
+}
+
+type FileBackend struct {
+	Cfg FileBackendCfg
+
+	encoder       Encoder
+	writeFailures *writeFailureReporter
+
+	mut    sync.Mutex
+	file   *os.File
+	writer io.Writer
+	buffer *bufio.Writer
+
+	stopFlush func()
+}
+
+func NewFileBackend(cfg FileBackendCfg) (*FileBackend, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("missing or empty path")
+	}
+
+	mode, err := parseFileMode(cfg.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	encoder, err := newFileEncoder(cfg.Encoder, cfg.EncoderType,
+		cfg.EncoderData)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if cfg.Truncate {
+		flags |= os.O_TRUNC
+	} else {
+		flags |= os.O_APPEND
+	}
+
+	file, err := os.OpenFile(cfg.Path, flags, mode)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %q: %w", cfg.Path, err)
+	}
+
+	b := &FileBackend{
+		Cfg: cfg,
+
+		encoder: encoder,
+		writeFailures: newWriteFailureReporter(BackendTypeFile, cfg.Path,
+			cfg.WriteFailures),
+
+		file:   file,
+		writer: file,
+	}
+
+	if err := writeFileHeader(file, encoder); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if cfg.BufferSize > 0 {
+		b.buffer = bufio.NewWriterSize(file, cfg.BufferSize)
+		b.writer = b.buffer
+
+		flushInterval := cfg.FlushInterval
+		if flushInterval <= 0 {
+			flushInterval = time.Second
+		}
+
+		_, b.stopFlush = getScheduler().loop(string(BackendTypeFile),
+			flushInterval, b.flushPeriodically)
+	}
+
+	return b, nil
+}
+
+func (b *FileBackend) Log(msg Message) {
+	b.LogBatch([]Message{msg})
+}
+
+func (b *FileBackend) LogBatch(msgs []Message) {
+	buf := getEncodingBuffer()
+	defer putEncodingBuffer(buf)
+
+	for _, msg := range msgs {
+		start := buf.Len()
+
+		err := b.encoder.EncodeMessage(msg, buf)
+		if err != nil {
+			buf.Truncate(start)
+
+			err2 := fmt.Errorf("cannot encode message: %w", err)
+			b.writeFailures.failure(err2)
+			continue
+		}
+
+		buf.WriteByte('\n')
+	}
+
+	b.mut.Lock()
+	_, err := b.writer.Write(buf.Bytes())
+	b.mut.Unlock()
+
+	if err != nil {
+		b.writeFailures.failureMessages(err, msgs)
+	} else {
+		b.writeFailures.success()
+	}
+}
+
+func (b *FileBackend) Flush() error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if b.buffer == nil {
+		return nil
+	}
+
+	return b.buffer.Flush()
+}
+
+func (b *FileBackend) Close() error {
+	if b.stopFlush != nil {
+		b.stopFlush()
+	}
+
+	if err := b.Flush(); err != nil {
+		b.file.Close()
+		return err
+	}
+
+	return b.file.Close()
+}
+
+func (b *FileBackend) flushPeriodically() {
+	if err := b.Flush(); err != nil {
+		b.writeFailures.failure(err)
+	}
+}
+
+func parseFileMode(s string) (os.FileMode, error) {
+	if s == "" {
+		return 0644, nil
+	}
+
+	i, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid file mode %q", s)
+	}
+
+	return os.FileMode(i), nil
+}
+
+func newFileEncoder(encoder Encoder, encoderType EncoderType, encoderData *json.RawMessage) (Encoder, error) {
+	if encoder != nil {
+		return encoder, nil
+	}
+
+	if encoderType == "" {
+		return NewTextEncoder(TextEncoderCfg{}), nil
+	}
+
+	return NewEncoder(encoderType, encoderData)
+}
+
+// Write the header of the encoder if there is one and if the file is empty.
+func writeFileHeader(file *os.File, encoder Encoder) error {
+	headerEncoder, ok := encoder.(HeaderEncoder)
+	if !ok {
+		return nil
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("cannot stat %q: %w", file.Name(), err)
+	}
+
+	if info.Size() > 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := headerEncoder.EncodeHeader(&buf); err != nil {
+		return fmt.Errorf("cannot encode header: %w", err)
+	}
+	buf.WriteByte('\n')
+
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("cannot write header: %w", err)
+	}
+
+	return nil
+}
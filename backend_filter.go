@@ -0,0 +1,172 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"path"
+)
+
+// The filter backend decorates another backend, only forwarding messages
+// matching all the conditions of its configuration, e.g. to send errors to
+// syslog while the terminal receives all messages.
+//
+// Domain and data value patterns use the syntax of path.Match; since domains
+// do not contain slashes, "*" matches any sequence of characters, including
+// dots.
+type FilterBackendCfg struct {
+	// The backend messages are written to, when the filter backend is
+	// created from a configuration.
+	Backend BackendCfg `json:"backend"`
+
+	// The levels of the messages forwarded; all levels if empty.
+	Levels []Level `json:"levels"`
+
+	// Patterns matching the domains of the messages forwarded; all domains
+	// if empty.
+	Domains []string `json:"domains"`
+
+	// Patterns matching data values: messages are forwarded if, for each
+	// key, they contain a datum whose formatted value matches the pattern.
+	Data map[string]string `json:"data"`
+
+	// If set, the predicate is called for messages matching all other
+	// conditions; messages are forwarded if it returns true.
+	Predicate func(Message) bool `json:"-"`
+}
+
+type FilterBackend struct {
+	Cfg     FilterBackendCfg
+	Backend Backend
+
+	levels map[Level]struct{}
+}
+
+func NewFilterBackend(backend Backend, cfg FilterBackendCfg) (*FilterBackend, error) {
+	if backend == nil {
+		return nil, fmt.Errorf("missing backend")
+	}
+
+	var levels map[Level]struct{}
+	if len(cfg.Levels) > 0 {
+		levels = make(map[Level]struct{})
+		for _, level := range cfg.Levels {
+			levels[level] = struct{}{}
+		}
+	}
+
+	for _, pattern := range cfg.Domains {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid domain pattern %q: %w",
+				pattern, err)
+		}
+	}
+
+	for key, pattern := range cfg.Data {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q for data key %q: %w",
+				pattern, key, err)
+		}
+	}
+
+	b := &FilterBackend{
+		Cfg:     cfg,
+		Backend: backend,
+
+		levels: levels,
+	}
+
+	return b, nil
+}
+
+func (b *FilterBackend) Log(msg Message) {
+	if !b.Match(msg) {
+		return
+	}
+
+	b.Backend.Log(msg)
+}
+
+func (b *FilterBackend) LogBatch(msgs []Message) {
+	matching := make([]Message, 0, len(msgs))
+	for _, msg := range msgs {
+		if b.Match(msg) {
+			matching = append(matching, msg)
+		}
+	}
+
+	if len(matching) == 0 {
+		return
+	}
+
+	logBatch(b.Backend, matching)
+}
+
+func (b *FilterBackend) Flush() error {
+	if flusher, ok := b.Backend.(interface{ Flush() error }); ok {
+		return flusher.Flush()
+	}
+
+	return nil
+}
+
+func (b *FilterBackend) Close() error {
+	if closer, ok := b.Backend.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// Return whether a message is forwarded by the backend.
+func (b *FilterBackend) Match(msg Message) bool {
+	if b.levels != nil {
+		if _, found := b.levels[msg.Level]; !found {
+			return false
+		}
+	}
+
+	if len(b.Cfg.Domains) > 0 {
+		matched := false
+
+		for _, pattern := range b.Cfg.Domains {
+			if ok, _ := path.Match(pattern, msg.domain); ok {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	for key, pattern := range b.Cfg.Data {
+		datum, found := msg.Data[key]
+		if !found {
+			return false
+		}
+
+		if ok, _ := path.Match(pattern, formatDatum2(datum)); !ok {
+			return false
+		}
+	}
+
+	if b.Cfg.Predicate != nil && !b.Cfg.Predicate(msg) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/exograd/go-log"
+	"github.com/exograd/go-log/logtest"
+)
+
+func newTestFilter(t *testing.T, cfg log.FilterBackendCfg) (*log.Logger, *logtest.Backend) {
+	backend := logtest.NewBackend()
+
+	filter, err := log.NewFilterBackend(backend, cfg)
+	if err != nil {
+		t.Fatalf("cannot create filter backend: %v", err)
+	}
+
+	logger := &log.Logger{
+		Backend: filter,
+		Domain:  "app",
+		Data:    log.Data{},
+	}
+
+	return logger, backend
+}
+
+func TestFilterBackendLevelsAndDomains(t *testing.T) {
+	logger, backend := newTestFilter(t, log.FilterBackendCfg{
+		Levels:  []log.Level{log.LevelError},
+		Domains: []string{"app.db*"},
+	})
+
+	logger.Error("m0")
+	logger.Child("db", nil).Info("m1")
+	logger.Child("db", nil).Error("m2")
+	logger.Child("db", nil).Child("pool", nil).Error("m3")
+	logger.Child("http", nil).Error("m4")
+
+	expected := []string{"m2", "m3"}
+	if texts := messageTexts(backend.Entries()); !reflect.DeepEqual(texts,
+		expected) {
+		t.Errorf("expected messages %v, got %v", expected, texts)
+	}
+}
+
+func TestFilterBackendData(t *testing.T) {
+	logger, backend := newTestFilter(t, log.FilterBackendCfg{
+		Data: map[string]string{"status": "5??"},
+		Predicate: func(msg log.Message) bool {
+			return msg.Message != "m3"
+		},
+	})
+
+	logger.InfoData(log.Data{"status": 200}, "m0")
+	logger.InfoData(log.Data{"status": 503}, "m1")
+	logger.Info("m2")
+	logger.InfoData(log.Data{"status": 500}, "m3")
+	logger.ErrorData(log.Data{"status": "504"}, "m4")
+
+	expected := []string{"m1", "m4"}
+	if texts := messageTexts(backend.Entries()); !reflect.DeepEqual(texts,
+		expected) {
+		t.Errorf("expected messages %v, got %v", expected, texts)
+	}
+}
+
+func TestFilterBackendInvalidPattern(t *testing.T) {
+	_, err := log.NewFilterBackend(logtest.NewBackend(), log.FilterBackendCfg{
+		Domains: []string{"app.["},
+	})
+	if err == nil {
+		t.Errorf("invalid domain pattern was accepted")
+	}
+}
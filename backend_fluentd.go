@@ -0,0 +1,226 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// The Fluentd backend sends messages using the forward protocol, in message
+// mode. The tag of each event is made of the tag prefix and of the domain of
+// the message. Records contain message data, the level and the message.
+//
+// https://github.com/fluent/fluentd/wiki/Forward-Protocol-Specification-v1
+type FluentdBackendCfg struct {
+	Addr      string `json:"addr"`
+	TagPrefix string `json:"tag_prefix"`
+
+	// In ack mode, the backend waits for the server to acknowledge each
+	// event.
+	RequireAck bool `json:"require_ack"`
+
+	Timeout time.Duration `json:"timeout"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg FluentdBackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
+}
+
+type FluentdBackend struct {
+	Cfg FluentdBackendCfg
+
+	writeFailures *writeFailureReporter
+
+	mut    sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func NewFluentdBackend(cfg FluentdBackendCfg) (*FluentdBackend, error) {
+	if cfg.Addr == "" {
+		cfg.Addr = "localhost:24224"
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	b := &FluentdBackend{
+		Cfg: cfg,
+
+		writeFailures: newWriteFailureReporter(BackendTypeFluentd, cfg.Addr,
+			cfg.WriteFailures),
+	}
+
+	return b, nil
+}
+
+func (b *FluentdBackend) Log(msg Message) {
+	var chunk string
+	if b.Cfg.RequireAck {
+		var id [16]byte
+		randomBytes(id[:])
+		chunk = base64.StdEncoding.EncodeToString(id[:])
+	}
+
+	var buf bytes.Buffer
+	b.encodeEvent(msg, chunk, &buf)
+
+	b.mut.Lock()
+	err := b.send(buf.Bytes(), chunk)
+	b.mut.Unlock()
+
+	if err != nil {
+		b.writeFailures.failureMessages(err, []Message{msg})
+	} else {
+		b.writeFailures.success()
+	}
+}
+
+func (b *FluentdBackend) Close() error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if b.conn == nil {
+		return nil
+	}
+
+	err := b.conn.Close()
+	b.conn = nil
+
+	return err
+}
+
+// Connect to the server if the backend is not connected.
+func (b *FluentdBackend) Probe() error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	return b.connect()
+}
+
+func (b *FluentdBackend) tag(msg Message) string {
+	switch {
+	case b.Cfg.TagPrefix == "" && msg.domain == "":
+		return "go-log"
+	case b.Cfg.TagPrefix == "":
+		return msg.domain
+	case msg.domain == "":
+		return b.Cfg.TagPrefix
+	default:
+		return b.Cfg.TagPrefix + "." + msg.domain
+	}
+}
+
+// [tag, time, record, option]
+func (b *FluentdBackend) encodeEvent(msg Message, chunk string, buf *bytes.Buffer) {
+	t := time.Now()
+	if msg.Time != nil {
+		t = *msg.Time
+	}
+
+	if chunk != "" {
+		writeMsgpackArrayHeader(buf, 4)
+	} else {
+		writeMsgpackArrayHeader(buf, 3)
+	}
+
+	writeMsgpackString(buf, b.tag(msg))
+
+	// EventTime extension
+	buf.Write([]byte{0xd7, 0x00})
+	binary.Write(buf, binary.BigEndian, uint32(t.Unix()))
+	binary.Write(buf, binary.BigEndian, uint32(t.Nanosecond()))
+
+	record := make(Data, len(msg.Data)+3)
+	for k, v := range msg.Data {
+		record[k] = v
+	}
+
+	record["level"] = string(msg.Level)
+	if msg.Level == LevelDebug {
+		record["debug_level"] = msg.DebugLevel
+	}
+	record["message"] = msg.Message
+
+	writeMsgpackMap(buf, record)
+
+	if chunk != "" {
+		writeMsgpackMapHeader(buf, 1)
+		writeMsgpackString(buf, "chunk")
+		writeMsgpackString(buf, chunk)
+	}
+}
+
+// The function is unsafe and MUST be called with b.mut held.
+func (b *FluentdBackend) send(event []byte, chunk string) error {
+	if err := b.connect(); err != nil {
+		return err
+	}
+
+	b.conn.SetDeadline(time.Now().Add(b.Cfg.Timeout))
+
+	if _, err := b.conn.Write(event); err != nil {
+		b.conn.Close()
+		b.conn = nil
+		return fmt.Errorf("cannot send event: %w", err)
+	}
+
+	if chunk == "" {
+		return nil
+	}
+
+	res, err := readMsgpackStringMap(b.reader)
+	if err != nil {
+		b.conn.Close()
+		b.conn = nil
+		return fmt.Errorf("cannot read ack response: %w", err)
+	}
+
+	if res["ack"] != chunk {
+		b.conn.Close()
+		b.conn = nil
+		return fmt.Errorf("invalid ack response")
+	}
+
+	return nil
+}
+
+// The function is unsafe and MUST be called with b.mut held.
+func (b *FluentdBackend) connect() error {
+	if b.conn != nil {
+		return nil
+	}
+
+	conn, err := net.DialTimeout("tcp", b.Cfg.Addr, b.Cfg.Timeout)
+	if err != nil {
+		return fmt.Errorf("cannot connect to fluentd: %w", err)
+	}
+
+	b.conn = trackConn(string(BackendTypeFluentd), conn)
+	b.reader = bufio.NewReader(conn)
+
+	return nil
+}
@@ -0,0 +1,472 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The Google Cloud Logging backend writes messages in batches using the
+// entries.write method of the Cloud Logging API. Message data are sent as
+// fields of the JSON payload.
+//
+// Access tokens are obtained from the metadata server unless a token or a
+// token function is provided. The monitored resource is detected using the
+// metadata server when it is not set: k8s_container on GKE, gce_instance on
+// GCE and global elsewhere.
+//
+// https://cloud.google.com/logging/docs/reference/v2/rest/v2/entries/write
+type GCPBackendCfg struct {
+	ProjectId string `json:"project_id"`
+
+	// The name of the log, "go-log" by default.
+	LogName string `json:"log_name"`
+
+	Resource *GCPResource `json:"resource,omitempty"`
+
+	Labels map[string]string `json:"labels"`
+
+	AccessToken string                            `json:"access_token"`
+	TokenFunc   func() (string, time.Time, error) `json:"-"`
+
+	// The URL of the API endpoint; the default value is
+	// "https://logging.googleapis.com/v2/entries:write".
+	URL     string        `json:"url"`
+	Timeout time.Duration `json:"timeout"`
+
+	Batching BatchingCfg `json:"batching"`
+
+	// Requests rejected with status 429 or with a server error are retried
+	// with exponential backoff.
+	MaxRetries     int           `json:"max_retries"`
+	InitialBackoff time.Duration `json:"initial_backoff"`
+	MaxBackoff     time.Duration `json:"max_backoff"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg GCPBackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
+}
+
+type GCPResource struct {
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+const gcpMetadataURL = "http://metadata.google.internal/computeMetadata/v1/"
+
+type GCPBackend struct {
+	Cfg GCPBackendCfg
+
+	logName       string
+	resource      GCPResource
+	client        *http.Client
+	batcher       *batcher
+	writeFailures *writeFailureReporter
+
+	tokenMut    sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+func NewGCPBackend(cfg GCPBackendCfg) (*GCPBackend, error) {
+	if cfg.LogName == "" {
+		cfg.LogName = "go-log"
+	}
+
+	if cfg.URL == "" {
+		cfg.URL = "https://logging.googleapis.com/v2/entries:write"
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 5
+	}
+
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 500 * time.Millisecond
+	}
+
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+
+	b := &GCPBackend{
+		Cfg: cfg,
+
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+		writeFailures: newWriteFailureReporter(BackendTypeGCP, cfg.URL,
+			cfg.WriteFailures),
+	}
+
+	if cfg.ProjectId == "" {
+		projectId, err := b.metadata("project/project-id")
+		if err != nil {
+			return nil, fmt.Errorf("cannot obtain project id: %w", err)
+		}
+
+		b.Cfg.ProjectId = projectId
+	}
+
+	b.logName = "projects/" + b.Cfg.ProjectId + "/logs/" +
+		url.PathEscape(cfg.LogName)
+
+	if cfg.Resource != nil {
+		b.resource = *cfg.Resource
+	} else {
+		b.resource = b.detectResource()
+	}
+
+	b.batcher = newBatcher(cfg.Batching, b.send)
+
+	return b, nil
+}
+
+func (b *GCPBackend) Log(msg Message) {
+	b.batcher.add(msg)
+}
+
+func (b *GCPBackend) LogBatch(msgs []Message) {
+	b.batcher.addBatch(msgs)
+}
+
+// Send all pending messages.
+func (b *GCPBackend) Flush() error {
+	b.batcher.flush()
+	return nil
+}
+
+// Send all pending messages and stop the backend.
+func (b *GCPBackend) Close() error {
+	b.batcher.close()
+	return nil
+}
+
+// Check that the server accepts connections.
+func (b *GCPBackend) Probe() error {
+	return probeURL(b.Cfg.URL, b.Cfg.Timeout)
+}
+
+func (b *GCPBackend) send(msgs []Message) {
+	if dropped := b.batcher.takeDropped(); dropped > 0 {
+		err := fmt.Errorf("%d messages dropped because too many messages "+
+			"were pending", dropped)
+		b.writeFailures.failure(err)
+	}
+
+	body, err := b.encodeBody(msgs)
+	if err != nil {
+		b.writeFailures.failureMessages(err, msgs)
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry, err := b.sendRequest(body)
+		if err == nil {
+			b.writeFailures.success()
+			return
+		}
+
+		if !retry || attempt > b.Cfg.MaxRetries {
+			b.writeFailures.failureMessages(err, msgs)
+			return
+		}
+
+		b.batcher.sleep(retryDelay(attempt, b.Cfg.InitialBackoff,
+			b.Cfg.MaxBackoff))
+	}
+}
+
+func (b *GCPBackend) encodeBody(msgs []Message) ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteString(`{"logName":`)
+	writeJSONString(&buf, b.logName)
+
+	resource, err := json.Marshal(b.resource)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode resource: %w", err)
+	}
+
+	buf.WriteString(`,"resource":`)
+	buf.Write(resource)
+
+	if len(b.Cfg.Labels) > 0 {
+		labels, err := json.Marshal(b.Cfg.Labels)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode labels: %w", err)
+		}
+
+		buf.WriteString(`,"labels":`)
+		buf.Write(labels)
+	}
+
+	buf.WriteString(`,"partialSuccess":true,"entries":[`)
+	for i, msg := range msgs {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		b.encodeEntry(msg, &buf)
+	}
+	buf.WriteString("]}")
+
+	return buf.Bytes(), nil
+}
+
+func (b *GCPBackend) encodeEntry(msg Message, buf *bytes.Buffer) {
+	t := time.Now()
+	if msg.Time != nil {
+		t = *msg.Time
+	}
+
+	buf.WriteString(`{"timestamp":`)
+	writeJSONString(buf, t.UTC().Format(time.RFC3339Nano))
+
+	buf.WriteString(`,"severity":`)
+	writeJSONString(buf, gcpSeverity(msg.Level))
+
+	if msg.domain != "" {
+		buf.WriteString(`,"labels":{"domain":`)
+		writeJSONString(buf, msg.domain)
+		buf.WriteByte('}')
+	}
+
+	buf.WriteString(`,"jsonPayload":{`)
+
+	keys := make([]string, 0, len(msg.Data))
+	for k := range msg.Data {
+		if k != "message" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		writeJSONString(buf, k)
+		buf.WriteByte(':')
+		writeJSONDatum(buf, msg.Data[k])
+		buf.WriteByte(',')
+	}
+
+	buf.WriteString(`"message":`)
+	writeJSONString(buf, msg.Message)
+
+	buf.WriteString("}}")
+}
+
+func gcpSeverity(level Level) string {
+	switch level {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelError:
+		return "ERROR"
+	default:
+		return "DEFAULT"
+	}
+}
+
+// Send a request and indicate whether it can be retried in case of failure.
+func (b *GCPBackend) sendRequest(body []byte) (bool, error) {
+	token, err := b.accessToken()
+	if err != nil {
+		return true, fmt.Errorf("cannot obtain access token: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", b.Cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("cannot create http request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("cannot send http request: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return true, fmt.Errorf("cannot read http response: %w", err)
+	}
+
+	if res.StatusCode == 401 {
+		// The token may have been revoked
+		b.tokenMut.Lock()
+		b.token = ""
+		b.tokenMut.Unlock()
+
+		return true, fmt.Errorf("request failed with status %d",
+			res.StatusCode)
+	} else if res.StatusCode == 429 || res.StatusCode >= 500 {
+		return true, fmt.Errorf("request failed with status %d",
+			res.StatusCode)
+	} else if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return false, fmt.Errorf("request failed with status %d: %s",
+			res.StatusCode, resBody)
+	}
+
+	return false, nil
+}
+
+func (b *GCPBackend) accessToken() (string, error) {
+	if b.Cfg.AccessToken != "" {
+		return b.Cfg.AccessToken, nil
+	}
+
+	b.tokenMut.Lock()
+	defer b.tokenMut.Unlock()
+
+	// Tokens are renewed one minute before they expire
+	if b.token != "" && time.Now().Add(time.Minute).Before(b.tokenExpiry) {
+		return b.token, nil
+	}
+
+	tokenFunc := b.Cfg.TokenFunc
+	if tokenFunc == nil {
+		tokenFunc = b.metadataToken
+	}
+
+	token, expiry, err := tokenFunc()
+	if err != nil {
+		return "", err
+	}
+
+	b.token = token
+	b.tokenExpiry = expiry
+
+	return token, nil
+}
+
+func (b *GCPBackend) metadataToken() (string, time.Time, error) {
+	data, err := b.metadata("instance/service-accounts/default/token")
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+
+	if err := json.Unmarshal([]byte(data), &token); err != nil {
+		return "", time.Time{},
+			fmt.Errorf("cannot decode token response: %w", err)
+	}
+
+	expiry := time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+
+	return token.AccessToken, expiry, nil
+}
+
+func (b *GCPBackend) detectResource() GCPResource {
+	projectId := b.Cfg.ProjectId
+
+	zone, err := b.metadata("instance/zone")
+	if err != nil {
+		return GCPResource{
+			Type:   "global",
+			Labels: map[string]string{"project_id": projectId},
+		}
+	}
+
+	// projects/<project-number>/zones/<zone>
+	zone = zone[strings.LastIndexByte(zone, '/')+1:]
+
+	clusterName, err := b.metadata("instance/attributes/cluster-name")
+	if err == nil && clusterName != "" {
+		namespace := "default"
+		data, err := os.ReadFile("/var/run/secrets/kubernetes.io/" +
+			"serviceaccount/namespace")
+		if err == nil {
+			namespace = strings.TrimSpace(string(data))
+		}
+
+		podName, _ := os.Hostname()
+
+		return GCPResource{
+			Type: "k8s_container",
+			Labels: map[string]string{
+				"project_id":     projectId,
+				"location":       zone,
+				"cluster_name":   clusterName,
+				"namespace_name": namespace,
+				"pod_name":       podName,
+				"container_name": os.Getenv("CONTAINER_NAME"),
+			},
+		}
+	}
+
+	instanceId, _ := b.metadata("instance/id")
+
+	return GCPResource{
+		Type: "gce_instance",
+		Labels: map[string]string{
+			"project_id":  projectId,
+			"instance_id": instanceId,
+			"zone":        zone,
+		},
+	}
+}
+
+func (b *GCPBackend) metadata(path string) (string, error) {
+	req, err := http.NewRequest("GET", gcpMetadataURL+path, nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot create http request: %w", err)
+	}
+
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	client := http.Client{Timeout: 2 * time.Second}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("cannot query metadata server: %w", err)
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", fmt.Errorf("cannot read metadata response: %w", err)
+	}
+
+	if res.StatusCode != 200 {
+		return "", fmt.Errorf("metadata request failed with status %d",
+			res.StatusCode)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
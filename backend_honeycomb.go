@@ -0,0 +1,317 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The Honeycomb backend sends each message as an event with the batch events
+// API. Message data are sent as event fields, along with the "message",
+// "level", "domain" and "debug_level" fields.
+//
+// https://docs.honeycomb.io/api/tag/Events#operation/createEvents
+type HoneycombBackendCfg struct {
+	// The API host, "https://api.honeycomb.io" by default.
+	URL     string `json:"url"`
+	APIKey  string `json:"api_key"`
+	Dataset string `json:"dataset"`
+
+	DisableCompression bool          `json:"disable_compression"`
+	Timeout            time.Duration `json:"timeout"`
+
+	Batching BatchingCfg `json:"batching"`
+
+	// Requests rejected with status 429 or with a server error are retried
+	// with exponential backoff.
+	MaxRetries     int           `json:"max_retries"`
+	InitialBackoff time.Duration `json:"initial_backoff"`
+	MaxBackoff     time.Duration `json:"max_backoff"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg HoneycombBackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
+}
+
+var honeycombReservedKeys = map[string]struct{}{
+	"message":     {},
+	"level":       {},
+	"domain":      {},
+	"debug_level": {},
+}
+
+type HoneycombBackend struct {
+	Cfg HoneycombBackendCfg
+
+	uri           string
+	client        *http.Client
+	batcher       *batcher
+	writeFailures *writeFailureReporter
+}
+
+func NewHoneycombBackend(cfg HoneycombBackendCfg) (*HoneycombBackend, error) {
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("missing or empty api key")
+	}
+
+	if cfg.Dataset == "" {
+		return nil, fmt.Errorf("missing or empty dataset")
+	}
+
+	if cfg.URL == "" {
+		cfg.URL = "https://api.honeycomb.io"
+	}
+
+	if _, err := url.Parse(cfg.URL); err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 5
+	}
+
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 500 * time.Millisecond
+	}
+
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+
+	uri := strings.TrimRight(cfg.URL, "/") + "/1/batch/" +
+		url.PathEscape(cfg.Dataset)
+
+	b := &HoneycombBackend{
+		Cfg: cfg,
+
+		uri: uri,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+		writeFailures: newWriteFailureReporter(BackendTypeHoneycomb,
+			cfg.Dataset, cfg.WriteFailures),
+	}
+
+	b.batcher = newBatcher(cfg.Batching, b.send)
+
+	return b, nil
+}
+
+func (b *HoneycombBackend) Log(msg Message) {
+	b.batcher.add(msg)
+}
+
+func (b *HoneycombBackend) LogBatch(msgs []Message) {
+	b.batcher.addBatch(msgs)
+}
+
+// Send all pending messages.
+func (b *HoneycombBackend) Flush() error {
+	b.batcher.flush()
+	return nil
+}
+
+// Send all pending messages and stop the backend.
+func (b *HoneycombBackend) Close() error {
+	b.batcher.close()
+	return nil
+}
+
+// Check that the server accepts connections.
+func (b *HoneycombBackend) Probe() error {
+	return probeURL(b.Cfg.URL, b.Cfg.Timeout)
+}
+
+func (b *HoneycombBackend) send(msgs []Message) {
+	if dropped := b.batcher.takeDropped(); dropped > 0 {
+		err := fmt.Errorf("%d messages dropped because too many messages "+
+			"were pending", dropped)
+		b.writeFailures.failure(err)
+	}
+
+	body, err := b.encodeBody(msgs)
+	if err != nil {
+		b.writeFailures.failureMessages(err, msgs)
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry, err := b.sendRequest(body)
+		if err == nil {
+			b.writeFailures.success()
+			return
+		}
+
+		if !retry || attempt > b.Cfg.MaxRetries {
+			b.writeFailures.failureMessages(err, msgs)
+			return
+		}
+
+		b.batcher.sleep(retryDelay(attempt, b.Cfg.InitialBackoff,
+			b.Cfg.MaxBackoff))
+	}
+}
+
+func (b *HoneycombBackend) encodeBody(msgs []Message) ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteByte('[')
+	for i, msg := range msgs {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		b.encodeEvent(msg, &buf)
+	}
+	buf.WriteByte(']')
+
+	if b.Cfg.DisableCompression {
+		return buf.Bytes(), nil
+	}
+
+	var zbuf bytes.Buffer
+
+	zw := gzip.NewWriter(&zbuf)
+	if _, err := zw.Write(buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("cannot compress request body: %w", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("cannot compress request body: %w", err)
+	}
+
+	return zbuf.Bytes(), nil
+}
+
+func (b *HoneycombBackend) encodeEvent(msg Message, buf *bytes.Buffer) {
+	t := time.Now()
+	if msg.Time != nil {
+		t = *msg.Time
+	}
+
+	buf.WriteString(`{"time":`)
+	writeJSONString(buf, t.UTC().Format(time.RFC3339Nano))
+
+	buf.WriteString(`,"data":{"message":`)
+	writeJSONString(buf, msg.Message)
+	buf.WriteString(`,"level":`)
+	writeJSONString(buf, string(msg.Level))
+
+	if msg.domain != "" {
+		buf.WriteString(`,"domain":`)
+		writeJSONString(buf, msg.domain)
+	}
+
+	if msg.Level == LevelDebug {
+		fmt.Fprintf(buf, `,"debug_level":%d`, msg.DebugLevel)
+	}
+
+	keys := make([]string, 0, len(msg.Data))
+	for k := range msg.Data {
+		if _, found := honeycombReservedKeys[k]; !found {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		buf.WriteByte(',')
+		writeJSONString(buf, k)
+		buf.WriteByte(':')
+		writeJSONDatum(buf, msg.Data[k])
+	}
+
+	buf.WriteString("}}")
+}
+
+// Send a request and indicate whether it can be retried in case of failure.
+// Events rejected individually are reported but never retried.
+func (b *HoneycombBackend) sendRequest(body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", b.uri, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("cannot create http request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Honeycomb-Team", b.Cfg.APIKey)
+
+	if !b.Cfg.DisableCompression {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("cannot send http request: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return true, fmt.Errorf("cannot read http response: %w", err)
+	}
+
+	if res.StatusCode == 429 || res.StatusCode >= 500 {
+		return true, fmt.Errorf("request failed with status %d",
+			res.StatusCode)
+	} else if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return false, fmt.Errorf("request failed with status %d: %s",
+			res.StatusCode, bytes.TrimSpace(resBody))
+	}
+
+	var statuses []struct {
+		Status int    `json:"status"`
+		Error  string `json:"error"`
+	}
+
+	if err := json.Unmarshal(resBody, &statuses); err != nil {
+		return false, fmt.Errorf("cannot decode http response: %w", err)
+	}
+
+	var nbRejected int
+	var firstError string
+
+	for _, status := range statuses {
+		if status.Status < 200 || status.Status >= 300 {
+			if nbRejected == 0 {
+				firstError = status.Error
+			}
+
+			nbRejected++
+		}
+	}
+
+	if nbRejected > 0 {
+		return false, fmt.Errorf("%d events rejected: %s", nbRejected,
+			firstError)
+	}
+
+	return false, nil
+}
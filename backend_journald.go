@@ -0,0 +1,133 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const DefaultJournaldSocketPath = "/run/systemd/journal/socket"
+
+// Message data are written to fields whose name is the data key converted to
+// uppercase and prefixed by "GO_LOG_DATA_", so that they cannot override
+// fields interpreted by journald such as MESSAGE, PRIORITY or CODE_FILE.
+type JournaldBackendCfg struct {
+	SocketPath       string `json:"socket_path"`
+	SyslogIdentifier string `json:"syslog_identifier"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg JournaldBackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
+}
+
+// https://systemd.io/JOURNAL_NATIVE_PROTOCOL/
+func encodeJournaldEntry(cfg JournaldBackendCfg, msg Message) []byte {
+	var buf bytes.Buffer
+
+	writeJournaldField(&buf, "MESSAGE", msg.Message)
+	writeJournaldField(&buf, "PRIORITY",
+		strconv.Itoa(getSeverityCode(msg.Level)))
+
+	if cfg.SyslogIdentifier != "" {
+		writeJournaldField(&buf, "SYSLOG_IDENTIFIER", cfg.SyslogIdentifier)
+	}
+
+	if msg.domain != "" {
+		writeJournaldField(&buf, "GO_LOG_DOMAIN", msg.domain)
+	}
+
+	if msg.Level == LevelDebug {
+		writeJournaldField(&buf, "GO_LOG_DEBUG_LEVEL",
+			strconv.Itoa(msg.DebugLevel))
+	}
+
+	keys := make([]string, 0, len(msg.Data))
+	for k := range msg.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		name := journaldFieldName(k)
+		if name == "" {
+			continue
+		}
+
+		writeJournaldField(&buf, name, formatDatum2(msg.Data[k]))
+	}
+
+	return buf.Bytes()
+}
+
+func writeJournaldField(buf *bytes.Buffer, name, value string) {
+	if !strings.ContainsRune(value, '\n') {
+		buf.WriteString(name)
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+
+	// Values containing newlines must use the binary format where the
+	// value is prefixed by its length as a little-endian 64 bit integer.
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+
+	buf.WriteString(name)
+	buf.WriteByte('\n')
+	buf.Write(size[:])
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+const journaldDataFieldPrefix = "GO_LOG_DATA_"
+
+// Journald field names can only contain uppercase letters, digits and
+// underscores, cannot start with a digit or an underscore (the latter being
+// reserved for trusted fields), and are limited to 64 characters. The prefix
+// takes care of the first character.
+func journaldFieldName(key string) string {
+	if key == "" {
+		return ""
+	}
+
+	var buf strings.Builder
+	buf.WriteString(journaldDataFieldPrefix)
+
+	for _, c := range key {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+			buf.WriteRune(c)
+		case c >= 'a' && c <= 'z':
+			buf.WriteRune(c - 'a' + 'A')
+		default:
+			buf.WriteByte('_')
+		}
+	}
+
+	name := buf.String()
+	if len(name) > 64 {
+		name = name[:64]
+	}
+
+	return name
+}
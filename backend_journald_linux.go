@@ -0,0 +1,106 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build linux
+// +build linux
+
+package log
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+type JournaldBackend struct {
+	Cfg JournaldBackendCfg
+
+	conn          *net.UnixConn
+	addr          *net.UnixAddr
+	writeFailures *writeFailureReporter
+}
+
+func NewJournaldBackend(cfg JournaldBackendCfg) (*JournaldBackend, error) {
+	socketPath := DefaultJournaldSocketPath
+	if cfg.SocketPath != "" {
+		socketPath = cfg.SocketPath
+	}
+
+	addr := &net.UnixAddr{Name: socketPath, Net: "unixgram"}
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create unix socket: %w", err)
+	}
+
+	b := &JournaldBackend{
+		Cfg: cfg,
+
+		conn: conn,
+		addr: addr,
+
+		writeFailures: newWriteFailureReporter(BackendTypeJournald,
+			socketPath, cfg.WriteFailures),
+	}
+
+	return b, nil
+}
+
+func (b *JournaldBackend) Log(msg Message) {
+	entry := encodeJournaldEntry(b.Cfg, msg)
+
+	if err := b.write(entry); err != nil {
+		b.writeFailures.failureMessages(err, []Message{msg})
+	} else {
+		b.writeFailures.success()
+	}
+}
+
+func (b *JournaldBackend) Close() error {
+	return b.conn.Close()
+}
+
+func (b *JournaldBackend) write(entry []byte) error {
+	_, _, err := b.conn.WriteMsgUnix(entry, nil, b.addr)
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, syscall.EMSGSIZE) && !errors.Is(err, syscall.ENOBUFS) {
+		return err
+	}
+
+	// Entries too large to fit in a datagram are written to a temporary
+	// file whose descriptor is passed to journald.
+	file, err := os.CreateTemp("/dev/shm", "go-log-journald-")
+	if err != nil {
+		return fmt.Errorf("cannot create temporary file: %w", err)
+	}
+	defer file.Close()
+
+	if err := os.Remove(file.Name()); err != nil {
+		return fmt.Errorf("cannot delete temporary file: %w", err)
+	}
+
+	if _, err := file.Write(entry); err != nil {
+		return fmt.Errorf("cannot write temporary file: %w", err)
+	}
+
+	rights := syscall.UnixRights(int(file.Fd()))
+
+	_, _, err = b.conn.WriteMsgUnix(nil, rights, b.addr)
+	return err
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodeJournaldEntry(t *testing.T) {
+	cfg := JournaldBackendCfg{SyslogIdentifier: "app"}
+
+	msg := Message{
+		Level:   LevelError,
+		Message: "cannot connect",
+		Data: Data{
+			"message":               "overridden",
+			"priority":              7,
+			"syslog_identifier":     "other",
+			"code_file":             "main.go",
+			"9lives":                true,
+			"":                      "empty",
+			"error":                 "line 1\nline 2",
+			strings.Repeat("a", 60): 1,
+		},
+
+		domain: "db",
+	}
+
+	expected := "MESSAGE=cannot connect\n" +
+		"PRIORITY=3\n" +
+		"SYSLOG_IDENTIFIER=app\n" +
+		"GO_LOG_DOMAIN=db\n" +
+		"GO_LOG_DATA_9LIVES=true\n" +
+		"GO_LOG_DATA_" + strings.Repeat("A", 52) + "=1\n" +
+		"GO_LOG_DATA_CODE_FILE=main.go\n" +
+		"GO_LOG_DATA_ERROR\n" +
+		"\x0d\x00\x00\x00\x00\x00\x00\x00line 1\nline 2\n" +
+		"GO_LOG_DATA_MESSAGE=overridden\n" +
+		"GO_LOG_DATA_PRIORITY=7\n" +
+		"GO_LOG_DATA_SYSLOG_IDENTIFIER=other\n"
+
+	if entry := string(encodeJournaldEntry(cfg, msg)); entry != expected {
+		t.Errorf("unexpected entry:\n%q\nexpected:\n%q", entry, expected)
+	}
+}
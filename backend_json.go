@@ -0,0 +1,100 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// The JSON backend writes one JSON object per line, which is the format
+// expected by most log collectors in containerized environments.
+type JSONBackendCfg struct {
+	// The output is either "stdout" (the default) or "stderr". If a writer
+	// is provided, it is used instead.
+	Output string    `json:"output"`
+	Writer io.Writer `json:"-"`
+
+	Encoder JSONEncoderCfg `json:"encoder"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg JSONBackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
+}
+
+type JSONBackend struct {
+	Cfg JSONBackendCfg
+
+	encoder       *JSONEncoder
+	writeFailures *writeFailureReporter
+
+	mut    sync.Mutex
+	writer io.Writer
+}
+
+func NewJSONBackend(cfg JSONBackendCfg) (*JSONBackend, error) {
+	writer := cfg.Writer
+	if writer == nil {
+		switch cfg.Output {
+		case "", "stdout":
+			writer = os.Stdout
+		case "stderr":
+			writer = os.Stderr
+		default:
+			return nil, fmt.Errorf("invalid output %q", cfg.Output)
+		}
+	}
+
+	b := &JSONBackend{
+		Cfg: cfg,
+
+		encoder: NewJSONEncoder(cfg.Encoder),
+		writeFailures: newWriteFailureReporter(BackendTypeJSON, cfg.Output,
+			cfg.WriteFailures),
+
+		writer: writer,
+	}
+
+	return b, nil
+}
+
+func (b *JSONBackend) Log(msg Message) {
+	b.LogBatch([]Message{msg})
+}
+
+func (b *JSONBackend) LogBatch(msgs []Message) {
+	buf := getEncodingBuffer()
+	defer putEncodingBuffer(buf)
+
+	for _, msg := range msgs {
+		b.encoder.EncodeMessage(msg, buf)
+		buf.WriteByte('\n')
+	}
+
+	b.mut.Lock()
+	_, err := b.writer.Write(buf.Bytes())
+	b.mut.Unlock()
+
+	if err != nil {
+		b.writeFailures.failureMessages(err, msgs)
+	} else {
+		b.writeFailures.success()
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// The Logstash backend sends messages as newline-delimited JSON objects to a
+// Logstash TCP input using the json_lines codec. Messages are queued in
+// memory and sent in batches; the connection is established again with
+// exponential backoff when it fails.
+type LogstashBackendCfg struct {
+	Addr string `json:"addr"`
+
+	TLS               bool        `json:"tls"`
+	CACertificatePath string      `json:"ca_certificate_path"`
+	TLSConfig         *tls.Config `json:"-"`
+
+	Timeout time.Duration `json:"timeout"`
+
+	// The maximum number of pending messages is the size of the queue.
+	Batching BatchingCfg `json:"batching"`
+
+	MaxRetries     int           `json:"max_retries"`
+	InitialBackoff time.Duration `json:"initial_backoff"`
+	MaxBackoff     time.Duration `json:"max_backoff"`
+
+	Encoder JSONEncoderCfg `json:"encoder"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg LogstashBackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
+}
+
+type LogstashBackend struct {
+	Cfg LogstashBackendCfg
+
+	tlsConfig     *tls.Config
+	encoder       *JSONEncoder
+	batcher       *batcher
+	writeFailures *writeFailureReporter
+
+	mut  sync.Mutex
+	conn net.Conn
+}
+
+func NewLogstashBackend(cfg LogstashBackendCfg) (*LogstashBackend, error) {
+	if cfg.Addr == "" {
+		return nil, fmt.Errorf("missing or empty address")
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 5
+	}
+
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 500 * time.Millisecond
+	}
+
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+
+	b := &LogstashBackend{
+		Cfg: cfg,
+
+		encoder: NewJSONEncoder(cfg.Encoder),
+		writeFailures: newWriteFailureReporter(BackendTypeLogstash, cfg.Addr,
+			cfg.WriteFailures),
+	}
+
+	if cfg.TLS {
+		tlsConfig, err := clientTLSConfig(cfg.TLSConfig, cfg.CACertificatePath)
+		if err != nil {
+			return nil, err
+		}
+
+		b.tlsConfig = tlsConfig
+	}
+
+	b.batcher = newBatcher(cfg.Batching, b.send)
+
+	return b, nil
+}
+
+func (b *LogstashBackend) Log(msg Message) {
+	b.batcher.add(msg)
+}
+
+func (b *LogstashBackend) LogBatch(msgs []Message) {
+	b.batcher.addBatch(msgs)
+}
+
+// Send all pending messages.
+func (b *LogstashBackend) Flush() error {
+	b.batcher.flush()
+	return nil
+}
+
+// Send all pending messages and close the connection.
+func (b *LogstashBackend) Close() error {
+	b.batcher.close()
+
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if b.conn == nil {
+		return nil
+	}
+
+	err := b.conn.Close()
+	b.conn = nil
+
+	return err
+}
+
+// Connect to the server if the backend is not connected.
+func (b *LogstashBackend) Probe() error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	return b.connect()
+}
+
+func (b *LogstashBackend) send(msgs []Message) {
+	if dropped := b.batcher.takeDropped(); dropped > 0 {
+		err := fmt.Errorf("%d messages dropped because too many messages "+
+			"were pending", dropped)
+		b.writeFailures.failure(err)
+	}
+
+	var buf bytes.Buffer
+	for _, msg := range msgs {
+		b.encoder.EncodeMessage(msg, &buf)
+		buf.WriteByte('\n')
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := b.write(buf.Bytes())
+		if err == nil {
+			b.writeFailures.success()
+			return
+		}
+
+		if attempt > b.Cfg.MaxRetries {
+			b.writeFailures.failureMessages(err, msgs)
+			return
+		}
+
+		b.batcher.sleep(retryDelay(attempt, b.Cfg.InitialBackoff,
+			b.Cfg.MaxBackoff))
+	}
+}
+
+func (b *LogstashBackend) write(data []byte) error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if err := b.connect(); err != nil {
+		return err
+	}
+
+	b.conn.SetWriteDeadline(time.Now().Add(b.Cfg.Timeout))
+
+	if _, err := b.conn.Write(data); err != nil {
+		b.conn.Close()
+		b.conn = nil
+		return fmt.Errorf("cannot write log messages: %w", err)
+	}
+
+	return nil
+}
+
+// The function is unsafe and MUST be called with b.mut held.
+func (b *LogstashBackend) connect() error {
+	if b.conn != nil {
+		return nil
+	}
+
+	dialer := net.Dialer{Timeout: b.Cfg.Timeout}
+
+	var conn net.Conn
+	var err error
+
+	if b.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(&dialer, "tcp", b.Cfg.Addr,
+			b.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", b.Cfg.Addr)
+	}
+
+	if err != nil {
+		return fmt.Errorf("cannot connect to logstash: %w", err)
+	}
+
+	b.conn = trackConn(string(BackendTypeLogstash), conn)
+	return nil
+}
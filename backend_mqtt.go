@@ -0,0 +1,351 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The MQTT backend publishes each message, encoded as a JSON object, using
+// MQTT 3.1.1. Only QoS levels 0 and 1 are supported.
+type MQTTBackendCfg struct {
+	Addr     string `json:"addr"`
+	ClientId string `json:"client_id"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	// The topic can contain the "{domain}" and "{level}" placeholders,
+	// e.g. "logs/{domain}/{level}". Dots in domains are replaced by
+	// slashes.
+	Topic string `json:"topic"`
+	QoS   int    `json:"qos"`
+
+	TLS               bool        `json:"tls"`
+	CACertificatePath string      `json:"ca_certificate_path"`
+	TLSConfig         *tls.Config `json:"-"`
+
+	Timeout time.Duration `json:"timeout"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg MQTTBackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
+}
+
+type MQTTBackend struct {
+	Cfg MQTTBackendCfg
+
+	tlsConfig     *tls.Config
+	encoder       *JSONEncoder
+	writeFailures *writeFailureReporter
+
+	mut      sync.Mutex
+	conn     net.Conn
+	reader   *bufio.Reader
+	packetId uint16
+}
+
+func NewMQTTBackend(cfg MQTTBackendCfg) (*MQTTBackend, error) {
+	if cfg.Addr == "" {
+		return nil, fmt.Errorf("missing or empty address")
+	}
+
+	if cfg.Topic == "" {
+		return nil, fmt.Errorf("missing or empty topic")
+	}
+
+	if cfg.QoS != 0 && cfg.QoS != 1 {
+		return nil, fmt.Errorf("unsupported qos %d", cfg.QoS)
+	}
+
+	if cfg.ClientId == "" {
+		cfg.ClientId = "go-log-" + strings.ReplaceAll(generateId(), "-", "")
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	b := &MQTTBackend{
+		Cfg: cfg,
+
+		encoder: NewJSONEncoder(JSONEncoderCfg{}),
+		writeFailures: newWriteFailureReporter(BackendTypeMQTT, cfg.Addr,
+			cfg.WriteFailures),
+	}
+
+	if cfg.TLS {
+		tlsConfig, err := clientTLSConfig(cfg.TLSConfig, cfg.CACertificatePath)
+		if err != nil {
+			return nil, err
+		}
+
+		b.tlsConfig = tlsConfig
+	}
+
+	return b, nil
+}
+
+func (b *MQTTBackend) Log(msg Message) {
+	var payload bytes.Buffer
+	b.encoder.EncodeMessage(msg, &payload)
+
+	b.mut.Lock()
+	err := b.publish(b.topic(msg), payload.Bytes())
+	b.mut.Unlock()
+
+	if err != nil {
+		b.writeFailures.failureMessages(err, []Message{msg})
+	} else {
+		b.writeFailures.success()
+	}
+}
+
+func (b *MQTTBackend) Close() error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if b.conn == nil {
+		return nil
+	}
+
+	// DISCONNECT
+	b.conn.Write([]byte{0xe0, 0x00})
+
+	err := b.conn.Close()
+	b.conn = nil
+
+	return err
+}
+
+// Connect to the server if the backend is not connected.
+func (b *MQTTBackend) Probe() error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	return b.connect()
+}
+
+func (b *MQTTBackend) topic(msg Message) string {
+	domain := strings.ReplaceAll(msg.domain, ".", "/")
+
+	return strings.NewReplacer("{domain}", domain,
+		"{level}", string(msg.Level)).Replace(b.Cfg.Topic)
+}
+
+// The function is unsafe and MUST be called with b.mut held.
+func (b *MQTTBackend) publish(topic string, payload []byte) error {
+	if err := b.connect(); err != nil {
+		return err
+	}
+
+	var packet bytes.Buffer
+	writeMQTTString(&packet, topic)
+
+	if b.Cfg.QoS > 0 {
+		b.packetId++
+		if b.packetId == 0 {
+			b.packetId = 1
+		}
+
+		binary.Write(&packet, binary.BigEndian, b.packetId)
+	}
+
+	packet.Write(payload)
+
+	header := byte(0x30 | b.Cfg.QoS<<1)
+
+	b.conn.SetDeadline(time.Now().Add(b.Cfg.Timeout))
+
+	if err := writeMQTTPacket(b.conn, header, packet.Bytes()); err != nil {
+		b.disconnect()
+		return fmt.Errorf("cannot publish message: %w", err)
+	}
+
+	if b.Cfg.QoS > 0 {
+		packetType, body, err := readMQTTPacket(b.reader)
+		if err != nil {
+			b.disconnect()
+			return fmt.Errorf("cannot read puback packet: %w", err)
+		}
+
+		if packetType != 0x40 || len(body) != 2 ||
+			binary.BigEndian.Uint16(body) != b.packetId {
+			b.disconnect()
+			return fmt.Errorf("unexpected packet of type %d", packetType>>4)
+		}
+	}
+
+	return nil
+}
+
+// The function is unsafe and MUST be called with b.mut held.
+func (b *MQTTBackend) connect() error {
+	if b.conn != nil {
+		return nil
+	}
+
+	dialer := net.Dialer{Timeout: b.Cfg.Timeout}
+
+	var conn net.Conn
+	var err error
+
+	if b.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(&dialer, "tcp", b.Cfg.Addr,
+			b.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", b.Cfg.Addr)
+	}
+
+	if err != nil {
+		return fmt.Errorf("cannot connect to the mqtt broker: %w", err)
+	}
+
+	// https://docs.oasis-open.org/mqtt/mqtt/v3.1.1/os/mqtt-v3.1.1-os.html#_Toc398718028
+	var packet bytes.Buffer
+	writeMQTTString(&packet, "MQTT")
+	packet.WriteByte(4) // protocol level
+
+	flags := byte(0x02) // clean session
+	if b.Cfg.Username != "" {
+		flags |= 0x80
+	}
+	if b.Cfg.Password != "" {
+		flags |= 0x40
+	}
+	packet.WriteByte(flags)
+
+	// Keep alive disabled: the broker does not expect any ping
+	packet.Write([]byte{0, 0})
+
+	writeMQTTString(&packet, b.Cfg.ClientId)
+	if b.Cfg.Username != "" {
+		writeMQTTString(&packet, b.Cfg.Username)
+	}
+	if b.Cfg.Password != "" {
+		writeMQTTString(&packet, b.Cfg.Password)
+	}
+
+	conn.SetDeadline(time.Now().Add(b.Cfg.Timeout))
+
+	if err := writeMQTTPacket(conn, 0x10, packet.Bytes()); err != nil {
+		conn.Close()
+		return fmt.Errorf("cannot send connect packet: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+
+	packetType, body, err := readMQTTPacket(reader)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("cannot read connack packet: %w", err)
+	}
+
+	if packetType != 0x20 || len(body) != 2 {
+		conn.Close()
+		return fmt.Errorf("unexpected packet of type %d", packetType>>4)
+	}
+
+	if body[1] != 0 {
+		conn.Close()
+		return fmt.Errorf("connection refused with code %d", body[1])
+	}
+
+	b.conn = trackConn(string(BackendTypeMQTT), conn)
+	b.reader = reader
+
+	return nil
+}
+
+// The function is unsafe and MUST be called with b.mut held.
+func (b *MQTTBackend) disconnect() {
+	b.conn.Close()
+	b.conn = nil
+	b.reader = nil
+}
+
+func writeMQTTString(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.BigEndian, uint16(len(s)))
+	buf.WriteString(s)
+}
+
+func writeMQTTPacket(w io.Writer, header byte, body []byte) error {
+	var buf bytes.Buffer
+	buf.WriteByte(header)
+
+	// Remaining length
+	n := len(body)
+	for {
+		c := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			c |= 0x80
+		}
+		buf.WriteByte(c)
+
+		if n == 0 {
+			break
+		}
+	}
+
+	buf.Write(body)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	n, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, fmt.Errorf("invalid remaining length")
+		}
+
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		n += int(c&0x7f) * multiplier
+		multiplier *= 128
+
+		if c&0x80 == 0 {
+			break
+		}
+	}
+
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+
+	return header & 0xf0, body, nil
+}
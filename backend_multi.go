@@ -0,0 +1,124 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"sync"
+)
+
+// The multi backend sends each message to several backends. Backends are
+// isolated from each other: a backend panicking while logging a message is
+// reported as a write failure and does not prevent other backends from
+// receiving the message.
+type MultiBackend struct {
+	Backends []Backend
+
+	WriteFailures *WriteFailureCfg
+
+	writeFailuresOnce sync.Once
+	writeFailures     *writeFailureReporter
+}
+
+func NewMultiBackend(backends ...Backend) *MultiBackend {
+	return &MultiBackend{
+		Backends: backends,
+	}
+}
+
+func (b *MultiBackend) Log(msg Message) {
+	for _, backend := range b.Backends {
+		b.call(backend, func() {
+			backend.Log(msg)
+		})
+	}
+}
+
+func (b *MultiBackend) LogBatch(msgs []Message) {
+	for _, backend := range b.Backends {
+		backend := backend
+
+		b.call(backend, func() {
+			logBatch(backend, msgs)
+		})
+	}
+}
+
+// Flush all backends which support it, returning the first error.
+func (b *MultiBackend) Flush() error {
+	var firstErr error
+
+	for _, backend := range b.Backends {
+		if flusher, ok := backend.(interface{ Flush() error }); ok {
+			if err := flusher.Flush(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// Close all backends which support it, returning the first error.
+func (b *MultiBackend) Close() error {
+	var firstErr error
+
+	for _, backend := range b.Backends {
+		if closer, ok := backend.(interface{ Close() error }); ok {
+			if err := closer.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// The multi backend reports delivery if all its backends do; otherwise
+// messages are considered delivered once written to synchronous backends.
+func (b *MultiBackend) ReportsDelivery() bool {
+	if len(b.Backends) == 0 {
+		return false
+	}
+
+	for _, backend := range b.Backends {
+		asyncBackend, ok := backend.(AsyncBackend)
+		if !ok || !asyncBackend.ReportsDelivery() {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (b *MultiBackend) call(backend Backend, fn func()) {
+	defer func() {
+		if value := recover(); value != nil {
+			err := fmt.Errorf("%T backend panicked: %v", backend, value)
+			b.reporter().failure(err)
+		}
+	}()
+
+	fn()
+}
+
+func (b *MultiBackend) reporter() *writeFailureReporter {
+	b.writeFailuresOnce.Do(func() {
+		b.writeFailures = newWriteFailureReporter("multi", "",
+			b.WriteFailures)
+	})
+
+	return b.writeFailures
+}
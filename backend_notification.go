@@ -0,0 +1,328 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+type NotificationService string
+
+const (
+	NotificationServiceSlack   NotificationService = "slack"
+	NotificationServiceTeams   NotificationService = "teams"
+	NotificationServiceDiscord NotificationService = "discord"
+)
+
+// The notification backend posts selected messages to the incoming webhook
+// of a chat service. Messages are rendered with a template and sent by a
+// separate goroutine; messages exceeding the rate limit are dropped and
+// counted in the next notification.
+type NotificationBackendCfg struct {
+	URL     string              `json:"url"`
+	Service NotificationService `json:"service"`
+
+	// Messages are selected by level (by default, only error messages) and
+	// by domain. A message matches a domain if its own domain is the same
+	// or is a child of it; if there is no domain, all messages match.
+	Levels  []Level  `json:"levels"`
+	Domains []string `json:"domains"`
+
+	// The template (see text/template) is executed with the
+	// NotificationTemplateData structure.
+	Template string `json:"template"`
+
+	// At most MaxMessages messages are sent for each interval. The default
+	// limit is 10 messages per minute.
+	MaxMessages int           `json:"max_messages"`
+	Interval    time.Duration `json:"interval"`
+
+	Timeout time.Duration `json:"timeout"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg NotificationBackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
+}
+
+type NotificationTemplateData struct {
+	Time       time.Time
+	Level      Level
+	DebugLevel int
+	Domain     string
+	Message    string
+	Data       map[string]string
+}
+
+const DefaultNotificationTemplate = "{{.Level}}" +
+	"{{if .Domain}} [{{.Domain}}]{{end}} {{.Message}}" +
+	"{{range $k, $v := .Data}}\n{{$k}}: {{$v}}{{end}}"
+
+// The maximum number of characters of a message accepted by Discord
+const discordMaxLength = 2000
+
+type NotificationBackend struct {
+	Cfg NotificationBackendCfg
+
+	template      *template.Template
+	client        *http.Client
+	writeFailures *writeFailureReporter
+
+	mut         sync.Mutex
+	periodStart time.Time
+	nbSent      int
+	nbDropped   int
+	closed      bool
+
+	texts chan string
+	wg    sync.WaitGroup
+}
+
+func NewNotificationBackend(cfg NotificationBackendCfg) (*NotificationBackend, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("missing or empty url")
+	}
+
+	switch cfg.Service {
+	case NotificationServiceSlack, NotificationServiceTeams,
+		NotificationServiceDiscord:
+	case "":
+		return nil, fmt.Errorf("missing or empty service")
+	default:
+		return nil, fmt.Errorf("invalid service %q", cfg.Service)
+	}
+
+	if len(cfg.Levels) == 0 {
+		cfg.Levels = []Level{LevelError}
+	}
+
+	if cfg.Template == "" {
+		cfg.Template = DefaultNotificationTemplate
+	}
+
+	tpl, err := template.New("notification").Parse(cfg.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	if cfg.MaxMessages <= 0 {
+		cfg.MaxMessages = 10
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	b := &NotificationBackend{
+		Cfg: cfg,
+
+		template: tpl,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+		writeFailures: newWriteFailureReporter(BackendTypeNotification,
+			string(cfg.Service), cfg.WriteFailures),
+
+		texts: make(chan string, cfg.MaxMessages),
+	}
+
+	b.wg.Add(1)
+	go b.main()
+
+	return b, nil
+}
+
+func (b *NotificationBackend) Log(msg Message) {
+	if !b.selected(msg) {
+		return
+	}
+
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(b.periodStart) >= b.Cfg.Interval {
+		b.periodStart = now
+		b.nbSent = 0
+	}
+
+	if b.nbSent >= b.Cfg.MaxMessages {
+		b.nbDropped++
+		return
+	}
+
+	text, err := b.render(msg)
+	if err != nil {
+		b.writeFailures.failure(err)
+		return
+	}
+
+	if b.nbDropped > 0 {
+		text += fmt.Sprintf("\n(%d messages dropped due to rate limiting)",
+			b.nbDropped)
+	}
+
+	select {
+	case b.texts <- text:
+		b.nbSent++
+		b.nbDropped = 0
+	default:
+		b.nbDropped++
+	}
+}
+
+// Send pending notifications and stop the backend.
+func (b *NotificationBackend) Close() error {
+	b.mut.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.texts)
+	}
+	b.mut.Unlock()
+
+	b.wg.Wait()
+
+	return nil
+}
+
+// Check that the server accepts connections.
+func (b *NotificationBackend) Probe() error {
+	return probeURL(b.Cfg.URL, b.Cfg.Timeout)
+}
+
+func (b *NotificationBackend) selected(msg Message) bool {
+	selected := false
+	for _, level := range b.Cfg.Levels {
+		if msg.Level == level {
+			selected = true
+			break
+		}
+	}
+
+	if !selected {
+		return false
+	}
+
+	if len(b.Cfg.Domains) == 0 {
+		return true
+	}
+
+	for _, domain := range b.Cfg.Domains {
+		if msg.domain == domain || strings.HasPrefix(msg.domain, domain+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b *NotificationBackend) render(msg Message) (string, error) {
+	data := NotificationTemplateData{
+		Level:      msg.Level,
+		DebugLevel: msg.DebugLevel,
+		Domain:     msg.domain,
+		Message:    msg.Message,
+		Data:       make(map[string]string, len(msg.Data)),
+	}
+
+	if msg.Time != nil {
+		data.Time = *msg.Time
+	}
+
+	for k, v := range msg.Data {
+		data.Data[k] = formatDatum2(v)
+	}
+
+	var buf bytes.Buffer
+	if err := b.template.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("cannot execute template: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+func (b *NotificationBackend) main() {
+	defer b.wg.Done()
+	defer trackGoroutine(string(BackendTypeNotification))()
+
+	for text := range b.texts {
+		if err := b.send(text); err != nil {
+			b.writeFailures.failure(err)
+		} else {
+			b.writeFailures.success()
+		}
+	}
+}
+
+func (b *NotificationBackend) send(text string) error {
+	var payload interface{}
+
+	switch b.Cfg.Service {
+	case NotificationServiceSlack, NotificationServiceTeams:
+		payload = map[string]string{"text": text}
+
+	case NotificationServiceDiscord:
+		if runes := []rune(text); len(runes) > discordMaxLength {
+			text = string(runes[:discordMaxLength-3]) + "..."
+		}
+
+		payload = map[string]string{"content": text}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("cannot encode payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", b.Cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot create http request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot send http request: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("request failed with status %d: %s",
+			res.StatusCode, bytes.TrimSpace(resBody))
+	}
+
+	return nil
+}
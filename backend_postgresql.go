@@ -0,0 +1,437 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The PostgreSQL backend inserts messages into a table with batched
+// multi-row inserts, so that audit logs can be stored next to application
+// data.
+//
+// The backend uses the database/sql package; the program must import a
+// PostgreSQL driver, e.g. github.com/lib/pq (driver "postgres") or
+// github.com/jackc/pgx/v5/stdlib (driver "pgx").
+type PostgreSQLBackendCfg struct {
+	URI    string `json:"uri"`
+	Driver string `json:"driver"`
+
+	// If set, the database is used instead of connecting to the URI; it is
+	// not closed when the backend is closed.
+	DB *sql.DB `json:"-"`
+
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+
+	// The names of the columns used to store messages; by default, each
+	// column is named after the field of the message, e.g. "time" or
+	// "domain".
+	Columns *PostgreSQLColumns `json:"columns,omitempty"`
+
+	// Data entries stored in dedicated columns instead of the data column,
+	// indexed by data key.
+	DataColumns map[string]string `json:"data_columns"`
+
+	// If set, the table is created when the backend is created. Dedicated
+	// data columns are created with the text type; tables using other types
+	// must be created by the application.
+	CreateTable bool `json:"create_table"`
+
+	Batching BatchingCfg `json:"batching"`
+
+	MaxRetries     int           `json:"max_retries"`
+	InitialBackoff time.Duration `json:"initial_backoff"`
+	MaxBackoff     time.Duration `json:"max_backoff"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg PostgreSQLBackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
+}
+
+// Columns set to "-" are not used.
+type PostgreSQLColumns struct {
+	Time       string `json:"time"`
+	Level      string `json:"level"`
+	DebugLevel string `json:"debug_level"`
+	Domain     string `json:"domain"`
+	Message    string `json:"message"`
+	Data       string `json:"data"`
+}
+
+type PostgreSQLBackend struct {
+	Cfg PostgreSQLBackendCfg
+
+	db            *sql.DB
+	columns       PostgreSQLColumns
+	dataKeys      []string
+	encoder       *JSONEncoder
+	batcher       *batcher
+	writeFailures *writeFailureReporter
+}
+
+// PostgreSQL does not accept more than 65535 parameters in a query.
+const postgreSQLMaxParameters = 65535
+
+func NewPostgreSQLBackend(cfg PostgreSQLBackendCfg) (*PostgreSQLBackend, error) {
+	if cfg.Driver == "" {
+		cfg.Driver = "postgres"
+	}
+
+	if cfg.Table == "" {
+		cfg.Table = "log_messages"
+	}
+
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 5
+	}
+
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 500 * time.Millisecond
+	}
+
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+
+	columns := PostgreSQLColumns{
+		Time:       "time",
+		Level:      "level",
+		DebugLevel: "debug_level",
+		Domain:     "domain",
+		Message:    "message",
+		Data:       "data",
+	}
+
+	if c := cfg.Columns; c != nil {
+		setColumn := func(column *string, name string) {
+			if name != "" {
+				*column = name
+			}
+		}
+
+		setColumn(&columns.Time, c.Time)
+		setColumn(&columns.Level, c.Level)
+		setColumn(&columns.DebugLevel, c.DebugLevel)
+		setColumn(&columns.Domain, c.Domain)
+		setColumn(&columns.Message, c.Message)
+		setColumn(&columns.Data, c.Data)
+	}
+
+	dataKeys := make([]string, 0, len(cfg.DataColumns))
+	for key := range cfg.DataColumns {
+		dataKeys = append(dataKeys, key)
+	}
+	sort.Strings(dataKeys)
+
+	b := &PostgreSQLBackend{
+		Cfg: cfg,
+
+		db:       cfg.DB,
+		columns:  columns,
+		dataKeys: dataKeys,
+		encoder:  NewJSONEncoder(JSONEncoderCfg{}),
+		writeFailures: newWriteFailureReporter(BackendTypePostgreSQL,
+			redactURI(cfg.URI), cfg.WriteFailures),
+	}
+
+	if len(b.columnNames()) == 0 {
+		return nil, fmt.Errorf("no column to insert messages into")
+	}
+
+	if b.db == nil {
+		if cfg.URI == "" {
+			return nil, fmt.Errorf("missing or empty uri")
+		}
+
+		db, err := sql.Open(cfg.Driver, cfg.URI)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open database: %w", err)
+		}
+
+		b.db = db
+	}
+
+	if cfg.CreateTable {
+		if err := b.createTable(); err != nil {
+			if cfg.DB == nil {
+				b.db.Close()
+			}
+
+			return nil, err
+		}
+	}
+
+	b.batcher = newBatcher(cfg.Batching, b.insert)
+
+	return b, nil
+}
+
+func (b *PostgreSQLBackend) Log(msg Message) {
+	b.batcher.add(msg)
+}
+
+func (b *PostgreSQLBackend) LogBatch(msgs []Message) {
+	b.batcher.addBatch(msgs)
+}
+
+// Insert all pending messages.
+func (b *PostgreSQLBackend) Flush() error {
+	b.batcher.flush()
+	return nil
+}
+
+// Insert all pending messages and close the database.
+func (b *PostgreSQLBackend) Close() error {
+	b.batcher.close()
+
+	if b.Cfg.DB != nil {
+		return nil
+	}
+
+	return b.db.Close()
+}
+
+// Check that the database server can be reached.
+func (b *PostgreSQLBackend) Probe() error {
+	return b.db.Ping()
+}
+
+func (b *PostgreSQLBackend) tableName() string {
+	name := quotePostgreSQLIdentifier(b.Cfg.Table)
+	if b.Cfg.Schema != "" {
+		name = quotePostgreSQLIdentifier(b.Cfg.Schema) + "." + name
+	}
+
+	return name
+}
+
+func (b *PostgreSQLBackend) createTable() error {
+	var columns []string
+
+	addColumn := func(name, definition string) {
+		if name != "-" {
+			columns = append(columns,
+				quotePostgreSQLIdentifier(name)+" "+definition)
+		}
+	}
+
+	addColumn(b.columns.Time, "TIMESTAMPTZ NOT NULL")
+	addColumn(b.columns.Level, "TEXT NOT NULL")
+	addColumn(b.columns.DebugLevel, "INTEGER")
+	addColumn(b.columns.Domain, "TEXT NOT NULL")
+	addColumn(b.columns.Message, "TEXT NOT NULL")
+	addColumn(b.columns.Data, "JSONB")
+
+	for _, key := range b.dataKeys {
+		addColumn(b.Cfg.DataColumns[key], "TEXT")
+	}
+
+	query := "CREATE TABLE IF NOT EXISTS " + b.tableName() + " (" +
+		strings.Join(columns, ", ") + ")"
+
+	if _, err := b.db.Exec(query); err != nil {
+		return fmt.Errorf("cannot create table: %w", err)
+	}
+
+	return nil
+}
+
+func (b *PostgreSQLBackend) insert(msgs []Message) {
+	if dropped := b.batcher.takeDropped(); dropped > 0 {
+		err := fmt.Errorf("%d messages dropped because too many messages "+
+			"were pending", dropped)
+		b.writeFailures.failure(err)
+	}
+
+	columns := b.columnNames()
+
+	batchSize := postgreSQLMaxParameters / len(columns)
+
+	for len(msgs) > 0 {
+		n := len(msgs)
+		if n > batchSize {
+			n = batchSize
+		}
+
+		chunk := msgs[:n]
+		msgs = msgs[n:]
+
+		query, args := b.insertQuery(columns, chunk)
+
+		for attempt := 1; ; attempt++ {
+			_, err := b.db.Exec(query, args...)
+			if err == nil {
+				b.writeFailures.success()
+				break
+			}
+
+			if attempt > b.Cfg.MaxRetries {
+				err = fmt.Errorf("cannot insert messages: %w", err)
+				b.writeFailures.failureMessages(err, chunk)
+				break
+			}
+
+			b.batcher.sleep(retryDelay(attempt, b.Cfg.InitialBackoff,
+				b.Cfg.MaxBackoff))
+		}
+	}
+}
+
+func (b *PostgreSQLBackend) columnNames() []string {
+	var columns []string
+
+	for _, name := range []string{b.columns.Time, b.columns.Level,
+		b.columns.DebugLevel, b.columns.Domain, b.columns.Message,
+		b.columns.Data} {
+		if name != "-" {
+			columns = append(columns, name)
+		}
+	}
+
+	for _, key := range b.dataKeys {
+		columns = append(columns, b.Cfg.DataColumns[key])
+	}
+
+	return columns
+}
+
+func (b *PostgreSQLBackend) insertQuery(columns []string, msgs []Message) (string, []interface{}) {
+	var query strings.Builder
+
+	query.WriteString("INSERT INTO ")
+	query.WriteString(b.tableName())
+	query.WriteString(" (")
+	for i, column := range columns {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString(quotePostgreSQLIdentifier(column))
+	}
+	query.WriteString(") VALUES ")
+
+	args := make([]interface{}, 0, len(columns)*len(msgs))
+
+	for i, msg := range msgs {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+
+		query.WriteByte('(')
+		for j := range columns {
+			if j > 0 {
+				query.WriteString(", ")
+			}
+			query.WriteByte('$')
+			query.WriteString(strconv.Itoa(len(args) + j + 1))
+		}
+		query.WriteByte(')')
+
+		args = append(args, b.messageValues(msg)...)
+	}
+
+	return query.String(), args
+}
+
+func (b *PostgreSQLBackend) messageValues(msg Message) []interface{} {
+	var values []interface{}
+
+	addValue := func(column string, value interface{}) {
+		if column != "-" {
+			values = append(values, value)
+		}
+	}
+
+	t := time.Now().UTC()
+	if msg.Time != nil {
+		t = msg.Time.UTC()
+	}
+
+	var debugLevel interface{}
+	if msg.Level == LevelDebug {
+		debugLevel = int64(msg.DebugLevel)
+	}
+
+	data := msg.Data
+	if len(b.dataKeys) > 0 && len(data) > 0 {
+		data = make(Data, len(msg.Data))
+		for k, v := range msg.Data {
+			if _, found := b.Cfg.DataColumns[k]; !found {
+				data[k] = v
+			}
+		}
+	}
+
+	var dataValue interface{}
+	if len(data) > 0 {
+		var buf bytes.Buffer
+		b.encoder.encodeData(data, &buf)
+		dataValue = buf.String()
+	}
+
+	addValue(b.columns.Time, t)
+	addValue(b.columns.Level, string(msg.Level))
+	addValue(b.columns.DebugLevel, debugLevel)
+	addValue(b.columns.Domain, msg.domain)
+	addValue(b.columns.Message, msg.Message)
+	addValue(b.columns.Data, dataValue)
+
+	for _, key := range b.dataKeys {
+		values = append(values, sqlDatum(msg.Data[key]))
+	}
+
+	return values
+}
+
+// Convert a datum to a value supported by all database/sql drivers.
+func sqlDatum(datum Datum) interface{} {
+	if datum == nil {
+		return nil
+	}
+
+	if _, ok := datum.(fmt.Stringer); !ok {
+		value, err := driver.DefaultParameterConverter.ConvertValue(datum)
+		if err == nil {
+			return value
+		}
+	}
+
+	return formatDatum2(datum)
+}
+
+func quotePostgreSQLIdentifier(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// Remove the password of a URI so that it can be used in error messages.
+func redactURI(s string) string {
+	uri, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+
+	return uri.Redacted()
+}
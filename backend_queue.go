@@ -0,0 +1,276 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"sync"
+)
+
+type QueueDropPolicy string
+
+const (
+	// Wait for space in the queue.
+	QueueDropPolicyBlock QueueDropPolicy = "block"
+
+	// Remove the oldest queued message to make room for the new one.
+	QueueDropPolicyDropOldest QueueDropPolicy = "drop_oldest"
+
+	// Drop the new message.
+	QueueDropPolicyDropNewest QueueDropPolicy = "drop_newest"
+)
+
+// The queue backend decorates another backend: messages are stored in a
+// bounded queue and written to the backend by a separate goroutine, so that
+// a slow backend does not slow down the code logging messages. When the
+// queue is full, the drop policy decides what happens to new messages.
+type QueueBackendCfg struct {
+	// The backend messages are written to, when the queue backend is created
+	// from a configuration.
+	Backend BackendCfg `json:"backend"`
+
+	// The maximum number of queued messages, 1000 by default.
+	QueueSize int `json:"queue_size"`
+
+	// The drop policy, QueueDropPolicyDropNewest by default.
+	DropPolicy QueueDropPolicy `json:"drop_policy"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg QueueBackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
+}
+
+type QueueBackend struct {
+	Cfg     QueueBackendCfg
+	Backend Backend
+
+	writeFailures *writeFailureReporter
+
+	queue chan Message
+
+	// Protects the closed flag against being set while messages are being
+	// added. Batches are added with the lock held exclusively so that they
+	// are not interleaved with other messages.
+	queueMut sync.RWMutex
+	closed   bool
+
+	mut     sync.Mutex
+	dropped int
+
+	// Held while messages are taken from the queue and written, so that
+	// Flush returns once all messages queued before have been written.
+	processMut sync.Mutex
+
+	wakeup         func()
+	stop           func()
+	untrackQueue   func()
+	reportDelivery bool
+}
+
+func NewQueueBackend(backend Backend, cfg QueueBackendCfg) (*QueueBackend, error) {
+	if backend == nil {
+		return nil, fmt.Errorf("missing backend")
+	}
+
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1000
+	}
+
+	switch cfg.DropPolicy {
+	case QueueDropPolicyBlock, QueueDropPolicyDropOldest,
+		QueueDropPolicyDropNewest:
+	case "":
+		cfg.DropPolicy = QueueDropPolicyDropNewest
+	default:
+		return nil, fmt.Errorf("invalid drop policy %q", cfg.DropPolicy)
+	}
+
+	b := &QueueBackend{
+		Cfg:     cfg,
+		Backend: backend,
+
+		writeFailures: newWriteFailureReporter(BackendTypeQueue, "",
+			cfg.WriteFailures),
+
+		queue: make(chan Message, cfg.QueueSize),
+	}
+
+	// If the decorated backend does not report delivery itself, messages
+	// are delivered once its Log method returns.
+	if asyncBackend, ok := backend.(AsyncBackend); !ok ||
+		!asyncBackend.ReportsDelivery() {
+		b.reportDelivery = true
+	}
+
+	b.untrackQueue = trackQueue(string(BackendTypeQueue), b.pending)
+
+	b.wakeup, b.stop = getScheduler().loop(string(BackendTypeQueue), 0,
+		b.process)
+
+	return b, nil
+}
+
+func (b *QueueBackend) ReportsDelivery() bool {
+	return true
+}
+
+func (b *QueueBackend) Log(msg Message) {
+	b.queueMut.RLock()
+	defer b.queueMut.RUnlock()
+
+	if b.closed {
+		return
+	}
+
+	if b.enqueue(msg) {
+		b.wakeup()
+	}
+}
+
+// Queue several messages; other messages cannot be queued in between.
+func (b *QueueBackend) LogBatch(msgs []Message) {
+	b.queueMut.Lock()
+	defer b.queueMut.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	for _, msg := range msgs {
+		b.enqueue(msg)
+	}
+
+	b.wakeup()
+}
+
+// Add a message to the queue according to the drop policy and return whether
+// it was queued.
+func (b *QueueBackend) enqueue(msg Message) bool {
+	switch b.Cfg.DropPolicy {
+	case QueueDropPolicyBlock:
+		select {
+		case b.queue <- msg:
+		default:
+			// The queue is full: the processing goroutine must be running
+			// for space to be freed, even while a batch is being queued.
+			b.wakeup()
+			b.queue <- msg
+		}
+
+	case QueueDropPolicyDropOldest:
+		for {
+			select {
+			case b.queue <- msg:
+				return true
+			default:
+			}
+
+			select {
+			case <-b.queue:
+				b.countDropped()
+			default:
+			}
+		}
+
+	case QueueDropPolicyDropNewest:
+		select {
+		case b.queue <- msg:
+		default:
+			b.countDropped()
+			return false
+		}
+	}
+
+	return true
+}
+
+// Write all queued messages, then flush the decorated backend if it supports
+// it.
+func (b *QueueBackend) Flush() error {
+	b.process()
+
+	if flusher, ok := b.Backend.(interface{ Flush() error }); ok {
+		return flusher.Flush()
+	}
+
+	return nil
+}
+
+// Write all queued messages and stop the backend. The decorated backend is
+// closed if it supports it.
+func (b *QueueBackend) Close() error {
+	b.queueMut.Lock()
+	b.closed = true
+	b.queueMut.Unlock()
+
+	b.stop()
+	b.process()
+
+	b.untrackQueue()
+
+	if closer, ok := b.Backend.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// Write messages until the queue is empty.
+func (b *QueueBackend) process() {
+	b.processMut.Lock()
+	defer b.processMut.Unlock()
+
+	for {
+		b.reportDropped()
+
+		select {
+		case msg := <-b.queue:
+			b.Backend.Log(msg)
+
+			if b.reportDelivery {
+				msg.Delivered()
+			}
+
+		default:
+			return
+		}
+	}
+}
+
+func (b *QueueBackend) pending() int {
+	return len(b.queue)
+}
+
+func (b *QueueBackend) countDropped() {
+	b.mut.Lock()
+	b.dropped++
+	b.mut.Unlock()
+}
+
+func (b *QueueBackend) reportDropped() {
+	b.mut.Lock()
+	dropped := b.dropped
+	b.dropped = 0
+	b.mut.Unlock()
+
+	if dropped > 0 {
+		err := fmt.Errorf("%d messages dropped because the queue was full",
+			dropped)
+		b.writeFailures.failure(err)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-log"
+	"github.com/exograd/go-log/logtest"
+)
+
+func newTestQueue(t *testing.T, cfg log.QueueBackendCfg) (*log.QueueBackend, *logtest.Backend, *logtest.Backend, *log.SimScheduler) {
+	sched := log.NewSimScheduler(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	t.Cleanup(log.SetSimScheduler(sched))
+
+	backend := logtest.NewBackend()
+	failures := logtest.NewBackend()
+
+	cfg.WriteFailures = &log.WriteFailureCfg{Backend: failures}
+
+	queue, err := log.NewQueueBackend(backend, cfg)
+	if err != nil {
+		t.Fatalf("cannot create queue backend: %v", err)
+	}
+
+	t.Cleanup(func() { queue.Close() })
+
+	return queue, backend, failures, sched
+}
+
+func logTestMessages(backend log.Backend, start, end int) {
+	for i := start; i < end; i++ {
+		backend.Log(log.Message{Message: fmt.Sprintf("m%d", i)})
+	}
+}
+
+func messageTexts(msgs []log.Message) []string {
+	texts := make([]string, len(msgs))
+	for i, msg := range msgs {
+		texts[i] = msg.Message
+	}
+
+	return texts
+}
+
+func TestQueueBackendOrdering(t *testing.T) {
+	queue, backend, _, sched := newTestQueue(t, log.QueueBackendCfg{})
+
+	logTestMessages(queue, 0, 3)
+
+	if n := len(backend.Entries()); n != 0 {
+		t.Fatalf("expected messages to be queued, got %d written", n)
+	}
+
+	queue.LogBatch([]log.Message{{Message: "m3"}, {Message: "m4"}})
+	logTestMessages(queue, 5, 6)
+
+	sched.Tick()
+
+	expected := []string{"m0", "m1", "m2", "m3", "m4", "m5"}
+	if texts := messageTexts(backend.Entries()); !reflect.DeepEqual(texts,
+		expected) {
+		t.Errorf("expected messages %v, got %v", expected, texts)
+	}
+}
+
+func TestQueueBackendFlush(t *testing.T) {
+	queue, backend, _, _ := newTestQueue(t, log.QueueBackendCfg{})
+
+	logTestMessages(queue, 0, 3)
+
+	if err := queue.Flush(); err != nil {
+		t.Fatalf("cannot flush queue: %v", err)
+	}
+
+	expected := []string{"m0", "m1", "m2"}
+	if texts := messageTexts(backend.Entries()); !reflect.DeepEqual(texts,
+		expected) {
+		t.Errorf("expected messages %v, got %v", expected, texts)
+	}
+
+	logTestMessages(queue, 3, 4)
+	queue.Close()
+	logTestMessages(queue, 4, 5)
+
+	expected = append(expected, "m3")
+	if texts := messageTexts(backend.Entries()); !reflect.DeepEqual(texts,
+		expected) {
+		t.Errorf("expected messages %v after close, got %v", expected, texts)
+	}
+}
+
+func TestQueueBackendDrop(t *testing.T) {
+	tests := []struct {
+		policy   log.QueueDropPolicy
+		expected []string
+	}{
+		{log.QueueDropPolicyDropNewest, []string{"m0", "m1", "m2"}},
+		{log.QueueDropPolicyDropOldest, []string{"m2", "m3", "m4"}},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.policy), func(t *testing.T) {
+			queue, backend, failures, sched := newTestQueue(t,
+				log.QueueBackendCfg{
+					QueueSize:  3,
+					DropPolicy: test.policy,
+				})
+
+			logTestMessages(queue, 0, 5)
+			sched.Tick()
+
+			texts := messageTexts(backend.Entries())
+			if !reflect.DeepEqual(texts, test.expected) {
+				t.Errorf("expected messages %v, got %v", test.expected, texts)
+			}
+
+			reports := failures.Filter(func(msg log.Message) bool {
+				err, _ := msg.Data["error"].(string)
+				return strings.HasPrefix(err, "2 messages dropped")
+			})
+			if len(reports) != 1 {
+				t.Errorf("expected 1 drop report, got %v", failures.Entries())
+			}
+		})
+	}
+}
+
+func TestQueueBackendBlockingBatch(t *testing.T) {
+	backend := logtest.NewBackend()
+
+	queue, err := log.NewQueueBackend(backend, log.QueueBackendCfg{
+		QueueSize:  2,
+		DropPolicy: log.QueueDropPolicyBlock,
+	})
+	if err != nil {
+		t.Fatalf("cannot create queue backend: %v", err)
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		queue.LogBatch([]log.Message{
+			{Message: "m0"}, {Message: "m1"}, {Message: "m2"},
+		})
+		logTestMessages(queue, 3, 4)
+		queue.Close()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("batch larger than the queue blocked forever")
+	}
+
+	expected := []string{"m0", "m1", "m2", "m3"}
+	if texts := messageTexts(backend.Entries()); !reflect.DeepEqual(texts,
+		expected) {
+		t.Errorf("expected messages %v, got %v", expected, texts)
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The rate limit backend decorates another backend, enforcing a token bucket
+// rate limit on messages so that log storms do not overwhelm downstream
+// collectors. Buckets are either global or per level and/or per domain.
+// Messages exceeding the limit are dropped and counted; a summary of
+// suppressed messages is logged at regular intervals.
+type RateLimitBackendCfg struct {
+	// The backend messages are written to, when the rate limit backend is
+	// created from a configuration.
+	Backend BackendCfg `json:"backend"`
+
+	// The number of messages allowed per second, 100 by default, and the
+	// size of the bucket, i.e. the number of messages which can be logged
+	// in a burst, equal to the rate by default. When buckets are per level,
+	// rates can be set for specific levels.
+	Rate       float64           `json:"rate"`
+	Burst      int               `json:"burst"`
+	LevelRates map[Level]float64 `json:"level_rates"`
+
+	PerLevel  bool `json:"per_level"`
+	PerDomain bool `json:"per_domain"`
+
+	// The maximum number of buckets, 1000 by default. Once reached, messages
+	// for new buckets share a single overflow bucket.
+	MaxBuckets int `json:"max_buckets"`
+
+	// The interval between summaries of suppressed messages, one minute by
+	// default.
+	SummaryInterval time.Duration `json:"summary_interval"`
+}
+
+type RateLimitBackend struct {
+	Cfg     RateLimitBackendCfg
+	Backend Backend
+
+	mut      sync.Mutex
+	buckets  map[rateLimitKey]*rateLimitBucket
+	overflow *rateLimitBucket
+
+	sched scheduler
+	stop  func()
+}
+
+type rateLimitKey struct {
+	level  Level
+	domain string
+}
+
+type rateLimitBucket struct {
+	key        rateLimitKey
+	rate       float64
+	burst      float64
+	tokens     float64
+	last       time.Time
+	suppressed int
+}
+
+func NewRateLimitBackend(backend Backend, cfg RateLimitBackendCfg) (*RateLimitBackend, error) {
+	if backend == nil {
+		return nil, fmt.Errorf("missing backend")
+	}
+
+	if cfg.Rate <= 0 {
+		cfg.Rate = 100
+	}
+
+	for level, rate := range cfg.LevelRates {
+		if rate <= 0 {
+			return nil, fmt.Errorf("invalid rate %g for level %q",
+				rate, level)
+		}
+	}
+
+	if cfg.MaxBuckets <= 0 {
+		cfg.MaxBuckets = 1000
+	}
+
+	if cfg.SummaryInterval <= 0 {
+		cfg.SummaryInterval = time.Minute
+	}
+
+	b := &RateLimitBackend{
+		Cfg:     cfg,
+		Backend: backend,
+
+		buckets: make(map[rateLimitKey]*rateLimitBucket),
+
+		sched: getScheduler(),
+	}
+
+	_, b.stop = b.sched.loop(string(BackendTypeRateLimit),
+		cfg.SummaryInterval, b.logSummary)
+
+	return b, nil
+}
+
+func (b *RateLimitBackend) Log(msg Message) {
+	if !b.allow(msg, b.sched.now()) {
+		return
+	}
+
+	b.Backend.Log(msg)
+}
+
+func (b *RateLimitBackend) LogBatch(msgs []Message) {
+	now := b.sched.now()
+
+	allowed := make([]Message, 0, len(msgs))
+	for _, msg := range msgs {
+		if b.allow(msg, now) {
+			allowed = append(allowed, msg)
+		}
+	}
+
+	if len(allowed) == 0 {
+		return
+	}
+
+	logBatch(b.Backend, allowed)
+}
+
+func (b *RateLimitBackend) Flush() error {
+	if flusher, ok := b.Backend.(interface{ Flush() error }); ok {
+		return flusher.Flush()
+	}
+
+	return nil
+}
+
+// Log a final summary of suppressed messages and stop the backend. The
+// decorated backend is closed if it supports it.
+func (b *RateLimitBackend) Close() error {
+	b.stop()
+
+	b.logSummary()
+
+	if closer, ok := b.Backend.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+func (b *RateLimitBackend) allow(msg Message, now time.Time) bool {
+	var key rateLimitKey
+	if b.Cfg.PerLevel {
+		key.level = msg.Level
+	}
+	if b.Cfg.PerDomain {
+		key.domain = msg.domain
+	}
+
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	bucket, found := b.buckets[key]
+	if !found {
+		if len(b.buckets) >= b.Cfg.MaxBuckets {
+			if b.overflow == nil {
+				b.overflow = b.newBucket(rateLimitKey{}, msg.Level, now)
+			}
+
+			bucket = b.overflow
+		} else {
+			bucket = b.newBucket(key, msg.Level, now)
+			b.buckets[key] = bucket
+		}
+	}
+
+	bucket.tokens += now.Sub(bucket.last).Seconds() * bucket.rate
+	if bucket.tokens > bucket.burst {
+		bucket.tokens = bucket.burst
+	}
+	bucket.last = now
+
+	if bucket.tokens < 1.0 {
+		bucket.suppressed++
+		return false
+	}
+
+	bucket.tokens--
+	return true
+}
+
+// The function is unsafe and MUST be called with b.mut held.
+func (b *RateLimitBackend) newBucket(key rateLimitKey, level Level, now time.Time) *rateLimitBucket {
+	rate := b.Cfg.Rate
+	if levelRate, found := b.Cfg.LevelRates[level]; found && b.Cfg.PerLevel {
+		rate = levelRate
+	}
+
+	burst := float64(b.Cfg.Burst)
+	if burst <= 0 {
+		burst = rate
+	}
+	if burst < 1.0 {
+		burst = 1.0
+	}
+
+	return &rateLimitBucket{
+		key:    key,
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   now,
+	}
+}
+
+func (b *RateLimitBackend) logSummary() {
+	b.mut.Lock()
+
+	var buckets []rateLimitBucket
+
+	collect := func(bucket *rateLimitBucket) {
+		if bucket.suppressed > 0 {
+			buckets = append(buckets, *bucket)
+			bucket.suppressed = 0
+		}
+	}
+
+	for _, bucket := range b.buckets {
+		collect(bucket)
+	}
+
+	if b.overflow != nil {
+		collect(b.overflow)
+	}
+
+	b.mut.Unlock()
+
+	sort.Slice(buckets, func(i, j int) bool {
+		k1, k2 := buckets[i].key, buckets[j].key
+		if k1.level != k2.level {
+			return k1.level < k2.level
+		}
+		return k1.domain < k2.domain
+	})
+
+	for _, bucket := range buckets {
+		data := Data{"suppressed_messages": bucket.suppressed}
+
+		if bucket.key.level != "" {
+			data["level"] = string(bucket.key.level)
+		}
+
+		if bucket.key.domain != "" {
+			data["domain"] = bucket.key.domain
+		}
+
+		t := b.sched.now().UTC()
+
+		b.Backend.Log(Message{
+			Time:  &t,
+			Level: LevelInfo,
+			Message: fmt.Sprintf("%d messages suppressed by rate limiting",
+				bucket.suppressed),
+			Data: data,
+
+			domain: InternalDomain,
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-log"
+	"github.com/exograd/go-log/logtest"
+)
+
+func newTestRateLimit(t *testing.T, cfg log.RateLimitBackendCfg) (*log.RateLimitBackend, *logtest.Backend, *log.SimScheduler) {
+	sched := log.NewSimScheduler(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	t.Cleanup(log.SetSimScheduler(sched))
+
+	backend := logtest.NewBackend()
+
+	rateLimit, err := log.NewRateLimitBackend(backend, cfg)
+	if err != nil {
+		t.Fatalf("cannot create rate limit backend: %v", err)
+	}
+
+	t.Cleanup(func() { rateLimit.Close() })
+
+	return rateLimit, backend, sched
+}
+
+func TestRateLimitBackend(t *testing.T) {
+	rateLimit, backend, sched := newTestRateLimit(t, log.RateLimitBackendCfg{
+		Rate:            2,
+		SummaryInterval: time.Minute,
+	})
+
+	logTestMessages(rateLimit, 0, 5)
+
+	sched.Advance(time.Second)
+	logTestMessages(rateLimit, 5, 10)
+
+	expected := []string{"m0", "m1", "m5", "m6"}
+	if texts := messageTexts(backend.Entries()); !reflect.DeepEqual(texts,
+		expected) {
+		t.Errorf("expected messages %v, got %v", expected, texts)
+	}
+
+	backend.Reset()
+	sched.Advance(59 * time.Second)
+
+	summaries := backend.FilterDomain(log.InternalDomain)
+	if len(summaries) != 1 {
+		t.Fatalf("expected 1 summary, got %v", backend.Entries())
+	}
+
+	if n := summaries[0].Data["suppressed_messages"]; n != 6 {
+		t.Errorf("expected 6 suppressed messages, got %v", n)
+	}
+
+	backend.Reset()
+	sched.Advance(time.Minute)
+
+	if entries := backend.Entries(); len(entries) != 0 {
+		t.Errorf("expected no summary without suppressed messages, got %v",
+			entries)
+	}
+}
+
+func TestRateLimitBackendPerLevel(t *testing.T) {
+	rateLimit, backend, _ := newTestRateLimit(t, log.RateLimitBackendCfg{
+		Rate:       1,
+		LevelRates: map[log.Level]float64{log.LevelError: 3},
+		PerLevel:   true,
+	})
+
+	rateLimit.LogBatch([]log.Message{
+		{Level: log.LevelInfo, Message: "i0"},
+		{Level: log.LevelError, Message: "e0"},
+		{Level: log.LevelInfo, Message: "i1"},
+		{Level: log.LevelError, Message: "e1"},
+		{Level: log.LevelError, Message: "e2"},
+		{Level: log.LevelError, Message: "e3"},
+	})
+
+	expected := []string{"i0", "e0", "e1", "e2"}
+	if texts := messageTexts(backend.Entries()); !reflect.DeepEqual(texts,
+		expected) {
+		t.Errorf("expected messages %v, got %v", expected, texts)
+	}
+
+	backend.Reset()
+	rateLimit.Close()
+
+	if !backend.ContainsData("level", "error") ||
+		!backend.ContainsData("level", "info") {
+		t.Errorf("missing per level summaries in %v", backend.Entries())
+	}
+}
@@ -0,0 +1,327 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// The Redis backend appends messages to a stream with XADD. Each entry
+// contains the time, level, domain and message of the log message, and its
+// data encoded as a JSON object.
+type RedisBackendCfg struct {
+	Addr     string `json:"addr"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	DB       int    `json:"db"`
+
+	StreamKey string `json:"stream_key"`
+
+	// If the maximum length is strictly positive, the stream is trimmed
+	// when entries are added. Approximate trimming is much more efficient
+	// but may keep a few more entries than the limit.
+	MaxLen            int64 `json:"max_len"`
+	ApproximateMaxLen bool  `json:"approximate_max_len"`
+
+	// The maximum number of idle connections kept open.
+	PoolSize int           `json:"pool_size"`
+	Timeout  time.Duration `json:"timeout"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg RedisBackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
+}
+
+type RedisBackend struct {
+	Cfg RedisBackendCfg
+
+	pool          chan *redisConn
+	writeFailures *writeFailureReporter
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+type redisError string
+
+func (err redisError) Error() string {
+	return "redis error: " + string(err)
+}
+
+func NewRedisBackend(cfg RedisBackendCfg) (*RedisBackend, error) {
+	if cfg.Addr == "" {
+		cfg.Addr = "localhost:6379"
+	}
+
+	if cfg.StreamKey == "" {
+		return nil, fmt.Errorf("missing or empty stream key")
+	}
+
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = 4
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+
+	b := &RedisBackend{
+		Cfg: cfg,
+
+		pool: make(chan *redisConn, cfg.PoolSize),
+		writeFailures: newWriteFailureReporter(BackendTypeRedis, cfg.Addr,
+			cfg.WriteFailures),
+	}
+
+	return b, nil
+}
+
+func (b *RedisBackend) Log(msg Message) {
+	if err := b.xadd(msg); err != nil {
+		b.writeFailures.failureMessages(err, []Message{msg})
+	} else {
+		b.writeFailures.success()
+	}
+}
+
+// Close all idle connections.
+func (b *RedisBackend) Close() error {
+	for {
+		select {
+		case conn := <-b.pool:
+			conn.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// Check that the server answers a PING command.
+func (b *RedisBackend) Probe() error {
+	conn, err := b.getConn()
+	if err != nil {
+		return err
+	}
+
+	if _, err := conn.call([]string{"PING"}, b.Cfg.Timeout); err != nil {
+		conn.conn.Close()
+		return err
+	}
+
+	b.putConn(conn)
+
+	return nil
+}
+
+func (b *RedisBackend) xadd(msg Message) error {
+	args := []string{"XADD", b.Cfg.StreamKey}
+
+	if b.Cfg.MaxLen > 0 {
+		args = append(args, "MAXLEN")
+		if b.Cfg.ApproximateMaxLen {
+			args = append(args, "~")
+		}
+		args = append(args, strconv.FormatInt(b.Cfg.MaxLen, 10))
+	}
+
+	t := time.Now().UTC()
+	if msg.Time != nil {
+		t = msg.Time.UTC()
+	}
+
+	args = append(args, "*",
+		"time", t.Format(time.RFC3339Nano),
+		"level", string(msg.Level))
+
+	if msg.Level == LevelDebug {
+		args = append(args, "debug_level", strconv.Itoa(msg.DebugLevel))
+	}
+
+	if msg.domain != "" {
+		args = append(args, "domain", msg.domain)
+	}
+
+	args = append(args, "message", msg.Message)
+
+	if len(msg.Data) > 0 {
+		var buf bytes.Buffer
+		NewJSONEncoder(JSONEncoderCfg{}).encodeData(msg.Data, &buf)
+		args = append(args, "data", buf.String())
+	}
+
+	conn, err := b.getConn()
+	if err != nil {
+		return err
+	}
+
+	if _, err := conn.call(args, b.Cfg.Timeout); err != nil {
+		var redisErr redisError
+		if errors.As(err, &redisErr) {
+			// The connection is still usable
+			b.putConn(conn)
+		} else {
+			conn.conn.Close()
+		}
+
+		return fmt.Errorf("cannot add stream entry: %w", err)
+	}
+
+	b.putConn(conn)
+
+	return nil
+}
+
+func (b *RedisBackend) getConn() (*redisConn, error) {
+	select {
+	case conn := <-b.pool:
+		return conn, nil
+	default:
+	}
+
+	netConn, err := net.DialTimeout("tcp", b.Cfg.Addr, b.Cfg.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to redis: %w", err)
+	}
+
+	netConn = trackConn(string(BackendTypeRedis), netConn)
+
+	conn := &redisConn{
+		conn:   netConn,
+		reader: bufio.NewReader(netConn),
+	}
+
+	if b.Cfg.Password != "" {
+		args := []string{"AUTH", b.Cfg.Password}
+		if b.Cfg.Username != "" {
+			args = []string{"AUTH", b.Cfg.Username, b.Cfg.Password}
+		}
+
+		if _, err := conn.call(args, b.Cfg.Timeout); err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("cannot authenticate: %w", err)
+		}
+	}
+
+	if b.Cfg.DB != 0 {
+		args := []string{"SELECT", strconv.Itoa(b.Cfg.DB)}
+		if _, err := conn.call(args, b.Cfg.Timeout); err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("cannot select database: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+func (b *RedisBackend) putConn(conn *redisConn) {
+	select {
+	case b.pool <- conn:
+	default:
+		conn.conn.Close()
+	}
+}
+
+// https://redis.io/docs/reference/protocol-spec/
+func (c *redisConn) call(args []string, timeout time.Duration) (interface{}, error) {
+	var buf bytes.Buffer
+
+	buf.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n")
+		buf.WriteString(arg)
+		buf.WriteString("\r\n")
+	}
+
+	c.conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := c.conn.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return c.readReply()
+}
+
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("invalid reply line %q", line)
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+
+	case '-':
+		return nil, redisError(line[1:])
+
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid bulk string length %q", line)
+		} else if n < 0 {
+			return nil, nil
+		}
+
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+
+		return string(data[:n]), nil
+
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid array length %q", line)
+		} else if n < 0 {
+			return nil, nil
+		}
+
+		elements := make([]interface{}, n)
+		for i := 0; i < n; i++ {
+			element, err := c.readReply()
+			if err != nil {
+				return nil, err
+			}
+
+			elements[i] = element
+		}
+
+		return elements, nil
+
+	default:
+		return nil, fmt.Errorf("invalid reply line %q", line)
+	}
+}
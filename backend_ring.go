@@ -0,0 +1,70 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+// The ring backend keeps the last messages in memory. It is usually combined
+// with other backends, e.g. to log recent debug messages only when an error
+// occurs, or to expose them on a diagnostics endpoint.
+type RingBackendCfg struct {
+	Size int `json:"size"`
+}
+
+const DefaultRingBackendSize = 1000
+
+type RingBackend struct {
+	Cfg RingBackendCfg
+
+	ring *captureRing
+}
+
+func NewRingBackend(cfg RingBackendCfg) *RingBackend {
+	if cfg.Size <= 0 {
+		cfg.Size = DefaultRingBackendSize
+	}
+
+	return &RingBackend{
+		Cfg: cfg,
+
+		ring: newCaptureRing(cfg.Size),
+	}
+}
+
+func (b *RingBackend) Log(msg Message) {
+	b.ring.add(msg)
+}
+
+func (b *RingBackend) LogBatch(msgs []Message) {
+	b.ring.addBatch(msgs)
+}
+
+// Return the messages currently stored, oldest first.
+func (b *RingBackend) Snapshot() []Message {
+	return b.ring.snapshot()
+}
+
+// Return the messages currently stored, oldest first, and remove them.
+func (b *RingBackend) Drain() []Message {
+	return b.ring.drain()
+}
+
+// Remove the messages currently stored and send them to another backend.
+func (b *RingBackend) DrainTo(backend Backend) {
+	msgs := b.ring.drain()
+	if len(msgs) == 0 {
+		return
+	}
+
+	logBatch(backend, msgs)
+}
@@ -0,0 +1,414 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RotatingFileBackendCfg struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+
+	// The current file is rotated when writing a message would make it
+	// larger than the maximum size or when it is older than the maximum
+	// age. Rotated files are renamed with a timestamp suffix, followed by
+	// a sequence number if several files are rotated in the same
+	// millisecond.
+	MaxSize int64         `json:"max_size"`
+	MaxAge  time.Duration `json:"max_age"`
+
+	// The number of rotated files to keep. Zero means that all rotated
+	// files are kept.
+	MaxFiles int `json:"max_files"`
+
+	// Compress rotated files with gzip.
+	Compress bool `json:"compress"`
+
+	EncoderType EncoderType      `json:"encoder_type"`
+	EncoderData *json.RawMessage `json:"encoder,omitempty"`
+	Encoder     Encoder          `json:"-"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg RotatingFileBackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
+}
+
+const rotatedFileTimestampFormat = "20060102T150405.000"
+
+type RotatingFileBackend struct {
+	Cfg RotatingFileBackendCfg
+
+	mode          os.FileMode
+	encoder       Encoder
+	writeFailures *writeFailureReporter
+	sched         scheduler
+
+	mut      sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+
+	// Compression runs in the background
+	wg sync.WaitGroup
+}
+
+func NewRotatingFileBackend(cfg RotatingFileBackendCfg) (*RotatingFileBackend, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("missing or empty path")
+	}
+
+	mode, err := parseFileMode(cfg.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	encoder, err := newFileEncoder(cfg.Encoder, cfg.EncoderType,
+		cfg.EncoderData)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &RotatingFileBackend{
+		Cfg: cfg,
+
+		mode:    mode,
+		encoder: encoder,
+		writeFailures: newWriteFailureReporter(BackendTypeRotatingFile,
+			cfg.Path, cfg.WriteFailures),
+		sched: getScheduler(),
+	}
+
+	if err := b.open(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (b *RotatingFileBackend) Log(msg Message) {
+	b.LogBatch([]Message{msg})
+}
+
+func (b *RotatingFileBackend) LogBatch(msgs []Message) {
+	var buf bytes.Buffer
+
+	for _, msg := range msgs {
+		start := buf.Len()
+
+		err := b.encoder.EncodeMessage(msg, &buf)
+		if err != nil {
+			buf.Truncate(start)
+
+			err2 := fmt.Errorf("cannot encode message: %w", err)
+			b.writeFailures.failure(err2)
+			continue
+		}
+
+		buf.WriteByte('\n')
+	}
+
+	if err := b.write(buf.Bytes()); err != nil {
+		b.writeFailures.failureMessages(err, msgs)
+	} else {
+		b.writeFailures.success()
+	}
+}
+
+func (b *RotatingFileBackend) write(data []byte) error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if b.file == nil {
+		if err := b.open(); err != nil {
+			return err
+		}
+	}
+
+	if b.mustRotate(int64(len(data))) {
+		if err := b.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := b.file.Write(data)
+	b.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("cannot write %q: %w", b.Cfg.Path, err)
+	}
+
+	return nil
+}
+
+// Wait for pending compressions and close the current file.
+func (b *RotatingFileBackend) Close() error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	b.wg.Wait()
+
+	if b.file == nil {
+		return nil
+	}
+
+	err := b.file.Close()
+	b.file = nil
+
+	return err
+}
+
+// The function is unsafe and MUST be called with b.mut held, or during
+// initialization.
+func (b *RotatingFileBackend) open() error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+
+	file, err := os.OpenFile(b.Cfg.Path, flags, b.mode)
+	if err != nil {
+		return fmt.Errorf("cannot open %q: %w", b.Cfg.Path, err)
+	}
+
+	if err := writeFileHeader(file, b.encoder); err != nil {
+		file.Close()
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("cannot stat %q: %w", b.Cfg.Path, err)
+	}
+
+	b.file = file
+	b.size = info.Size()
+	b.openedAt = b.sched.now()
+
+	return nil
+}
+
+// The function is unsafe and MUST be called with b.mut held.
+func (b *RotatingFileBackend) mustRotate(n int64) bool {
+	if b.Cfg.MaxSize > 0 && b.size > 0 && b.size+n > b.Cfg.MaxSize {
+		return true
+	}
+
+	if b.Cfg.MaxAge > 0 && b.sched.now().Sub(b.openedAt) >= b.Cfg.MaxAge {
+		return true
+	}
+
+	return false
+}
+
+// The function is unsafe and MUST be called with b.mut held.
+func (b *RotatingFileBackend) rotate() error {
+	if err := b.file.Close(); err != nil {
+		return fmt.Errorf("cannot close %q: %w", b.Cfg.Path, err)
+	}
+	b.file = nil
+
+	rotatedPath, err := b.rotatedPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(b.Cfg.Path, rotatedPath); err != nil {
+		return fmt.Errorf("cannot rename %q: %w", b.Cfg.Path, err)
+	}
+
+	if err := b.open(); err != nil {
+		return err
+	}
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		defer trackGoroutine(string(BackendTypeRotatingFile))()
+
+		if b.Cfg.Compress {
+			if err := compressFile(rotatedPath); err != nil {
+				b.writeFailures.failure(err)
+			}
+		}
+
+		if err := b.deleteOldFiles(); err != nil {
+			b.writeFailures.failure(err)
+		}
+	}()
+
+	return nil
+}
+
+// Return a path for the file being rotated which is not used by another
+// rotated file, compressed or not.
+func (b *RotatingFileBackend) rotatedPath() (string, error) {
+	timestamp := b.sched.now().UTC().Format(rotatedFileTimestampFormat)
+	basePath := b.Cfg.Path + "." + timestamp
+
+	path := basePath
+
+	for seq := 1; ; seq++ {
+		used := false
+
+		for _, p := range []string{path, path + ".gz"} {
+			if _, err := os.Lstat(p); err == nil {
+				used = true
+			} else if !os.IsNotExist(err) {
+				return "", fmt.Errorf("cannot stat %q: %w", p, err)
+			}
+		}
+
+		if !used {
+			return path, nil
+		}
+
+		path = basePath + "-" + strconv.Itoa(seq)
+	}
+}
+
+type rotatedFile struct {
+	path      string
+	timestamp time.Time
+	seq       int
+}
+
+// Parse the suffix of a rotated file, i.e. a timestamp optionally followed
+// by a sequence number.
+func parseRotatedFileSuffix(suffix string) (time.Time, int, bool) {
+	seq := 0
+
+	if idx := strings.IndexByte(suffix, '-'); idx >= 0 {
+		i, err := strconv.Atoi(suffix[idx+1:])
+		if err != nil || i <= 0 {
+			return time.Time{}, 0, false
+		}
+
+		seq = i
+		suffix = suffix[:idx]
+	}
+
+	t, err := time.Parse(rotatedFileTimestampFormat, suffix)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+
+	return t, seq, true
+}
+
+func (b *RotatingFileBackend) deleteOldFiles() error {
+	if b.Cfg.MaxFiles <= 0 {
+		return nil
+	}
+
+	paths, err := filepath.Glob(b.Cfg.Path + ".*")
+	if err != nil {
+		return fmt.Errorf("cannot list rotated files: %w", err)
+	}
+
+	// Note that temporary files created during compression are ignored
+	// since their suffix is not a timestamp.
+	var files []rotatedFile
+	for _, path := range paths {
+		suffix := strings.TrimPrefix(path, b.Cfg.Path+".")
+		suffix = strings.TrimSuffix(suffix, ".gz")
+
+		timestamp, seq, ok := parseRotatedFileSuffix(suffix)
+		if !ok {
+			continue
+		}
+
+		files = append(files, rotatedFile{path, timestamp, seq})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].timestamp.Equal(files[j].timestamp) {
+			return files[i].timestamp.Before(files[j].timestamp)
+		}
+
+		return files[i].seq < files[j].seq
+	})
+
+	for len(files) > b.Cfg.MaxFiles {
+		// Files can be deleted concurrently by the goroutine of another
+		// rotation.
+		err := os.Remove(files[0].path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cannot delete %q: %w", files[0].path, err)
+		}
+
+		files = files[1:]
+	}
+
+	return nil
+}
+
+func compressFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot open %q: %w", path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("cannot stat %q: %w", path, err)
+	}
+
+	tmpPath := path + ".gz.tmp"
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	gzFile, err := os.OpenFile(tmpPath, flags, info.Mode())
+	if err != nil {
+		return fmt.Errorf("cannot create %q: %w", tmpPath, err)
+	}
+	defer os.Remove(tmpPath)
+	defer gzFile.Close()
+
+	writer := gzip.NewWriter(gzFile)
+
+	if _, err := io.Copy(writer, file); err != nil {
+		return fmt.Errorf("cannot compress %q: %w", path, err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("cannot compress %q: %w", path, err)
+	}
+
+	if err := gzFile.Close(); err != nil {
+		return fmt.Errorf("cannot close %q: %w", tmpPath, err)
+	}
+
+	if err := os.Rename(tmpPath, path+".gz"); err != nil {
+		return fmt.Errorf("cannot rename %q: %w", tmpPath, err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("cannot delete %q: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log_test
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-log"
+)
+
+func newTestRotatingFile(t *testing.T, cfg log.RotatingFileBackendCfg) (*log.RotatingFileBackend, *log.SimScheduler) {
+	sched := log.NewSimScheduler(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	t.Cleanup(log.SetSimScheduler(sched))
+
+	cfg.Path = filepath.Join(t.TempDir(), "test.log")
+
+	backend, err := log.NewRotatingFileBackend(cfg)
+	if err != nil {
+		t.Fatalf("cannot create rotating file backend: %v", err)
+	}
+
+	t.Cleanup(func() { backend.Close() })
+
+	return backend, sched
+}
+
+// Return the content of the rotated files, oldest first, decompressing them
+// if necessary. Compressed files are reported with a ".gz" suffix.
+func readRotatedFiles(t *testing.T, path string) ([]string, []string) {
+	paths, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatalf("cannot list rotated files: %v", err)
+	}
+
+	// Files rotated in the same millisecond have a sequence number
+	sort.Slice(paths, func(i, j int) bool {
+		if len(paths[i]) != len(paths[j]) {
+			return len(paths[i]) < len(paths[j])
+		}
+
+		return paths[i] < paths[j]
+	})
+
+	var names, contents []string
+
+	for _, p := range paths {
+		file, err := os.Open(p)
+		if err != nil {
+			t.Fatalf("cannot open %q: %v", p, err)
+		}
+
+		var r io.Reader = file
+
+		if strings.HasSuffix(p, ".gz") {
+			zr, err := gzip.NewReader(file)
+			if err != nil {
+				t.Fatalf("cannot decompress %q: %v", p, err)
+			}
+
+			r = zr
+		}
+
+		data, err := io.ReadAll(r)
+		file.Close()
+		if err != nil {
+			t.Fatalf("cannot read %q: %v", p, err)
+		}
+
+		names = append(names, strings.TrimPrefix(p, path))
+		contents = append(contents, string(data))
+	}
+
+	return names, contents
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cannot read %q: %v", path, err)
+	}
+
+	return string(data)
+}
+
+func TestRotatingFileBackendSize(t *testing.T) {
+	backend, _ := newTestRotatingFile(t, log.RotatingFileBackendCfg{
+		MaxSize: 200,
+	})
+
+	padding := strings.Repeat("x", 100)
+
+	for i := 0; i < 200; i++ {
+		backend.Log(log.Message{
+			Level:   log.LevelInfo,
+			Message: fmt.Sprintf("message %03d %s", i, padding),
+		})
+	}
+
+	backend.Close()
+
+	// All files were rotated in the same virtual millisecond, none of them
+	// may have been overwritten.
+	_, contents := readRotatedFiles(t, backend.Cfg.Path)
+	contents = append(contents, readFile(t, backend.Cfg.Path))
+
+	if len(contents) != 200 {
+		t.Fatalf("expected 200 files, got %d", len(contents))
+	}
+
+	for i, content := range contents {
+		if !strings.Contains(content, fmt.Sprintf("message %03d ", i)) ||
+			strings.Count(content, "\n") != 1 {
+			t.Errorf("file %d does not contain message %d: %q", i, i, content)
+		}
+	}
+}
+
+func TestRotatingFileBackendAge(t *testing.T) {
+	backend, sched := newTestRotatingFile(t, log.RotatingFileBackendCfg{
+		MaxAge: time.Hour,
+	})
+
+	logTestMessages(backend, 0, 2)
+
+	sched.Advance(30 * time.Minute)
+	logTestMessages(backend, 2, 3)
+
+	if names, _ := readRotatedFiles(t, backend.Cfg.Path); len(names) != 0 {
+		t.Fatalf("file rotated before the maximum age: %v", names)
+	}
+
+	sched.Advance(30 * time.Minute)
+	logTestMessages(backend, 3, 4)
+
+	backend.Close()
+
+	names, contents := readRotatedFiles(t, backend.Cfg.Path)
+	if expected := []string{".20220101T010000.000"}; !reflect.DeepEqual(names,
+		expected) {
+		t.Fatalf("expected rotated files %v, got %v", expected, names)
+	}
+
+	if n := strings.Count(contents[0], "\n"); n != 3 {
+		t.Errorf("expected 3 messages in the rotated file, got %d", n)
+	}
+
+	if content := readFile(t, backend.Cfg.Path); !strings.Contains(content,
+		"m3") {
+		t.Errorf("missing last message in the current file: %q", content)
+	}
+}
+
+func TestRotatingFileBackendMaxFiles(t *testing.T) {
+	backend, sched := newTestRotatingFile(t, log.RotatingFileBackendCfg{
+		MaxSize:  1,
+		MaxFiles: 3,
+	})
+
+	for i := 0; i < 10; i++ {
+		logTestMessages(backend, i, i+1)
+		sched.Advance(time.Second)
+	}
+
+	backend.Close()
+
+	names, contents := readRotatedFiles(t, backend.Cfg.Path)
+
+	// Each file is rotated when the next message is written
+	expected := []string{".20220101T000007.000", ".20220101T000008.000",
+		".20220101T000009.000"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected rotated files %v, got %v", expected, names)
+	}
+
+	for i, content := range contents {
+		if msg := fmt.Sprintf("m%d", i+6); !strings.Contains(content, msg) {
+			t.Errorf("rotated file %s does not contain %s: %q", names[i],
+				msg, content)
+		}
+	}
+}
+
+func TestRotatingFileBackendCompression(t *testing.T) {
+	backend, sched := newTestRotatingFile(t, log.RotatingFileBackendCfg{
+		MaxSize:  1,
+		Compress: true,
+	})
+
+	for i := 0; i < 3; i++ {
+		logTestMessages(backend, i, i+1)
+		sched.Advance(time.Second)
+	}
+
+	backend.Close()
+
+	names, contents := readRotatedFiles(t, backend.Cfg.Path)
+
+	expected := []string{".20220101T000001.000.gz", ".20220101T000002.000.gz"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected rotated files %v, got %v", expected, names)
+	}
+
+	for i, content := range contents {
+		if msg := fmt.Sprintf("m%d", i); !strings.Contains(content, msg) {
+			t.Errorf("rotated file %s does not contain %s: %q", names[i],
+				msg, content)
+		}
+	}
+}
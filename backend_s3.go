@@ -0,0 +1,441 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The S3 backend accumulates messages, encoded as JSON lines, into gzip
+// compressed chunks which are uploaded as objects to S3 or to an
+// S3-compatible storage service. It is meant for cheap long-term retention;
+// messages are only uploaded once a chunk is complete.
+type S3BackendCfg struct {
+	// The endpoint is https://s3.<region>.amazonaws.com by default. Most
+	// S3-compatible services require path-style addressing.
+	Endpoint  string `json:"endpoint"`
+	Region    string `json:"region"`
+	Bucket    string `json:"bucket"`
+	PathStyle bool   `json:"path_style"`
+
+	// Credentials are read from the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY
+	// and AWS_SESSION_TOKEN environment variables if they are not set.
+	AccessKeyId     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	SessionToken    string `json:"session_token"`
+
+	// The key of each object is built from the template: "{hostname}" is
+	// replaced by the hostname, "{id}" by a random identifier, and time
+	// layouts between curly braces (see the time package) are replaced
+	// using the time the chunk was started.
+	KeyTemplate string `json:"key_template"`
+	Hostname    string `json:"hostname"`
+
+	StorageClass string `json:"storage_class"`
+
+	// A chunk is uploaded when its uncompressed size reaches the maximum
+	// size or when it is older than the upload interval.
+	MaxChunkSize   int           `json:"max_chunk_size"`
+	UploadInterval time.Duration `json:"upload_interval"`
+
+	// The maximum number of chunks waiting to be uploaded; new chunks are
+	// dropped when the limit is reached.
+	MaxPendingChunks int `json:"max_pending_chunks"`
+
+	Timeout time.Duration `json:"timeout"`
+
+	MaxRetries     int           `json:"max_retries"`
+	InitialBackoff time.Duration `json:"initial_backoff"`
+	MaxBackoff     time.Duration `json:"max_backoff"`
+
+	Encoder JSONEncoderCfg `json:"encoder"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg S3BackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
+}
+
+const (
+	DefaultS3KeyTemplate    = "{2006/01/02}/{hostname}-{150405}-{id}.jsonl.gz"
+	DefaultS3MaxChunkSize   = 16 * 1024 * 1024
+	DefaultS3UploadInterval = 5 * time.Minute
+)
+
+type S3Backend struct {
+	Cfg S3BackendCfg
+
+	endpoint      *url.URL
+	credentials   awsCredentials
+	client        *http.Client
+	encoder       *JSONEncoder
+	writeFailures *writeFailureReporter
+	sched         scheduler
+
+	mut    sync.Mutex
+	chunk  *s3Chunk
+	closed bool
+
+	chunks     chan *s3Chunk
+	flushes    chan chan struct{}
+	stopChan   chan struct{}
+	wg         sync.WaitGroup
+	stopTicker func()
+}
+
+type s3Chunk struct {
+	start time.Time
+	size  int
+	buf   bytes.Buffer
+	zw    *gzip.Writer
+}
+
+func NewS3Backend(cfg S3BackendCfg) (*S3Backend, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("missing or empty bucket")
+	}
+
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_REGION")
+		if cfg.Region == "" {
+			return nil, fmt.Errorf("missing or empty region")
+		}
+	}
+
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %w", err)
+	}
+
+	credentials := awsCredentials{
+		AccessKeyId:     cfg.AccessKeyId,
+		SecretAccessKey: cfg.SecretAccessKey,
+		SessionToken:    cfg.SessionToken,
+	}
+
+	if credentials.AccessKeyId == "" {
+		credentials.AccessKeyId = os.Getenv("AWS_ACCESS_KEY_ID")
+		credentials.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		credentials.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+
+	if credentials.AccessKeyId == "" || credentials.SecretAccessKey == "" {
+		return nil, fmt.Errorf("missing credentials")
+	}
+
+	if cfg.KeyTemplate == "" {
+		cfg.KeyTemplate = DefaultS3KeyTemplate
+	}
+
+	if cfg.Hostname == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("cannot obtain hostname: %w", err)
+		}
+
+		cfg.Hostname = hostname
+	}
+
+	if cfg.MaxChunkSize <= 0 {
+		cfg.MaxChunkSize = DefaultS3MaxChunkSize
+	}
+
+	if cfg.UploadInterval <= 0 {
+		cfg.UploadInterval = DefaultS3UploadInterval
+	}
+
+	if cfg.MaxPendingChunks <= 0 {
+		cfg.MaxPendingChunks = 4
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Minute
+	}
+
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 5
+	}
+
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 500 * time.Millisecond
+	}
+
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+
+	b := &S3Backend{
+		Cfg: cfg,
+
+		endpoint:    endpoint,
+		credentials: credentials,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+		encoder: NewJSONEncoder(cfg.Encoder),
+		writeFailures: newWriteFailureReporter(BackendTypeS3,
+			endpoint.Host+"/"+cfg.Bucket, cfg.WriteFailures),
+		sched: getScheduler(),
+
+		chunks:   make(chan *s3Chunk, cfg.MaxPendingChunks),
+		flushes:  make(chan chan struct{}),
+		stopChan: make(chan struct{}),
+	}
+
+	b.wg.Add(1)
+	go b.uploader()
+
+	_, b.stopTicker = b.sched.loop(string(BackendTypeS3),
+		cfg.UploadInterval/10, b.rotateExpiredChunk)
+
+	return b, nil
+}
+
+func (b *S3Backend) Log(msg Message) {
+	var line bytes.Buffer
+	b.encoder.EncodeMessage(msg, &line)
+	line.WriteByte('\n')
+
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	if b.chunk == nil {
+		b.chunk = newS3Chunk(b.sched.now())
+	}
+
+	b.chunk.zw.Write(line.Bytes())
+	b.chunk.size += line.Len()
+
+	if b.chunk.size >= b.Cfg.MaxChunkSize {
+		b.rotate()
+	}
+}
+
+// Upload the current chunk and wait for all pending chunks to be uploaded.
+func (b *S3Backend) Flush() error {
+	b.mut.Lock()
+	if b.closed {
+		b.mut.Unlock()
+		return nil
+	}
+	b.rotate()
+	b.mut.Unlock()
+
+	b.waitForUploads()
+
+	return nil
+}
+
+// Upload all pending messages and stop the backend.
+func (b *S3Backend) Close() error {
+	b.mut.Lock()
+	if b.closed {
+		b.mut.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.rotate()
+	b.mut.Unlock()
+
+	b.stopTicker()
+	b.waitForUploads()
+
+	close(b.stopChan)
+	b.wg.Wait()
+
+	return nil
+}
+
+// Check that the server accepts connections.
+func (b *S3Backend) Probe() error {
+	return probeURL(b.endpoint.String(), b.Cfg.Timeout)
+}
+
+func (b *S3Backend) waitForUploads() {
+	done := make(chan struct{})
+
+	select {
+	case b.flushes <- done:
+		<-done
+
+	case <-b.stopChan:
+		// The backend was closed concurrently and all chunks were uploaded.
+	}
+}
+
+func newS3Chunk(now time.Time) *s3Chunk {
+	c := &s3Chunk{
+		start: now.UTC(),
+	}
+
+	c.zw = gzip.NewWriter(&c.buf)
+
+	return c
+}
+
+// The function is unsafe and MUST be called with b.mut held.
+func (b *S3Backend) rotate() {
+	chunk := b.chunk
+	if chunk == nil {
+		return
+	}
+
+	b.chunk = nil
+
+	chunk.zw.Close()
+
+	select {
+	case b.chunks <- chunk:
+	default:
+		err := fmt.Errorf("chunk of %d bytes dropped because too many "+
+			"chunks were pending", chunk.size)
+		b.writeFailures.failure(err)
+	}
+}
+
+func (b *S3Backend) rotateExpiredChunk() {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if b.chunk != nil &&
+		b.sched.now().Sub(b.chunk.start) >= b.Cfg.UploadInterval {
+		b.rotate()
+	}
+}
+
+func (b *S3Backend) uploader() {
+	defer b.wg.Done()
+	defer trackGoroutine(string(BackendTypeS3))()
+
+	for {
+		select {
+		case <-b.stopChan:
+			return
+
+		case chunk := <-b.chunks:
+			b.upload(chunk)
+
+		case done := <-b.flushes:
+			// Chunks are queued before the flush request is sent, so all
+			// chunks to flush are already in the channel.
+			for pending := true; pending; {
+				select {
+				case chunk := <-b.chunks:
+					b.upload(chunk)
+				default:
+					pending = false
+				}
+			}
+
+			close(done)
+		}
+	}
+}
+
+func (b *S3Backend) upload(chunk *s3Chunk) {
+	key := b.objectKey(chunk.start)
+	body := chunk.buf.Bytes()
+
+	for attempt := 1; ; attempt++ {
+		retry, err := b.putObject(key, body)
+		if err == nil {
+			b.writeFailures.success()
+			return
+		}
+
+		if !retry || attempt > b.Cfg.MaxRetries {
+			b.writeFailures.failure(err)
+			return
+		}
+
+		b.sched.sleep(retryDelay(attempt, b.Cfg.InitialBackoff,
+			b.Cfg.MaxBackoff))
+	}
+}
+
+func (b *S3Backend) objectKey(t time.Time) string {
+	key := strings.NewReplacer("{hostname}", b.Cfg.Hostname,
+		"{id}", generateId()).Replace(b.Cfg.KeyTemplate)
+
+	return expandTimeTemplate(key, t)
+}
+
+// Upload an object and indicate whether it can be retried in case of
+// failure.
+func (b *S3Backend) putObject(key string, body []byte) (bool, error) {
+	endpoint := *b.endpoint
+
+	path := "/" + awsURIEncode(key, false)
+	if b.Cfg.PathStyle {
+		path = "/" + awsURIEncode(b.Cfg.Bucket, true) + path
+	} else {
+		endpoint.Host = b.Cfg.Bucket + "." + endpoint.Host
+	}
+
+	uri := strings.TrimSuffix(endpoint.String(), "/") + path
+
+	req, err := http.NewRequest("PUT", uri, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("cannot create http request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/gzip")
+
+	if b.Cfg.StorageClass != "" {
+		req.Header.Set("X-Amz-Storage-Class", b.Cfg.StorageClass)
+	}
+
+	signAWSRequest(req, sha256Hex(body), b.credentials, b.Cfg.Region, "s3",
+		time.Now())
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("cannot send http request: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return true, fmt.Errorf("cannot read http response: %w", err)
+	}
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+
+	err = fmt.Errorf("cannot upload object %q: request failed with "+
+		"status %d: %s", key, res.StatusCode, bytes.TrimSpace(resBody))
+
+	return res.StatusCode == 429 || res.StatusCode >= 500, err
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"time"
+)
+
+// The sampling backend decorates another backend, only writing a sample of
+// messages of selected levels, e.g. to keep representative debug messages
+// without drowning the backend. Sampling works as for loggers (see
+// SamplingCfg): for each period, the first messages are kept, then one
+// message out of n. Setting First to 0 keeps one message out of n, while
+// setting Thereafter to 0 keeps at most First messages per period.
+type SamplingBackendCfg struct {
+	// The backend messages are written to, when the sampling backend is
+	// created from a configuration.
+	Backend BackendCfg `json:"backend"`
+
+	// The sampling configuration of each level. Messages whose level is not
+	// listed are always written.
+	Levels map[Level]SamplingCfg `json:"levels"`
+}
+
+type SamplingBackend struct {
+	Cfg     SamplingBackendCfg
+	Backend Backend
+
+	samplers map[Level]*sampler
+}
+
+func NewSamplingBackend(backend Backend, cfg SamplingBackendCfg) (*SamplingBackend, error) {
+	if backend == nil {
+		return nil, fmt.Errorf("missing backend")
+	}
+
+	samplers := make(map[Level]*sampler)
+
+	for level, samplingCfg := range cfg.Levels {
+		sampler, err := newSampler(samplingCfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sampling configuration for "+
+				"level %q: %w", level, err)
+		}
+
+		samplers[level] = sampler
+	}
+
+	b := &SamplingBackend{
+		Cfg:     cfg,
+		Backend: backend,
+
+		samplers: samplers,
+	}
+
+	return b, nil
+}
+
+func (b *SamplingBackend) Log(msg Message) {
+	if !b.sample(msg, time.Now()) {
+		return
+	}
+
+	b.Backend.Log(msg)
+}
+
+func (b *SamplingBackend) LogBatch(msgs []Message) {
+	now := time.Now()
+
+	sampled := make([]Message, 0, len(msgs))
+	for _, msg := range msgs {
+		if b.sample(msg, now) {
+			sampled = append(sampled, msg)
+		}
+	}
+
+	if len(sampled) == 0 {
+		return
+	}
+
+	logBatch(b.Backend, sampled)
+}
+
+func (b *SamplingBackend) Flush() error {
+	if flusher, ok := b.Backend.(interface{ Flush() error }); ok {
+		return flusher.Flush()
+	}
+
+	return nil
+}
+
+func (b *SamplingBackend) Close() error {
+	if closer, ok := b.Backend.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+func (b *SamplingBackend) sample(msg Message, now time.Time) bool {
+	sampler, found := b.samplers[msg.Level]
+	if !found {
+		return true
+	}
+
+	return sampler.sample(msg, msg.domain, now)
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-log"
+	"github.com/exograd/go-log/logtest"
+)
+
+func TestSamplingBackend(t *testing.T) {
+	backend := logtest.NewBackend()
+
+	sampling, err := log.NewSamplingBackend(backend, log.SamplingBackendCfg{
+		Levels: map[log.Level]log.SamplingCfg{
+			log.LevelDebug: {
+				Interval:   time.Hour,
+				First:      2,
+				Thereafter: 3,
+			},
+			log.LevelInfo: {
+				Interval: time.Hour,
+				First:    1,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot create sampling backend: %v", err)
+	}
+
+	var kept []int
+	for i := 0; i < 10; i++ {
+		sampling.Log(log.Message{Level: log.LevelDebug, Message: "debug"})
+
+		if len(backend.Entries()) > len(kept) {
+			kept = append(kept, i)
+		}
+	}
+
+	if expected := []int{0, 1, 4, 7}; !reflect.DeepEqual(kept, expected) {
+		t.Errorf("expected debug messages %v to be kept, got %v", expected,
+			kept)
+	}
+
+	backend.Reset()
+
+	sampling.LogBatch([]log.Message{
+		{Level: log.LevelInfo, Message: "info"},
+		{Level: log.LevelInfo, Message: "info"},
+		{Level: log.LevelError, Message: "error"},
+		{Level: log.LevelError, Message: "error"},
+	})
+
+	expected := []string{"info", "error", "error"}
+	if texts := messageTexts(backend.Entries()); !reflect.DeepEqual(texts,
+		expected) {
+		t.Errorf("expected messages %v, got %v", expected, texts)
+	}
+}
+
+func TestSamplingBackendInvalidCfg(t *testing.T) {
+	_, err := log.NewSamplingBackend(logtest.NewBackend(),
+		log.SamplingBackendCfg{
+			Levels: map[log.Level]log.SamplingCfg{
+				log.LevelDebug: {First: -1},
+			},
+		})
+	if err == nil {
+		t.Errorf("invalid sampling configuration was accepted")
+	}
+}
@@ -0,0 +1,447 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The Sentry backend sends error messages to Sentry as events, with message
+// data as extra context. Messages with lower levels are not sent but kept as
+// breadcrumbs, which are attached to the next event. Events are sent by a
+// separate goroutine.
+//
+// If a message contains a datum of type Stack, it is used as the stack trace
+// of the event. Otherwise the stack trace of the logging call is attached to
+// the event if AttachStackTrace is set. Events are grouped by the aggregation
+// key of their message (see AggregationKey).
+type SentryBackendCfg struct {
+	// The DSN, e.g. "https://<key>@o0.ingest.sentry.io/<project-id>".
+	DSN string `json:"dsn"`
+
+	Environment string `json:"environment"`
+	Release     string `json:"release"`
+	ServerName  string `json:"server_name"`
+
+	AttachStackTrace bool `json:"attach_stack_trace"`
+
+	// The number of breadcrumbs kept, 100 by default.
+	MaxBreadcrumbs int `json:"max_breadcrumbs"`
+
+	// The number of events waiting to be sent, 100 by default. Events are
+	// dropped when the queue is full.
+	QueueSize int `json:"queue_size"`
+
+	Timeout time.Duration `json:"timeout"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg SentryBackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
+}
+
+type SentryBackend struct {
+	Cfg SentryBackendCfg
+
+	envelopeURI   string
+	authHeader    string
+	client        *http.Client
+	writeFailures *writeFailureReporter
+
+	breadcrumbsMut sync.Mutex
+	breadcrumbs    []Message
+
+	eventsMut sync.Mutex
+	events    chan []byte
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+func NewSentryBackend(cfg SentryBackendCfg) (*SentryBackend, error) {
+	if cfg.DSN == "" {
+		return nil, fmt.Errorf("missing or empty dsn")
+	}
+
+	dsn, err := url.Parse(cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dsn: %w", err)
+	}
+
+	if dsn.User == nil || dsn.User.Username() == "" {
+		return nil, fmt.Errorf("invalid dsn: missing public key")
+	}
+
+	idx := strings.LastIndexByte(dsn.Path, '/')
+	projectId := dsn.Path[idx+1:]
+	if projectId == "" {
+		return nil, fmt.Errorf("invalid dsn: missing project id")
+	}
+
+	if cfg.ServerName == "" {
+		cfg.ServerName, _ = os.Hostname()
+	}
+
+	if cfg.MaxBreadcrumbs <= 0 {
+		cfg.MaxBreadcrumbs = 100
+	}
+
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 100
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	envelopeURI := url.URL{
+		Scheme: dsn.Scheme,
+		Host:   dsn.Host,
+		Path:   dsn.Path[:idx] + "/api/" + projectId + "/envelope/",
+	}
+
+	b := &SentryBackend{
+		Cfg: cfg,
+
+		envelopeURI: envelopeURI.String(),
+		authHeader: "Sentry sentry_version=7, sentry_client=go-log, " +
+			"sentry_key=" + dsn.User.Username(),
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+		writeFailures: newWriteFailureReporter(BackendTypeSentry,
+			dsn.Host, cfg.WriteFailures),
+
+		events: make(chan []byte, cfg.QueueSize),
+	}
+
+	b.wg.Add(1)
+	go b.main()
+
+	return b, nil
+}
+
+func (b *SentryBackend) Log(msg Message) {
+	if msg.Level != LevelError {
+		b.addBreadcrumb(msg)
+		return
+	}
+
+	b.breadcrumbsMut.Lock()
+	breadcrumbs := b.breadcrumbs
+	b.breadcrumbs = nil
+	b.breadcrumbsMut.Unlock()
+
+	var stack Stack
+	for _, datum := range msg.Data {
+		if s, ok := datum.(Stack); ok {
+			stack = s
+			break
+		}
+	}
+
+	if stack == nil && b.Cfg.AttachStackTrace {
+		stack = callerStack()
+	}
+
+	var buf bytes.Buffer
+	b.encodeEnvelope(msg, breadcrumbs, stack, &buf)
+
+	b.eventsMut.Lock()
+	defer b.eventsMut.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	select {
+	case b.events <- buf.Bytes():
+	default:
+		b.writeFailures.failure(fmt.Errorf("event dropped because too " +
+			"many events are waiting to be sent"))
+	}
+}
+
+// Send all pending events and stop the backend.
+func (b *SentryBackend) Close() error {
+	b.eventsMut.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.events)
+	}
+	b.eventsMut.Unlock()
+
+	b.wg.Wait()
+
+	return nil
+}
+
+// Check that the server accepts connections.
+func (b *SentryBackend) Probe() error {
+	return probeURL(b.envelopeURI, b.Cfg.Timeout)
+}
+
+func (b *SentryBackend) addBreadcrumb(msg Message) {
+	b.breadcrumbsMut.Lock()
+	defer b.breadcrumbsMut.Unlock()
+
+	if len(b.breadcrumbs) >= b.Cfg.MaxBreadcrumbs {
+		n := copy(b.breadcrumbs, b.breadcrumbs[1:])
+		b.breadcrumbs = b.breadcrumbs[:n]
+	}
+
+	b.breadcrumbs = append(b.breadcrumbs, msg)
+}
+
+func (b *SentryBackend) main() {
+	defer b.wg.Done()
+	defer trackGoroutine(string(BackendTypeSentry))()
+
+	for envelope := range b.events {
+		if err := b.send(envelope); err != nil {
+			b.writeFailures.failure(err)
+		} else {
+			b.writeFailures.success()
+		}
+	}
+}
+
+func (b *SentryBackend) send(envelope []byte) error {
+	req, err := http.NewRequest("POST", b.envelopeURI,
+		bytes.NewReader(envelope))
+	if err != nil {
+		return fmt.Errorf("cannot create http request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", b.authHeader)
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot send http request: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("request failed with status %d: %s",
+			res.StatusCode, bytes.TrimSpace(resBody))
+	}
+
+	return nil
+}
+
+// https://develop.sentry.dev/sdk/envelopes/
+func (b *SentryBackend) encodeEnvelope(msg Message, breadcrumbs []Message,
+	stack Stack, buf *bytes.Buffer) {
+	var id [16]byte
+	randomBytes(id[:])
+	eventId := hex.EncodeToString(id[:])
+
+	t := time.Now()
+	if msg.Time != nil {
+		t = *msg.Time
+	}
+
+	buf.WriteString(`{"event_id":"` + eventId + `","sent_at":`)
+	writeJSONString(buf, time.Now().UTC().Format(time.RFC3339Nano))
+	buf.WriteString("}\n")
+
+	buf.WriteString(`{"type":"event"}` + "\n")
+
+	// https://develop.sentry.dev/sdk/event-payloads/
+	buf.WriteString(`{"event_id":"` + eventId + `","platform":"go"`)
+	buf.WriteString(`,"level":"error","timestamp":`)
+	writeSentryTimestamp(buf, t)
+
+	field := func(key, value string) {
+		if value == "" {
+			return
+		}
+
+		buf.WriteString(`,"` + key + `":`)
+		writeJSONString(buf, value)
+	}
+
+	field("logger", msg.domain)
+	field("server_name", b.Cfg.ServerName)
+	field("environment", b.Cfg.Environment)
+	field("release", b.Cfg.Release)
+
+	buf.WriteString(`,"message":{"formatted":`)
+	writeJSONString(buf, msg.Message)
+	buf.WriteByte('}')
+
+	if key := messageAggregationKey(msg); key != "" {
+		buf.WriteString(`,"fingerprint":[`)
+		writeJSONString(buf, key)
+		buf.WriteByte(']')
+	}
+
+	if len(msg.Data) > 0 {
+		buf.WriteString(`,"extra":`)
+		writeSentryData(buf, msg.Data)
+	}
+
+	if len(stack) > 0 {
+		buf.WriteString(`,"exception":{"values":[{"type":`)
+		writeJSONString(buf, msg.Message)
+		buf.WriteString(`,"stacktrace":`)
+		writeSentryStack(buf, stack)
+		buf.WriteString("}]}")
+	}
+
+	if len(breadcrumbs) > 0 {
+		buf.WriteString(`,"breadcrumbs":{"values":[`)
+
+		for i, breadcrumb := range breadcrumbs {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			writeSentryBreadcrumb(buf, breadcrumb)
+		}
+
+		buf.WriteString("]}")
+	}
+
+	buf.WriteString("}\n")
+}
+
+func writeSentryBreadcrumb(buf *bytes.Buffer, msg Message) {
+	t := time.Now()
+	if msg.Time != nil {
+		t = *msg.Time
+	}
+
+	buf.WriteString(`{"timestamp":`)
+	writeSentryTimestamp(buf, t)
+
+	buf.WriteString(`,"level":`)
+	writeJSONString(buf, string(msg.Level))
+
+	if msg.domain != "" {
+		buf.WriteString(`,"category":`)
+		writeJSONString(buf, msg.domain)
+	}
+
+	buf.WriteString(`,"message":`)
+	writeJSONString(buf, msg.Message)
+
+	if len(msg.Data) > 0 {
+		buf.WriteString(`,"data":`)
+		writeSentryData(buf, msg.Data)
+	}
+
+	buf.WriteByte('}')
+}
+
+func writeSentryTimestamp(buf *bytes.Buffer, t time.Time) {
+	seconds := float64(t.UnixNano()) / 1e9
+	buf.WriteString(strconv.FormatFloat(seconds, 'f', 6, 64))
+}
+
+func writeSentryData(buf *bytes.Buffer, data Data) {
+	keys := make([]string, 0, len(data))
+	for k, v := range data {
+		if _, isStack := v.(Stack); !isStack {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	buf.WriteByte('{')
+
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		writeJSONString(buf, k)
+		buf.WriteByte(':')
+		writeJSONDatum(buf, data[k])
+	}
+
+	buf.WriteByte('}')
+}
+
+// Sentry expects frames ordered from the oldest to the most recent call.
+func writeSentryStack(buf *bytes.Buffer, stack Stack) {
+	buf.WriteString(`{"frames":[`)
+
+	for i := len(stack) - 1; i >= 0; i-- {
+		frame := stack[i]
+
+		if i < len(stack)-1 {
+			buf.WriteByte(',')
+		}
+
+		module, function := splitFunctionName(frame.Function)
+
+		buf.WriteString(`{"function":`)
+		writeJSONString(buf, function)
+		buf.WriteString(`,"module":`)
+		writeJSONString(buf, module)
+		buf.WriteString(`,"abs_path":`)
+		writeJSONString(buf, frame.File)
+		buf.WriteString(`,"lineno":`)
+		buf.WriteString(strconv.Itoa(frame.Line))
+		buf.WriteByte('}')
+	}
+
+	buf.WriteString("]}")
+}
+
+// Split a fully qualified function name such as
+// "github.com/exograd/go-log.(*Logger).Info" into the package path and the
+// function name.
+func splitFunctionName(name string) (string, string) {
+	start := strings.LastIndexByte(name, '/') + 1
+
+	idx := strings.IndexByte(name[start:], '.')
+	if idx == -1 {
+		return "", name
+	}
+
+	return name[:start+idx], name[start+idx+1:]
+}
+
+// Return the stack of the goroutine which logged the message, without the
+// frames of the log package.
+func callerStack() Stack {
+	stack := CaptureStack(1)
+
+	for i, frame := range stack {
+		module, _ := splitFunctionName(frame.Function)
+		if module != "github.com/exograd/go-log" {
+			return stack[i:]
+		}
+	}
+
+	return stack
+}
@@ -0,0 +1,261 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// The SQLite backend inserts messages into a table of a local database,
+// making them queryable with SQL on single-host deployments. Data are
+// stored as JSON objects and can be accessed with the JSON functions of
+// SQLite, e.g. json_extract(data, '$.request_id').
+//
+// The backend uses the database/sql package; the program must import a
+// SQLite driver, e.g. github.com/mattn/go-sqlite3 (driver "sqlite3") or
+// modernc.org/sqlite (driver "sqlite").
+type SQLiteBackendCfg struct {
+	Path   string `json:"path"`
+	Driver string `json:"driver"`
+	Table  string `json:"table"`
+
+	// If set, the database is used instead of opening the file; it is not
+	// closed when the backend is closed.
+	DB *sql.DB `json:"-"`
+
+	Batching BatchingCfg `json:"batching"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg SQLiteBackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
+}
+
+type SQLiteBackend struct {
+	Cfg SQLiteBackendCfg
+
+	db            *sql.DB
+	insertQuery   string
+	encoder       *JSONEncoder
+	batcher       *batcher
+	writeFailures *writeFailureReporter
+}
+
+// Times are stored with a fixed width so that they can be compared as
+// strings.
+const sqliteTimeLayout = "2006-01-02T15:04:05.000000Z"
+
+func NewSQLiteBackend(cfg SQLiteBackendCfg) (*SQLiteBackend, error) {
+	if cfg.Driver == "" {
+		cfg.Driver = "sqlite3"
+	}
+
+	if cfg.Table == "" {
+		cfg.Table = "log_messages"
+	}
+
+	if err := validateSQLIdentifier(cfg.Table); err != nil {
+		return nil, fmt.Errorf("invalid table name: %w", err)
+	}
+
+	db := cfg.DB
+	if db == nil {
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("missing or empty path")
+		}
+
+		var err error
+		db, err = sql.Open(cfg.Driver, cfg.Path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open database: %w", err)
+		}
+	}
+
+	b := &SQLiteBackend{
+		Cfg: cfg,
+
+		db:      db,
+		encoder: NewJSONEncoder(JSONEncoderCfg{SortKeys: true}),
+		writeFailures: newWriteFailureReporter(BackendTypeSQLite, cfg.Path,
+			cfg.WriteFailures),
+	}
+
+	if err := b.initDB(); err != nil {
+		if cfg.DB == nil {
+			db.Close()
+		}
+
+		return nil, err
+	}
+
+	b.insertQuery = `INSERT INTO "` + cfg.Table + `"` +
+		` (time, level, debug_level, domain, message, data)` +
+		` VALUES (?, ?, ?, ?, ?, ?)`
+
+	b.batcher = newBatcher(cfg.Batching, b.insert)
+
+	return b, nil
+}
+
+func (b *SQLiteBackend) initDB() error {
+	// With write-ahead logging, readers do not block the backend and the
+	// backend does not block readers. Durability of the last transactions
+	// is not worth a synchronization for each batch.
+	pragmas := []string{
+		"PRAGMA journal_mode = WAL",
+		"PRAGMA synchronous = NORMAL",
+		"PRAGMA busy_timeout = 5000",
+	}
+
+	for _, pragma := range pragmas {
+		if _, err := b.db.Exec(pragma); err != nil {
+			return fmt.Errorf("cannot execute %q: %w", pragma, err)
+		}
+	}
+
+	table := `"` + b.Cfg.Table + `"`
+
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS ` + table + ` (
+  id INTEGER PRIMARY KEY,
+  time TEXT NOT NULL,
+  level TEXT NOT NULL,
+  debug_level INTEGER,
+  domain TEXT NOT NULL,
+  message TEXT NOT NULL,
+  data TEXT
+)`,
+		`CREATE INDEX IF NOT EXISTS "` + b.Cfg.Table + `_time"` +
+			` ON ` + table + ` (time)`,
+	}
+
+	for _, query := range queries {
+		if _, err := b.db.Exec(query); err != nil {
+			return fmt.Errorf("cannot create table: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (b *SQLiteBackend) Log(msg Message) {
+	b.batcher.add(msg)
+}
+
+func (b *SQLiteBackend) LogBatch(msgs []Message) {
+	b.batcher.addBatch(msgs)
+}
+
+// Insert all pending messages.
+func (b *SQLiteBackend) Flush() error {
+	b.batcher.flush()
+	return nil
+}
+
+// Insert all pending messages and close the database.
+func (b *SQLiteBackend) Close() error {
+	b.batcher.close()
+
+	if b.Cfg.DB != nil {
+		return nil
+	}
+
+	return b.db.Close()
+}
+
+func (b *SQLiteBackend) insert(msgs []Message) {
+	if dropped := b.batcher.takeDropped(); dropped > 0 {
+		err := fmt.Errorf("%d messages dropped because too many messages "+
+			"were pending", dropped)
+		b.writeFailures.failure(err)
+	}
+
+	if err := b.insertMessages(msgs); err != nil {
+		b.writeFailures.failureMessages(err, msgs)
+	} else {
+		b.writeFailures.success()
+	}
+}
+
+func (b *SQLiteBackend) insertMessages(msgs []Message) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(b.insertQuery)
+	if err != nil {
+		return fmt.Errorf("cannot prepare query: %w", err)
+	}
+	defer stmt.Close()
+
+	var buf bytes.Buffer
+
+	for _, msg := range msgs {
+		t := time.Now().UTC()
+		if msg.Time != nil {
+			t = msg.Time.UTC()
+		}
+
+		var debugLevel, data interface{}
+
+		if msg.Level == LevelDebug {
+			debugLevel = msg.DebugLevel
+		}
+
+		if len(msg.Data) > 0 {
+			buf.Reset()
+			b.encoder.encodeData(msg.Data, &buf)
+			data = buf.String()
+		}
+
+		_, err := stmt.Exec(t.Format(sqliteTimeLayout), string(msg.Level),
+			debugLevel, msg.domain, msg.Message, data)
+		if err != nil {
+			return fmt.Errorf("cannot insert message: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Table names are interpolated in queries; we only accept simple
+// identifiers.
+func validateSQLIdentifier(s string) error {
+	if s == "" {
+		return fmt.Errorf("empty identifier")
+	}
+
+	for i, c := range s {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return fmt.Errorf("invalid character %q in identifier %q", c, s)
+		}
+	}
+
+	return nil
+}
@@ -18,13 +18,14 @@ package log
 
 import (
 	"bytes"
+	"crypto/tls"
 	"fmt"
 	"net"
-	"os"
+	"runtime"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
+	"unicode"
 )
 
 const (
@@ -32,26 +33,195 @@ const (
 	FacilityCode = 16 // local use 0
 )
 
+type SyslogFormat string
+
+const (
+	SyslogFormatRFC5424 SyslogFormat = "rfc5424"
+	SyslogFormatLEEF    SyslogFormat = "leef"
+)
+
+type SyslogTransport string
+
+const (
+	SyslogTransportTCP SyslogTransport = "tcp"
+	SyslogTransportUDP SyslogTransport = "udp"
+
+	// Connect over TCP with TLS; frames are prefixed by their length as
+	// with TCP.
+	//
+	// https://datatracker.ietf.org/doc/html/rfc5425
+	SyslogTransportTLS SyslogTransport = "tls"
+
+	// Connect to the local syslog daemon with a unix datagram socket, or
+	// with a unix stream socket if datagrams are not supported. Frames are
+	// separated by newline characters on stream sockets. If the address
+	// is empty, the socket path is detected based on the operating system.
+	SyslogTransportUnix SyslogTransport = "unix"
+)
+
 type SyslogBackendCfg struct {
-	Addr            string `json:"addr"`
-	ApplicationName string `json:"application_name"`
+	Addr            string          `json:"addr"`
+	Transport       SyslogTransport `json:"transport"` // tcp by default
+	ApplicationName string          `json:"application_name"`
+	Format          SyslogFormat    `json:"format"`
+	LEEF            *LEEFEncoderCfg `json:"leef,omitempty"`
+
+	// TLS settings used with the tls transport. If a CA certificate path is
+	// set, the server certificate is verified with the certificates it
+	// contains instead of system certificates.
+	CACertificatePath string      `json:"ca_certificate_path"`
+	TLSConfig         *tls.Config `json:"-"`
+
+	// If set, frames are posted to an HTTP relay when the syslog daemon
+	// cannot be reached.
+	HTTPRelay *SyslogHTTPRelayCfg `json:"http_relay,omitempty"`
+
+	// The hostname is obtained from the system when the backend is created
+	// unless it is set in the configuration. If the refresh interval is
+	// set, the system hostname is periodically obtained again, which is
+	// useful in environments where it can change.
+	Hostname                string        `json:"hostname"`
+	HostnameRefreshInterval time.Duration `json:"hostname_refresh_interval"`
+
+	// Frames logged while another goroutine is writing to the socket are
+	// accumulated and sent together with a single write. Once the amount
+	// of pending data reaches this size, callers wait for the current write
+	// to complete.
+	MaxPendingSize int `json:"max_pending_size"`
+
+	// If set, enable strict RFC 5424 validation, see RFC5424ValidationCfg.
+	// Reports are sent to the write failure backend unless the validation
+	// configuration has its own backend.
+	Validation *RFC5424ValidationCfg `json:"validation,omitempty"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg SyslogBackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
 }
 
+const DefaultSyslogMaxPendingSize = 1024 * 1024
+
 type SyslogBackend struct {
 	Cfg SyslogBackendCfg
 
-	mut  sync.Mutex
-	conn net.Conn
+	encoder       *RFC5424Encoder
+	leefEncoder   *LEEFEncoder
+	tlsConfig     *tls.Config
+	relay         *syslogHTTPRelay
+	writeFailures *writeFailureReporter
+
+	mut        sync.Mutex
+	conn       net.Conn
+	network    string
+	relayUntil time.Time
+	closed     bool
+
+	pendingMut  sync.Mutex
+	pendingCond *sync.Cond
+	pending     []byte
+	pendingMsgs []Message
+	spare       []byte
+	flushing    bool
 }
 
 func NewSyslogBackend(cfg SyslogBackendCfg) (*SyslogBackend, error) {
+	if cfg.MaxPendingSize <= 0 {
+		cfg.MaxPendingSize = DefaultSyslogMaxPendingSize
+	}
+
 	b := &SyslogBackend{
 		Cfg: cfg,
 	}
 
+	b.pendingCond = sync.NewCond(&b.pendingMut)
+
+	switch cfg.Transport {
+	case "":
+		b.Cfg.Transport = SyslogTransportTCP
+	case SyslogTransportTCP, SyslogTransportUDP, SyslogTransportUnix:
+	case SyslogTransportTLS:
+		tlsConfig, err := clientTLSConfig(cfg.TLSConfig, cfg.CACertificatePath)
+		if err != nil {
+			return nil, err
+		}
+
+		b.tlsConfig = tlsConfig
+	default:
+		return nil, fmt.Errorf("invalid syslog transport %q", cfg.Transport)
+	}
+
+	b.writeFailures = newWriteFailureReporter(BackendTypeSyslog, cfg.Addr,
+		cfg.WriteFailures)
+
+	switch cfg.Format {
+	case "", SyslogFormatRFC5424:
+
+	case SyslogFormatLEEF:
+		var leefCfg LEEFEncoderCfg
+		if cfg.LEEF != nil {
+			leefCfg = *cfg.LEEF
+		}
+
+		encoder, err := NewLEEFEncoder(leefCfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid leef configuration: %w", err)
+		}
+
+		b.leefEncoder = encoder
+
+	default:
+		return nil, fmt.Errorf("invalid syslog format %q", cfg.Format)
+	}
+
+	var validationCfg *RFC5424ValidationCfg
+	if cfg.Validation != nil {
+		if err := cfg.Validation.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid validation configuration: %w",
+				err)
+		}
+
+		validationCfg2 := *cfg.Validation
+		if validationCfg2.Backend == nil {
+			validationCfg2.Backend = b.writeFailures.Cfg.Backend
+		}
+
+		validationCfg = &validationCfg2
+	}
+
+	b.encoder = NewRFC5424Encoder(RFC5424EncoderCfg{
+		ApplicationName:         cfg.ApplicationName,
+		Hostname:                cfg.Hostname,
+		HostnameRefreshInterval: cfg.HostnameRefreshInterval,
+		Validation:              validationCfg,
+	})
+
+	if cfg.HTTPRelay != nil {
+		relay, err := newSyslogHTTPRelay(*cfg.HTTPRelay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid http relay configuration: %w", err)
+		}
+
+		b.relay = relay
+	}
+
+	// If a write failure handler is set, e.g. by the failover backend, the
+	// handler is told about the connection failure instead of the backend
+	// failing to initialize. The backend connects again on the next write.
 	if err := b.connect(); err != nil {
-		err2 := fmt.Errorf("cannot initialize syslog backend: %w", err)
-		return nil, err2
+		switch {
+		case b.relay != nil:
+			b.relayUntil = time.Now().Add(b.relay.Cfg.RetryInterval)
+
+		case b.keepsMessages():
+			b.writeFailures.failure(err)
+
+		default:
+			err2 := fmt.Errorf("cannot initialize syslog backend: %w", err)
+			return nil, err2
+		}
 	}
 
 	return b, nil
@@ -63,35 +233,90 @@ func (b *SyslogBackend) connect() error {
 		return nil
 	}
 
-	conn, err := net.Dial("tcp", b.Cfg.Addr)
+	var conn net.Conn
+	var network string
+	var err error
+
+	switch b.Cfg.Transport {
+	case SyslogTransportUnix:
+		conn, network, err = dialLocalSyslog(b.Cfg.Addr)
+	case SyslogTransportTLS:
+		network = "tcp"
+		conn, err = tls.Dial(network, b.Cfg.Addr, b.tlsConfig)
+	default:
+		network = string(b.Cfg.Transport)
+		conn, err = net.Dial(network, b.Cfg.Addr)
+	}
+
 	if err != nil {
 		b.conn = nil
 		err2 := fmt.Errorf("cannot connect to the syslog daemon: %w", err)
 		return err2
 	}
 
-	b.conn = conn
+	b.conn = trackConn(string(BackendTypeSyslog), conn)
+	b.network = network
 	return nil
 }
 
-func (b *SyslogBackend) writeAndRetry(msg bytes.Buffer) error {
+// Return the paths of the socket of the local syslog daemon for the current
+// operating system, in the order they should be tried.
+func localSyslogPaths() []string {
+	switch runtime.GOOS {
+	case "linux":
+		return []string{"/dev/log"}
+	case "darwin", "ios":
+		return []string{"/var/run/syslog"}
+	case "freebsd", "dragonfly":
+		return []string{"/var/run/log"}
+	default:
+		return []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+	}
+}
+
+func dialLocalSyslog(socketPath string) (net.Conn, string, error) {
+	paths := []string{socketPath}
+	if socketPath == "" {
+		paths = localSyslogPaths()
+	}
+
+	var err error
+
+	for _, path := range paths {
+		for _, network := range []string{"unixgram", "unix"} {
+			var conn net.Conn
+			conn, err = net.Dial(network, path)
+			if err == nil {
+				return conn, network, nil
+			}
+		}
+	}
+
+	return nil, "", err
+}
+
+// The data is a sequence of frames, each one prefixed by its length.
+func (b *SyslogBackend) writeAndRetry(data []byte) error {
 	b.mut.Lock()
 	defer b.mut.Unlock()
 
-	var buf bytes.Buffer
-	buf.WriteString(strconv.Itoa(msg.Len()) + " ")
-	buf.Write(msg.Bytes())
+	// Messages logged after the backend was closed are dropped.
+	if b.closed {
+		return nil
+	}
 
 	if err := b.connect(); err != nil {
 		return fmt.Errorf("cannot write log message: %w", err)
 	}
 
-	if _, err := b.conn.Write(buf.Bytes()); err != nil {
+	if err := b.writeConn(data); err != nil {
 		_ = b.conn.Close()
+		b.conn = nil
 		if err := b.connect(); err != nil {
 			return err
 		}
-		if _, err := b.conn.Write(buf.Bytes()); err != nil {
+
+		if err := b.writeConn(data); err != nil {
 			_ = b.conn.Close()
 			b.conn = nil
 			return fmt.Errorf("cannot write log message: %w", err)
@@ -101,72 +326,245 @@ func (b *SyslogBackend) writeAndRetry(msg bytes.Buffer) error {
 	return nil
 }
 
+// The function is unsafe and MUST be called with b.mut held.
+func (b *SyslogBackend) writeConn(data []byte) error {
+	switch b.network {
+	case "udp", "unixgram":
+		// https://datatracker.ietf.org/doc/html/rfc5426#section-3.1
+		//
+		// Each datagram contains a single frame without any length prefix.
+		return forEachSyslogFrame(data, func(frame []byte) error {
+			_, err := b.conn.Write(frame)
+			return err
+		})
+
+	case "unix":
+		// Local syslog daemons expect frames terminated by a newline
+		// character on stream sockets.
+		var buf bytes.Buffer
+		buf.Grow(len(data))
+
+		forEachSyslogFrame(data, func(frame []byte) error {
+			buf.Write(frame)
+			buf.WriteByte('\n')
+			return nil
+		})
+
+		_, err := b.conn.Write(buf.Bytes())
+		return err
+
+	default:
+		_, err := b.conn.Write(data)
+		return err
+	}
+}
+
+// Call a function for each frame of a sequence of frames prefixed by their
+// length, stopping at the first error.
+func forEachSyslogFrame(data []byte, fn func([]byte) error) error {
+	for len(data) > 0 {
+		idx := bytes.IndexByte(data, ' ')
+		size, _ := strconv.Atoi(string(data[:idx]))
+		frame := data[idx+1 : idx+1+size]
+		data = data[idx+1+size:]
+
+		if err := fn(frame); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (b *SyslogBackend) Log(msg Message) {
-	var buf bytes.Buffer
+	buf := getEncodingBuffer()
+	defer putEncodingBuffer(buf)
+
+	b.encodeFrame(msg, buf)
 
-	// https://datatracker.ietf.org/doc/html/rfc5424#section-6.2.1
-	pri := FacilityCode*8 + getSeverityCode(msg.Level)
+	var msgs []Message
+	if b.keepsMessages() {
+		msgs = []Message{msg}
+	}
 
-	// https://datatracker.ietf.org/doc/html/rfc5424#section-6.2.2
-	version := 1
+	b.write(msgs, buf.Bytes())
+}
 
-	// https://datatracker.ietf.org/doc/html/rfc5424#section-6.2.3
-	datetime := msg.Time.Format(time.RFC3339Nano)
+// Write several messages; their frames are queued together so that no other
+// frame can be written in between.
+func (b *SyslogBackend) LogBatch(msgs []Message) {
+	buf := getEncodingBuffer()
+	defer putEncodingBuffer(buf)
 
-	// https://datatracker.ietf.org/doc/html/rfc5424#section-6.2.4
-	hostname, err := os.Hostname()
-	if err != nil {
-		hostname = "-"
+	ends := make([]int, len(msgs))
+	for i, msg := range msgs {
+		b.encodeFrame(msg, buf)
+		ends[i] = buf.Len()
 	}
 
-	// https://datatracker.ietf.org/doc/html/rfc5424#section-6.2.5
-	appname := "-"
-	if b.Cfg.ApplicationName != "" {
-		appname = b.Cfg.ApplicationName
+	data := buf.Bytes()
+	frames := make([][]byte, len(msgs))
+
+	start := 0
+	for i, end := range ends {
+		frames[i] = data[start:end]
+		start = end
 	}
 
-	// https://datatracker.ietf.org/doc/html/rfc5424#section-6.2.6
-	procid := os.Getpid()
+	var pendingMsgs []Message
+	if b.keepsMessages() {
+		pendingMsgs = msgs
+	}
+
+	b.write(pendingMsgs, frames...)
+}
+
+// Connect to the server if the backend is not connected.
+func (b *SyslogBackend) Probe() error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if b.closed {
+		return fmt.Errorf("backend closed")
+	}
+
+	return b.connect()
+}
+
+// Wait for pending frames to be written and close the connection.
+func (b *SyslogBackend) Close() error {
+	b.pendingMut.Lock()
+	for b.flushing {
+		b.pendingCond.Wait()
+	}
+	b.pendingMut.Unlock()
 
-	// https://datatracker.ietf.org/doc/html/rfc5424#section-6.2.7
-	msgid := "-"
+	b.mut.Lock()
+	defer b.mut.Unlock()
 
-	// https://datatracker.ietf.org/doc/html/rfc5424#section-6.3.1
-	sdElementId := "go-log@32473"
-	sdElementParameters := []string{}
+	b.closed = true
 
-	for key, value := range msg.Data {
-		escapedValue := escapeSdElementValue(formatDatum2(value))
-		sdElementParameters =
-			append(sdElementParameters,
-				fmt.Sprintf("%s=\"%s\"", key, escapedValue))
+	if b.conn == nil {
+		return nil
 	}
 
-	// https://datatracker.ietf.org/doc/html/rfc5424#section-6.4
-	message := BOM + msg.Message
+	err := b.conn.Close()
+	b.conn = nil
 
-	var format string
-	var arguments []interface{}
+	return err
+}
 
-	// https://datatracker.ietf.org/doc/html/rfc5424#section-6
-	if len(sdElementParameters) == 0 {
-		format = "<%d>%d %s %s %s %d %s [%s] %s"
-		arguments = []interface{}{pri, version, datetime,
-			hostname, appname, procid, msgid, sdElementId,
-			message}
+func (b *SyslogBackend) encodeFrame(msg Message, buf *bytes.Buffer) {
+	if b.leefEncoder != nil {
+		// LEEF events are transported in the message part of the frame.
+		start := buf.Len()
+		b.encoder.encodeHeader(msg, buf)
+		buf.WriteString("- ")
+		msgStart := buf.Len()
+		b.leefEncoder.EncodeMessage(msg, buf)
+
+		if v := b.encoder.validator; v != nil {
+			v.checkFrame(buf, start, msgStart, msgStart)
+		}
 	} else {
-		format = "<%d>%d %s %s %s %d %s [%s %s] %s"
-		arguments = []interface{}{pri, version, datetime,
-			hostname, appname, procid, msgid, sdElementId,
-			strings.Join(sdElementParameters, " "),
-			message}
+		b.encoder.EncodeMessage(msg, buf)
+	}
+}
+
+// Messages are kept with pending frames so that they can be passed to the
+// write failure handler if the frames cannot be written.
+func (b *SyslogBackend) keepsMessages() bool {
+	return b.writeFailures.Cfg.Handler != nil
+}
+
+func (b *SyslogBackend) write(msgs []Message, frames ...[]byte) {
+	b.pendingMut.Lock()
+
+	for b.flushing && len(b.pending) >= b.Cfg.MaxPendingSize {
+		b.pendingCond.Wait()
+	}
+
+	// https://datatracker.ietf.org/doc/html/rfc6587#section-3.4.1
+	for _, frame := range frames {
+		b.pending = strconv.AppendInt(b.pending, int64(len(frame)), 10)
+		b.pending = append(b.pending, ' ')
+		b.pending = append(b.pending, frame...)
+	}
+
+	b.pendingMsgs = append(b.pendingMsgs, msgs...)
+
+	// If another goroutine is currently writing, it will pick up the frame
+	// once done.
+	if b.flushing {
+		b.pendingMut.Unlock()
+		return
+	}
+
+	b.flushing = true
+	b.pendingMut.Unlock()
+
+	b.flushPending()
+}
+
+func (b *SyslogBackend) flushPending() {
+	for {
+		b.pendingMut.Lock()
+
+		if len(b.pending) == 0 {
+			b.flushing = false
+			b.pendingCond.Broadcast()
+			b.pendingMut.Unlock()
+			return
+		}
+
+		data := b.pending
+		b.pending = b.spare[:0]
+		b.spare = nil
+
+		msgs := b.pendingMsgs
+		b.pendingMsgs = nil
+
+		b.pendingCond.Broadcast()
+		b.pendingMut.Unlock()
+
+		if err := b.send(data); err != nil {
+			b.writeFailures.failureMessages(err, msgs)
+		} else {
+			b.writeFailures.success()
+		}
+
+		b.pendingMut.Lock()
+		if cap(data) <= b.Cfg.MaxPendingSize {
+			b.spare = data[:0]
+		}
+		b.pendingMut.Unlock()
 	}
+}
 
-	fmt.Fprintf(&buf, format, arguments...)
+func (b *SyslogBackend) send(data []byte) error {
+	if b.relay == nil {
+		return b.writeAndRetry(data)
+	}
+
+	b.mut.Lock()
+	relayed := time.Now().Before(b.relayUntil)
+	b.mut.Unlock()
+
+	if !relayed {
+		err := b.writeAndRetry(data)
+		if err == nil {
+			return nil
+		}
 
-	if err := b.writeAndRetry(buf); err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
+		// We keep using the relay for a while before trying to reach the
+		// syslog daemon again.
+		b.mut.Lock()
+		b.relayUntil = time.Now().Add(b.relay.Cfg.RetryInterval)
+		b.mut.Unlock()
 	}
+
+	// The relay expects individual frames
+	return forEachSyslogFrame(data, b.relay.post)
 }
 
 func getSeverityCode(l Level) int {
@@ -184,9 +582,10 @@ func getSeverityCode(l Level) int {
 	return code
 }
 
-func escapeSdElementValue(src string) string {
-	var dest bytes.Buffer
-
+// Values must be valid UTF-8 (invalid sequences are replaced by U+FFFD).
+// Control characters are not forbidden by RFC 5424, but a lot of receivers
+// choke on them, so we escape them the same way Go does.
+func writeSdElementValue(dest *bytes.Buffer, src string) {
 	for _, rune := range src {
 		switch rune {
 		case '\\':
@@ -195,21 +594,71 @@ func escapeSdElementValue(src string) string {
 			dest.WriteString("\\\"")
 		case ']':
 			dest.WriteString("\\]")
+		case '\n':
+			dest.WriteString("\\n")
+		case '\r':
+			dest.WriteString("\\r")
+		case '\t':
+			dest.WriteString("\\t")
 		default:
-			dest.WriteRune(rune)
+			if unicode.IsControl(rune) {
+				fmt.Fprintf(dest, "\\u%04x", rune)
+			} else {
+				dest.WriteRune(rune)
+			}
+		}
+	}
+}
+
+// https://datatracker.ietf.org/doc/html/rfc5424#section-6.3.3
+//
+// SD-NAME is a sequence of 1 to 32 printable US-ASCII characters except '=',
+// ' ', ']' and '"'. Invalid characters are replaced by underscores.
+func sdName(src string) string {
+	if src == "" {
+		return "_"
+	}
+
+	dest := []byte(src)
+	for i, c := range dest {
+		if c <= 32 || c >= 127 || c == '=' || c == ']' || c == '"' {
+			dest[i] = '_'
 		}
 	}
 
-	return dest.String()
+	if len(dest) > 32 {
+		dest = dest[:32]
+	}
+
+	return string(dest)
+}
+
+// https://datatracker.ietf.org/doc/html/rfc5424#section-6
+//
+// Header fields are sequences of printable US-ASCII characters with a
+// maximum length depending on the field.
+func headerField(src string, maxLength int) string {
+	dest := []byte(src)
+	for i, c := range dest {
+		if c <= 32 || c >= 127 {
+			dest[i] = '_'
+		}
+	}
+
+	if len(dest) > maxLength {
+		dest = dest[:maxLength]
+	}
+
+	return string(dest)
 }
 
 func formatDatum2(datum Datum) string {
 	switch v := datum.(type) {
 	case fmt.Stringer:
-		return formatDatum2(v.String())
+		return formatDatum2(stringerString(v))
 	case string:
 		return v
 	default:
-		return fmt.Sprintf("%v", v)
+		return formatValue(v)
 	}
 }
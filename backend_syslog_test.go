@@ -0,0 +1,207 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Decode an SD-PARAM value written by writeSdElementValue.
+func parseSdElementValue(s string) (string, error) {
+	var buf strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch c {
+		case '"', ']':
+			return "", fmt.Errorf("unescaped character %q at offset %d", c, i)
+
+		case '\\':
+			if i+1 >= len(s) {
+				return "", fmt.Errorf("truncated escape sequence")
+			}
+
+			i++
+
+			switch s[i] {
+			case '\\', '"', ']':
+				buf.WriteByte(s[i])
+			case 'n':
+				buf.WriteByte('\n')
+			case 'r':
+				buf.WriteByte('\r')
+			case 't':
+				buf.WriteByte('\t')
+			case 'u':
+				var r rune
+				if i+4 >= len(s) {
+					return "", fmt.Errorf("truncated unicode escape sequence")
+				}
+
+				if _, err := fmt.Sscanf(s[i+1:i+5], "%04x", &r); err != nil {
+					return "", fmt.Errorf("invalid unicode escape sequence: %w",
+						err)
+				}
+
+				buf.WriteRune(r)
+				i += 4
+			default:
+				return "", fmt.Errorf("invalid escape sequence \\%c", s[i])
+			}
+
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	return buf.String(), nil
+}
+
+func FuzzSdElementValue(f *testing.F) {
+	for _, s := range []string{"", "foo", `a"b]c\d`, "a\nb\tc\r", "\x00\x1f\x7f",
+		"\xff\xfe", "été", " "} {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		var buf bytes.Buffer
+		writeSdElementValue(&buf, s)
+
+		value := buf.String()
+
+		if !utf8.ValidString(value) {
+			t.Fatalf("invalid UTF-8 in %q", value)
+		}
+
+		for _, c := range value {
+			if unicode.IsControl(c) {
+				t.Fatalf("unescaped control character %q in %q", c, value)
+			}
+		}
+
+		decodedValue, err := parseSdElementValue(value)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %v", value, err)
+		}
+
+		// Invalid UTF-8 sequences are replaced byte by byte, the same way
+		// the conversion to runes does it.
+		if expected := string([]rune(s)); decodedValue != expected {
+			t.Fatalf("%q was decoded as %q instead of %q", value,
+				decodedValue, expected)
+		}
+	})
+}
+
+func FuzzSdName(f *testing.F) {
+	for _, s := range []string{"", "foo", "a=b", "a b", `a"b]`, "été",
+		strings.Repeat("x", 40)} {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		name := sdName(s)
+
+		if len(name) < 1 || len(name) > 32 {
+			t.Fatalf("invalid length %d for %q", len(name), name)
+		}
+
+		for i := 0; i < len(name); i++ {
+			c := name[i]
+			if c <= 32 || c >= 127 || c == '=' || c == ']' || c == '"' {
+				t.Fatalf("invalid character %q in %q", c, name)
+			}
+		}
+	})
+}
+
+func TestSyslogBackendTLS(t *testing.T) {
+	// Use the certificate of the test HTTP server, which is valid for
+	// 127.0.0.1.
+	server := httptest.NewTLSServer(nil)
+	server.Close()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", server.TLS)
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	defer listener.Close()
+
+	frameChan := make(chan string, 1)
+
+	go func() {
+		defer close(frameChan)
+
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+
+		sizeString, err := r.ReadString(' ')
+		if err != nil {
+			return
+		}
+
+		size, _ := strconv.Atoi(strings.TrimSpace(sizeString))
+
+		frame := make([]byte, size)
+		if _, err := io.ReadFull(r, frame); err != nil {
+			return
+		}
+
+		frameChan <- string(frame)
+	}()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	backend, err := NewSyslogBackend(SyslogBackendCfg{
+		Addr:      listener.Addr().String(),
+		Transport: SyslogTransportTLS,
+		TLSConfig: &tls.Config{RootCAs: pool},
+	})
+	if err != nil {
+		t.Fatalf("cannot create backend: %v", err)
+	}
+	defer backend.Close()
+
+	backend.Log(Message{Level: LevelInfo, Message: "hello"})
+
+	select {
+	case frame := <-frameChan:
+		if !strings.HasSuffix(frame, BOM+"hello") {
+			t.Errorf("unexpected frame %q", frame)
+		}
+
+	case <-time.After(10 * time.Second):
+		t.Fatalf("no frame received")
+	}
+}
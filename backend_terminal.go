@@ -19,52 +19,250 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type TerminalBackendCfg struct {
-	Color       bool `json:"color"`
-	DomainWidth int  `json:"domain_width"`
+	Color       bool                 `json:"color"`
+	ColorValues bool                 `json:"color_values"`
+	ValueColors *TerminalValueColors `json:"value_colors,omitempty"`
+	DomainWidth int                  `json:"domain_width"`
+
+	// The color theme, see TerminalThemes. Value colors which are set
+	// override the ones of the theme; since unset colors are zero, black
+	// cannot be used to override a theme color.
+	Theme TerminalTheme `json:"theme"`
+
+	// In strict logfmt mode, keys are sanitized, all values are quoted when
+	// necessary and data are never colorized, so that the data line can
+	// always be parsed back.
+	StrictLogfmt bool `json:"strict_logfmt"`
+
+	// If a locale (e.g. "en-US" or "fr-FR") is set, numbers and times in
+	// data are rendered using its conventions; the clock ("12h" or "24h")
+	// of the locale can be overridden. Locales are ignored in strict logfmt
+	// mode.
+	Locale string `json:"locale"`
+	Clock  string `json:"clock"`
+
+	// In expanded mode, the data of error messages are rendered as a block
+	// with one entry per line; long values are wrapped to ExpandedWidth
+	// cells (100 by default) and JSON values are pretty-printed. Expanded
+	// mode is ignored in strict logfmt mode.
+	Expanded      bool `json:"expanded"`
+	ExpandedWidth int  `json:"expanded_width"`
+}
+
+type TerminalValueColors struct {
+	Bool   Color `json:"bool"`
+	Number Color `json:"number"`
+	Nil    Color `json:"nil"`
+	Error  Color `json:"error"`
+}
+
+// Return a copy of the colors where each color set in other replaces the
+// current one.
+func (colors TerminalValueColors) merge(other TerminalValueColors) TerminalValueColors {
+	if other.Bool != 0 {
+		colors.Bool = other.Bool
+	}
+
+	if other.Number != 0 {
+		colors.Number = other.Number
+	}
+
+	if other.Nil != 0 {
+		colors.Nil = other.Nil
+	}
+
+	if other.Error != 0 {
+		colors.Error = other.Error
+	}
+
+	return colors
+}
+
+var DefaultTerminalValueColors = TerminalValueColors{
+	Bool:   ColorMagenta,
+	Number: ColorCyan,
+	Nil:    ColorYellow,
+	Error:  ColorRed,
+}
+
+type TerminalTheme string
+
+const (
+	TerminalThemeDefault TerminalTheme = "default"
+
+	// Avoids combinations of red and green, which cannot be distinguished
+	// with the most common forms of color blindness.
+	TerminalThemeDeuteranopia TerminalTheme = "deuteranopia"
+
+	// Bright and bold colors, readable on low quality displays and with
+	// low vision.
+	TerminalThemeHighContrast TerminalTheme = "high_contrast"
+
+	// No color at all; domains, keys and errors are rendered in bold.
+	TerminalThemeMonochrome TerminalTheme = "monochrome"
+)
+
+type TerminalThemeColors struct {
+	Domain Color
+	Key    Color
+	Values TerminalValueColors
+}
+
+var TerminalThemes = map[TerminalTheme]TerminalThemeColors{
+	TerminalThemeDefault: {
+		Domain: ColorGreen,
+		Key:    ColorBlue,
+		Values: DefaultTerminalValueColors,
+	},
+
+	TerminalThemeDeuteranopia: {
+		Domain: ColorBrightBlue,
+		Key:    ColorYellow,
+		Values: TerminalValueColors{
+			Bool:   ColorMagenta,
+			Number: ColorCyan,
+			Nil:    ColorBrightBlack,
+			Error:  ColorBrightYellow.Bold(),
+		},
+	},
+
+	TerminalThemeHighContrast: {
+		Domain: ColorBrightWhite.Bold(),
+		Key:    ColorBrightCyan,
+		Values: TerminalValueColors{
+			Bool:   ColorBrightMagenta,
+			Number: ColorBrightYellow,
+			Nil:    ColorBrightWhite,
+			Error:  ColorBrightRed.Bold(),
+		},
+	},
+
+	TerminalThemeMonochrome: {
+		Domain: ColorDefault.Bold(),
+		Key:    ColorDefault.Bold(),
+		Values: TerminalValueColors{
+			Bool:   ColorDefault,
+			Number: ColorDefault,
+			Nil:    ColorDefault,
+			Error:  ColorDefault.Bold(),
+		},
+	},
 }
 
 type TerminalBackend struct {
 	Cfg TerminalBackendCfg
 
 	domainWidth int
+	domainColor Color
+	keyColor    Color
+	valueColors TerminalValueColors
+	locale      *locale
+}
+
+func (cfg *TerminalBackendCfg) check() error {
+	if _, found := TerminalThemes[cfg.Theme]; !found && cfg.Theme != "" {
+		return fmt.Errorf("unknown terminal theme %q", cfg.Theme)
+	}
+
+	if cfg.Locale != "" {
+		if _, err := newLocale(cfg.Locale, cfg.Clock); err != nil {
+			return fmt.Errorf("invalid terminal locale: %w", err)
+		}
+	}
+
+	return nil
 }
 
+// Terminal backends cannot fail to be created: an invalid configuration is
+// reported on stderr and replaced by default values. Backends created from a
+// BackendCfg are validated beforehand.
 func NewTerminalBackend(cfg TerminalBackendCfg) *TerminalBackend {
 	domainWidth := 24
 	if cfg.DomainWidth > 0 {
 		domainWidth = cfg.DomainWidth
 	}
 
+	theme, found := TerminalThemes[cfg.Theme]
+	if !found {
+		if cfg.Theme != "" {
+			fmt.Fprintf(os.Stderr, "unknown terminal theme %q\n", cfg.Theme)
+		}
+
+		theme = TerminalThemes[TerminalThemeDefault]
+	}
+
+	valueColors := theme.Values
+	if cfg.ValueColors != nil {
+		valueColors = valueColors.merge(*cfg.ValueColors)
+	}
+
 	b := &TerminalBackend{
 		Cfg: cfg,
 
 		domainWidth: domainWidth,
+		domainColor: theme.Domain,
+		keyColor:    theme.Key,
+		valueColors: valueColors,
+	}
+
+	if cfg.Locale != "" {
+		locale, err := newLocale(cfg.Locale, cfg.Clock)
+		if err != nil {
+			// The terminal backend cannot fail to be created, and
+			// rendering is not worth failing for.
+			fmt.Fprintf(os.Stderr, "invalid terminal locale: %v\n", err)
+		} else {
+			b.locale = locale
+		}
 	}
 
 	return b
 }
 
 func (b *TerminalBackend) Log(msg Message) {
-	domain := fmt.Sprintf("%-*s", b.domainWidth, msg.domain)
+	var buf bytes.Buffer
+	b.encodeMessage(msg, &buf)
+
+	io.Copy(os.Stderr, &buf)
+}
+
+func (b *TerminalBackend) LogBatch(msgs []Message) {
+	var buf bytes.Buffer
+	for _, msg := range msgs {
+		b.encodeMessage(msg, &buf)
+	}
+
+	io.Copy(os.Stderr, &buf)
+}
+
+func (b *TerminalBackend) encodeMessage(msg Message, buf *bytes.Buffer) {
+	domain := padRight(stripZeroWidthSpaces(msg.domain), b.domainWidth)
 
 	level := string(msg.Level)
 	if msg.Level == LevelDebug {
 		level += "." + strconv.Itoa(msg.DebugLevel)
 	}
 
-	var buf bytes.Buffer
+	fmt.Fprintf(buf, "%-7s  %s  %s\n", level, b.Colorize(b.domainColor, domain),
+		stripZeroWidthSpaces(msg.Message))
 
-	fmt.Fprintf(&buf, "%-7s  %s  %s\n",
-		level, b.Colorize(ColorGreen, domain), msg.Message)
+	if len(msg.Data) > 0 && b.Cfg.Expanded && !b.Cfg.StrictLogfmt &&
+		msg.Level == LevelError {
+		b.encodeExpandedData(msg.Data, buf)
+		return
+	}
 
 	if len(msg.Data) > 0 {
-		fmt.Fprintf(&buf, "         ")
+		fmt.Fprintf(buf, "         ")
 
 		keys := make([]string, len(msg.Data))
 		i := 0
@@ -76,19 +274,22 @@ func (b *TerminalBackend) Log(msg Message) {
 
 		for i, k := range keys {
 			if i > 0 {
-				fmt.Fprintf(&buf, " ")
+				fmt.Fprintf(buf, " ")
 			}
 
-			fmt.Fprintf(&buf, "%s=%s",
-				b.Colorize(ColorBlue, k), formatDatum(msg.Data[k]))
+			if b.Cfg.StrictLogfmt {
+				value := quoteLogfmtValue(formatDatum2(msg.Data[k]))
+				fmt.Fprintf(buf, "%s=%s", logfmtKey(k), value)
+			} else {
+				fmt.Fprintf(buf, "%s=%s",
+					b.Colorize(b.keyColor, k), b.formatDatum(msg.Data[k]))
+			}
 
 			i++
 		}
 
-		fmt.Fprintf(&buf, "\n")
+		fmt.Fprintf(buf, "\n")
 	}
-
-	io.Copy(os.Stderr, &buf)
 }
 
 func (b *TerminalBackend) Colorize(color Color, s string) string {
@@ -99,19 +300,94 @@ func (b *TerminalBackend) Colorize(color Color, s string) string {
 	return Colorize(color, s)
 }
 
+func (b *TerminalBackend) formatDatum(datum Datum) string {
+	var s string
+
+	if b.locale != nil {
+		if ls, ok := b.locale.formatDatum(datum); ok {
+			s = quoteLogfmtValue(ls)
+		}
+	}
+
+	if s == "" {
+		s = formatDatum(datum)
+	}
+
+	if !b.Cfg.Color || !b.Cfg.ColorValues {
+		return s
+	}
+
+	if _, isError := datum.(error); isError && !isNilPointer(datum) {
+		return Colorize(b.valueColors.Error, s)
+	}
+
+	if datum == nil {
+		return Colorize(b.valueColors.Nil, s)
+	}
+
+	switch reflect.ValueOf(datum).Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface,
+		reflect.Func, reflect.Chan:
+		if reflect.ValueOf(datum).IsNil() {
+			return Colorize(b.valueColors.Nil, s)
+		}
+
+	case reflect.Bool:
+		return Colorize(b.valueColors.Bool, s)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Complex64, reflect.Complex128:
+		return Colorize(b.valueColors.Number, s)
+	}
+
+	return s
+}
+
 func formatDatum(datum Datum) string {
 	switch v := datum.(type) {
 	case fmt.Stringer:
-		return formatDatum(v.String())
+		return formatDatum(stringerString(v))
 
 	case string:
-		if !strings.Contains(v, " ") {
-			return v
+		return quoteLogfmtValue(v)
+
+	default:
+		return formatValue(v)
+	}
+}
+
+func quoteLogfmtValue(s string) string {
+	if s == "" {
+		return `""`
+	}
+
+	if !utf8.ValidString(s) {
+		return strconv.Quote(s)
+	}
+
+	for _, c := range s {
+		if c == ' ' || c == '=' || c == '"' || unicode.IsControl(c) {
+			return strconv.Quote(s)
 		}
+	}
 
-		return fmt.Sprintf("%q", v)
+	return s
+}
 
-	default:
-		return fmt.Sprintf("%v", v)
+func logfmtKey(k string) string {
+	if k == "" {
+		return "_"
 	}
+
+	return strings.Map(func(c rune) rune {
+		if c <= ' ' || c == '=' || c == '"' || c == utf8.RuneError ||
+			unicode.IsControl(c) {
+			return '_'
+		}
+
+		return c
+	}, k)
 }
@@ -0,0 +1,199 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const terminalDataIndent = "         "
+
+// Render data as a block with one entry per line, for error messages in
+// expanded mode.
+func (b *TerminalBackend) encodeExpandedData(data Data, buf *bytes.Buffer) {
+	keys := make([]string, 0, len(data))
+	keyWidth := 0
+
+	for k := range data {
+		keys = append(keys, k)
+
+		if w := stringWidth(k); w > keyWidth {
+			keyWidth = w
+		}
+	}
+	sort.Strings(keys)
+
+	if keyWidth > 24 {
+		keyWidth = 24
+	}
+
+	width := b.Cfg.ExpandedWidth
+	if width <= 0 {
+		width = 100
+	}
+
+	valueWidth := width - len(terminalDataIndent) - keyWidth - 2
+	if valueWidth < 20 {
+		valueWidth = 20
+	}
+
+	continuation := terminalDataIndent + strings.Repeat(" ", keyWidth+2)
+
+	for _, k := range keys {
+		buf.WriteString(terminalDataIndent)
+		buf.WriteString(b.Colorize(b.keyColor, k))
+		buf.WriteString(":")
+		buf.WriteString(strings.Repeat(" ", keyWidth-stringWidth(k)+1))
+
+		lines, ok := expandedDatumLines(data[k], valueWidth)
+		if !ok {
+			buf.WriteString(b.formatDatum(data[k]))
+			buf.WriteByte('\n')
+			continue
+		}
+
+		for i, line := range lines {
+			if i > 0 {
+				buf.WriteString(continuation)
+			}
+
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+	}
+}
+
+// Return the lines used to render a datum, or false if the datum is a simple
+// value which is rendered as usual.
+func expandedDatumLines(datum Datum, width int) ([]string, bool) {
+	var s string
+
+	switch v := datum.(type) {
+	case Stack:
+		s = v.String()
+
+	case json.RawMessage:
+		s = prettyJSON(v)
+
+	case []byte:
+		s = string(v)
+		if pretty, ok := prettyJSONString(s); ok {
+			s = pretty
+		}
+
+	case string:
+		if v == "" {
+			return nil, false
+		}
+
+		s = v
+		if pretty, ok := prettyJSONString(s); ok {
+			s = pretty
+		}
+
+	case error:
+		s = formatDatum2(v)
+
+	default:
+		switch reflect.ValueOf(datum).Kind() {
+		case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+			data, err := marshalJSONDatum(datum)
+			if err != nil {
+				return nil, false
+			}
+
+			s = prettyJSON(data)
+
+		default:
+			return nil, false
+		}
+	}
+
+	s = stripZeroWidthSpaces(s)
+
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		lines = append(lines, wrapLine(strings.TrimRight(line, " \t\r"),
+			width)...)
+	}
+
+	return lines, true
+}
+
+func prettyJSONString(s string) (string, bool) {
+	s2 := strings.TrimSpace(s)
+	if len(s2) < 2 || (s2[0] != '{' && s2[0] != '[') ||
+		!json.Valid([]byte(s2)) {
+		return "", false
+	}
+
+	return prettyJSON([]byte(s2)), true
+}
+
+func prettyJSON(data []byte) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return string(data)
+	}
+
+	return buf.String()
+}
+
+// Split a line so that each part is at most width cells wide, breaking at
+// spaces when possible. Leading spaces are preserved so that indented
+// content such as pretty-printed JSON keeps its structure.
+func wrapLine(line string, width int) []string {
+	if stringWidth(line) <= width {
+		return []string{line}
+	}
+
+	var lines []string
+
+	for stringWidth(line) > width {
+		cut, cutWidth, lastSpace := 0, 0, -1
+
+		for i, r := range line {
+			w := runeWidth(r)
+			if cutWidth+w > width {
+				break
+			}
+
+			if r == ' ' && strings.TrimLeft(line[:i], " ") != "" {
+				lastSpace = i
+			}
+
+			cut = i + len(string(r))
+			cutWidth += w
+		}
+
+		if cut == 0 {
+			break
+		}
+
+		if lastSpace > 0 {
+			lines = append(lines, line[:lastSpace])
+			line = line[lastSpace+1:]
+		} else {
+			lines = append(lines, line[:cut])
+			line = line[cut:]
+		}
+	}
+
+	return append(lines, line)
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+func FuzzQuoteLogfmtValue(f *testing.F) {
+	for _, s := range []string{"", "foo", "foo bar", "a=b", `"quoted"`,
+		"a\nb", "\xff", "été", `back\slash`} {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		value := quoteLogfmtValue(s)
+
+		if !utf8.ValidString(value) {
+			t.Fatalf("invalid UTF-8 in %q", value)
+		}
+
+		if value == s {
+			if s == "" || strings.ContainsAny(s, ` ="`) {
+				t.Fatalf("%q must be quoted", s)
+			}
+
+			for _, c := range s {
+				if unicode.IsControl(c) {
+					t.Fatalf("%q must be quoted", s)
+				}
+			}
+
+			return
+		}
+
+		decodedValue, err := strconv.Unquote(value)
+		if err != nil {
+			t.Fatalf("cannot unquote %q: %v", value, err)
+		}
+
+		if decodedValue != s {
+			t.Fatalf("%q was decoded as %q", value, decodedValue)
+		}
+	})
+}
+
+func FuzzLogfmtKey(f *testing.F) {
+	for _, s := range []string{"", "foo", "a b", "a=b", `"`, "\xff", "été"} {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		key := logfmtKey(s)
+
+		if key == "" {
+			t.Fatalf("empty key for %q", s)
+		}
+
+		if !utf8.ValidString(key) {
+			t.Fatalf("invalid UTF-8 in %q", key)
+		}
+
+		for _, c := range key {
+			if c <= ' ' || c == '=' || c == '"' || unicode.IsControl(c) {
+				t.Fatalf("invalid character %q in %q", c, key)
+			}
+		}
+	})
+}
@@ -0,0 +1,248 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// The webhook backend sends messages in batches to an HTTP endpoint, each
+// request containing a JSON array of messages encoded with the JSON encoder.
+type WebhookBackendCfg struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"` // POST by default
+	Headers map[string]string `json:"headers"`
+	Gzip    bool              `json:"gzip"`
+	Timeout time.Duration     `json:"timeout"`
+
+	Encoder JSONEncoderCfg `json:"encoder"`
+
+	Batching BatchingCfg `json:"batching"`
+
+	// Requests failing because of a network error or with one of the retry
+	// statuses are retried with exponential backoff. By default, requests
+	// are retried for status 429 and for all server errors.
+	MaxRetries     int           `json:"max_retries"`
+	InitialBackoff time.Duration `json:"initial_backoff"`
+	MaxBackoff     time.Duration `json:"max_backoff"`
+	RetryStatuses  []int         `json:"retry_statuses"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg WebhookBackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
+}
+
+type WebhookBackend struct {
+	Cfg WebhookBackendCfg
+
+	client        *http.Client
+	encoder       *JSONEncoder
+	batcher       *batcher
+	writeFailures *writeFailureReporter
+}
+
+func NewWebhookBackend(cfg WebhookBackendCfg) (*WebhookBackend, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("missing or empty url")
+	}
+
+	uri, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+
+	if cfg.Method == "" {
+		cfg.Method = "POST"
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 5
+	}
+
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 500 * time.Millisecond
+	}
+
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+
+	b := &WebhookBackend{
+		Cfg: cfg,
+
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+		encoder: NewJSONEncoder(cfg.Encoder),
+		writeFailures: newWriteFailureReporter(BackendTypeWebhook, uri.Host,
+			cfg.WriteFailures),
+	}
+
+	b.batcher = newBatcher(cfg.Batching, b.send)
+
+	return b, nil
+}
+
+func (b *WebhookBackend) Log(msg Message) {
+	b.batcher.add(msg)
+}
+
+func (b *WebhookBackend) LogBatch(msgs []Message) {
+	b.batcher.addBatch(msgs)
+}
+
+// Send all pending messages.
+func (b *WebhookBackend) Flush() error {
+	b.batcher.flush()
+	return nil
+}
+
+// Send all pending messages and stop the backend.
+func (b *WebhookBackend) Close() error {
+	b.batcher.close()
+	return nil
+}
+
+// Check that the server accepts connections.
+func (b *WebhookBackend) Probe() error {
+	return probeURL(b.Cfg.URL, b.Cfg.Timeout)
+}
+
+func (b *WebhookBackend) send(msgs []Message) {
+	if dropped := b.batcher.takeDropped(); dropped > 0 {
+		err := fmt.Errorf("%d messages dropped because too many messages "+
+			"were pending", dropped)
+		b.writeFailures.failure(err)
+	}
+
+	body, err := b.encodeBody(msgs)
+	if err != nil {
+		b.writeFailures.failureMessages(err, msgs)
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry, err := b.sendRequest(body)
+		if err == nil {
+			b.writeFailures.success()
+			return
+		}
+
+		if !retry || attempt > b.Cfg.MaxRetries {
+			b.writeFailures.failureMessages(err, msgs)
+			return
+		}
+
+		b.batcher.sleep(retryDelay(attempt, b.Cfg.InitialBackoff,
+			b.Cfg.MaxBackoff))
+	}
+}
+
+func (b *WebhookBackend) encodeBody(msgs []Message) ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteByte('[')
+	for i, msg := range msgs {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		b.encoder.EncodeMessage(msg, &buf)
+	}
+	buf.WriteByte(']')
+
+	if !b.Cfg.Gzip {
+		return buf.Bytes(), nil
+	}
+
+	var zbuf bytes.Buffer
+
+	zw := gzip.NewWriter(&zbuf)
+	if _, err := zw.Write(buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("cannot compress request body: %w", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("cannot compress request body: %w", err)
+	}
+
+	return zbuf.Bytes(), nil
+}
+
+// Send a request and indicate whether it can be retried in case of failure.
+func (b *WebhookBackend) sendRequest(body []byte) (bool, error) {
+	req, err := http.NewRequest(b.Cfg.Method, b.Cfg.URL,
+		bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("cannot create http request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if b.Cfg.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	for name, value := range b.Cfg.Headers {
+		req.Header.Set(name, value)
+	}
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("cannot send http request: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return true, fmt.Errorf("cannot read http response: %w", err)
+	}
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+
+	err = fmt.Errorf("request failed with status %d: %s", res.StatusCode,
+		bytes.TrimSpace(resBody))
+
+	return b.retryStatus(res.StatusCode), err
+}
+
+func (b *WebhookBackend) retryStatus(status int) bool {
+	if len(b.Cfg.RetryStatuses) == 0 {
+		return status == 429 || status >= 500
+	}
+
+	for _, s := range b.Cfg.RetryStatuses {
+		if status == s {
+			return true
+		}
+	}
+
+	return false
+}
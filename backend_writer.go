@@ -0,0 +1,143 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// The writer backend writes messages, one per line, to any io.Writer, e.g. a
+// pipe, a network connection or a buffer in tests. Since a writer cannot be
+// described in JSON, the configuration has to be provided in the Backend
+// field of BackendCfg.
+type WriterBackendCfg struct {
+	Writer io.Writer `json:"-"`
+
+	// The encoder used to format messages. The text encoder is used by
+	// default.
+	EncoderType EncoderType      `json:"encoder_type"`
+	EncoderData *json.RawMessage `json:"encoder,omitempty"`
+	Encoder     Encoder          `json:"-"`
+
+	WriteFailures *WriteFailureCfg `json:"write_failures,omitempty"`
+}
+
+func (cfg WriterBackendCfg) withWriteFailureHandler(handler func(WriteFailure)) interface{} {
+	cfg.WriteFailures = cfg.WriteFailures.withHandler(handler)
+	return &cfg
+}
+
+type WriterBackend struct {
+	Cfg WriterBackendCfg
+
+	encoder       Encoder
+	writeFailures *writeFailureReporter
+
+	mut    sync.Mutex
+	writer io.Writer
+}
+
+func NewWriterBackend(cfg WriterBackendCfg) (*WriterBackend, error) {
+	if cfg.Writer == nil {
+		return nil, fmt.Errorf("missing writer")
+	}
+
+	encoder, err := newFileEncoder(cfg.Encoder, cfg.EncoderType,
+		cfg.EncoderData)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &WriterBackend{
+		Cfg: cfg,
+
+		encoder: encoder,
+		writeFailures: newWriteFailureReporter(BackendTypeWriter, "",
+			cfg.WriteFailures),
+
+		writer: cfg.Writer,
+	}
+
+	if headerEncoder, ok := encoder.(HeaderEncoder); ok {
+		var buf bytes.Buffer
+		if err := headerEncoder.EncodeHeader(&buf); err != nil {
+			return nil, fmt.Errorf("cannot encode header: %w", err)
+		}
+		buf.WriteByte('\n')
+
+		if _, err := cfg.Writer.Write(buf.Bytes()); err != nil {
+			return nil, fmt.Errorf("cannot write header: %w", err)
+		}
+	}
+
+	return b, nil
+}
+
+func (b *WriterBackend) Log(msg Message) {
+	b.LogBatch([]Message{msg})
+}
+
+func (b *WriterBackend) LogBatch(msgs []Message) {
+	var buf bytes.Buffer
+
+	for _, msg := range msgs {
+		start := buf.Len()
+
+		if err := b.encoder.EncodeMessage(msg, &buf); err != nil {
+			buf.Truncate(start)
+
+			err2 := fmt.Errorf("cannot encode message: %w", err)
+			b.writeFailures.failure(err2)
+			continue
+		}
+
+		buf.WriteByte('\n')
+	}
+
+	if buf.Len() == 0 {
+		return
+	}
+
+	b.mut.Lock()
+	_, err := b.writer.Write(buf.Bytes())
+	b.mut.Unlock()
+
+	if err != nil {
+		b.writeFailures.failureMessages(err, msgs)
+	} else {
+		b.writeFailures.success()
+	}
+}
+
+// Flush the writer if it supports it, e.g. if it is a bufio.Writer.
+func (b *WriterBackend) Flush() error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if flusher, ok := b.writer.(interface{ Flush() error }); ok {
+		return flusher.Flush()
+	}
+
+	return nil
+}
+
+// Flush the writer. The writer is owned by the caller and is not closed.
+func (b *WriterBackend) Close() error {
+	return b.Flush()
+}
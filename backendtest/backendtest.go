@@ -0,0 +1,286 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Package backendtest provides a conformance suite for log backends. It is
+// meant to be called from the tests of out-of-tree backends:
+//
+//	func TestConformance(t *testing.T) {
+//		backendtest.Conformance(t, NewMyBackend())
+//	}
+//
+// Backends whose output can be read back should use ConformanceOutput so
+// that the suite also checks what was written:
+//
+//	func TestConformance(t *testing.T) {
+//		var buf bytes.Buffer
+//		backendtest.ConformanceOutput(t, NewMyBackend(&buf), buf.String)
+//	}
+package backendtest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-log"
+)
+
+// The maximum amount of time a single test is allowed to run before we
+// consider that the backend is blocked.
+var Timeout = 10 * time.Second
+
+func Conformance(t *testing.T, backend log.Backend) {
+	t.Helper()
+
+	conformance(t, &suite{backend: backend})
+}
+
+// Run the conformance suite and check that each message was written. The
+// output function returns all data written by the backend so far; it must
+// flush the backend first if the backend buffers data.
+func ConformanceOutput(t *testing.T, backend log.Backend, output func() string) {
+	t.Helper()
+
+	conformance(t, &suite{backend: backend, output: output})
+}
+
+type suite struct {
+	backend log.Backend
+	output  func() string
+}
+
+func conformance(t *testing.T, s *suite) {
+	t.Helper()
+
+	t.Run("levels", func(t *testing.T) {
+		testLevels(t, s)
+	})
+
+	t.Run("nil-data", func(t *testing.T) {
+		testNilData(t, s)
+	})
+
+	t.Run("huge-messages", func(t *testing.T) {
+		testHugeMessages(t, s)
+	})
+
+	t.Run("non-utf8", func(t *testing.T) {
+		testNonUTF8(t, s)
+	})
+
+	t.Run("concurrency", func(t *testing.T) {
+		testConcurrency(t, s)
+	})
+}
+
+func testLevels(t *testing.T, s *suite) {
+	logger := newLogger(s.backend)
+
+	output := s.run(t, func() {
+		logger.Debug(1, "debug message")
+		logger.Debug(9, "debug message with level %d", 9)
+		logger.Info("info message")
+		logger.Error("error message")
+
+		logger.DebugData(log.Data{"a": 1}, 1, "debug message with data")
+		logger.InfoData(log.Data{"a": 1}, "info message with data")
+		logger.ErrorData(log.Data{"a": 1}, "error message with data")
+	})
+
+	s.expectMessages(t, output, "debug message", "debug message with level 9",
+		"info message", "error message", "debug message with data",
+		"info message with data", "error message with data")
+}
+
+func testNilData(t *testing.T, s *suite) {
+	logger := newLogger(s.backend)
+
+	output := s.run(t, func() {
+		now := time.Now().UTC()
+
+		s.backend.Log(log.Message{
+			Time:    &now,
+			Level:   log.LevelInfo,
+			Message: "message without data",
+		})
+
+		logger.InfoData(nil, "message with nil data")
+		logger.InfoData(log.Data{"nil": nil}, "message with a nil datum")
+		logger.InfoData(log.Data{"nil": (*int)(nil)},
+			"message with a nil pointer datum")
+		logger.InfoData(log.Data{"": "empty key"},
+			"message with an empty key")
+	})
+
+	s.expectMessages(t, output, "message without data",
+		"message with nil data", "message with a nil datum",
+		"message with a nil pointer datum", "message with an empty key")
+}
+
+func testHugeMessages(t *testing.T, s *suite) {
+	logger := newLogger(s.backend)
+
+	huge := strings.Repeat("0123456789abcdef", 64*1024)
+
+	output := s.run(t, func() {
+		logger.Info("%s", huge)
+		logger.InfoData(log.Data{"huge": huge}, "message with huge data")
+
+		data := make(log.Data, 1000)
+		for i := 0; i < 1000; i++ {
+			data["key"+strings.Repeat("x", i%32)+string(rune('a'+i%26))] = i
+		}
+		logger.InfoData(data, "message with many data entries")
+	})
+
+	// Messages must not be truncated
+	s.expectMessages(t, output, huge, "message with huge data",
+		"message with many data entries")
+}
+
+func testNonUTF8(t *testing.T, s *suite) {
+	logger := newLogger(s.backend)
+
+	output := s.run(t, func() {
+		invalid := "invalid \xff\xfe utf-8 \xc3\x28 sequence"
+
+		logger.Info("%s", invalid)
+		logger.InfoData(log.Data{invalid: invalid}, "non utf-8 data")
+		logger.Info("control characters: \x00\x01\x1b[31m\t\r\n\x7f")
+		logger.InfoData(log.Data{"value": "\"]\\ \n="},
+			"special characters")
+	})
+
+	// Invalid sequences and control characters can be replaced or escaped
+	s.expectMessages(t, output, "non utf-8 data", "control characters:",
+		"special characters")
+}
+
+func testConcurrency(t *testing.T, s *suite) {
+	logger := newLogger(s.backend)
+
+	const nbGoroutines = 16
+	const nbMessages = 100
+
+	output := s.run(t, func() {
+		var wg sync.WaitGroup
+
+		for i := 0; i < nbGoroutines; i++ {
+			wg.Add(1)
+
+			go func(i int) {
+				defer wg.Done()
+
+				child := logger.Child("goroutine", log.Data{"goroutine": i})
+
+				for j := 0; j < nbMessages; j++ {
+					child.InfoData(log.Data{"j": j},
+						"concurrent message %02d/%03d", i, j)
+				}
+			}(i)
+		}
+
+		wg.Wait()
+	})
+
+	if s.output == nil {
+		return
+	}
+
+	// Each message must be written exactly once
+	for i := 0; i < nbGoroutines; i++ {
+		for j := 0; j < nbMessages; j++ {
+			msg := fmt.Sprintf("concurrent message %02d/%03d", i, j)
+
+			if n := strings.Count(output, msg); n != 1 {
+				t.Errorf("message %q written %d times", msg, n)
+			}
+		}
+	}
+}
+
+// Run a test function and return the output written by the backend in the
+// meantime.
+func (s *suite) run(t *testing.T, fn func()) string {
+	t.Helper()
+
+	if s.output == nil {
+		run(t, fn)
+		return ""
+	}
+
+	start := len(s.output())
+
+	run(t, fn)
+
+	output := s.output()
+	if len(output) < start {
+		t.Fatalf("output shrank from %d to %d bytes", start, len(output))
+	}
+
+	return output[start:]
+}
+
+func (s *suite) expectMessages(t *testing.T, output string, msgs ...string) {
+	t.Helper()
+
+	if s.output == nil {
+		return
+	}
+
+	for _, msg := range msgs {
+		if !strings.Contains(output, msg) {
+			if len(msg) > 64 {
+				msg = fmt.Sprintf("%s... (%d bytes)", msg[:64], len(msg))
+			}
+
+			t.Errorf("message %q not found in the output", msg)
+		}
+	}
+}
+
+func newLogger(backend log.Backend) *log.Logger {
+	return &log.Logger{
+		Backend:    backend,
+		Domain:     "backendtest",
+		Data:       log.Data{},
+		DebugLevel: 9,
+	}
+}
+
+func run(t *testing.T, fn func()) {
+	t.Helper()
+
+	done := make(chan interface{}, 1)
+
+	go func() {
+		defer func() {
+			done <- recover()
+		}()
+
+		fn()
+	}()
+
+	select {
+	case value := <-done:
+		if value != nil {
+			t.Fatalf("backend panicked: %v", value)
+		}
+
+	case <-time.After(Timeout):
+		t.Fatalf("backend blocked for more than %v", Timeout)
+	}
+}
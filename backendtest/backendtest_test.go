@@ -0,0 +1,121 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package backendtest_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/exograd/go-log"
+	"github.com/exograd/go-log/backendtest"
+)
+
+func TestFileBackend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+
+	backend, err := log.NewFileBackend(log.FileBackendCfg{
+		Path:       path,
+		BufferSize: 64 * 1024,
+	})
+	if err != nil {
+		t.Fatalf("cannot create file backend: %v", err)
+	}
+	defer backend.Close()
+
+	backendtest.ConformanceOutput(t, backend, func() string {
+		if err := backend.Flush(); err != nil {
+			t.Fatalf("cannot flush file backend: %v", err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("cannot read %q: %v", path, err)
+		}
+
+		return string(data)
+	})
+}
+
+func TestJSONBackend(t *testing.T) {
+	var buf bytes.Buffer
+
+	backend, err := log.NewJSONBackend(log.JSONBackendCfg{
+		Writer: &buf,
+	})
+	if err != nil {
+		t.Fatalf("cannot create json backend: %v", err)
+	}
+
+	backendtest.ConformanceOutput(t, backend, buf.String)
+}
+
+func TestWriterBackend(t *testing.T) {
+	var buf bytes.Buffer
+
+	backend, err := log.NewWriterBackend(log.WriterBackendCfg{
+		Writer: &buf,
+	})
+	if err != nil {
+		t.Fatalf("cannot create writer backend: %v", err)
+	}
+
+	backendtest.ConformanceOutput(t, backend, buf.String)
+}
+
+func TestRingBackend(t *testing.T) {
+	backend := log.NewRingBackend(log.RingBackendCfg{
+		Size: 10000,
+	})
+
+	backendtest.ConformanceOutput(t, backend, func() string {
+		var buf strings.Builder
+
+		for _, msg := range backend.Snapshot() {
+			buf.WriteString(msg.Message)
+			buf.WriteByte('\n')
+		}
+
+		return buf.String()
+	})
+}
+
+func TestTerminalBackend(t *testing.T) {
+	// The terminal backend always writes to the standard error output
+	path := filepath.Join(t.TempDir(), "stderr")
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("cannot create %q: %v", path, err)
+	}
+	defer file.Close()
+
+	stderr := os.Stderr
+	os.Stderr = file
+	defer func() { os.Stderr = stderr }()
+
+	backend := log.NewTerminalBackend(log.TerminalBackendCfg{})
+
+	backendtest.ConformanceOutput(t, backend, func() string {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("cannot read %q: %v", path, err)
+		}
+
+		return string(data)
+	})
+}
@@ -0,0 +1,596 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package backendtest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Wire servers record the bytes sent by network backends, so that their
+// output can be tested without any real collector.
+//
+// In record mode, frames received by the server are optionally forwarded to
+// an upstream collector, and are saved to a file when the server is checked.
+// In replay mode, frames are compared to the ones previously saved, and
+// HTTP responses are replayed in order.
+//
+// Each TCP connection is a frame, each UDP datagram is a frame, and each HTTP
+// request body is a frame. Interactive protocols, where the backend waits for
+// responses, are only supported over HTTP.
+//
+// Timestamps and other variable parts of frames are replaced by the
+// normalizers of the server before frames are saved or compared.
+
+// If set to a non-empty value, wire servers created with NewWireServer run
+// in record mode.
+const RecordEnvVar = "GO_LOG_RECORD"
+
+type Frame struct {
+	Data []byte
+
+	// HTTP frames only
+	Method         string
+	Path           string
+	ResponseStatus int
+	Response       []byte
+}
+
+type Normalizer func([]byte) []byte
+
+var rfc3339TimeRE = regexp.MustCompile(
+	`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})?`)
+
+// Replace all RFC 3339 timestamps by "<time>".
+func NormalizeTimes(data []byte) []byte {
+	return rfc3339TimeRE.ReplaceAll(data, []byte("<time>"))
+}
+
+var DefaultNormalizers = []Normalizer{NormalizeTimes}
+
+type WireServer struct {
+	Network     string
+	Path        string
+	Upstream    string
+	Record      bool
+	Normalizers []Normalizer
+
+	listener   net.Listener
+	packetConn net.PacketConn
+	httpServer *httptest.Server
+
+	expected []Frame
+
+	mut      sync.Mutex
+	frames   []Frame
+	wg       sync.WaitGroup
+	lastRead time.Time
+}
+
+// Create a wire server for a network ("tcp", "udp" or "http") using the
+// recording stored at a path. The server records frames if the environment
+// variable named by RecordEnvVar is set, forwarding them to the upstream
+// collector if there is one.
+func NewWireServer(t *testing.T, network, path, upstream string) *WireServer {
+	t.Helper()
+
+	s := &WireServer{
+		Network:     network,
+		Path:        path,
+		Upstream:    upstream,
+		Record:      os.Getenv(RecordEnvVar) != "",
+		Normalizers: DefaultNormalizers,
+	}
+
+	if !s.Record {
+		frames, err := ReadFrames(path)
+		if err != nil {
+			t.Fatalf("cannot read recording: %v", err)
+		}
+
+		s.expected = frames
+	}
+
+	if err := s.start(); err != nil {
+		t.Fatalf("cannot start wire server: %v", err)
+	}
+
+	t.Cleanup(func() {
+		s.Close()
+	})
+
+	return s
+}
+
+// Return the address of the server, or its URL for HTTP servers.
+func (s *WireServer) Addr() string {
+	switch {
+	case s.listener != nil:
+		return s.listener.Addr().String()
+	case s.packetConn != nil:
+		return s.packetConn.LocalAddr().String()
+	default:
+		return s.httpServer.URL
+	}
+}
+
+func (s *WireServer) Close() error {
+	switch {
+	case s.listener != nil:
+		s.listener.Close()
+	case s.packetConn != nil:
+		s.packetConn.Close()
+	default:
+		s.httpServer.Close()
+	}
+
+	s.wg.Wait()
+
+	return nil
+}
+
+// Return the normalized frames received so far.
+func (s *WireServer) Frames() []Frame {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	frames := make([]Frame, len(s.frames))
+	copy(frames, s.frames)
+
+	return frames
+}
+
+// Save received frames in record mode, or compare them to the recording in
+// replay mode. Backends must be flushed, and TCP backends closed, before the
+// server is checked.
+func (s *WireServer) Check(t *testing.T) {
+	t.Helper()
+
+	s.wait()
+
+	frames := s.Frames()
+
+	if s.Record {
+		if err := WriteFrames(s.Path, frames); err != nil {
+			t.Fatalf("cannot write recording: %v", err)
+		}
+
+		return
+	}
+
+	if len(frames) != len(s.expected) {
+		t.Errorf("received %d frames but %d were recorded",
+			len(frames), len(s.expected))
+	}
+
+	for i := 0; i < len(frames) && i < len(s.expected); i++ {
+		f, ef := frames[i], s.expected[i]
+
+		if f.Method != ef.Method || f.Path != ef.Path {
+			t.Errorf("frame %d: received request %s %s but %s %s was "+
+				"recorded", i, f.Method, f.Path, ef.Method, ef.Path)
+		}
+
+		if offset := diffOffset(f.Data, ef.Data); offset >= 0 {
+			t.Errorf("frame %d differs from the recording at offset %d:\n"+
+				"received: %q\nrecorded: %q", i, offset,
+				excerpt(f.Data, offset), excerpt(ef.Data, offset))
+		}
+	}
+}
+
+// Wait for frames still being received: TCP connections still open and UDP
+// datagrams still in flight.
+func (s *WireServer) wait() {
+	start := time.Now()
+	deadline := start.Add(Timeout)
+
+	for time.Now().Before(deadline) {
+		s.mut.Lock()
+		idle := time.Since(s.lastRead) > 100*time.Millisecond
+		complete := !s.Record && len(s.frames) >= len(s.expected)
+		s.mut.Unlock()
+
+		if complete || (idle && time.Since(start) > 200*time.Millisecond) {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (s *WireServer) normalize(data []byte) []byte {
+	for _, normalizer := range s.Normalizers {
+		data = normalizer(data)
+	}
+
+	return data
+}
+
+func (s *WireServer) addFrame(frame Frame) {
+	frame.Data = s.normalize(frame.Data)
+
+	s.mut.Lock()
+	s.frames = append(s.frames, frame)
+	s.mut.Unlock()
+}
+
+func (s *WireServer) touch() {
+	s.mut.Lock()
+	s.lastRead = time.Now()
+	s.mut.Unlock()
+}
+
+func (s *WireServer) start() error {
+	switch s.Network {
+	case "tcp":
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return err
+		}
+
+		s.listener = listener
+
+		s.wg.Add(1)
+		go s.acceptTCP()
+
+	case "udp":
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			return err
+		}
+
+		s.packetConn = conn
+
+		s.wg.Add(1)
+		go s.readUDP()
+
+	case "http":
+		s.httpServer = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	default:
+		return fmt.Errorf("unsupported network %q", s.Network)
+	}
+
+	return nil
+}
+
+func (s *WireServer) acceptTCP() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.touch()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.readTCP(conn)
+		}()
+	}
+}
+
+func (s *WireServer) readTCP(conn net.Conn) {
+	defer conn.Close()
+
+	var upstream net.Conn
+	if s.Record && s.Upstream != "" {
+		var err error
+		upstream, err = net.Dial("tcp", s.Upstream)
+		if err == nil {
+			defer upstream.Close()
+			go io.Copy(conn, upstream)
+		}
+	}
+
+	// The connection is considered active until it is closed, so that
+	// Check waits for it.
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.touch()
+			}
+		}
+	}()
+
+	var data bytes.Buffer
+	buf := make([]byte, 32*1024)
+
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			data.Write(buf[:n])
+
+			if upstream != nil {
+				upstream.Write(buf[:n])
+			}
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	s.addFrame(Frame{Data: data.Bytes()})
+}
+
+func (s *WireServer) readUDP() {
+	defer s.wg.Done()
+
+	var upstream net.Conn
+	if s.Record && s.Upstream != "" {
+		var err error
+		upstream, err = net.Dial("udp", s.Upstream)
+		if err == nil {
+			defer upstream.Close()
+		}
+	}
+
+	buf := make([]byte, 64*1024)
+
+	for {
+		n, _, err := s.packetConn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		s.touch()
+
+		data := make([]byte, n)
+		copy(data, buf[:n])
+
+		if upstream != nil {
+			upstream.Write(data)
+		}
+
+		s.addFrame(Frame{Data: data})
+	}
+}
+
+func (s *WireServer) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	s.touch()
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	frame := Frame{
+		Data:   body,
+		Method: req.Method,
+		Path:   req.URL.Path,
+	}
+
+	if s.Record {
+		frame.ResponseStatus = http.StatusOK
+
+		if s.Upstream != "" {
+			status, response, err := forwardHTTPRequest(s.Upstream, req, body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+
+			frame.ResponseStatus = status
+			frame.Response = response
+		}
+	} else {
+		s.mut.Lock()
+		i := len(s.frames)
+		s.mut.Unlock()
+
+		frame.ResponseStatus = http.StatusOK
+		if i < len(s.expected) {
+			frame.ResponseStatus = s.expected[i].ResponseStatus
+			frame.Response = s.expected[i].Response
+		}
+	}
+
+	s.addFrame(frame)
+
+	w.WriteHeader(frame.ResponseStatus)
+	w.Write(frame.Response)
+}
+
+func forwardHTTPRequest(upstream string, req *http.Request, body []byte) (int, []byte, error) {
+	uri := strings.TrimSuffix(upstream, "/") + req.URL.RequestURI()
+
+	req2, err := http.NewRequest(req.Method, uri, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	req2.Header = req.Header.Clone()
+
+	res, err := http.DefaultClient.Do(req2)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+
+	response, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return res.StatusCode, response, nil
+}
+
+// Recordings are text files containing a sequence of frames. Each frame
+// starts with a header line containing its size and, for HTTP frames, the
+// method and path of the request, followed by its data and a newline. HTTP
+// frames are followed by a response header line containing the status and
+// the size of the response, the response and a newline:
+//
+//	=== frame 11 POST /_bulk
+//	hello world
+//	=== response 200 2
+//	{}
+func WriteFrames(path string, frames []Frame) error {
+	var buf bytes.Buffer
+
+	for _, frame := range frames {
+		fmt.Fprintf(&buf, "=== frame %d", len(frame.Data))
+		if frame.Method != "" {
+			fmt.Fprintf(&buf, " %s %s", frame.Method, frame.Path)
+		}
+		buf.WriteByte('\n')
+		buf.Write(frame.Data)
+		buf.WriteByte('\n')
+
+		if frame.Method != "" {
+			fmt.Fprintf(&buf, "=== response %d %d\n", frame.ResponseStatus,
+				len(frame.Response))
+			buf.Write(frame.Response)
+			buf.WriteByte('\n')
+		}
+	}
+
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+func ReadFrames(path string) ([]Frame, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+
+	var frames []Frame
+
+	for {
+		header, err := r.ReadString('\n')
+		if err == io.EOF && header == "" {
+			return frames, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot read frame header: %w", err)
+		}
+
+		fields := strings.Fields(header)
+
+		switch {
+		case len(fields) >= 3 && fields[0] == "===" && fields[1] == "frame":
+			var frame Frame
+
+			if len(fields) == 5 {
+				frame.Method = fields[3]
+				frame.Path = fields[4]
+			}
+
+			frame.Data, err = readFrameData(r, fields[2])
+			if err != nil {
+				return nil, err
+			}
+
+			frames = append(frames, frame)
+
+		case len(fields) == 4 && fields[0] == "===" &&
+			fields[1] == "response" && len(frames) > 0:
+			frame := &frames[len(frames)-1]
+
+			frame.ResponseStatus, err = strconv.Atoi(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("invalid response status %q",
+					fields[2])
+			}
+
+			frame.Response, err = readFrameData(r, fields[3])
+			if err != nil {
+				return nil, err
+			}
+
+		default:
+			return nil, fmt.Errorf("invalid frame header %q",
+				strings.TrimSpace(header))
+		}
+	}
+}
+
+func readFrameData(r *bufio.Reader, sizeString string) ([]byte, error) {
+	size, err := strconv.Atoi(sizeString)
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("invalid frame size %q", sizeString)
+	}
+
+	data := make([]byte, size+1)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("cannot read frame data: %w", err)
+	}
+
+	if data[size] != '\n' {
+		return nil, fmt.Errorf("missing newline after frame data")
+	}
+
+	return data[:size], nil
+}
+
+func diffOffset(a, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return len(a)
+		}
+		return len(b)
+	}
+
+	return -1
+}
+
+func excerpt(data []byte, offset int) []byte {
+	start := offset - 32
+	if start < 0 {
+		start = 0
+	}
+
+	end := offset + 32
+	if end > len(data) {
+		end = len(data)
+	}
+
+	return data[start:end]
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package backendtest_test
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/exograd/go-log"
+	"github.com/exograd/go-log/backendtest"
+	"github.com/exograd/go-log/logtest"
+)
+
+// Recordings are updated by running the tests with GO_LOG_RECORD set, e.g.
+// against a local syslog daemon or Elasticsearch node used as upstream.
+// Messages have a fixed time, so frames are compared byte for byte; only
+// the process identifier in syslog frames is normalized.
+
+var wireTestTime = time.Date(2022, 3, 14, 15, 9, 26, 535000000, time.UTC)
+
+func wireTestMessages() []log.Message {
+	return []log.Message{
+		{
+			Time:    &wireTestTime,
+			Level:   log.LevelInfo,
+			Message: "server started",
+			Data:    log.Data{"port": 8080},
+		},
+		{
+			Time:       &wireTestTime,
+			Level:      log.LevelDebug,
+			DebugLevel: 1,
+			Message:    "special characters: \"quoted\" [bracket] \\ é",
+			Data:       log.Data{"value": "a\"b]c\\d"},
+		},
+		{
+			Time:    &wireTestTime,
+			Level:   log.LevelError,
+			Message: "cannot connect to the database",
+			Data:    log.Data{"error": "connection refused"},
+		},
+	}
+}
+
+// The PROCID header field of syslog frames is the identifier of the test
+// process.
+var syslogProcIDRE = regexp.MustCompile(` backendtest \d+ `)
+
+func normalizeSyslogProcID(data []byte) []byte {
+	return syslogProcIDRE.ReplaceAll(data, []byte(" backendtest <pid> "))
+}
+
+func TestWireSyslogUDP(t *testing.T) {
+	server := backendtest.NewWireServer(t, "udp", "testdata/syslog_udp.wire",
+		"")
+	server.Normalizers = []backendtest.Normalizer{normalizeSyslogProcID}
+
+	backend, err := log.NewSyslogBackend(log.SyslogBackendCfg{
+		Addr:            server.Addr(),
+		Transport:       log.SyslogTransportUDP,
+		ApplicationName: "backendtest",
+		Hostname:        "test-host",
+	})
+	if err != nil {
+		t.Fatalf("cannot create syslog backend: %v", err)
+	}
+
+	for _, msg := range wireTestMessages() {
+		backend.Log(msg)
+	}
+
+	server.Check(t)
+}
+
+func TestWireElasticsearch(t *testing.T) {
+	server := backendtest.NewWireServer(t, "http",
+		"testdata/elasticsearch.wire", "")
+	server.Normalizers = nil
+
+	failures := logtest.NewBackend()
+
+	backend, err := log.NewElasticsearchBackend(log.ElasticsearchBackendCfg{
+		URL:            server.Addr(),
+		Index:          "logs-{2006.01.02}",
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		WriteFailures:  &log.WriteFailureCfg{Backend: failures},
+	})
+	if err != nil {
+		t.Fatalf("cannot create elasticsearch backend: %v", err)
+	}
+	defer backend.Close()
+
+	backend.LogBatch(wireTestMessages())
+
+	if err := backend.Flush(); err != nil {
+		t.Fatalf("cannot flush elasticsearch backend: %v", err)
+	}
+
+	server.Check(t)
+
+	// The recorded responses reject the second document with status 429 the
+	// first time; it must be sent again on its own and accepted.
+	if entries := failures.Entries(); len(entries) > 0 {
+		t.Errorf("unexpected write failures: %v", entries)
+	}
+}
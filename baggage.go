@@ -0,0 +1,59 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"context"
+)
+
+// Baggage entries are key-value pairs propagated across services, e.g. by
+// OpenTelemetry. The library does not depend on any tracing implementation:
+// applications provide a function returning the baggage associated with a
+// context, typically built on top of go.opentelemetry.io/otel/baggage:
+//
+//	logger.Baggage = func(ctx context.Context) map[string]string {
+//		entries := make(map[string]string)
+//		for _, m := range baggage.FromContext(ctx).Members() {
+//			entries[m.Key()] = m.Value()
+//		}
+//		return entries
+//	}
+//
+// Only entries whose key is listed in LoggerCfg.BaggageKeys are added to
+// message data.
+type BaggageFunc func(context.Context) map[string]string
+
+const baggageDataKeyPrefix = "baggage."
+
+func (l *Logger) baggageData(ctx context.Context) Data {
+	if l.Baggage == nil || len(l.Cfg.BaggageKeys) == 0 {
+		return nil
+	}
+
+	entries := l.Baggage(ctx)
+	if len(entries) == 0 {
+		return nil
+	}
+
+	data := Data{}
+
+	for _, key := range l.Cfg.BaggageKeys {
+		if value, found := entries[key]; found {
+			data[baggageDataKeyPrefix+key] = value
+		}
+	}
+
+	return data
+}
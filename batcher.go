@@ -0,0 +1,201 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// The batcher accumulates messages and passes them to a flush function in
+// batches, either when enough messages are pending or at regular intervals.
+// It is used by backends sending messages to remote services.
+type BatchingCfg struct {
+	BatchSize     int           `json:"batch_size"`
+	FlushInterval time.Duration `json:"flush_interval"`
+
+	// The maximum number of messages waiting to be sent; new messages are
+	// dropped when the limit is reached.
+	MaxPending int `json:"max_pending"`
+}
+
+type batcher struct {
+	Cfg BatchingCfg
+
+	flushFunc func([]Message)
+
+	mut      sync.Mutex
+	messages []Message
+	dropped  int
+
+	flushMut sync.Mutex
+
+	sched  scheduler
+	wakeup func()
+	stop   func()
+
+	untrackQueue func()
+}
+
+func newBatcher(cfg BatchingCfg, flushFunc func([]Message)) *batcher {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+
+	if cfg.MaxPending <= 0 {
+		cfg.MaxPending = 10 * cfg.BatchSize
+	}
+
+	b := &batcher{
+		Cfg: cfg,
+
+		flushFunc: flushFunc,
+
+		sched: getScheduler(),
+	}
+
+	b.untrackQueue = trackQueue("batcher", b.pending)
+
+	b.wakeup, b.stop = b.sched.loop("batcher", cfg.FlushInterval, b.flush)
+
+	return b
+}
+
+func (b *batcher) add(msg Message) {
+	b.mut.Lock()
+
+	if len(b.messages) >= b.Cfg.MaxPending {
+		b.dropped++
+		b.mut.Unlock()
+		return
+	}
+
+	b.messages = append(b.messages, msg)
+	full := len(b.messages) >= b.Cfg.BatchSize
+
+	b.mut.Unlock()
+
+	if full {
+		b.wakeup()
+	}
+}
+
+// Add several messages at once; they are sent contiguously. Messages which
+// do not fit in the pending list are dropped.
+func (b *batcher) addBatch(msgs []Message) {
+	b.mut.Lock()
+
+	n := b.Cfg.MaxPending - len(b.messages)
+	if n < 0 {
+		n = 0
+	}
+
+	if n < len(msgs) {
+		b.dropped += len(msgs) - n
+		msgs = msgs[:n]
+	}
+
+	b.messages = append(b.messages, msgs...)
+	full := len(b.messages) >= b.Cfg.BatchSize
+
+	b.mut.Unlock()
+
+	if full {
+		b.wakeup()
+	}
+}
+
+func (b *batcher) pending() int {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	return len(b.messages)
+}
+
+// Return the number of messages dropped since the last call.
+func (b *batcher) takeDropped() int {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	dropped := b.dropped
+	b.dropped = 0
+
+	return dropped
+}
+
+// Send all pending messages.
+func (b *batcher) flush() {
+	b.flushMut.Lock()
+	defer b.flushMut.Unlock()
+
+	for {
+		b.mut.Lock()
+
+		n := len(b.messages)
+		if n > b.Cfg.BatchSize {
+			n = b.Cfg.BatchSize
+		}
+
+		batch := make([]Message, n)
+		copy(batch, b.messages[:n])
+		b.messages = b.messages[n:]
+
+		if len(b.messages) == 0 {
+			b.messages = nil
+		}
+
+		b.mut.Unlock()
+
+		if n == 0 {
+			return
+		}
+
+		b.flushFunc(batch)
+	}
+}
+
+func (b *batcher) close() {
+	b.stop()
+
+	b.flush()
+
+	b.untrackQueue()
+}
+
+// Wait before retrying to send a batch.
+func (b *batcher) sleep(d time.Duration) {
+	b.sched.sleep(d)
+}
+
+// Return the delay before a retry, using exponential backoff with jitter.
+// Attempts start at 1.
+func retryDelay(attempt int, initialDelay, maxDelay time.Duration) time.Duration {
+	delay := initialDelay
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	// Between 50% and 100% of the delay
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testBatches struct {
+	batches [][]string
+}
+
+func (tb *testBatches) flush(msgs []Message) {
+	batch := make([]string, len(msgs))
+	for i, msg := range msgs {
+		batch[i] = msg.Message
+	}
+
+	tb.batches = append(tb.batches, batch)
+}
+
+func newTestBatcher(t *testing.T, cfg BatchingCfg) (*batcher, *testBatches, *SimScheduler) {
+	sched := NewSimScheduler(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	t.Cleanup(SetSimScheduler(sched))
+
+	var tb testBatches
+	b := newBatcher(cfg, tb.flush)
+	t.Cleanup(b.close)
+
+	return b, &tb, sched
+}
+
+func addTestMessages(b *batcher, start, end int) {
+	for i := start; i < end; i++ {
+		b.add(Message{Message: fmt.Sprintf("m%d", i)})
+	}
+}
+
+func TestBatcherOrdering(t *testing.T) {
+	b, tb, sched := newTestBatcher(t, BatchingCfg{
+		BatchSize:     2,
+		FlushInterval: 10 * time.Second,
+	})
+
+	addTestMessages(b, 0, 5)
+
+	if n := sched.Tick(); n != 1 {
+		t.Fatalf("expected 1 flush, got %d", n)
+	}
+
+	expected := [][]string{{"m0", "m1"}, {"m2", "m3"}, {"m4"}}
+	if !reflect.DeepEqual(tb.batches, expected) {
+		t.Errorf("expected batches %v, got %v", expected, tb.batches)
+	}
+
+	b.addBatch([]Message{{Message: "m5"}, {Message: "m6"}, {Message: "m7"}})
+	sched.Tick()
+
+	expected = append(expected, []string{"m5", "m6"}, []string{"m7"})
+	if !reflect.DeepEqual(tb.batches, expected) {
+		t.Errorf("expected batches %v, got %v", expected, tb.batches)
+	}
+}
+
+func TestBatcherFlushInterval(t *testing.T) {
+	b, tb, sched := newTestBatcher(t, BatchingCfg{
+		BatchSize:     10,
+		FlushInterval: 10 * time.Second,
+	})
+
+	addTestMessages(b, 0, 3)
+
+	if n := sched.Tick(); n != 0 {
+		t.Fatalf("expected no flush before the batch is full, got %d", n)
+	}
+
+	sched.Advance(9 * time.Second)
+	if len(tb.batches) != 0 {
+		t.Fatalf("expected no batch before the flush interval, got %v",
+			tb.batches)
+	}
+
+	sched.Advance(time.Second)
+
+	expected := [][]string{{"m0", "m1", "m2"}}
+	if !reflect.DeepEqual(tb.batches, expected) {
+		t.Errorf("expected batches %v, got %v", expected, tb.batches)
+	}
+}
+
+func TestBatcherDrop(t *testing.T) {
+	b, tb, sched := newTestBatcher(t, BatchingCfg{
+		BatchSize:     10,
+		FlushInterval: 10 * time.Second,
+		MaxPending:    3,
+	})
+
+	addTestMessages(b, 0, 5)
+	b.addBatch([]Message{{Message: "m5"}})
+
+	if dropped := b.takeDropped(); dropped != 3 {
+		t.Errorf("expected 3 dropped messages, got %d", dropped)
+	}
+
+	if dropped := b.takeDropped(); dropped != 0 {
+		t.Errorf("expected dropped messages to be reset, got %d", dropped)
+	}
+
+	sched.Advance(10 * time.Second)
+
+	expected := [][]string{{"m0", "m1", "m2"}}
+	if !reflect.DeepEqual(tb.batches, expected) {
+		t.Errorf("expected batches %v, got %v", expected, tb.batches)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// Encode bursts of messages the way the JSON backend does, and report the
+// number of garbage collections per burst, with a new buffer for each burst
+// and with buffers obtained from the encoding buffer pool.
+func benchmarkEncodingBuffers(b *testing.B, getBuffer func() *bytes.Buffer, putBuffer func(*bytes.Buffer)) {
+	encoder := NewJSONEncoder(JSONEncoderCfg{})
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	msgs := make([]Message, 100)
+	for i := range msgs {
+		msgs[i] = Message{
+			Time:    &now,
+			Level:   LevelInfo,
+			Message: "GET /api/v1/projects/42/pipelines 200",
+			Data: Data{
+				"status":   200,
+				"duration": 0.0124,
+				"user":     "1234",
+			},
+		}
+	}
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	nbGC := stats.NumGC
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		buf := getBuffer()
+
+		for _, msg := range msgs {
+			encoder.EncodeMessage(msg, buf)
+			buf.WriteByte('\n')
+		}
+
+		io.Discard.Write(buf.Bytes())
+		putBuffer(buf)
+	}
+
+	b.StopTimer()
+
+	runtime.ReadMemStats(&stats)
+	b.ReportMetric(float64(stats.NumGC-nbGC)/float64(b.N), "gc/op")
+}
+
+func BenchmarkEncodingBuffersAllocated(b *testing.B) {
+	benchmarkEncodingBuffers(b, func() *bytes.Buffer {
+		return new(bytes.Buffer)
+	}, func(*bytes.Buffer) {})
+}
+
+func BenchmarkEncodingBuffersPooled(b *testing.B) {
+	benchmarkEncodingBuffers(b, getEncodingBuffer, putEncodingBuffer)
+}
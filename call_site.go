@@ -0,0 +1,90 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"sync"
+	"time"
+)
+
+// Call site rate limiting restricts the number of messages logged from each
+// call site (i.e. each location in the source code calling the logger) during
+// a period of time, whatever the content of these messages.
+type CallSiteRateLimitCfg struct {
+	Limit  int           `json:"limit"`
+	Period time.Duration `json:"period"`
+}
+
+type callSiteLimiter struct {
+	Cfg CallSiteRateLimitCfg
+
+	mut   sync.Mutex
+	sites map[uintptr]*callSiteWindow
+}
+
+type callSiteWindow struct {
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+func newCallSiteLimiter(cfg CallSiteRateLimitCfg) *callSiteLimiter {
+	if cfg.Limit <= 0 {
+		cfg.Limit = 10
+	}
+
+	if cfg.Period <= 0 {
+		cfg.Period = time.Second
+	}
+
+	return &callSiteLimiter{
+		Cfg: cfg,
+
+		sites: make(map[uintptr]*callSiteWindow),
+	}
+}
+
+// Return whether a message can be logged for a call site, and the number of
+// messages suppressed during the previous period if this is the first message
+// of a new period.
+func (l *callSiteLimiter) allow(pc uintptr, now time.Time) (bool, int) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	window, found := l.sites[pc]
+	if !found {
+		window = &callSiteWindow{start: now}
+		l.sites[pc] = window
+	}
+
+	var suppressed int
+
+	if now.Sub(window.start) >= l.Cfg.Period {
+		suppressed = window.suppressed
+
+		window.start = now
+		window.count = 0
+		window.suppressed = 0
+	}
+
+	if window.count >= l.Cfg.Limit {
+		window.suppressed++
+		return false, 0
+	}
+
+	window.count++
+
+	return true, suppressed
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"sync"
+)
+
+type captureRing struct {
+	mut      sync.Mutex
+	messages []Message
+	next     int
+	full     bool
+}
+
+func newCaptureRing(n int) *captureRing {
+	return &captureRing{
+		messages: make([]Message, n),
+	}
+}
+
+func (r *captureRing) add(msg Message) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	r.addUnlocked(msg)
+}
+
+func (r *captureRing) addBatch(msgs []Message) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	for _, msg := range msgs {
+		r.addUnlocked(msg)
+	}
+}
+
+// The function is unsafe and MUST be called with r.mut held.
+func (r *captureRing) addUnlocked(msg Message) {
+	r.messages[r.next] = msg
+
+	r.next++
+	if r.next == len(r.messages) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+func (r *captureRing) snapshot() []Message {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	return r.orderedMessages()
+}
+
+// Return all messages and empty the ring.
+func (r *captureRing) drain() []Message {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	messages := r.orderedMessages()
+
+	for i := range r.messages {
+		r.messages[i] = Message{}
+	}
+
+	r.next = 0
+	r.full = false
+
+	return messages
+}
+
+// The function is unsafe and MUST be called with r.mut held.
+func (r *captureRing) orderedMessages() []Message {
+	if !r.full {
+		messages := make([]Message, r.next)
+		copy(messages, r.messages[:r.next])
+		return messages
+	}
+
+	messages := make([]Message, 0, len(r.messages))
+	messages = append(messages, r.messages[r.next:]...)
+	messages = append(messages, r.messages[:r.next]...)
+	return messages
+}
+
+// Mirror the last n messages logged in an in-memory ring, in addition to
+// sending them to the backend. Capture is shared by the logger and all
+// loggers sharing the same root logger, including existing children. A value
+// of n lower or equal to zero disables capture.
+func (l *Logger) EnableCapture(n int) {
+	var ring *captureRing
+	if n > 0 {
+		ring = newCaptureRing(n)
+	}
+
+	if l.state == nil {
+		l.state = newRuntimeState()
+	}
+
+	l.state.capture.Store(ring)
+}
+
+// Return captured messages, oldest first.
+func (l *Logger) CapturedMessages() []Message {
+	ring := l.captureRing()
+	if ring == nil {
+		return nil
+	}
+
+	return ring.snapshot()
+}
+
+func (l *Logger) captureRing() *captureRing {
+	if l.state == nil {
+		return nil
+	}
+
+	return l.state.capture.Load().(*captureRing)
+}
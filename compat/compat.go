@@ -0,0 +1,171 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Package compat mirrors the API of the standard log package on top of
+// loggers, in order to ease the migration of programs using it. Print
+// functions log info messages; Fatal and Panic functions log error messages
+// before exiting or panicking.
+package compat
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/exograd/go-log"
+)
+
+type Logger struct {
+	Logger *log.Logger
+}
+
+var (
+	defaultLoggerMut sync.Mutex
+	defaultLogger    = New(log.DefaultLogger(""))
+)
+
+func New(logger *log.Logger) *Logger {
+	return &Logger{
+		Logger: logger,
+	}
+}
+
+// Set the logger used by package functions.
+func SetLogger(logger *log.Logger) {
+	defaultLoggerMut.Lock()
+	defaultLogger = New(logger)
+	defaultLoggerMut.Unlock()
+}
+
+func Default() *Logger {
+	defaultLoggerMut.Lock()
+	defer defaultLoggerMut.Unlock()
+
+	return defaultLogger
+}
+
+func (l *Logger) Print(args ...interface{}) {
+	l.print(1, fmt.Sprint(args...))
+}
+
+func (l *Logger) Printf(format string, args ...interface{}) {
+	l.print(1, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Println(args ...interface{}) {
+	l.print(1, sprintln(args...))
+}
+
+func (l *Logger) Fatal(args ...interface{}) {
+	l.fatal(1, fmt.Sprint(args...))
+}
+
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.fatal(1, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Fatalln(args ...interface{}) {
+	l.fatal(1, sprintln(args...))
+}
+
+func (l *Logger) Panic(args ...interface{}) {
+	l.panic(1, fmt.Sprint(args...))
+}
+
+func (l *Logger) Panicf(format string, args ...interface{}) {
+	l.panic(1, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Panicln(args ...interface{}) {
+	l.panic(1, sprintln(args...))
+}
+
+func Print(args ...interface{}) {
+	Default().print(1, fmt.Sprint(args...))
+}
+
+func Printf(format string, args ...interface{}) {
+	Default().print(1, fmt.Sprintf(format, args...))
+}
+
+func Println(args ...interface{}) {
+	Default().print(1, sprintln(args...))
+}
+
+func Fatal(args ...interface{}) {
+	Default().fatal(1, fmt.Sprint(args...))
+}
+
+func Fatalf(format string, args ...interface{}) {
+	Default().fatal(1, fmt.Sprintf(format, args...))
+}
+
+func Fatalln(args ...interface{}) {
+	Default().fatal(1, sprintln(args...))
+}
+
+func Panic(args ...interface{}) {
+	Default().panic(1, fmt.Sprint(args...))
+}
+
+func Panicf(format string, args ...interface{}) {
+	Default().panic(1, fmt.Sprintf(format, args...))
+}
+
+func Panicln(args ...interface{}) {
+	Default().panic(1, sprintln(args...))
+}
+
+// The depth is the number of stack frames between the caller of the compat
+// function and the function calling print, fatal or panic; it is passed to
+// the logger so that messages are attributed to their real call site.
+func (l *Logger) print(depth int, s string) {
+	l.Logger.LogDepth(depth+1, log.Message{
+		Level:   log.LevelInfo,
+		Message: s,
+	})
+}
+
+func (l *Logger) fatal(depth int, s string) {
+	l.Logger.LogDepth(depth+1, log.Message{
+		Level:   log.LevelError,
+		Message: s,
+	})
+
+	l.exit()
+}
+
+func (l *Logger) panic(depth int, s string) {
+	l.Logger.LogDepth(depth+1, log.Message{
+		Level:   log.LevelError,
+		Message: s,
+	})
+
+	panic(s)
+}
+
+// Pending messages are flushed before exiting when the backend supports it.
+func (l *Logger) exit() {
+	if backend, ok := l.Logger.Backend.(interface{ Flush() error }); ok {
+		backend.Flush()
+	}
+
+	os.Exit(1)
+}
+
+// Messages do not end with a newline character.
+func sprintln(args ...interface{}) string {
+	return strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+}
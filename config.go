@@ -0,0 +1,468 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Logger configurations can be composed from several JSON files, e.g. a base
+// configuration shared by multiple services and service-specific overrides.
+//
+// Files are merged in order, each file overriding the previous ones. A file
+// can include other files with the "include" member, containing a list of
+// paths relative to the directory of the file; included files are merged in
+// order before the content of the file itself.
+//
+// Objects are merged recursively. Other values, including arrays, replace the
+// previous value. A null value deletes the previous value.
+//
+// Configurations written for previous versions of the format are migrated
+// when they are decoded, before being merged.
+//
+// The "profiles" member contains named partial configurations, e.g. one for
+// each environment. LoadLoggerCfg merges into the configuration the profile
+// whose name is the value of the environment variable named by
+// ProfileEnvVar. If the variable is not set, or if the configuration does not
+// define any profile, no profile is used.
+
+const cfgIncludeKey = "include"
+
+// Version 1: a single backend defined by the "backend_type" and "backend"
+// members.
+//
+// Version 2: a list of backends in the "backends" member.
+const CurrentConfigVersion = 2
+
+const cfgProfilesKey = "profiles"
+
+var ProfileEnvVar = "GO_LOG_PROFILE"
+
+func LoadLoggerCfg(paths ...string) (LoggerCfg, error) {
+	var cfg LoggerCfg
+
+	value, err := loadCfgFiles(paths)
+	if err != nil {
+		return cfg, err
+	}
+
+	if err := decodeLoggerCfg(value, &cfg); err != nil {
+		return cfg, err
+	}
+
+	return cfg.ApplyProfile(os.Getenv(ProfileEnvVar))
+}
+
+// Return a copy of the configuration where a profile was merged. Profiles
+// are ignored if the name is empty or if the configuration does not define
+// any profile. Since the configuration is merged as a JSON value, fields
+// which cannot be encoded, such as LoggerCfg.Backend, are not preserved.
+func (cfg LoggerCfg) ApplyProfile(name string) (LoggerCfg, error) {
+	if name == "" || len(cfg.Profiles) == 0 {
+		return cfg, nil
+	}
+
+	profileData, found := cfg.Profiles[name]
+	if !found {
+		return cfg, fmt.Errorf("unknown profile %q", name)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(profileData))
+	decoder.UseNumber()
+
+	var profile map[string]interface{}
+	if err := decoder.Decode(&profile); err != nil {
+		return cfg, fmt.Errorf("invalid profile %q: %w", name, err)
+	}
+
+	value, err := cfgJSONValue(cfg)
+	if err != nil {
+		return cfg, err
+	}
+
+	delete(value, cfgProfilesKey)
+	value = mergeCfgValues(value, profile)
+
+	if err := mergeCfgV1BackendData(value); err != nil {
+		return cfg, fmt.Errorf("invalid profile %q: %w", name, err)
+	}
+
+	var cfg2 LoggerCfg
+	if err := decodeLoggerCfg(value, &cfg2); err != nil {
+		return cfg, fmt.Errorf("invalid profile %q: %w", name, err)
+	}
+
+	return cfg2, nil
+}
+
+func loadCfgFiles(paths []string) (map[string]interface{}, error) {
+	value := make(map[string]interface{})
+
+	for _, path := range paths {
+		fileValue, err := loadCfgFile(path, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		value = mergeCfgValues(value, fileValue)
+	}
+
+	if err := mergeCfgV1BackendData(value); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return value, nil
+}
+
+func loadCfgFile(path string, stack []string) (map[string]interface{}, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path %q: %w", path, err)
+	}
+
+	for _, p := range stack {
+		if p == absPath {
+			return nil, fmt.Errorf("circular inclusion of %q", path)
+		}
+	}
+	stack = append(stack, absPath)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %q: %w", path, err)
+	}
+
+	// Numbers are kept as is to avoid any loss of precision when the merged
+	// value is encoded again.
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value map[string]interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("cannot decode %q: %w", path, err)
+	} else if value == nil {
+		value = make(map[string]interface{})
+	}
+
+	includeValue, found := value[cfgIncludeKey]
+	delete(value, cfgIncludeKey)
+
+	if err := migrateCfgValue(value); err != nil {
+		return nil, fmt.Errorf("invalid configuration in %q: %w", path, err)
+	}
+
+	if !found {
+		return value, nil
+	}
+
+	includes, ok := includeValue.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid include list in %q", path)
+	}
+
+	dirPath := filepath.Dir(path)
+	baseValue := make(map[string]interface{})
+
+	for _, include := range includes {
+		includePath, ok := include.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid include list in %q", path)
+		}
+
+		if !filepath.IsAbs(includePath) {
+			includePath = filepath.Join(dirPath, includePath)
+		}
+
+		includeValue, err := loadCfgFile(includePath, stack)
+		if err != nil {
+			return nil, err
+		}
+
+		baseValue = mergeCfgValues(baseValue, includeValue)
+	}
+
+	return mergeCfgValues(baseValue, value), nil
+}
+
+func mergeCfgValues(base, override map[string]interface{}) map[string]interface{} {
+	value := make(map[string]interface{}, len(base))
+	for k, v := range base {
+		value[k] = v
+	}
+
+	for k, v := range override {
+		if v == nil {
+			delete(value, k)
+			continue
+		}
+
+		baseObj, isBaseObj := value[k].(map[string]interface{})
+		obj, isObj := v.(map[string]interface{})
+
+		if isBaseObj && isObj {
+			value[k] = mergeCfgValues(baseObj, obj)
+		} else {
+			value[k] = v
+		}
+	}
+
+	return value
+}
+
+func decodeLoggerCfg(value map[string]interface{}, cfg *LoggerCfg) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("cannot encode configuration: %w", err)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return nil
+}
+
+func (cfg *LoggerCfg) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value map[string]interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	} else if value == nil {
+		return nil
+	}
+
+	if err := migrateCfgValue(value); err != nil {
+		return err
+	}
+
+	data2, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	// Use a type without the UnmarshalJSON method to avoid infinite
+	// recursion.
+	type loggerCfg LoggerCfg
+	return json.Unmarshal(data2, (*loggerCfg)(cfg))
+}
+
+func migrateCfgValue(value map[string]interface{}) error {
+	version := 1
+
+	if versionValue, found := value["config_version"]; found {
+		var i int64
+
+		switch v := versionValue.(type) {
+		case json.Number:
+			var err error
+			if i, err = v.Int64(); err != nil {
+				return fmt.Errorf("invalid configuration version %q", v)
+			}
+		case float64:
+			i = int64(v)
+		case int:
+			i = int64(v)
+		default:
+			return fmt.Errorf("invalid configuration version %v", v)
+		}
+
+		version = int(i)
+	}
+
+	if version < 1 || version > CurrentConfigVersion {
+		return fmt.Errorf("unsupported configuration version %d", version)
+	}
+
+	if version == 1 {
+		migrateCfgValueV1(value)
+	}
+
+	value["config_version"] = CurrentConfigVersion
+
+	if profiles, ok := value[cfgProfilesKey].(map[string]interface{}); ok {
+		for name, profileValue := range profiles {
+			profile, ok := profileValue.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("invalid profile %q", name)
+			}
+
+			// Profiles use the version of the configuration containing
+			// them.
+			profile["config_version"] = version
+			if err := migrateCfgValue(profile); err != nil {
+				return fmt.Errorf("invalid profile %q: %w", name, err)
+			}
+			delete(profile, "config_version")
+		}
+	}
+
+	return nil
+}
+
+func migrateCfgValueV1(value map[string]interface{}) {
+	backendType, found := value["backend_type"]
+	if !found {
+		return
+	}
+
+	backend := map[string]interface{}{
+		"type": backendType,
+	}
+
+	if backendData, found := value["backend"]; found {
+		backend["backend"] = backendData
+	}
+
+	value["backends"] = []interface{}{backend}
+
+	delete(value, "backend_type")
+	delete(value, "backend")
+}
+
+// A version 1 file which overrides backend settings without redefining the
+// backend type only contains the "backend" member and cannot be migrated on
+// its own. Once files are merged, these settings are merged into the data of
+// the single backend of the configuration.
+func mergeCfgV1BackendData(value map[string]interface{}) error {
+	backendData, found := value["backend"]
+	if !found {
+		return nil
+	}
+
+	backendsValue, found := value["backends"]
+	if !found {
+		return nil
+	}
+
+	if _, found := value["backend_type"]; found {
+		return fmt.Errorf("cannot use both \"backends\" and \"backend_type\"")
+	}
+
+	backends, ok := backendsValue.([]interface{})
+	if !ok || len(backends) != 1 {
+		return fmt.Errorf("cannot apply \"backend\" settings to a " +
+			"configuration which does not contain exactly one backend")
+	}
+
+	backend, ok := backends[0].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid backend configuration")
+	}
+
+	backend2 := mergeCfgValues(backend, map[string]interface{}{
+		"backend": backendData,
+	})
+
+	value["backends"] = []interface{}{backend2}
+	delete(value, "backend")
+
+	return nil
+}
+
+// Keys whose values are secrets in backend configurations, in addition to
+// the default sensitive keys.
+var cfgSensitiveKeys = []string{"dsn"}
+
+// Return the configuration as a JSON value where secrets are redacted: values
+// associated with sensitive keys (see DefaultSensitiveKeys) or with one of
+// the extra keys, and passwords contained in URIs.
+func (cfg LoggerCfg) Redacted(extraKeys ...string) (map[string]interface{}, error) {
+	value, err := cfgJSONValue(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Backend != nil {
+		backendValue, err := cfgJSONValue(cfg.Backend)
+		if err != nil {
+			return nil, err
+		}
+
+		value["backend"] = backendValue
+	}
+
+	if backendValues, ok := value["backends"].([]interface{}); ok {
+		for i, backendCfg := range cfg.Backends {
+			if backendCfg.Backend == nil || i >= len(backendValues) {
+				continue
+			}
+
+			backendValue, err := cfgJSONValue(backendCfg.Backend)
+			if err != nil {
+				return nil, err
+			}
+
+			if obj, ok := backendValues[i].(map[string]interface{}); ok {
+				obj["backend"] = backendValue
+			}
+		}
+	}
+
+	keys := append(append([]string{}, cfgSensitiveKeys...), extraKeys...)
+
+	redactedValue := redactJSONValue(value, keys)
+	redactedValue = redactCfgURIs(redactedValue)
+
+	return redactedValue.(map[string]interface{}), nil
+}
+
+func cfgJSONValue(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode configuration: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value map[string]interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("cannot decode configuration: %w", err)
+	}
+
+	return value, nil
+}
+
+func redactCfgURIs(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = redactCfgURIs(child)
+		}
+		return v
+
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redactCfgURIs(child)
+		}
+		return v
+
+	case string:
+		if strings.Contains(v, "://") {
+			return redactURI(v)
+		}
+		return v
+
+	default:
+		return v
+	}
+}
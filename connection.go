@@ -0,0 +1,149 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A connection logger tracks the lifecycle of a long-lived connection such as
+// a WebSocket or a long-polling request. Its logger is a child logger whose
+// messages contain the identifier of the connection.
+type ConnectionLogger struct {
+	// The two counters must be the first fields so that they are 64 bit
+	// aligned on 32 bit platforms.
+	bytesIn  int64
+	bytesOut int64
+
+	Logger *Logger
+	Id     string
+
+	start time.Time
+
+	mut     sync.Mutex
+	lastErr error
+	closed  bool
+}
+
+func (l *Logger) OpenConnection(connectionType string, data Data) *ConnectionLogger {
+	id := generateId()
+
+	c := &ConnectionLogger{
+		Logger: l.Child("", MergeData(data, Data{
+			"connection_id":   id,
+			"connection_type": connectionType,
+		})),
+		Id: id,
+
+		start: time.Now(),
+	}
+
+	c.Logger.Info("%s connection opened", connectionType)
+
+	return c
+}
+
+func (c *ConnectionLogger) AddBytesIn(n int) {
+	atomic.AddInt64(&c.bytesIn, int64(n))
+}
+
+func (c *ConnectionLogger) AddBytesOut(n int) {
+	atomic.AddInt64(&c.bytesOut, int64(n))
+}
+
+// Record the last error which occurred on the connection; it will be logged
+// when the connection is closed.
+func (c *ConnectionLogger) SetError(err error) {
+	if err == nil {
+		return
+	}
+
+	c.mut.Lock()
+	c.lastErr = err
+	c.mut.Unlock()
+}
+
+// Log the closing of the connection. The code is protocol specific (e.g. a
+// WebSocket close code) and is ignored if it is zero. Only the first call
+// has an effect.
+func (c *ConnectionLogger) Close(code int, reason string) {
+	c.mut.Lock()
+	if c.closed {
+		c.mut.Unlock()
+		return
+	}
+	c.closed = true
+	lastErr := c.lastErr
+	c.mut.Unlock()
+
+	duration := time.Since(c.start)
+
+	data := Data{
+		"duration":  duration.Seconds(),
+		"bytes_in":  atomic.LoadInt64(&c.bytesIn),
+		"bytes_out": atomic.LoadInt64(&c.bytesOut),
+	}
+
+	if code != 0 {
+		data["close_code"] = code
+	}
+
+	if reason != "" {
+		data["close_reason"] = reason
+	}
+
+	if lastErr != nil {
+		data["last_error"] = lastErr.Error()
+	}
+
+	c.Logger.InfoData(data, "connection closed after %v",
+		duration.Round(time.Millisecond))
+}
+
+// Wrap a network connection so that bytes read and written and errors are
+// recorded automatically.
+func (c *ConnectionLogger) WrapConn(conn net.Conn) net.Conn {
+	return &loggedConn{Conn: conn, logger: c}
+}
+
+type loggedConn struct {
+	net.Conn
+
+	logger *ConnectionLogger
+}
+
+func (c *loggedConn) Read(data []byte) (int, error) {
+	n, err := c.Conn.Read(data)
+	c.logger.AddBytesIn(n)
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		c.logger.SetError(err)
+	}
+
+	return n, err
+}
+
+func (c *loggedConn) Write(data []byte) (int, error) {
+	n, err := c.Conn.Write(data)
+	c.logger.AddBytesOut(n)
+	c.logger.SetError(err)
+
+	return n, err
+}
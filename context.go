@@ -0,0 +1,95 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"context"
+)
+
+// Common request attributes are stored in contexts with dedicated keys so
+// that all components use the same data keys.
+
+type contextKey int
+
+const (
+	contextKeyRequestId contextKey = iota
+	contextKeyUserId
+	contextKeyTenant
+	contextKeyFlagRecorder
+)
+
+var contextDataKeys = []struct {
+	key     contextKey
+	dataKey string
+}{
+	{contextKeyRequestId, "request_id"},
+	{contextKeyUserId, "user_id"},
+	{contextKeyTenant, "tenant"},
+}
+
+func WithRequestId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKeyRequestId, id)
+}
+
+func WithUserId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKeyUserId, id)
+}
+
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, contextKeyTenant, tenant)
+}
+
+func RequestId(ctx context.Context) (string, bool) {
+	return contextString(ctx, contextKeyRequestId)
+}
+
+func UserId(ctx context.Context) (string, bool) {
+	return contextString(ctx, contextKeyUserId)
+}
+
+func Tenant(ctx context.Context) (string, bool) {
+	return contextString(ctx, contextKeyTenant)
+}
+
+func contextString(ctx context.Context, key contextKey) (string, bool) {
+	s, ok := ctx.Value(key).(string)
+	return s, ok
+}
+
+// Return the data associated with attributes stored in the context.
+func ContextData(ctx context.Context) Data {
+	data := Data{}
+
+	for _, k := range contextDataKeys {
+		if value, ok := contextString(ctx, k.key); ok {
+			data[k.dataKey] = value
+		}
+	}
+
+	return data
+}
+
+// Return a logger whose messages contain the data associated with attributes
+// and selected baggage entries stored in the context. If the context contains
+// a flag recorder, the logger uses it as flag provider.
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	child := l.Child("", MergeData(ContextData(ctx), l.baggageData(ctx)))
+
+	if recorder := ContextFlagRecorder(ctx); recorder != nil {
+		child.Flags = recorder
+	}
+
+	return child
+}
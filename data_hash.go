@@ -0,0 +1,263 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Canonical returns a serialization of data which only depends on their
+// content: keys are sorted at all levels and numbers are written the same way
+// whatever their type, so that int(1), uint8(1) and float64(1.0) are
+// identical. The output is JSON, but is not meant to be parsed: values which
+// cannot be represented are replaced by strings.
+func (data Data) Canonical() []byte {
+	var buf bytes.Buffer
+
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf.WriteByte('{')
+
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		writeJSONString(&buf, k)
+		buf.WriteByte(':')
+		writeCanonicalDatum(&buf, data[k])
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes()
+}
+
+// Hash returns the hexadecimal SHA-256 digest of the canonical serialization
+// of data (see Canonical).
+func (data Data) Hash() string {
+	sum := sha256.Sum256(data.Canonical())
+	return hex.EncodeToString(sum[:])
+}
+
+func writeCanonicalDatum(buf *bytes.Buffer, datum Datum) {
+	if isCyclicValue(reflect.ValueOf(datum), nil, 0) {
+		writeJSONString(buf, formatDatum2(datum))
+		return
+	}
+
+	writeCanonicalValue(buf, reflect.ValueOf(datum))
+}
+
+func writeCanonicalValue(buf *bytes.Buffer, v reflect.Value) {
+	if !v.IsValid() {
+		buf.WriteString("null")
+		return
+	}
+
+	if v.CanInterface() {
+		switch i := v.Interface().(type) {
+		case time.Time:
+			writeJSONString(buf, i.UTC().Format(time.RFC3339Nano))
+			return
+
+		case json.Number:
+			writeCanonicalNumber(buf, i)
+			return
+
+		case error:
+			if isNilValue(v) {
+				buf.WriteString("null")
+			} else {
+				writeJSONString(buf, formatDatum2(i))
+			}
+			return
+
+		case json.Marshaler:
+			if isNilValue(v) {
+				buf.WriteString("null")
+			} else {
+				writeCanonicalJSON(buf, i)
+			}
+			return
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		buf.WriteString(strconv.FormatBool(v.Bool()))
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		buf.WriteString(strconv.FormatInt(v.Int(), 10))
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		buf.WriteString(strconv.FormatUint(v.Uint(), 10))
+
+	case reflect.Float32, reflect.Float64:
+		writeCanonicalFloat(buf, v.Float())
+
+	case reflect.String:
+		writeJSONString(buf, v.String())
+
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			buf.WriteString("null")
+		} else {
+			writeCanonicalValue(buf, v.Elem())
+		}
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			buf.WriteString("null")
+			return
+		}
+
+		buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			writeCanonicalValue(buf, v.Index(i))
+		}
+		buf.WriteByte(']')
+
+	case reflect.Map:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return
+		}
+
+		type entry struct {
+			key   string
+			value reflect.Value
+		}
+
+		entries := make([]entry, 0, v.Len())
+
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key()
+
+			var keyString string
+			if key.Kind() == reflect.String {
+				keyString = key.String()
+			} else {
+				var keyBuf bytes.Buffer
+				writeCanonicalValue(&keyBuf, key)
+				keyString = keyBuf.String()
+			}
+
+			entries = append(entries, entry{keyString, iter.Value()})
+		}
+
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].key < entries[j].key
+		})
+
+		buf.WriteByte('{')
+		for i, e := range entries {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			writeJSONString(buf, e.key)
+			buf.WriteByte(':')
+			writeCanonicalValue(buf, e.value)
+		}
+		buf.WriteByte('}')
+
+	case reflect.Struct:
+		if v.CanInterface() {
+			writeCanonicalJSON(buf, v.Interface())
+		} else {
+			writeJSONString(buf, v.Type().String())
+		}
+
+	default:
+		writeJSONString(buf, v.Type().String())
+	}
+}
+
+// Integral values are written as integers so that the type used to store a
+// number does not change its representation.
+func writeCanonicalFloat(buf *bytes.Buffer, f float64) {
+	switch {
+	case math.IsNaN(f):
+		writeJSONString(buf, "NaN")
+	case math.IsInf(f, 1):
+		writeJSONString(buf, "+Inf")
+	case math.IsInf(f, -1):
+		writeJSONString(buf, "-Inf")
+	case f == math.Trunc(f) && math.Abs(f) < 1e18:
+		buf.WriteString(strconv.FormatInt(int64(f), 10))
+	default:
+		buf.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+}
+
+// Values whose structure is not known (structures and JSON marshalers) are
+// encoded to JSON then decoded to generic values.
+func writeCanonicalJSON(buf *bytes.Buffer, value interface{}) {
+	data, err := marshalJSONDatum(value)
+	if err != nil {
+		writeJSONString(buf, formatDatum2(value))
+		return
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		writeJSONString(buf, formatDatum2(value))
+		return
+	}
+
+	writeCanonicalValue(buf, reflect.ValueOf(generic))
+}
+
+func writeCanonicalNumber(buf *bytes.Buffer, n json.Number) {
+	if i, err := n.Int64(); err == nil {
+		buf.WriteString(strconv.FormatInt(i, 10))
+	} else if f, err := n.Float64(); err == nil {
+		writeCanonicalFloat(buf, f)
+	} else {
+		writeJSONString(buf, n.String())
+	}
+}
+
+func isNilValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil()
+	}
+
+	return false
+}
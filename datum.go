@@ -0,0 +1,205 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Data values are provided by the caller and can be anything. Formatting them
+// must never crash the process, whatever their String method does or however
+// their content is organized.
+
+const maxDatumDepth = 32
+
+func stringerString(v fmt.Stringer) (s string) {
+	defer func() {
+		if value := recover(); value != nil {
+			if isNilPointer(v) {
+				s = "<nil>"
+			} else {
+				s = fmt.Sprintf("!PANIC(String: %v)", value)
+			}
+		}
+	}()
+
+	return v.String()
+}
+
+func formatValue(v interface{}) (s string) {
+	switch v.(type) {
+	case nil, bool, string, int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprintf("%v", v)
+	}
+
+	value := reflect.ValueOf(v)
+
+	t := value.Type()
+	if t.Kind() == reflect.Ptr {
+		// Pointers are only dereferenced at the top level
+		t = t.Elem()
+	}
+
+	if mayContainCycle(t) && isCyclicValue(value, nil, 0) {
+		return fmt.Sprintf("!CYCLIC(%T)", v)
+	}
+
+	// The fmt package already recovers from panics in String, Error and
+	// Format methods, but we still want to be protected against any other
+	// kind of issue.
+	defer func() {
+		if value := recover(); value != nil {
+			s = fmt.Sprintf("!PANIC(%T: %v)", v, value)
+		}
+	}()
+
+	return fmt.Sprintf("%v", v)
+}
+
+func isNilPointer(v interface{}) bool {
+	value := reflect.ValueOf(v)
+	return value.Kind() == reflect.Ptr && value.IsNil()
+}
+
+// Return true if the value contains a reference cycle that would cause the
+// fmt package to recurse infinitely, or if it is nested too deeply. Note that
+// fmt only dereferences pointers at the top level, so we do not have to
+// follow them below.
+func isCyclicValue(v reflect.Value, path []uintptr, depth int) bool {
+	if depth > maxDatumDepth {
+		return true
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if depth > 0 || v.IsNil() {
+			return false
+		}
+
+		return isCyclicValue(v.Elem(), path, depth+1)
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return false
+		}
+
+		return isCyclicValue(v.Elem(), path, depth+1)
+
+	case reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return false
+		}
+
+		if !mayContainCycle(v.Type()) {
+			return false
+		}
+
+		ptr := v.Pointer()
+		for _, p := range path {
+			if p == ptr {
+				return true
+			}
+		}
+		path = append(path, ptr)
+
+		if v.Kind() == reflect.Map {
+			iter := v.MapRange()
+			for iter.Next() {
+				if isCyclicValue(iter.Key(), path, depth+1) ||
+					isCyclicValue(iter.Value(), path, depth+1) {
+					return true
+				}
+			}
+		} else {
+			for i := 0; i < v.Len(); i++ {
+				if isCyclicValue(v.Index(i), path, depth+1) {
+					return true
+				}
+			}
+		}
+
+	case reflect.Array:
+		if !mayContainCycle(v.Type().Elem()) {
+			return false
+		}
+
+		for i := 0; i < v.Len(); i++ {
+			if isCyclicValue(v.Index(i), path, depth+1) {
+				return true
+			}
+		}
+
+	case reflect.Struct:
+		if !mayContainCycle(v.Type()) {
+			return false
+		}
+
+		for i := 0; i < v.NumField(); i++ {
+			if isCyclicValue(v.Field(i), path, depth+1) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Whether values of each type can contain a reference cycle, so that the
+// whole value is only walked when necessary.
+var cyclicTypes sync.Map // reflect.Type -> bool
+
+// Return true if values of a type can contain a reference cycle or be nested
+// arbitrarily deep, i.e. if they can contain interfaces or recursive types. As
+// for isCyclicValue, pointers are not followed.
+func mayContainCycle(t reflect.Type) bool {
+	if value, found := cyclicTypes.Load(t); found {
+		return value.(bool)
+	}
+
+	cyclic := typeMayContainCycle(t, 0)
+	cyclicTypes.Store(t, cyclic)
+
+	return cyclic
+}
+
+func typeMayContainCycle(t reflect.Type, depth int) bool {
+	if depth > maxDatumDepth {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+
+	case reflect.Map:
+		return typeMayContainCycle(t.Key(), depth+1) ||
+			typeMayContainCycle(t.Elem(), depth+1)
+
+	case reflect.Slice, reflect.Array:
+		return typeMayContainCycle(t.Elem(), depth+1)
+
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if typeMayContainCycle(t.Field(i).Type, depth+1) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testPanickingStringer struct{}
+
+func (testPanickingStringer) String() string {
+	panic("invalid state")
+}
+
+type testValueStringer struct {
+	Name string
+}
+
+func (s testValueStringer) String() string {
+	return s.Name
+}
+
+type testRecursiveSlice []testRecursiveSlice
+
+func TestStringerString(t *testing.T) {
+	var nilStringer *testValueStringer
+
+	tests := []struct {
+		value    interface{ String() string }
+		expected string
+	}{
+		{testValueStringer{Name: "foo"}, "foo"},
+		{testPanickingStringer{}, "!PANIC(String: invalid state)"},
+		{nilStringer, "<nil>"},
+	}
+
+	for _, test := range tests {
+		if s := stringerString(test.value); s != test.expected {
+			t.Errorf("%#v was formatted as %q instead of %q",
+				test.value, s, test.expected)
+		}
+	}
+}
+
+func TestFormatValueCyclic(t *testing.T) {
+	slice := []interface{}{1, nil}
+	slice[1] = slice
+
+	m := map[string]interface{}{"a": 1}
+	m["b"] = m
+
+	nested := interface{}(42)
+	for i := 0; i < maxDatumDepth+1; i++ {
+		nested = []interface{}{nested}
+	}
+
+	structValue := struct {
+		Values []interface{}
+	}{
+		Values: slice,
+	}
+
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{slice, "!CYCLIC([]interface {})"},
+		{m, "!CYCLIC(map[string]interface {})"},
+		{nested, "!CYCLIC([]interface {})"},
+		{structValue, "!CYCLIC(struct { Values []interface {} })"},
+		{&structValue, "!CYCLIC(*struct { Values []interface {} })"},
+	}
+
+	for _, test := range tests {
+		if s := formatValue(test.value); s != test.expected {
+			t.Errorf("value was formatted as %q instead of %q",
+				s, test.expected)
+		}
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	type point struct {
+		X, Y int
+	}
+
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, "<nil>"},
+		{42, "42"},
+		{point{1, 2}, "{1 2}"},
+		{&point{1, 2}, "&{1 2}"},
+		{[]int{1, 2, 3}, "[1 2 3]"},
+		{map[string]int{"a": 1}, "map[a:1]"},
+		{[]interface{}{"a", []interface{}{1, 2}}, "[a [1 2]]"},
+	}
+
+	for _, test := range tests {
+		if s := formatValue(test.value); s != test.expected {
+			t.Errorf("%#v was formatted as %q instead of %q",
+				test.value, s, test.expected)
+		}
+	}
+}
+
+func TestMayContainCycle(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected bool
+	}{
+		{struct {
+			A int
+			B string
+		}{}, false},
+		{struct{ A []int }{}, false},
+		{[4]int{}, false},
+		{map[string][]string{}, false},
+		{struct{ A *struct{ B []interface{} } }{}, false},
+		{struct{ A []interface{} }{}, true},
+		{map[string]interface{}{}, true},
+		{[2]struct{ A interface{} }{}, true},
+		{testRecursiveSlice{}, true},
+	}
+
+	for _, test := range tests {
+		typ := reflect.TypeOf(test.value)
+
+		if cyclic := mayContainCycle(typ); cyclic != test.expected {
+			t.Errorf("type %v may contain a cycle: got %t instead of %t",
+				typ, cyclic, test.expected)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build !golog_nodebug
+// +build !golog_nodebug
+
+package log
+
+import (
+	"fmt"
+)
+
+// DebugEnabled is false when the program is built with the golog_nodebug build
+// tag, in which case debug functions do nothing.
+const DebugEnabled = true
+
+func (l *Logger) Debug(level int, format string, args ...interface{}) {
+	l.log(Message{
+		Level:      LevelDebug,
+		DebugLevel: level,
+		Message:    fmt.Sprintf(format, args...),
+
+		format: format,
+	}, 1)
+}
+
+func (l *Logger) DebugData(data Data, level int, format string, args ...interface{}) {
+	l.log(Message{
+		Level:      LevelDebug,
+		DebugLevel: level,
+		Message:    fmt.Sprintf(format, args...),
+		Data:       data,
+
+		format: format,
+	}, 1)
+}
+
+// Return nil if the message would be filtered; see Event.
+func (l *Logger) DebugEv(level int) *Event {
+	if l.CurrentDebugLevel() < level {
+		return nil
+	}
+
+	return l.newEvent(LevelDebug, level)
+}
+
+func (o *OnceLogger) Debug(level int, format string, args ...interface{}) {
+	o.log(Message{
+		Level:      LevelDebug,
+		DebugLevel: level,
+		Message:    fmt.Sprintf(format, args...),
+	})
+}
+
+func (o *OnceLogger) DebugData(data Data, level int, format string, args ...interface{}) {
+	o.log(Message{
+		Level:      LevelDebug,
+		DebugLevel: level,
+		Message:    fmt.Sprintf(format, args...),
+		Data:       data,
+	})
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build golog_nodebug
+// +build golog_nodebug
+
+package log
+
+// When the program is built with the golog_nodebug build tag, debug functions
+// do nothing. Since they are trivially inlined, the compiler removes calls
+// and the evaluation of arguments without side effects. Call sites where
+// arguments are expensive to compute can be guarded with DebugEnabled to be
+// removed entirely:
+//
+//	if log.DebugEnabled {
+//		logger.Debug(1, "state: %s", dumpState())
+//	}
+const DebugEnabled = false
+
+func (l *Logger) Debug(level int, format string, args ...interface{}) {
+}
+
+func (l *Logger) DebugData(data Data, level int, format string, args ...interface{}) {
+}
+
+func (l *Logger) DebugEv(level int) *Event {
+	return nil
+}
+
+func (o *OnceLogger) Debug(level int, format string, args ...interface{}) {
+}
+
+func (o *OnceLogger) DebugData(data Data, level int, format string, args ...interface{}) {
+}
@@ -0,0 +1,264 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Degradation protects the program when logging cannot keep up, e.g. when a
+// backend is down and messages accumulate in batching queues. The logger
+// moves through the following levels:
+//
+//   - full: all messages are logged;
+//   - sampled: only one non-error message out of n is logged;
+//   - errors_only: only error messages are logged;
+//   - emergency: only error messages are logged, and they are sent to the
+//     emergency backend (stderr by default) instead of the regular
+//     backends.
+//
+// The level is computed at regular intervals from the number of messages
+// waiting in batching queues and from the number of backends failing
+// repeatedly. The logger moves down the ladder as soon as a threshold is
+// reached, and moves back up one level at a time once conditions have stayed
+// below the threshold of the current level during the recovery delay.
+//
+// Level changes are reported in the internal domain.
+type DegradationCfg struct {
+	// Queue depths at which each level is entered.
+	SampledQueueDepth    int `json:"sampled_queue_depth"`
+	ErrorsOnlyQueueDepth int `json:"errors_only_queue_depth"`
+	EmergencyQueueDepth  int `json:"emergency_queue_depth"`
+
+	// The number of failing backends at which messages are sampled. Backends
+	// are considered to be failing once write failures are escalated (see
+	// WriteFailureCfg).
+	SampledFailingBackends int `json:"sampled_failing_backends"`
+
+	SampleThereafter int `json:"sample_thereafter"`
+
+	CheckInterval time.Duration `json:"check_interval"`
+	RecoveryDelay time.Duration `json:"recovery_delay"`
+
+	EmergencyBackend Backend `json:"-"`
+}
+
+type DegradationLevel int
+
+const (
+	DegradationFull DegradationLevel = iota
+	DegradationSampled
+	DegradationErrorsOnly
+	DegradationEmergency
+)
+
+func (l DegradationLevel) String() string {
+	switch l {
+	case DegradationFull:
+		return "full"
+	case DegradationSampled:
+		return "sampled"
+	case DegradationErrorsOnly:
+		return "errors_only"
+	case DegradationEmergency:
+		return "emergency"
+	default:
+		return fmt.Sprintf("DegradationLevel(%d)", int(l))
+	}
+}
+
+type degradation struct {
+	Cfg DegradationCfg
+
+	level     int32
+	nextCheck int64
+	counter   uint64
+	dropped   uint64
+
+	mut           sync.Mutex
+	recoveryStart time.Time
+}
+
+func newDegradation(cfg DegradationCfg) *degradation {
+	if cfg.SampledQueueDepth <= 0 {
+		cfg.SampledQueueDepth = 1000
+	}
+
+	if cfg.ErrorsOnlyQueueDepth <= 0 {
+		cfg.ErrorsOnlyQueueDepth = 5000
+	}
+
+	if cfg.EmergencyQueueDepth <= 0 {
+		cfg.EmergencyQueueDepth = 20000
+	}
+
+	if cfg.SampledFailingBackends <= 0 {
+		cfg.SampledFailingBackends = 1
+	}
+
+	if cfg.SampleThereafter <= 0 {
+		cfg.SampleThereafter = 10
+	}
+
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = time.Second
+	}
+
+	if cfg.RecoveryDelay <= 0 {
+		cfg.RecoveryDelay = 30 * time.Second
+	}
+
+	if cfg.EmergencyBackend == nil {
+		cfg.EmergencyBackend = NewTerminalBackend(TerminalBackendCfg{})
+	}
+
+	return &degradation{
+		Cfg: cfg,
+	}
+}
+
+func (d *degradation) currentLevel() DegradationLevel {
+	return DegradationLevel(atomic.LoadInt32(&d.level))
+}
+
+// Return the backend the message must be sent to, or nil if the message
+// must be dropped.
+func (d *degradation) route(msg Message, backend Backend, now time.Time) Backend {
+	nextCheck := atomic.LoadInt64(&d.nextCheck)
+	if now.UnixNano() >= nextCheck &&
+		atomic.CompareAndSwapInt64(&d.nextCheck, nextCheck,
+			now.Add(d.Cfg.CheckInterval).UnixNano()) {
+		d.check(now, backend)
+	}
+
+	level := d.currentLevel()
+
+	switch {
+	case level == DegradationFull:
+		return backend
+
+	case msg.Level == LevelError:
+		if level == DegradationEmergency {
+			return d.Cfg.EmergencyBackend
+		}
+		return backend
+
+	case level == DegradationSampled:
+		n := atomic.AddUint64(&d.counter, 1)
+		if n%uint64(d.Cfg.SampleThereafter) == 0 {
+			return backend
+		}
+	}
+
+	atomic.AddUint64(&d.dropped, 1)
+	return nil
+}
+
+func (d *degradation) targetLevel() DegradationLevel {
+	depth := pendingMessageCount()
+
+	switch {
+	case depth >= d.Cfg.EmergencyQueueDepth:
+		return DegradationEmergency
+	case depth >= d.Cfg.ErrorsOnlyQueueDepth:
+		return DegradationErrorsOnly
+	case depth >= d.Cfg.SampledQueueDepth:
+		return DegradationSampled
+	case failingBackendCount() >= d.Cfg.SampledFailingBackends:
+		return DegradationSampled
+	default:
+		return DegradationFull
+	}
+}
+
+func (d *degradation) check(now time.Time, backend Backend) {
+	target := d.targetLevel()
+
+	d.mut.Lock()
+
+	level := d.currentLevel()
+	newLevel := level
+
+	switch {
+	case target > level:
+		newLevel = target
+		d.recoveryStart = time.Time{}
+
+	case target < level:
+		if d.recoveryStart.IsZero() {
+			d.recoveryStart = now
+		} else if now.Sub(d.recoveryStart) >= d.Cfg.RecoveryDelay {
+			newLevel = level - 1
+			d.recoveryStart = now
+		}
+
+	default:
+		d.recoveryStart = time.Time{}
+	}
+
+	if newLevel != level {
+		atomic.StoreInt32(&d.level, int32(newLevel))
+	}
+
+	d.mut.Unlock()
+
+	if newLevel == level {
+		return
+	}
+
+	dropped := atomic.SwapUint64(&d.dropped, 0)
+
+	logLevel := LevelError
+	if newLevel < level {
+		logLevel = LevelInfo
+	}
+
+	t := now.UTC()
+	reportMsg := Message{
+		Time:  &t,
+		Level: logLevel,
+		Message: fmt.Sprintf("logging degradation level changed from %s "+
+			"to %s", level, newLevel),
+		Data: Data{
+			"degradation_level": newLevel.String(),
+			"queue_depth":       pendingMessageCount(),
+			"failing_backends":  failingBackendCount(),
+			"dropped_messages":  dropped,
+		},
+
+		domain: InternalDomain,
+	}
+
+	if newLevel == DegradationEmergency || level == DegradationEmergency {
+		d.Cfg.EmergencyBackend.Log(reportMsg)
+	}
+
+	if newLevel != DegradationEmergency {
+		backend.Log(reportMsg)
+	}
+}
+
+// Return the current degradation level, which is always full if degradation
+// is not enabled.
+func (l *Logger) DegradationLevel() DegradationLevel {
+	if l.degradation == nil {
+		return DegradationFull
+	}
+
+	return l.degradation.currentLevel()
+}
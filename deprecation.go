@@ -0,0 +1,59 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"time"
+)
+
+// Log a deprecation warning for a feature, at most once per process. The
+// removal string indicates when the feature will be removed (e.g. a version
+// number or a date) and can be empty.
+//
+// Deprecation messages always contain the "deprecated_feature" data entry,
+// and "deprecated_removal" if the removal is known, so that deprecated usage
+// can be inventoried from logs.
+func (l *Logger) Deprecated(feature, removal string, format string, args ...interface{}) {
+	if !claimOnceKey("deprecated:"+feature, 0, time.Now()) {
+		return
+	}
+
+	var text string
+	if format == "" {
+		if removal == "" {
+			text = fmt.Sprintf("%s is deprecated", feature)
+		} else {
+			text = fmt.Sprintf("%s is deprecated and will be removed in %s",
+				feature, removal)
+		}
+	} else {
+		text = fmt.Sprintf(format, args...)
+	}
+
+	data := Data{
+		"deprecated_feature": feature,
+	}
+
+	if removal != "" {
+		data["deprecated_removal"] = removal
+	}
+
+	l.log(Message{
+		Level:   LevelInfo,
+		Message: text,
+		Data:    data,
+	}, 1)
+}
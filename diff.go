@@ -0,0 +1,129 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+// Diff returns the fields which differ between two values, each one
+// associated with a datum containing the "old" and "new" values; a side is
+// omitted when the field does not exist in the corresponding value. Values
+// are compared through their JSON representation so that structures, maps
+// and Data can be used. Nested objects are walked, their fields being
+// identified by dot-separated paths, while arrays are compared as a whole.
+// Values of sensitive fields are redacted.
+//
+// If one of the values is not an object, the whole values are compared and
+// reported using the "value" key.
+func Diff(before, after interface{}) Data {
+	data := Data{}
+
+	v1 := diffValue(before)
+	v2 := diffValue(after)
+
+	m1, ok1 := v1.(map[string]interface{})
+	m2, ok2 := v2.(map[string]interface{})
+
+	if ok1 && ok2 {
+		diffObjects("", m1, m2, false, data)
+	} else if !reflect.DeepEqual(v1, v2) {
+		data["value"] = diffEntry(v1, v2, true, true, false)
+	}
+
+	return data
+}
+
+func diffValue(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return formatDatum2(value)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return formatDatum2(value)
+	}
+
+	return v
+}
+
+func diffObjects(prefix string, m1, m2 map[string]interface{},
+	sensitive bool, data Data) {
+	keys := make([]string, 0, len(m1)+len(m2))
+	for key := range m1 {
+		keys = append(keys, key)
+	}
+	for key := range m2 {
+		if _, found := m1[key]; !found {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		keySensitive := sensitive || isSensitiveKey(key, nil)
+
+		v1, found1 := m1[key]
+		v2, found2 := m2[key]
+
+		if found1 && found2 {
+			c1, ok1 := v1.(map[string]interface{})
+			c2, ok2 := v2.(map[string]interface{})
+
+			if ok1 && ok2 {
+				diffObjects(path, c1, c2, keySensitive, data)
+				continue
+			}
+
+			if reflect.DeepEqual(v1, v2) {
+				continue
+			}
+		}
+
+		data[path] = diffEntry(v1, v2, found1, found2, keySensitive)
+	}
+}
+
+func diffEntry(v1, v2 interface{}, found1, found2, sensitive bool) Datum {
+	entry := make(map[string]interface{}, 2)
+
+	if found1 {
+		if sensitive {
+			v1 = RedactedValue
+		}
+		entry["old"] = redactJSONValue(v1, nil)
+	}
+
+	if found2 {
+		if sensitive {
+			v2 = RedactedValue
+		}
+		entry["new"] = redactJSONValue(v2, nil)
+	}
+
+	return entry
+}
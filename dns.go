@@ -0,0 +1,163 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+type DNSLoggingCfg struct {
+	// The debug level of messages for successful operations. The default
+	// level is 1.
+	DebugLevel int `json:"debug_level"`
+
+	// Only log one successful operation out of n. Failures and slow
+	// operations are always logged.
+	SampleRate int `json:"sample_rate"`
+
+	// Operations slower than this threshold are logged at info level. The
+	// default threshold is one second.
+	SlowThreshold time.Duration `json:"slow_threshold"`
+}
+
+// A DNS logger wraps a resolver and a dialer to log DNS lookups and dial
+// attempts. Its resolver logs connections to DNS servers; it can be used as
+// net.DefaultResolver to observe all lookups performed by the Go resolver.
+type DNSLogger struct {
+	// The counter must be the first field so that it is 64 bit aligned on
+	// 32 bit platforms.
+	counter uint64
+
+	Cfg      DNSLoggingCfg
+	Logger   *Logger
+	Resolver *net.Resolver
+	Dialer   *net.Dialer
+}
+
+func NewDNSLogger(logger *Logger, cfg DNSLoggingCfg) *DNSLogger {
+	if cfg.DebugLevel <= 0 {
+		cfg.DebugLevel = 1
+	}
+
+	if cfg.SampleRate <= 0 {
+		cfg.SampleRate = 1
+	}
+
+	if cfg.SlowThreshold <= 0 {
+		cfg.SlowThreshold = time.Second
+	}
+
+	d := &DNSLogger{
+		Cfg:    cfg,
+		Logger: logger,
+	}
+
+	var serverDialer net.Dialer
+
+	d.Resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			start := time.Now()
+			conn, err := serverDialer.DialContext(ctx, network, address)
+			d.logOperation("dns server connection", Data{
+				"network": network,
+				"address": address,
+			}, start, err)
+			return conn, err
+		},
+	}
+
+	d.Dialer = &net.Dialer{
+		Resolver: d.Resolver,
+	}
+
+	return d
+}
+
+func (d *DNSLogger) LookupHost(ctx context.Context, host string) ([]string, error) {
+	start := time.Now()
+	addrs, err := d.Resolver.LookupHost(ctx, host)
+
+	d.logOperation("dns lookup", Data{
+		"host":      host,
+		"addresses": addrs,
+	}, start, err)
+
+	return addrs, err
+}
+
+func (d *DNSLogger) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	start := time.Now()
+	addrs, err := d.Resolver.LookupIPAddr(ctx, host)
+
+	addrStrings := make([]string, len(addrs))
+	for i, addr := range addrs {
+		addrStrings[i] = addr.String()
+	}
+
+	d.logOperation("dns lookup", Data{
+		"host":      host,
+		"addresses": addrStrings,
+	}, start, err)
+
+	return addrs, err
+}
+
+// DialContext has the same signature as the DialContext field of
+// http.Transport so that it can be used for HTTP clients.
+func (d *DNSLogger) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	start := time.Now()
+	conn, err := d.Dialer.DialContext(ctx, network, address)
+
+	data := Data{
+		"network": network,
+		"address": address,
+	}
+
+	if conn != nil {
+		data["remote_addr"] = conn.RemoteAddr().String()
+	}
+
+	d.logOperation("dial", data, start, err)
+
+	return conn, err
+}
+
+func (d *DNSLogger) logOperation(operation string, data Data, start time.Time, err error) {
+	duration := time.Since(start)
+	data["duration"] = duration.Seconds()
+
+	switch {
+	case err != nil:
+		d.Logger.ErrorData(data, "%s failed after %v: %v", operation,
+			duration.Round(time.Microsecond), err)
+
+	case duration >= d.Cfg.SlowThreshold:
+		d.Logger.InfoData(data, "slow %s: %v", operation,
+			duration.Round(time.Microsecond))
+
+	default:
+		n := atomic.AddUint64(&d.counter, 1)
+		if n%uint64(d.Cfg.SampleRate) != 0 {
+			return
+		}
+
+		d.Logger.DebugData(data, d.Cfg.DebugLevel, "%s succeeded in %v",
+			operation, duration.Round(time.Microsecond))
+	}
+}
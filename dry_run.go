@@ -0,0 +1,53 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+// In dry-run mode, backends writing to files, sockets or system services are
+// replaced by the terminal backend, and each message is annotated with the
+// destination it would have been sent to. Dry-run mode is enabled either
+// globally or in the configuration of a logger; the global switch must be
+// set before loggers are created.
+var DryRun bool
+
+const DryRunDestinationKey = "dry_run_destination"
+
+type dryRunBackend struct {
+	backend     *TerminalBackend
+	destination string
+}
+
+func newDryRunBackend(backendType BackendType, endpoint string) *dryRunBackend {
+	destination := string(backendType)
+	if endpoint != "" {
+		destination += ":" + endpoint
+	}
+
+	b := dryRunBackend{
+		backend:     NewTerminalBackend(TerminalBackendCfg{}),
+		destination: destination,
+	}
+
+	return &b
+}
+
+func (b *dryRunBackend) Log(msg Message) {
+	msg.Data = MergeData(msg.Data, Data{DryRunDestinationKey: b.destination})
+	b.backend.Log(msg)
+}
+
+// Dry run backends do not hold any resource.
+func (b *dryRunBackend) Close() error {
+	return nil
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+type EncoderType string
+
+const (
+	EncoderTypeText    EncoderType = "text"
+	EncoderTypeJSON    EncoderType = "json"
+	EncoderTypeW3C     EncoderType = "w3c"
+	EncoderTypeRFC5424 EncoderType = "rfc5424"
+	EncoderTypeLEEF    EncoderType = "leef"
+)
+
+// Encoders are used by backends writing messages to files or streams.
+type Encoder interface {
+	// Append the representation of a message to a buffer, without any
+	// trailing newline character.
+	EncodeMessage(msg Message, buf *bytes.Buffer) error
+}
+
+// Encoders for formats whose files start with a header implement the
+// HeaderEncoder interface. As for messages, the header is written without any
+// trailing newline character.
+type HeaderEncoder interface {
+	EncodeHeader(buf *bytes.Buffer) error
+}
+
+func NewEncoder(encoderType EncoderType, encoderData *json.RawMessage) (Encoder, error) {
+	encoderCfg := func(cfgObj interface{}) error {
+		if encoderData == nil {
+			return nil
+		}
+
+		if err := json.Unmarshal(*encoderData, cfgObj); err != nil {
+			return fmt.Errorf("invalid encoder configuration: %w", err)
+		}
+
+		return nil
+	}
+
+	switch encoderType {
+	case EncoderTypeText:
+		var cfg TextEncoderCfg
+		if err := encoderCfg(&cfg); err != nil {
+			return nil, err
+		}
+		return NewTextEncoder(cfg), nil
+
+	case EncoderTypeJSON:
+		var cfg JSONEncoderCfg
+		if err := encoderCfg(&cfg); err != nil {
+			return nil, err
+		}
+		return NewJSONEncoder(cfg), nil
+
+	case EncoderTypeW3C:
+		var cfg W3CEncoderCfg
+		if err := encoderCfg(&cfg); err != nil {
+			return nil, err
+		}
+		return NewW3CEncoder(cfg), nil
+
+	case EncoderTypeRFC5424:
+		var cfg RFC5424EncoderCfg
+		if err := encoderCfg(&cfg); err != nil {
+			return nil, err
+		}
+		if cfg.Validation != nil {
+			if err := cfg.Validation.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid validation configuration: %w",
+					err)
+			}
+		}
+		return NewRFC5424Encoder(cfg), nil
+
+	case EncoderTypeLEEF:
+		var cfg LEEFEncoderCfg
+		if err := encoderCfg(&cfg); err != nil {
+			return nil, err
+		}
+		return NewLEEFEncoder(cfg)
+
+	case "":
+		return nil, fmt.Errorf("missing or empty encoder type")
+
+	default:
+		return nil, fmt.Errorf("invalid encoder type %q", encoderType)
+	}
+}
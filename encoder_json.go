@@ -0,0 +1,252 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// The JSON encoder writes each message as a JSON object containing the time,
+// level, domain, message and data of the message.
+type JSONEncoderCfg struct {
+	// Sort data keys, making the output deterministic at the cost of a small
+	// overhead.
+	SortKeys bool `json:"sort_keys"`
+
+	// Use the field names of the JSON log format of AWS Lambda, so that
+	// CloudWatch Logs can parse messages: "timestamp" instead of "time",
+	// upper case levels, and the "request_id" data entry written as the
+	// top-level "requestId" field.
+	CloudWatch bool `json:"cloudwatch"`
+}
+
+type JSONEncoder struct {
+	Cfg JSONEncoderCfg
+}
+
+func NewJSONEncoder(cfg JSONEncoderCfg) *JSONEncoder {
+	return &JSONEncoder{
+		Cfg: cfg,
+	}
+}
+
+func (e *JSONEncoder) EncodeMessage(msg Message, buf *bytes.Buffer) error {
+	var t time.Time
+	if msg.Time != nil {
+		t = msg.Time.UTC()
+	} else {
+		t = time.Now().UTC()
+	}
+
+	var timestamp [64]byte
+
+	data := msg.Data
+
+	if e.Cfg.CloudWatch {
+		buf.WriteString(`{"timestamp":"`)
+		buf.Write(t.AppendFormat(timestamp[:0], time.RFC3339Nano))
+		buf.WriteString(`","level":`)
+		writeJSONString(buf, strings.ToUpper(string(msg.Level)))
+
+		if requestId, ok := data["request_id"].(string); ok {
+			buf.WriteString(`,"requestId":`)
+			writeJSONString(buf, requestId)
+
+			data = make(Data, len(msg.Data))
+			for k, v := range msg.Data {
+				if k != "request_id" {
+					data[k] = v
+				}
+			}
+		}
+	} else {
+		buf.WriteString(`{"time":"`)
+		buf.Write(t.AppendFormat(timestamp[:0], time.RFC3339Nano))
+		buf.WriteString(`","level":`)
+		writeJSONString(buf, string(msg.Level))
+	}
+
+	if msg.Level == LevelDebug {
+		buf.WriteString(`,"debug_level":`)
+		buf.WriteString(strconv.Itoa(msg.DebugLevel))
+	}
+
+	if msg.domain != "" {
+		buf.WriteString(`,"domain":`)
+		writeJSONString(buf, msg.domain)
+	}
+
+	buf.WriteString(`,"message":`)
+	writeJSONString(buf, msg.Message)
+
+	if len(data) > 0 {
+		buf.WriteString(`,"data":`)
+		e.encodeData(data, buf)
+	}
+
+	buf.WriteByte('}')
+
+	return nil
+}
+
+func (e *JSONEncoder) encodeData(data Data, buf *bytes.Buffer) {
+	buf.WriteByte('{')
+
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+
+	if e.Cfg.SortKeys {
+		sort.Strings(keys)
+	}
+
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		writeJSONString(buf, k)
+		buf.WriteByte(':')
+		writeJSONDatum(buf, data[k])
+	}
+
+	buf.WriteByte('}')
+}
+
+func writeJSONDatum(buf *bytes.Buffer, datum Datum) {
+	switch v := datum.(type) {
+	case nil:
+		buf.WriteString("null")
+	case string:
+		writeJSONString(buf, v)
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case int:
+		buf.WriteString(strconv.FormatInt(int64(v), 10))
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case error:
+		writeJSONString(buf, formatDatum2(v))
+
+	default:
+		data, err := marshalJSONDatum(v)
+		if err != nil {
+			writeJSONString(buf, formatDatum2(v))
+		} else {
+			buf.Write(data)
+		}
+	}
+}
+
+func marshalJSONDatum(v interface{}) (data []byte, err error) {
+	if isCyclicValue(reflect.ValueOf(v), nil, 0) {
+		return nil, fmt.Errorf("cyclic value")
+	}
+
+	defer func() {
+		if value := recover(); value != nil {
+			data = nil
+			err = fmt.Errorf("panic: %v", value)
+		}
+	}()
+
+	return json.Marshal(v)
+}
+
+const hexDigits = "0123456789abcdef"
+
+// The set of ASCII characters which can be written as is in JSON strings.
+var jsonSafeASCII [utf8.RuneSelf]bool
+
+func init() {
+	for c := 0x20; c < 0x7f; c++ {
+		jsonSafeASCII[c] = c != '"' && c != '\\'
+	}
+}
+
+// Write a JSON string; invalid UTF-8 sequences are replaced by the Unicode
+// replacement character.
+//
+// Message text dominates encoding time, so sequences of characters which do
+// not have to be escaped are copied with a single write.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	buf.Grow(len(s) + 2)
+	buf.WriteByte('"')
+
+	start := 0
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		if c < utf8.RuneSelf {
+			if jsonSafeASCII[c] {
+				i++
+				continue
+			}
+
+			buf.WriteString(s[start:i])
+
+			switch {
+			case c == '"' || c == '\\':
+				buf.WriteByte('\\')
+				buf.WriteByte(c)
+			case c == '\n':
+				buf.WriteString(`\n`)
+			case c == '\r':
+				buf.WriteString(`\r`)
+			case c == '\t':
+				buf.WriteString(`\t`)
+			default:
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hexDigits[c>>4])
+				buf.WriteByte(hexDigits[c&0xf])
+			}
+
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			buf.WriteString(s[start:i])
+			buf.WriteString(`\ufffd`)
+		case r == '\u2028' || r == '\u2029':
+			// Valid JSON, but not valid JavaScript
+			buf.WriteString(s[start:i])
+			buf.WriteString(`\u202`)
+			buf.WriteByte(hexDigits[r&0xf])
+		default:
+			i += size
+			continue
+		}
+
+		i += size
+		start = i
+	}
+
+	buf.WriteString(s[start:])
+	buf.WriteByte('"')
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func FuzzJSONEncoderData(f *testing.F) {
+	f.Add("key", "value", int64(42), 3.14, true)
+	f.Add("", "", int64(0), 0.0, false)
+	f.Add("a\"b", "line 1\nline 2\t\x00", int64(math.MinInt64), -1e308, true)
+	f.Add("\xff", "\xfe  ", int64(math.MaxInt64), math.Inf(1), false)
+
+	now := time.Date(2022, 1, 1, 12, 30, 0, 0, time.UTC)
+
+	f.Fuzz(func(t *testing.T, key, s string, i int64, x float64, b bool) {
+		encoder := NewJSONEncoder(JSONEncoderCfg{})
+
+		data := Data{
+			key: s,
+			"i": i,
+			"x": x,
+			"b": b,
+		}
+
+		var buf bytes.Buffer
+		encoder.EncodeMessage(Message{
+			Time:    &now,
+			Level:   LevelInfo,
+			Message: s,
+			Data:    data,
+		}, &buf)
+
+		if !utf8.Valid(buf.Bytes()) {
+			t.Fatalf("invalid UTF-8 in %q", buf.String())
+		}
+
+		var value struct {
+			Message string                     `json:"message"`
+			Data    map[string]json.RawMessage `json:"data"`
+		}
+
+		if err := json.Unmarshal(buf.Bytes(), &value); err != nil {
+			t.Fatalf("cannot decode %q: %v", buf.String(), err)
+		}
+
+		// Invalid UTF-8 sequences are replaced byte by byte.
+		if expected := string([]rune(s)); value.Message != expected {
+			t.Errorf("message %q was decoded as %q instead of %q", s,
+				value.Message, expected)
+		}
+
+		for k, datum := range data {
+			rawValue, found := value.Data[string([]rune(k))]
+			if !found {
+				t.Errorf("missing key %q in %q", k, buf.String())
+				continue
+			}
+
+			var err error
+			var ok bool
+
+			switch v := datum.(type) {
+			case string:
+				var decodedValue string
+				err = json.Unmarshal(rawValue, &decodedValue)
+				ok = decodedValue == string([]rune(v))
+
+			case int64:
+				ok = string(rawValue) == strconv.FormatInt(v, 10)
+
+			case float64:
+				if math.IsNaN(v) || math.IsInf(v, 0) {
+					// Not representable in JSON
+					var decodedValue string
+					err = json.Unmarshal(rawValue, &decodedValue)
+					ok = decodedValue == formatDatum2(v)
+				} else {
+					var decodedValue float64
+					err = json.Unmarshal(rawValue, &decodedValue)
+					ok = decodedValue == v
+				}
+
+			case bool:
+				ok = string(rawValue) == strconv.FormatBool(v)
+			}
+
+			if err != nil {
+				t.Errorf("cannot decode value of key %q: %v", k, err)
+			} else if !ok {
+				t.Errorf("value %#v of key %q was decoded as %s", datum, k,
+					rawValue)
+			}
+		}
+	})
+}
+
+var benchmarkJSONStrings = []struct {
+	name string
+	s    string
+}{
+	{"ascii", "GET /api/v1/projects/42/pipelines returned 200 in 12.4ms " +
+		"for user 1234 from 192.0.2.1"},
+	{"escaped", "cannot parse \"config.json\": unexpected character '\\t' " +
+		"at line 12\n\tin section \"backends\""},
+	{"unicode", "l'opération a échoué : délai d'attente dépassé après 30 " +
+		"secondes — nouvelle tentative"},
+}
+
+func BenchmarkWriteJSONString(b *testing.B) {
+	for _, bs := range benchmarkJSONStrings {
+		s := bs.s
+
+		b.Run(bs.name, func(b *testing.B) {
+			var buf bytes.Buffer
+
+			b.SetBytes(int64(len(s)))
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				writeJSONString(&buf, s)
+			}
+		})
+	}
+}
+
+// Baseline: encoding/json, without HTML escaping since writeJSONString does
+// not escape HTML characters either.
+func BenchmarkWriteJSONStringEncodingJSON(b *testing.B) {
+	for _, bs := range benchmarkJSONStrings {
+		s := bs.s
+
+		b.Run(bs.name, func(b *testing.B) {
+			var buf bytes.Buffer
+
+			encoder := json.NewEncoder(&buf)
+			encoder.SetEscapeHTML(false)
+
+			b.SetBytes(int64(len(s)))
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				encoder.Encode(s)
+			}
+		})
+	}
+}
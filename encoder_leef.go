@@ -0,0 +1,203 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// https://www.ibm.com/docs/en/dsm?topic=overview-leef-event-components
+type LEEFEncoderCfg struct {
+	Vendor         string `json:"vendor"`
+	Product        string `json:"product"`
+	ProductVersion string `json:"product_version"`
+
+	// The event identifier; if it is empty, the domain of the message is
+	// used.
+	EventId string `json:"event_id"`
+
+	// The character separating attributes, either a single character or its
+	// hexadecimal code prefixed by "x" or "0x". The default delimiter is the
+	// tabulation character.
+	Delimiter string `json:"delimiter"`
+}
+
+const leefDevTimeFormat = "MMM dd yyyy HH:mm:ss.SSS zzz"
+
+type LEEFEncoder struct {
+	Cfg LEEFEncoderCfg
+
+	delimiter     rune
+	delimiterSpec string
+}
+
+func NewLEEFEncoder(cfg LEEFEncoderCfg) (*LEEFEncoder, error) {
+	delimiter, err := parseLEEFDelimiter(cfg.Delimiter)
+	if err != nil {
+		return nil, err
+	}
+
+	delimiterSpec := string(delimiter)
+	if delimiter < 0x20 || delimiter >= 0x7f || delimiter == '|' {
+		delimiterSpec = fmt.Sprintf("x%02x", delimiter)
+	}
+
+	e := &LEEFEncoder{
+		Cfg: cfg,
+
+		delimiter:     delimiter,
+		delimiterSpec: delimiterSpec,
+	}
+
+	return e, nil
+}
+
+func parseLEEFDelimiter(s string) (rune, error) {
+	if s == "" {
+		return '\t', nil
+	}
+
+	if utf8.RuneCountInString(s) == 1 {
+		c, _ := utf8.DecodeRuneInString(s)
+		if c == 0 || c == '=' {
+			return 0, fmt.Errorf("invalid delimiter %q", s)
+		}
+
+		return c, nil
+	}
+
+	var hex string
+	switch {
+	case strings.HasPrefix(s, "0x"):
+		hex = s[2:]
+	case strings.HasPrefix(s, "x"):
+		hex = s[1:]
+	default:
+		return 0, fmt.Errorf("invalid delimiter %q", s)
+	}
+
+	code, err := strconv.ParseUint(hex, 16, 8)
+	if err != nil || code == 0 || code == '=' {
+		return 0, fmt.Errorf("invalid delimiter %q", s)
+	}
+
+	return rune(code), nil
+}
+
+func (e *LEEFEncoder) EncodeMessage(msg Message, buf *bytes.Buffer) error {
+	eventId := e.Cfg.EventId
+	if eventId == "" {
+		eventId = msg.domain
+	}
+
+	buf.WriteString("LEEF:2.0|")
+	for _, field := range []string{e.Cfg.Vendor, e.Cfg.Product,
+		e.Cfg.ProductVersion, eventId, e.delimiterSpec} {
+		buf.WriteString(escapeLEEFHeaderField(field))
+		buf.WriteByte('|')
+	}
+
+	var t time.Time
+	if msg.Time != nil {
+		t = *msg.Time
+	} else {
+		t = time.Now()
+	}
+
+	e.writeAttribute(buf, "devTime", t.Format("Jan 02 2006 15:04:05.000 MST"))
+	buf.WriteRune(e.delimiter)
+	e.writeAttribute(buf, "devTimeFormat", leefDevTimeFormat)
+	buf.WriteRune(e.delimiter)
+	e.writeAttribute(buf, "sev", strconv.Itoa(leefSeverity(msg.Level)))
+
+	if msg.domain != "" {
+		buf.WriteRune(e.delimiter)
+		e.writeAttribute(buf, "cat", msg.domain)
+	}
+
+	buf.WriteRune(e.delimiter)
+	e.writeAttribute(buf, "msg", msg.Message)
+
+	keys := make([]string, 0, len(msg.Data))
+	for k := range msg.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		buf.WriteRune(e.delimiter)
+		e.writeAttribute(buf, k, formatDatum2(msg.Data[k]))
+	}
+
+	return nil
+}
+
+func (e *LEEFEncoder) writeAttribute(buf *bytes.Buffer, key, value string) {
+	// LEEF does not define any escaping mechanism for attributes: the
+	// delimiter cannot appear in keys or values, and keys cannot contain an
+	// equal sign.
+	buf.WriteString(strings.Map(func(c rune) rune {
+		if c == e.delimiter || c == '=' || c <= ' ' {
+			return '_'
+		}
+
+		return c
+	}, key))
+
+	buf.WriteByte('=')
+
+	buf.WriteString(strings.Map(func(c rune) rune {
+		if c == e.delimiter || c == '\n' || c == '\r' {
+			return ' '
+		}
+
+		return c
+	}, strings.ToValidUTF8(value, "\uFFFD")))
+}
+
+func escapeLEEFHeaderField(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `|`, `\|`)
+
+	return strings.Map(func(c rune) rune {
+		if c == '\n' || c == '\r' {
+			return ' '
+		}
+
+		return c
+	}, s)
+}
+
+// LEEF severities range from 1 (lowest) to 10 (highest).
+func leefSeverity(l Level) int {
+	var sev int
+
+	switch l {
+	case LevelDebug:
+		sev = 1
+	case LevelInfo:
+		sev = 3
+	case LevelError:
+		sev = 7
+	}
+
+	return sev
+}
@@ -0,0 +1,216 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// The RFC 5424 encoder is used by the syslog backend, and can be used with
+// any other backend supporting encoders, e.g. to write syslog-formatted
+// files. Messages are written without octet counting.
+type RFC5424EncoderCfg struct {
+	ApplicationName string `json:"application_name"`
+
+	// See SyslogBackendCfg.
+	Hostname                string        `json:"hostname"`
+	HostnameRefreshInterval time.Duration `json:"hostname_refresh_interval"`
+
+	// If set, enable strict validation, see RFC5424ValidationCfg.
+	Validation *RFC5424ValidationCfg `json:"validation,omitempty"`
+}
+
+type RFC5424Encoder struct {
+	Cfg RFC5424EncoderCfg
+
+	priPrefixes [3]string
+	appname     string
+	procid      string
+	validator   *rfc5424Validator
+
+	hostnameMut       sync.Mutex
+	hostname          string
+	hostnameRefreshed time.Time
+	headerSuffix      string
+}
+
+func NewRFC5424Encoder(cfg RFC5424EncoderCfg) *RFC5424Encoder {
+	e := &RFC5424Encoder{
+		Cfg: cfg,
+	}
+
+	e.initHeaderSegments()
+
+	if cfg.Validation != nil {
+		e.validator = newRFC5424Validator(*cfg.Validation)
+	}
+
+	if cfg.Hostname != "" {
+		e.hostname = headerField(cfg.Hostname, 255)
+		e.updateHeaderSuffix()
+	} else {
+		e.refreshHostname(time.Now())
+	}
+
+	return e
+}
+
+func (e *RFC5424Encoder) EncodeMessage(msg Message, buf *bytes.Buffer) error {
+	start := buf.Len()
+
+	e.encodeHeader(msg, buf)
+
+	sdStart := buf.Len()
+
+	// https://datatracker.ietf.org/doc/html/rfc5424#section-6.3.1
+	buf.WriteString("[go-log@32473")
+
+	for key, value := range msg.Data {
+		var name string
+		if e.validator == nil {
+			name = sdName(key)
+		} else {
+			var ok bool
+			if name, ok = e.validator.paramName(key); !ok {
+				continue
+			}
+		}
+
+		buf.WriteByte(' ')
+		buf.WriteString(name)
+		buf.WriteString(`="`)
+		writeSdElementValue(buf, formatDatum2(value))
+		buf.WriteByte('"')
+	}
+
+	buf.WriteString("] ")
+
+	msgStart := buf.Len()
+
+	// https://datatracker.ietf.org/doc/html/rfc5424#section-6.4
+	buf.WriteString(BOM)
+	if utf8.ValidString(msg.Message) {
+		buf.WriteString(msg.Message)
+	} else {
+		buf.WriteString(strings.ToValidUTF8(msg.Message, "\uFFFD"))
+	}
+
+	if e.validator != nil {
+		e.validator.checkFrame(buf, start, sdStart, msgStart)
+	}
+
+	return nil
+}
+
+// Write all header fields, followed by a space character.
+func (e *RFC5424Encoder) encodeHeader(msg Message, buf *bytes.Buffer) {
+	var t time.Time
+	if msg.Time != nil {
+		t = msg.Time.UTC()
+	} else {
+		t = time.Now().UTC()
+	}
+
+	// https://datatracker.ietf.org/doc/html/rfc5424#section-6
+	//
+	// The PRI and VERSION fields only depend on the level, and the
+	// HOSTNAME, APP-NAME, PROCID and MSGID fields are the same for all
+	// messages; they are computed once and for all.
+	buf.WriteString(e.priPrefix(msg.Level))
+
+	// https://datatracker.ietf.org/doc/html/rfc5424#section-6.2.3
+	var timestamp [64]byte
+	buf.Write(t.AppendFormat(timestamp[:0], time.RFC3339Nano))
+
+	buf.WriteString(e.currentHeaderSuffix())
+}
+
+// https://datatracker.ietf.org/doc/html/rfc5424#section-6.2.1
+func (e *RFC5424Encoder) priPrefix(level Level) string {
+	switch level {
+	case LevelDebug:
+		return e.priPrefixes[0]
+	case LevelInfo:
+		return e.priPrefixes[1]
+	default:
+		return e.priPrefixes[2]
+	}
+}
+
+func (e *RFC5424Encoder) initHeaderSegments() {
+	for i, level := range []Level{LevelDebug, LevelInfo, LevelError} {
+		pri := FacilityCode*8 + getSeverityCode(level)
+
+		// https://datatracker.ietf.org/doc/html/rfc5424#section-6.2.2
+		e.priPrefixes[i] = "<" + strconv.Itoa(pri) + ">1 "
+	}
+
+	// https://datatracker.ietf.org/doc/html/rfc5424#section-6.2.5
+	e.appname = "-"
+	if e.Cfg.ApplicationName != "" {
+		e.appname = headerField(e.Cfg.ApplicationName, 48)
+	}
+
+	// https://datatracker.ietf.org/doc/html/rfc5424#section-6.2.6
+	e.procid = strconv.Itoa(os.Getpid())
+}
+
+// The function is unsafe and MUST be called with e.hostnameMut held, or
+// during initialization.
+func (e *RFC5424Encoder) updateHeaderSuffix() {
+	// https://datatracker.ietf.org/doc/html/rfc5424#section-6.2.4
+	// https://datatracker.ietf.org/doc/html/rfc5424#section-6.2.7
+	e.headerSuffix = " " + e.hostname + " " + e.appname + " " + e.procid +
+		" - "
+}
+
+// The function is unsafe and MUST be called with e.hostnameMut held, or
+// during initialization.
+func (e *RFC5424Encoder) refreshHostname(now time.Time) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		if e.hostname == "" {
+			e.hostname = "-"
+		}
+	} else {
+		e.hostname = headerField(hostname, 255)
+	}
+
+	e.hostnameRefreshed = now
+
+	e.updateHeaderSuffix()
+}
+
+func (e *RFC5424Encoder) currentHeaderSuffix() string {
+	if e.Cfg.Hostname != "" || e.Cfg.HostnameRefreshInterval <= 0 {
+		return e.headerSuffix
+	}
+
+	e.hostnameMut.Lock()
+	defer e.hostnameMut.Unlock()
+
+	now := time.Now()
+	if now.Sub(e.hostnameRefreshed) >= e.Cfg.HostnameRefreshInterval {
+		e.refreshHostname(now)
+	}
+
+	return e.headerSuffix
+}
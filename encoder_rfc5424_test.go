@@ -0,0 +1,297 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+type rfc5424Frame struct {
+	Header []string
+	Params map[string]string
+	Msg    string
+}
+
+// Parse a frame written by RFC5424Encoder, i.e. with a single SD-ELEMENT.
+//
+// https://datatracker.ietf.org/doc/html/rfc5424#section-6
+func parseRFC5424Frame(s string) (*rfc5424Frame, error) {
+	parts := strings.SplitN(s, " ", 7)
+	if len(parts) != 7 {
+		return nil, fmt.Errorf("truncated header")
+	}
+
+	var frame rfc5424Frame
+	frame.Header = parts[:6]
+
+	for i, field := range frame.Header {
+		if field == "" {
+			return nil, fmt.Errorf("empty header field %d", i)
+		}
+
+		for j := 0; j < len(field); j++ {
+			if c := field[j]; c < 33 || c > 126 {
+				return nil, fmt.Errorf("invalid character %q in header "+
+					"field %d", c, i)
+			}
+		}
+	}
+
+	if _, err := time.Parse(time.RFC3339Nano, frame.Header[1]); err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %w", err)
+	}
+
+	s = parts[6]
+
+	if !strings.HasPrefix(s, "[go-log@32473") {
+		return nil, fmt.Errorf("missing structured data")
+	}
+	s = s[len("[go-log@32473"):]
+
+	frame.Params = make(map[string]string)
+
+	for len(s) > 0 && s[0] == ' ' {
+		s = s[1:]
+
+		idx := strings.Index(s, `="`)
+		if idx == -1 {
+			return nil, fmt.Errorf("truncated parameter")
+		}
+
+		name := s[:idx]
+		s = s[idx+2:]
+
+		end := -1
+		for i := 0; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == '"' {
+				end = i
+				break
+			}
+		}
+
+		if end == -1 {
+			return nil, fmt.Errorf("unterminated value for parameter %q", name)
+		}
+
+		value, err := parseSdElementValue(s[:end])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for parameter %q: %w",
+				name, err)
+		}
+
+		frame.Params[name] = value
+		s = s[end+1:]
+	}
+
+	if !strings.HasPrefix(s, "] "+BOM) {
+		return nil, fmt.Errorf("unterminated structured data")
+	}
+
+	frame.Msg = s[len("] "+BOM):]
+
+	return &frame, nil
+}
+
+func FuzzRFC5424Frame(f *testing.F) {
+	f.Add("hello world", "key", "value", "app", "host")
+	f.Add("", "", "", "", "")
+	f.Add("line 1\nline 2", "a=b", `x"y]z\`, "my app", "host name")
+	f.Add("\xff\xfe", "\xff", "\x00\x1b[31m", "été", "é")
+
+	now := time.Date(2022, 1, 1, 12, 30, 0, 123000000, time.UTC)
+
+	f.Fuzz(func(t *testing.T, message, key, value, appName, hostname string) {
+		encoder := NewRFC5424Encoder(RFC5424EncoderCfg{
+			ApplicationName: appName,
+			Hostname:        hostname,
+		})
+
+		var buf bytes.Buffer
+		encoder.EncodeMessage(Message{
+			Time:    &now,
+			Level:   LevelInfo,
+			Message: message,
+			Data:    Data{key: value},
+		}, &buf)
+
+		if !utf8.Valid(buf.Bytes()) {
+			t.Fatalf("invalid UTF-8 in %q", buf.String())
+		}
+
+		frame, err := parseRFC5424Frame(buf.String())
+		if err != nil {
+			t.Fatalf("cannot parse %q: %v", buf.String(), err)
+		}
+
+		if frame.Header[0] != "<134>1" {
+			t.Errorf("invalid PRI and VERSION fields %q", frame.Header[0])
+		}
+
+		if decodedValue, found := frame.Params[sdName(key)]; !found {
+			t.Errorf("missing parameter %q in %q", sdName(key), buf.String())
+		} else if decodedValue != string([]rune(value)) {
+			t.Errorf("parameter value %q was decoded as %q", value,
+				decodedValue)
+		}
+
+		if expected := strings.ToValidUTF8(message, "�"); frame.Msg !=
+			expected {
+			t.Errorf("message %q was decoded as %q instead of %q", message,
+				frame.Msg, expected)
+		}
+	})
+}
+
+type testMessageRecorder struct {
+	mut  sync.Mutex
+	msgs []Message
+}
+
+func (r *testMessageRecorder) Log(msg Message) {
+	r.mut.Lock()
+	r.msgs = append(r.msgs, msg)
+	r.mut.Unlock()
+}
+
+func (r *testMessageRecorder) count() int {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	return len(r.msgs)
+}
+
+func TestRFC5424ValidationCfg(t *testing.T) {
+	tests := []struct {
+		cfg   RFC5424ValidationCfg
+		valid bool
+	}{
+		{RFC5424ValidationCfg{}, true},
+		{RFC5424ValidationCfg{MaxFrameLength: 480}, true},
+		{RFC5424ValidationCfg{MaxFrameLength: 100}, false},
+		{RFC5424ValidationCfg{InvalidKeys: "foo"}, false},
+	}
+
+	for _, test := range tests {
+		if err := test.cfg.Validate(); (err == nil) != test.valid {
+			t.Errorf("unexpected validation result for %#v: %v", test.cfg,
+				err)
+		}
+	}
+}
+
+func TestRFC5424ValidationFrameLength(t *testing.T) {
+	now := time.Date(2022, 1, 1, 12, 30, 0, 0, time.UTC)
+
+	encoderCfg := RFC5424EncoderCfg{
+		ApplicationName: "app",
+		Hostname:        strings.Repeat("h", 255),
+	}
+
+	var header bytes.Buffer
+	NewRFC5424Encoder(encoderCfg).encodeHeader(Message{
+		Time:  &now,
+		Level: LevelInfo,
+	}, &header)
+
+	reports := &testMessageRecorder{}
+	encoderCfg.Validation = &RFC5424ValidationCfg{
+		MaxFrameLength: 480,
+		Backend:        reports,
+	}
+
+	var buf bytes.Buffer
+	NewRFC5424Encoder(encoderCfg).EncodeMessage(Message{
+		Time:    &now,
+		Level:   LevelInfo,
+		Message: strings.Repeat("é", 300),
+		Data:    Data{"key": strings.Repeat("v", 1000)},
+	}, &buf)
+
+	frame := buf.String()
+
+	if prefix := header.String() + "- " + BOM; !strings.HasPrefix(frame,
+		prefix) {
+		t.Fatalf("frame %q does not start with %q", frame, prefix)
+	}
+
+	if len(frame) > 480 {
+		t.Errorf("frame of %d bytes is longer than 480 bytes", len(frame))
+	}
+
+	if !utf8.ValidString(frame) {
+		t.Errorf("invalid UTF-8 in %q", frame)
+	}
+
+	if n := reports.count(); n != 1 {
+		t.Errorf("expected 1 report, got %d", n)
+	}
+}
+
+func TestRFC5424ValidationHeaderTooLong(t *testing.T) {
+	v := newRFC5424Validator(RFC5424ValidationCfg{
+		Backend: &testMessageRecorder{},
+	})
+
+	// Configurations are validated, but the header must never be cut even
+	// if it is longer than the maximum length.
+	v.Cfg.MaxFrameLength = 10
+
+	header := "<134>1 2022-01-01T12:30:00Z host app 42 - "
+
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	sdStart := buf.Len()
+	buf.WriteString(`[go-log@32473 key="value"] `)
+	msgStart := buf.Len()
+	buf.WriteString(BOM + "hello")
+
+	v.checkFrame(&buf, 0, sdStart, msgStart)
+
+	if expected := header + "- "; buf.String() != expected {
+		t.Errorf("frame was truncated to %q instead of %q", buf.String(),
+			expected)
+	}
+}
+
+func TestRFC5424ValidationReportedKeys(t *testing.T) {
+	reports := &testMessageRecorder{}
+
+	v := newRFC5424Validator(RFC5424ValidationCfg{Backend: reports})
+
+	for i := 0; i < 2*rfc5424MaxReportedKeys; i++ {
+		v.paramName(fmt.Sprintf("invalid key %d", i))
+	}
+
+	v.paramName("invalid key 0")
+
+	// Keys are reported once until the table is full, then at most once per
+	// interval.
+	if n, expected := reports.count(), rfc5424MaxReportedKeys+1; n !=
+		expected {
+		t.Errorf("expected %d reports, got %d", expected, n)
+	}
+
+	if n := len(v.reportedKeys); n != rfc5424MaxReportedKeys {
+		t.Errorf("%d keys are recorded", n)
+	}
+}
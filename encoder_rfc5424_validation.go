@@ -0,0 +1,252 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+type RFC5424InvalidKeyAction string
+
+const (
+	// Replace invalid characters by underscores and truncate names longer
+	// than 32 characters.
+	RFC5424InvalidKeyActionSanitize RFC5424InvalidKeyAction = "sanitize"
+
+	// Drop data entries whose key is not a valid SD-PARAM name.
+	RFC5424InvalidKeyActionReject RFC5424InvalidKeyAction = "reject"
+)
+
+// Default maximum length of a frame; RFC 5424 receivers should accept
+// frames up to 2048 bytes and may discard or truncate longer frames.
+const DefaultRFC5424MaxFrameLength = 2048
+
+// Receivers must accept frames up to 480 bytes; smaller maximum lengths
+// would not leave room for the header.
+const MinRFC5424MaxFrameLength = 480
+
+// In strict mode, the RFC 5424 encoder checks that data keys are valid
+// SD-PARAM names and that frames do not exceed a maximum length. Frames
+// which are too long are truncated: structured data are dropped if they do
+// not fit, then the message text is cut. The header is never cut, so frames
+// whose header alone is too long, e.g. because of a very long hostname, are
+// left longer than the maximum length.
+//
+// Violations are reported in the internal domain, once for each data key
+// and at most once per minute for oversized frames. Once 1024 distinct keys
+// have been reported, other invalid keys are reported at most once per
+// minute.
+
+type RFC5424ValidationCfg struct {
+	InvalidKeys    RFC5424InvalidKeyAction `json:"invalid_keys"` // sanitize by default
+	MaxFrameLength int                     `json:"max_frame_length"`
+
+	// The backend reports are sent to; messages are printed on stderr by
+	// default.
+	Backend Backend `json:"-"`
+}
+
+const (
+	rfc5424ReportInterval  = time.Minute
+	rfc5424MaxReportedKeys = 1024
+)
+
+type rfc5424Validator struct {
+	Cfg RFC5424ValidationCfg
+
+	mut             sync.Mutex
+	reportedKeys    map[string]struct{}
+	lastKeyReport   time.Time
+	lastFrameReport time.Time
+}
+
+func (cfg RFC5424ValidationCfg) Validate() error {
+	switch cfg.InvalidKeys {
+	case "", RFC5424InvalidKeyActionSanitize, RFC5424InvalidKeyActionReject:
+	default:
+		return fmt.Errorf("invalid key action %q", cfg.InvalidKeys)
+	}
+
+	if cfg.MaxFrameLength != 0 &&
+		cfg.MaxFrameLength < MinRFC5424MaxFrameLength {
+		return fmt.Errorf("max frame length must be at least %d bytes",
+			MinRFC5424MaxFrameLength)
+	}
+
+	return nil
+}
+
+// The configuration must have been checked with Validate.
+func newRFC5424Validator(cfg RFC5424ValidationCfg) *rfc5424Validator {
+	if cfg.InvalidKeys == "" {
+		cfg.InvalidKeys = RFC5424InvalidKeyActionSanitize
+	}
+
+	if cfg.MaxFrameLength <= 0 {
+		cfg.MaxFrameLength = DefaultRFC5424MaxFrameLength
+	} else if cfg.MaxFrameLength < MinRFC5424MaxFrameLength {
+		cfg.MaxFrameLength = MinRFC5424MaxFrameLength
+	}
+
+	if cfg.Backend == nil {
+		cfg.Backend = NewTerminalBackend(TerminalBackendCfg{})
+	}
+
+	v := rfc5424Validator{
+		Cfg: cfg,
+
+		reportedKeys: make(map[string]struct{}),
+	}
+
+	return &v
+}
+
+// https://datatracker.ietf.org/doc/html/rfc5424#section-6.3.3
+func validSdName(s string) bool {
+	if s == "" || len(s) > 32 {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= 32 || c >= 127 || c == '=' || c == ']' || c == '"' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Return the SD-PARAM name to use for a data key, and false if the entry
+// must be dropped.
+func (v *rfc5424Validator) paramName(key string) (string, bool) {
+	if validSdName(key) {
+		return key, true
+	}
+
+	v.reportKey(key)
+
+	if v.Cfg.InvalidKeys == RFC5424InvalidKeyActionReject {
+		return "", false
+	}
+
+	return sdName(key), true
+}
+
+// Truncate the frame starting at a position in the buffer if it is too
+// long. Structured data start at sdStart and the message text at msgStart.
+func (v *rfc5424Validator) checkFrame(buf *bytes.Buffer, start, sdStart, msgStart int) {
+	length := buf.Len() - start
+	maxLength := v.Cfg.MaxFrameLength
+
+	if length <= maxLength {
+		return
+	}
+
+	v.reportFrame(length)
+
+	if msgStart-start > maxLength && sdStart < msgStart {
+		// Structured data do not fit, replace them by NILVALUE.
+		msg := append([]byte(nil), buf.Bytes()[msgStart:]...)
+
+		buf.Truncate(sdStart)
+		buf.WriteString("- ")
+		msgStart = buf.Len()
+		buf.Write(msg)
+	}
+
+	if buf.Len()-start <= maxLength {
+		return
+	}
+
+	end := start + maxLength
+	if end < msgStart {
+		end = msgStart
+	}
+
+	data := buf.Bytes()
+	for end > msgStart && end > start && !utf8.RuneStart(data[end]) {
+		end--
+	}
+
+	buf.Truncate(end)
+}
+
+func (v *rfc5424Validator) reportKey(key string) {
+	v.mut.Lock()
+	_, reported := v.reportedKeys[key]
+	if !reported {
+		if len(v.reportedKeys) < rfc5424MaxReportedKeys {
+			v.reportedKeys[key] = struct{}{}
+		} else {
+			now := time.Now()
+			reported = now.Sub(v.lastKeyReport) < rfc5424ReportInterval
+			if !reported {
+				v.lastKeyReport = now
+			}
+		}
+	}
+	v.mut.Unlock()
+
+	if reported {
+		return
+	}
+
+	var action string
+	if v.Cfg.InvalidKeys == RFC5424InvalidKeyActionReject {
+		action = "rejected"
+	} else {
+		action = "sanitized"
+	}
+
+	v.report(Data{"key": key, "action": action},
+		"data key %q is not a valid rfc 5424 parameter name", key)
+}
+
+func (v *rfc5424Validator) reportFrame(length int) {
+	now := time.Now()
+
+	v.mut.Lock()
+	report := now.Sub(v.lastFrameReport) >= rfc5424ReportInterval
+	if report {
+		v.lastFrameReport = now
+	}
+	v.mut.Unlock()
+
+	if !report {
+		return
+	}
+
+	v.report(Data{"length": length, "max_length": v.Cfg.MaxFrameLength},
+		"rfc 5424 frame of %d bytes truncated to %d bytes", length,
+		v.Cfg.MaxFrameLength)
+}
+
+func (v *rfc5424Validator) report(data Data, format string, args ...interface{}) {
+	t := time.Now().UTC()
+
+	v.Cfg.Backend.Log(Message{
+		Time:    &t,
+		Level:   LevelError,
+		Message: fmt.Sprintf(format, args...),
+		Data:    data,
+
+		domain: InternalDomain,
+	})
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The text encoder writes one line per message, containing the time, level,
+// domain and message followed by data in logfmt format. It is the default
+// encoder of the file backend.
+type TextEncoderCfg struct {
+	DomainWidth int `json:"domain_width"`
+}
+
+type TextEncoder struct {
+	Cfg TextEncoderCfg
+}
+
+var textMessageReplacer = strings.NewReplacer("\n", `\n`, "\r", `\r`)
+
+func NewTextEncoder(cfg TextEncoderCfg) *TextEncoder {
+	return &TextEncoder{
+		Cfg: cfg,
+	}
+}
+
+func (e *TextEncoder) EncodeMessage(msg Message, buf *bytes.Buffer) error {
+	var t time.Time
+	if msg.Time != nil {
+		t = msg.Time.UTC()
+	} else {
+		t = time.Now().UTC()
+	}
+
+	var timestamp [64]byte
+	buf.Write(t.AppendFormat(timestamp[:0], "2006-01-02T15:04:05.000Z"))
+
+	level := string(msg.Level)
+	if msg.Level == LevelDebug {
+		level += "." + strconv.Itoa(msg.DebugLevel)
+	}
+
+	buf.WriteByte(' ')
+	writeTextPadded(buf, level, 7)
+
+	buf.WriteByte(' ')
+	if msg.domain == "" {
+		writeTextPadded(buf, "-", e.Cfg.DomainWidth)
+	} else {
+		writeTextPadded(buf, msg.domain, e.Cfg.DomainWidth)
+	}
+
+	buf.WriteByte(' ')
+	textMessageReplacer.WriteString(buf, msg.Message)
+
+	keys := make([]string, 0, len(msg.Data))
+	for k := range msg.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		buf.WriteByte(' ')
+		buf.WriteString(logfmtKey(k))
+		buf.WriteByte('=')
+		buf.WriteString(quoteLogfmtValue(formatDatum2(msg.Data[k])))
+	}
+
+	return nil
+}
+
+func writeTextPadded(buf *bytes.Buffer, s string, width int) {
+	buf.WriteString(padRight(stripZeroWidthSpaces(s), width))
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// https://www.w3.org/TR/WD-logfile.html
+//
+// Fields are either one of "date", "time", "level", "domain" and "message",
+// or the key of a data entry. Except for "date" and "time", fields are
+// declared in the #Fields directive with the "x-" prefix reserved for
+// application specific fields, unless they already have a W3C prefix.
+type W3CEncoderCfg struct {
+	Fields []string `json:"fields"`
+}
+
+var DefaultW3CFields = []string{"date", "time", "level", "domain", "message"}
+
+type W3CEncoder struct {
+	Cfg W3CEncoderCfg
+
+	fields []string
+}
+
+func NewW3CEncoder(cfg W3CEncoderCfg) *W3CEncoder {
+	fields := DefaultW3CFields
+	if len(cfg.Fields) > 0 {
+		fields = cfg.Fields
+	}
+
+	e := &W3CEncoder{
+		Cfg: cfg,
+
+		fields: fields,
+	}
+
+	return e
+}
+
+func (e *W3CEncoder) EncodeHeader(buf *bytes.Buffer) error {
+	now := time.Now().UTC()
+
+	buf.WriteString("#Version: 1.0\n")
+	buf.WriteString("#Software: go-log\n")
+	buf.WriteString("#Date: " + now.Format("2006-01-02 15:04:05") + "\n")
+	buf.WriteString("#Fields:")
+
+	for _, field := range e.fields {
+		buf.WriteByte(' ')
+		buf.WriteString(w3cFieldIdentifier(field))
+	}
+
+	return nil
+}
+
+func (e *W3CEncoder) EncodeMessage(msg Message, buf *bytes.Buffer) error {
+	var t time.Time
+	if msg.Time != nil {
+		t = msg.Time.UTC()
+	} else {
+		t = time.Now().UTC()
+	}
+
+	for i, field := range e.fields {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+
+		switch field {
+		case "date":
+			buf.WriteString(t.Format("2006-01-02"))
+		case "time":
+			buf.WriteString(t.Format("15:04:05.000"))
+		case "level":
+			buf.WriteString(string(msg.Level))
+		case "domain":
+			writeW3CValue(buf, msg.domain)
+		case "message":
+			writeW3CValue(buf, msg.Message)
+		default:
+			if value, found := msg.Data[field]; found && value != nil {
+				writeW3CValue(buf, formatDatum2(value))
+			} else {
+				buf.WriteByte('-')
+			}
+		}
+	}
+
+	return nil
+}
+
+func w3cFieldIdentifier(field string) string {
+	field = strings.Map(func(c rune) rune {
+		if unicode.IsSpace(c) || unicode.IsControl(c) {
+			return '_'
+		}
+
+		return c
+	}, field)
+
+	switch field {
+	case "date", "time":
+		return field
+	}
+
+	for _, prefix := range []string{"c-", "s-", "r-", "cs-", "sc-", "sr-",
+		"rs-", "x-"} {
+		if strings.HasPrefix(field, prefix) {
+			return field
+		}
+	}
+
+	return "x-" + field
+}
+
+// Values containing whitespaces or double quotes are quoted, double quotes
+// being escaped by doubling them. Since entries are separated by newlines,
+// control characters are replaced by spaces.
+func writeW3CValue(buf *bytes.Buffer, s string) {
+	if s == "" {
+		buf.WriteByte('-')
+		return
+	}
+
+	s = strings.Map(func(c rune) rune {
+		if unicode.IsControl(c) {
+			return ' '
+		}
+
+		return c
+	}, strings.ToValidUTF8(s, "\uFFFD"))
+
+	if !strings.ContainsAny(s, " \"") {
+		buf.WriteString(s)
+		return
+	}
+
+	buf.WriteByte('"')
+	buf.WriteString(strings.ReplaceAll(s, `"`, `""`))
+	buf.WriteByte('"')
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Event provides a chained API to build and log messages:
+//
+//	logger.ErrorEv().Str("user", id).Err(err).Msg("cannot update user")
+//
+// Methods can be called on a nil event, which is what loggers return for
+// debug messages which would be filtered; they do nothing, so disabled events
+// do not cost any allocation. Events are reused once logged and must not be
+// used after a call to Msg, Msgf or Send.
+type Event struct {
+	logger *Logger
+	msg    Message
+	data   Data
+}
+
+var eventPool = sync.Pool{
+	New: func() interface{} {
+		return &Event{
+			data: make(Data),
+		}
+	},
+}
+
+func (l *Logger) newEvent(level Level, debugLevel int) *Event {
+	e := eventPool.Get().(*Event)
+
+	e.logger = l
+	e.msg = Message{
+		Level:      level,
+		DebugLevel: debugLevel,
+	}
+
+	return e
+}
+
+func (l *Logger) InfoEv() *Event {
+	return l.newEvent(LevelInfo, 0)
+}
+
+func (l *Logger) ErrorEv() *Event {
+	return l.newEvent(LevelError, 0)
+}
+
+func (e *Event) Str(key, value string) *Event {
+	if e != nil {
+		e.data[key] = value
+	}
+
+	return e
+}
+
+func (e *Event) Int(key string, value int) *Event {
+	if e != nil {
+		e.data[key] = value
+	}
+
+	return e
+}
+
+func (e *Event) Int64(key string, value int64) *Event {
+	if e != nil {
+		e.data[key] = value
+	}
+
+	return e
+}
+
+func (e *Event) Uint64(key string, value uint64) *Event {
+	if e != nil {
+		e.data[key] = value
+	}
+
+	return e
+}
+
+func (e *Event) Float64(key string, value float64) *Event {
+	if e != nil {
+		e.data[key] = value
+	}
+
+	return e
+}
+
+func (e *Event) Bool(key string, value bool) *Event {
+	if e != nil {
+		e.data[key] = value
+	}
+
+	return e
+}
+
+func (e *Event) Dur(key string, value time.Duration) *Event {
+	if e != nil {
+		e.data[key] = value
+	}
+
+	return e
+}
+
+func (e *Event) Time(key string, value time.Time) *Event {
+	if e != nil {
+		e.data[key] = value
+	}
+
+	return e
+}
+
+// Add an error with the "error" key; nil errors are ignored.
+func (e *Event) Err(err error) *Event {
+	if e != nil && err != nil {
+		e.data["error"] = err
+	}
+
+	return e
+}
+
+func (e *Event) Any(key string, value interface{}) *Event {
+	if e != nil {
+		e.data[key] = value
+	}
+
+	return e
+}
+
+func (e *Event) Data(data Data) *Event {
+	if e != nil {
+		for k, v := range data {
+			e.data[k] = v
+		}
+	}
+
+	return e
+}
+
+func (e *Event) Msg(s string) {
+	if e == nil {
+		return
+	}
+
+	e.log(s)
+}
+
+func (e *Event) Msgf(format string, args ...interface{}) {
+	if e == nil {
+		return
+	}
+
+	e.log(fmt.Sprintf(format, args...))
+}
+
+// Log the event without any message text.
+func (e *Event) Send() {
+	if e == nil {
+		return
+	}
+
+	e.log("")
+}
+
+func (e *Event) log(s string) {
+	e.msg.Message = s
+	e.msg.Data = e.data
+
+	// The depth is the one of Msg, Msgf and Send
+	e.logger.log(e.msg, 2)
+
+	// Data are copied by the logger, so the map can be reused
+	for k := range e.data {
+		delete(e.data, k)
+	}
+
+	e.logger = nil
+	e.msg = Message{}
+
+	eventPool.Put(e)
+}
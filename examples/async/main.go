@@ -0,0 +1,78 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Command async writes messages through a queue backend, so that logging
+// never waits for the destination, and prints delivery latency statistics
+// and the resources used by the logging subsystem.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/exograd/go-log"
+)
+
+func main() {
+	logger, err := log.NewLogger("example", log.LoggerCfg{
+		BackendType: log.BackendTypeQueue,
+		Backend: &log.QueueBackendCfg{
+			Backend: log.BackendCfg{
+				Type: log.BackendTypeJSON,
+				Backend: &log.JSONBackendCfg{
+					Output: "stdout",
+				},
+			},
+			QueueSize:  100,
+			DropPolicy: log.QueueDropPolicyBlock,
+		},
+
+		DeliveryLatency: &log.DeliveryLatencyCfg{
+			Threshold: time.Millisecond,
+		},
+	})
+	if err != nil {
+		die("cannot create logger: %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		logger.InfoData(log.Data{"i": i}, "message %d", i)
+	}
+
+	usage := log.CurrentResourceUsage()
+
+	backend := logger.Backend.(*log.QueueBackend)
+	if err := backend.Close(); err != nil {
+		die("cannot close backend: %v", err)
+	}
+
+	printJSON("delivery latency", logger.DeliveryLatency())
+	printJSON("resource usage", usage)
+}
+
+func printJSON(label string, value interface{}) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		die("cannot encode %s: %v", label, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: %s\n", label, data)
+}
+
+func die(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Command config creates a logger from a JSON configuration sending all
+// messages to the terminal and only error messages, with a rate limit, to a
+// JSON stream on stdout.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/exograd/go-log"
+)
+
+const configuration = `{
+  "backends": [
+    {
+      "type": "terminal",
+      "backend": {"color": true, "theme": "deuteranopia"}
+    },
+    {
+      "type": "filter",
+      "backend": {
+        "levels": ["error"],
+        "backend": {
+          "type": "rate_limit",
+          "backend": {
+            "rate": 10,
+            "backend": {"type": "json"}
+          }
+        }
+      }
+    }
+  ],
+  "debug_level": 1
+}`
+
+func main() {
+	var cfg log.LoggerCfg
+	if err := json.Unmarshal([]byte(configuration), &cfg); err != nil {
+		die("invalid configuration: %v", err)
+	}
+
+	logger, err := log.NewLogger("example", cfg)
+	if err != nil {
+		die("cannot create logger: %v", err)
+	}
+
+	logger.Debug(1, "debug message")
+	logger.Info("info message")
+	logger.ErrorData(log.Data{"code": 42}, "error message")
+}
+
+func die(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Command http logs the requests handled by an HTTP server with the HTTP
+// middleware, including a handler which panics. The server is started on a
+// local port and a few requests are sent to it before exiting.
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/exograd/go-log"
+)
+
+func main() {
+	logger := log.DefaultLogger("example")
+
+	middleware, err := log.NewHTTPMiddleware(logger, log.HTTPMiddlewareCfg{})
+	if err != nil {
+		die("cannot create middleware: %v", err)
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/hello", func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, "hello\n")
+	})
+
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, req *http.Request) {
+		panic("something went wrong")
+	})
+
+	server := httptest.NewServer(middleware.Wrap(mux))
+	defer server.Close()
+
+	for _, path := range []string{"/hello", "/panic", "/unknown"} {
+		res, err := http.Get(server.URL + path)
+		if err != nil {
+			die("cannot send request: %v", err)
+		}
+
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}
+}
+
+func die(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", args...)
+	os.Exit(1)
+}
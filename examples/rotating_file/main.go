@@ -0,0 +1,80 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Command rotating_file writes JSON messages to a file rotated every
+// kilobyte, keeping the three last rotated files compressed, then lists the
+// files created.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/exograd/go-log"
+)
+
+func main() {
+	dirPath, err := os.MkdirTemp("", "go-log-example-")
+	if err != nil {
+		die("cannot create directory: %v", err)
+	}
+	defer os.RemoveAll(dirPath)
+
+	encoderData := json.RawMessage(`{"sort_keys": true}`)
+
+	backendCfg := log.RotatingFileBackendCfg{
+		Path:        filepath.Join(dirPath, "example.log"),
+		MaxSize:     1024,
+		MaxFiles:    3,
+		Compress:    true,
+		EncoderType: log.EncoderTypeJSON,
+		EncoderData: &encoderData,
+	}
+
+	logger, err := log.NewLogger("example", log.LoggerCfg{
+		BackendType: log.BackendTypeRotatingFile,
+		Backend:     &backendCfg,
+	})
+	if err != nil {
+		die("cannot create logger: %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		logger.InfoData(log.Data{"i": i}, "message %d", i)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if closer, ok := logger.Backend.(interface{ Close() error }); ok {
+		if err := closer.Close(); err != nil {
+			die("cannot close backend: %v", err)
+		}
+	}
+
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		die("cannot read directory: %v", err)
+	}
+
+	for _, entry := range entries {
+		fmt.Println(entry.Name())
+	}
+}
+
+func die(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Command syslog sends RFC 5424 messages to a syslog daemon over TCP. If no
+// address is provided, a local server printing the frames it receives is
+// started, so that the program can run without a syslog daemon. See the tls
+// example to send messages over TLS.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/exograd/go-log"
+)
+
+func main() {
+	addr := flag.String("addr", "", "the address of the syslog daemon")
+	flag.Parse()
+
+	if *addr == "" {
+		*addr = startServer()
+	}
+
+	logger, err := log.NewLogger("example", log.LoggerCfg{
+		BackendType: log.BackendTypeSyslog,
+		Backend: &log.SyslogBackendCfg{
+			Addr:            *addr,
+			ApplicationName: "syslog-example",
+		},
+	})
+	if err != nil {
+		die("cannot create logger: %v", err)
+	}
+
+	logger.Info("starting")
+	logger.InfoData(log.Data{"user": "bob", "attempts": 3}, "user logged in")
+	logger.Error("something went wrong")
+
+	// Leave some time to the local server to print frames
+	time.Sleep(100 * time.Millisecond)
+}
+
+func startServer() string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		die("cannot listen: %v", err)
+	}
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		buf := make([]byte, 4096)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+
+			fmt.Printf("received: %q\n", buf[:n])
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func die(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", args...)
+	os.Exit(1)
+}
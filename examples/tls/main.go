@@ -0,0 +1,58 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Command tls sends RFC 5424 messages to a syslog daemon over TLS (RFC 5425),
+// e.g. rsyslog with the imtcp module and the gtls stream driver listening on
+// port 6514.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/exograd/go-log"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:6514",
+		"the address of the syslog daemon")
+	caCertificatePath := flag.String("ca-certificate", "",
+		"the path of the ca certificate used to verify the server")
+	flag.Parse()
+
+	logger, err := log.NewLogger("example", log.LoggerCfg{
+		BackendType: log.BackendTypeSyslog,
+		Backend: &log.SyslogBackendCfg{
+			Addr:              *addr,
+			Transport:         log.SyslogTransportTLS,
+			CACertificatePath: *caCertificatePath,
+			ApplicationName:   "tls-example",
+		},
+	})
+	if err != nil {
+		die("cannot create logger: %v", err)
+	}
+
+	logger.InfoData(log.Data{"transport": "tls"}, "hello")
+
+	if err := logger.Close(); err != nil {
+		die("cannot close logger: %v", err)
+	}
+}
+
+func die(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", args...)
+	os.Exit(1)
+}
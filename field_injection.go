@@ -0,0 +1,102 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+// A field injector returns data added to a message just before it is passed
+// to a backend. Injectors are set per backend (see BackendCfg), so that data
+// only useful to one destination, e.g. a shard identifier computed for a
+// specific service, are not sent to other backends.
+type FieldInjector func(msg Message) Data
+
+// The field injection backend decorates another backend, adding the data
+// returned by injectors to each message. Injected data never replace data
+// already present in the message; when several injectors return the same
+// key, the first one wins.
+type FieldInjectionBackend struct {
+	Backend   Backend
+	Injectors []FieldInjector
+}
+
+func NewFieldInjectionBackend(backend Backend, injectors ...FieldInjector) *FieldInjectionBackend {
+	return &FieldInjectionBackend{
+		Backend:   backend,
+		Injectors: injectors,
+	}
+}
+
+func (b *FieldInjectionBackend) Log(msg Message) {
+	b.Backend.Log(b.inject(msg))
+}
+
+func (b *FieldInjectionBackend) LogBatch(msgs []Message) {
+	msgs2 := make([]Message, len(msgs))
+	for i, msg := range msgs {
+		msgs2[i] = b.inject(msg)
+	}
+
+	logBatch(b.Backend, msgs2)
+}
+
+func (b *FieldInjectionBackend) ReportsDelivery() bool {
+	asyncBackend, ok := b.Backend.(AsyncBackend)
+	return ok && asyncBackend.ReportsDelivery()
+}
+
+func (b *FieldInjectionBackend) Flush() error {
+	if flusher, ok := b.Backend.(interface{ Flush() error }); ok {
+		return flusher.Flush()
+	}
+
+	return nil
+}
+
+func (b *FieldInjectionBackend) Close() error {
+	if closer, ok := b.Backend.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+func (b *FieldInjectionBackend) inject(msg Message) Message {
+	var data Data
+
+	for _, injector := range b.Injectors {
+		for k, v := range injector(msg) {
+			if _, found := msg.Data[k]; found {
+				continue
+			}
+
+			if data == nil {
+				// The data of the message are shared with other backends
+				// and must not be modified.
+				data = make(Data, len(msg.Data)+1)
+				for k2, v2 := range msg.Data {
+					data[k2] = v2
+				}
+			}
+
+			if _, found := data[k]; !found {
+				data[k] = v
+			}
+		}
+	}
+
+	if data != nil {
+		msg.Data = data
+	}
+
+	return msg
+}
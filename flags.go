@@ -0,0 +1,124 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+type FlagEvaluation struct {
+	Flag    string
+	Variant string
+	Reason  string
+}
+
+// Feature flag systems can record evaluations in any value implementing the
+// FlagEvaluationRecorder interface, including loggers.
+type FlagEvaluationRecorder interface {
+	RecordFlagEvaluation(FlagEvaluation)
+}
+
+// A flag provider returns the current variant of a flag. Loggers use it to
+// include the variants of the flags listed in LoggerCfg.ErrorFlags in error
+// messages.
+type FlagProvider interface {
+	FlagVariant(flag string) (string, bool)
+}
+
+// A flag recorder keeps track of the last variant of each flag evaluated.
+// Variants usually depend on the request being handled, so recorders are
+// meant to be created for each request, see WithFlagRecorder.
+type FlagRecorder struct {
+	mut      sync.Mutex
+	variants map[string]string
+}
+
+func NewFlagRecorder() *FlagRecorder {
+	return &FlagRecorder{
+		variants: make(map[string]string),
+	}
+}
+
+func (r *FlagRecorder) RecordFlagEvaluation(e FlagEvaluation) {
+	r.mut.Lock()
+	r.variants[e.Flag] = e.Variant
+	r.mut.Unlock()
+}
+
+func (r *FlagRecorder) FlagVariant(flag string) (string, bool) {
+	r.mut.Lock()
+	variant, found := r.variants[flag]
+	r.mut.Unlock()
+
+	return variant, found
+}
+
+// Return a context containing a new flag recorder. Loggers obtained with
+// Logger.WithContext record flag evaluations in it, and add the variants it
+// contains to error messages, so that errors only report the variants
+// evaluated for the current request.
+func WithFlagRecorder(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKeyFlagRecorder, NewFlagRecorder())
+}
+
+// Return the flag recorder stored in a context, or nil if there is none.
+func ContextFlagRecorder(ctx context.Context) *FlagRecorder {
+	recorder, _ := ctx.Value(contextKeyFlagRecorder).(*FlagRecorder)
+	return recorder
+}
+
+func (l *Logger) RecordFlagEvaluation(e FlagEvaluation) {
+	if recorder, ok := l.Flags.(FlagEvaluationRecorder); ok {
+		recorder.RecordFlagEvaluation(e)
+	}
+
+	data := Data{
+		"flag":         e.Flag,
+		"flag_variant": e.Variant,
+	}
+
+	if e.Reason != "" {
+		data["flag_reason"] = e.Reason
+	}
+
+	l.log(Message{
+		Level: LevelInfo,
+		Message: fmt.Sprintf("feature flag %q evaluated to %q",
+			e.Flag, e.Variant),
+		Data: data,
+	}, 1)
+}
+
+func (l *Logger) errorFlags() map[string]string {
+	if l.Flags == nil || len(l.Cfg.ErrorFlags) == 0 {
+		return nil
+	}
+
+	var flags map[string]string
+
+	for _, flag := range l.Cfg.ErrorFlags {
+		if variant, found := l.Flags.FlagVariant(flag); found {
+			if flags == nil {
+				flags = make(map[string]string)
+			}
+
+			flags[flag] = variant
+		}
+	}
+
+	return flags
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/exograd/go-log"
+	"github.com/exograd/go-log/logtest"
+)
+
+func TestFlagRecorderContext(t *testing.T) {
+	logger, backend := logtest.NewLogger("test")
+	logger.Cfg.ErrorFlags = []string{"checkout"}
+
+	// Each request records its own evaluations.
+	ctx1 := log.WithFlagRecorder(context.Background())
+	ctx2 := log.WithFlagRecorder(context.Background())
+
+	logger1 := logger.WithContext(ctx1)
+	logger2 := logger.WithContext(ctx2)
+
+	logger1.RecordFlagEvaluation(log.FlagEvaluation{
+		Flag:    "checkout",
+		Variant: "v1",
+	})
+
+	logger2.RecordFlagEvaluation(log.FlagEvaluation{
+		Flag:    "checkout",
+		Variant: "v2",
+	})
+
+	backend.Reset()
+
+	logger1.Error("error 1")
+	logger2.Error("error 2")
+	logger.Error("error 3")
+
+	entries := backend.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 messages, got %v", entries)
+	}
+
+	for i, expected := range []interface{}{
+		map[string]string{"checkout": "v1"},
+		map[string]string{"checkout": "v2"},
+		nil,
+	} {
+		if flags := entries[i].Data["feature_flags"]; !reflect.DeepEqual(flags,
+			expected) {
+			t.Errorf("message %d contains flags %v instead of %v", i, flags,
+				expected)
+		}
+	}
+}
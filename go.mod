@@ -1,3 +1,5 @@
 module github.com/exograd/go-log
 
-go 1.17
+go 1.18
+
+require golang.org/x/sys v0.13.0
@@ -0,0 +1,145 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"strings"
+)
+
+// Body capture records the beginning of request and response bodies, and
+// adds them to the log message of requests whose response status is 400 or
+// higher. Only bodies whose content type matches one of the configured content
+// types (either a full media type or a "type/*" pattern) are captured; values
+// of sensitive fields in JSON and form bodies are redacted, and other text
+// bodies are scrubbed with DefaultScrubPatterns.
+type HTTPBodyCaptureCfg struct {
+	MaxSize      int      `json:"max_size"`
+	ContentTypes []string `json:"content_types"`
+	RedactedKeys []string `json:"redacted_keys"`
+}
+
+var DefaultHTTPBodyCaptureContentTypes = []string{
+	"application/json",
+	"application/x-www-form-urlencoded",
+	"text/*",
+}
+
+func (cfg *HTTPBodyCaptureCfg) setDefaults() {
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = 4096
+	}
+
+	if len(cfg.ContentTypes) == 0 {
+		cfg.ContentTypes = DefaultHTTPBodyCaptureContentTypes
+	}
+}
+
+func (cfg *HTTPBodyCaptureCfg) captureContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, pattern := range cfg.ContentTypes {
+		if strings.HasSuffix(pattern, "/*") {
+			if strings.HasPrefix(mediaType, pattern[:len(pattern)-1]) {
+				return true
+			}
+		} else if mediaType == pattern {
+			return true
+		}
+	}
+
+	return false
+}
+
+type cappedBuffer struct {
+	data      []byte
+	maxSize   int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(data []byte) (int, error) {
+	n := len(data)
+
+	if free := b.maxSize - len(b.data); n > free {
+		data = data[:free]
+		b.truncated = true
+	}
+
+	b.data = append(b.data, data...)
+
+	return n, nil
+}
+
+type captureReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func newCaptureReadCloser(body io.ReadCloser, buf *cappedBuffer) io.ReadCloser {
+	return &captureReadCloser{
+		Reader: io.TeeReader(body, buf),
+		Closer: body,
+	}
+}
+
+func (cfg *HTTPBodyCaptureCfg) bodyDatum(contentType string, buf *cappedBuffer) Datum {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case "application/json":
+		var value interface{}
+		if err := json.Unmarshal(buf.data, &value); err != nil {
+			// We cannot redact the content of truncated or invalid
+			// documents, so we do not log them.
+			return fmt.Sprintf("<%d bytes of unparsable json>",
+				len(buf.data))
+		}
+
+		data, err := json.Marshal(redactJSONValue(value, cfg.RedactedKeys))
+		if err != nil {
+			return fmt.Sprintf("<%d bytes of json>", len(buf.data))
+		}
+
+		return string(data)
+
+	case "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(buf.data))
+		if err != nil {
+			return fmt.Sprintf("<%d bytes of unparsable form data>",
+				len(buf.data))
+		}
+
+		for key := range values {
+			if isSensitiveKey(key, cfg.RedactedKeys) {
+				values[key] = []string{RedactedValue}
+			}
+		}
+
+		return values.Encode()
+
+	default:
+		// Text bodies have no structure we could use to find sensitive
+		// values, so we mask them with the default scrubbing patterns.
+		text := strings.ToValidUTF8(string(buf.data), "\uFFFD")
+		return defaultMessageScrubber.scrub(text)
+	}
+}
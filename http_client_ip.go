@@ -0,0 +1,147 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type ClientIPStrategy string
+
+const (
+	// Use the address of the peer which sent the request.
+	ClientIPStrategyRemoteAddr ClientIPStrategy = "remote_addr"
+
+	// Use the rightmost address of the X-Forwarded-For header which is not a
+	// trusted proxy.
+	ClientIPStrategyXForwardedFor ClientIPStrategy = "x_forwarded_for"
+
+	// Use the address in the X-Real-IP header.
+	ClientIPStrategyXRealIP ClientIPStrategy = "x_real_ip"
+
+	// Use the address in the CF-Connecting-IP header set by Cloudflare.
+	ClientIPStrategyCFConnectingIP ClientIPStrategy = "cf_connecting_ip"
+)
+
+// Headers are only used if the peer is a trusted proxy, so strategies based on
+// headers require at least one trusted proxy. Trusting all peers, e.g. with
+// "0.0.0.0/0" and "::/0", is only safe when the server cannot be reached
+// without going through a proxy.
+type clientIPResolver struct {
+	strategy       ClientIPStrategy
+	trustedProxies []*net.IPNet
+}
+
+func newClientIPResolver(strategy ClientIPStrategy, trustedProxies []string) (*clientIPResolver, error) {
+	switch strategy {
+	case "":
+		strategy = ClientIPStrategyRemoteAddr
+
+	case ClientIPStrategyRemoteAddr, ClientIPStrategyXForwardedFor,
+		ClientIPStrategyXRealIP, ClientIPStrategyCFConnectingIP:
+
+	default:
+		return nil, fmt.Errorf("invalid client ip strategy %q", strategy)
+	}
+
+	r := &clientIPResolver{
+		strategy: strategy,
+	}
+
+	for _, s := range trustedProxies {
+		if !strings.Contains(s, "/") {
+			if strings.Contains(s, ":") {
+				s += "/128"
+			} else {
+				s += "/32"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", s, err)
+		}
+
+		r.trustedProxies = append(r.trustedProxies, ipNet)
+	}
+
+	if strategy != ClientIPStrategyRemoteAddr && len(r.trustedProxies) == 0 {
+		return nil, fmt.Errorf("client ip strategy %q requires at least one "+
+			"trusted proxy", strategy)
+	}
+
+	return r, nil
+}
+
+func (r *clientIPResolver) isTrusted(ip net.IP) bool {
+	for _, ipNet := range r.trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *clientIPResolver) clientIP(req *http.Request) string {
+	peer := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+
+	peerIP := net.ParseIP(peer)
+	if peerIP == nil || r.strategy == ClientIPStrategyRemoteAddr ||
+		!r.isTrusted(peerIP) {
+		return peer
+	}
+
+	switch r.strategy {
+	case ClientIPStrategyXForwardedFor:
+		var addrs []string
+		for _, value := range req.Header.Values("X-Forwarded-For") {
+			for _, addr := range strings.Split(value, ",") {
+				addrs = append(addrs, strings.TrimSpace(addr))
+			}
+		}
+
+		// Walk the list from the right, skipping trusted proxies; if all
+		// addresses are trusted, the leftmost one is the client.
+		for i := len(addrs) - 1; i >= 0; i-- {
+			ip := net.ParseIP(addrs[i])
+			if ip == nil {
+				break
+			}
+
+			if !r.isTrusted(ip) || i == 0 {
+				return addrs[i]
+			}
+		}
+
+	case ClientIPStrategyXRealIP:
+		if ip := net.ParseIP(req.Header.Get("X-Real-IP")); ip != nil {
+			return ip.String()
+		}
+
+	case ClientIPStrategyCFConnectingIP:
+		if ip := net.ParseIP(req.Header.Get("CF-Connecting-IP")); ip != nil {
+			return ip.String()
+		}
+	}
+
+	return peer
+}
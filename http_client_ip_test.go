@@ -0,0 +1,129 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	proxies := []string{"10.0.0.0/8", "2001:db8::1"}
+	all := []string{"0.0.0.0/0", "::/0"}
+
+	tests := []struct {
+		name     string
+		strategy ClientIPStrategy
+		proxies  []string
+		peer     string
+		headers  map[string][]string
+		clientIP string
+	}{
+		{"remote addr", ClientIPStrategyRemoteAddr, nil,
+			"192.0.2.1:1234",
+			map[string][]string{"X-Forwarded-For": {"203.0.113.5"}},
+			"192.0.2.1"},
+		{"untrusted peer", ClientIPStrategyXForwardedFor, proxies,
+			"192.0.2.1:1234",
+			map[string][]string{"X-Forwarded-For": {"203.0.113.5"}},
+			"192.0.2.1"},
+		{"single proxy", ClientIPStrategyXForwardedFor, proxies,
+			"10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"203.0.113.5"}},
+			"203.0.113.5"},
+		{"spoofed entries", ClientIPStrategyXForwardedFor, proxies,
+			"10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {
+				"198.51.100.1, 203.0.113.5, 10.0.0.2"}},
+			"203.0.113.5"},
+		{"several headers", ClientIPStrategyXForwardedFor, proxies,
+			"10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {
+				"198.51.100.1", "203.0.113.5,10.0.0.2"}},
+			"203.0.113.5"},
+		{"trusted entries only", ClientIPStrategyXForwardedFor, proxies,
+			"10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+			"10.0.0.3"},
+		{"invalid entry", ClientIPStrategyXForwardedFor, proxies,
+			"10.0.0.1:1234",
+			map[string][]string{"X-Forwarded-For": {"203.0.113.5, foo"}},
+			"10.0.0.1"},
+		{"missing header", ClientIPStrategyXForwardedFor, proxies,
+			"10.0.0.1:1234", nil,
+			"10.0.0.1"},
+		{"ipv6", ClientIPStrategyXForwardedFor, proxies,
+			"[2001:db8::1]:1234",
+			map[string][]string{"X-Forwarded-For": {"2001:db8::2"}},
+			"2001:db8::2"},
+		{"trust all", ClientIPStrategyXForwardedFor, all,
+			"192.0.2.1:1234",
+			map[string][]string{"X-Forwarded-For": {
+				"203.0.113.5, 198.51.100.1"}},
+			"203.0.113.5"},
+		{"x-real-ip", ClientIPStrategyXRealIP, proxies,
+			"10.0.0.1:1234",
+			map[string][]string{"X-Real-Ip": {"203.0.113.5"}},
+			"203.0.113.5"},
+		{"x-real-ip untrusted peer", ClientIPStrategyXRealIP, proxies,
+			"192.0.2.1:1234",
+			map[string][]string{"X-Real-Ip": {"203.0.113.5"}},
+			"192.0.2.1"},
+		{"cf-connecting-ip", ClientIPStrategyCFConnectingIP, proxies,
+			"10.0.0.1:1234",
+			map[string][]string{"Cf-Connecting-Ip": {"203.0.113.5"}},
+			"203.0.113.5"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := newClientIPResolver(test.strategy, test.proxies)
+			if err != nil {
+				t.Fatalf("cannot create resolver: %v", err)
+			}
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = test.peer
+			for name, values := range test.headers {
+				req.Header[name] = values
+			}
+
+			if clientIP := r.clientIP(req); clientIP != test.clientIP {
+				t.Errorf("client ip is %q instead of %q", clientIP,
+					test.clientIP)
+			}
+		})
+	}
+}
+
+func TestClientIPResolverInvalidCfg(t *testing.T) {
+	tests := []struct {
+		strategy ClientIPStrategy
+		proxies  []string
+	}{
+		{"foo", nil},
+		{ClientIPStrategyXForwardedFor, nil},
+		{ClientIPStrategyXRealIP, []string{}},
+		{ClientIPStrategyCFConnectingIP, nil},
+		{ClientIPStrategyXForwardedFor, []string{"10.0.0.300"}},
+	}
+
+	for _, test := range tests {
+		if _, err := newClientIPResolver(test.strategy, test.proxies); err == nil {
+			t.Errorf("strategy %q with trusted proxies %v was accepted",
+				test.strategy, test.proxies)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+type HTTPMiddlewareCfg struct {
+	// The name of the response header containing the incident identifier
+	// when a handler panics. The default header is "X-Incident-Id".
+	IncidentIdHeader string `json:"incident_id_header"`
+
+	// The strategy used to derive the client address logged as
+	// "remote_addr", and the list of addresses or networks of proxies whose
+	// headers can be trusted. Strategies based on headers require at least
+	// one trusted proxy.
+	ClientIPStrategy ClientIPStrategy `json:"client_ip_strategy"`
+	TrustedProxies   []string         `json:"trusted_proxies"`
+
+	BodyCapture *HTTPBodyCaptureCfg `json:"body_capture,omitempty"`
+}
+
+// The HTTP middleware logs each request handled. If the handler panics, the
+// panic is logged with the stack trace and an incident identifier, and a 500
+// response containing the same identifier is sent to the client. If the
+// response had already been started, the middleware panics with
+// http.ErrAbortHandler instead so that the server closes the connection.
+type HTTPMiddleware struct {
+	Cfg    HTTPMiddlewareCfg
+	Logger *Logger
+
+	clientIPResolver *clientIPResolver
+	bodyCapture      *HTTPBodyCaptureCfg
+}
+
+func NewHTTPMiddleware(logger *Logger, cfg HTTPMiddlewareCfg) (*HTTPMiddleware, error) {
+	if cfg.IncidentIdHeader == "" {
+		cfg.IncidentIdHeader = "X-Incident-Id"
+	}
+
+	clientIPResolver, err := newClientIPResolver(cfg.ClientIPStrategy,
+		cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &HTTPMiddleware{
+		Cfg:    cfg,
+		Logger: logger,
+
+		clientIPResolver: clientIPResolver,
+	}
+
+	if cfg.BodyCapture != nil {
+		bodyCapture := *cfg.BodyCapture
+		bodyCapture.setDefaults()
+		m.bodyCapture = &bodyCapture
+	}
+
+	return m, nil
+}
+
+func (m *HTTPMiddleware) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+
+		w2 := &httpResponseWriter{
+			ResponseWriter: w,
+			bodyCapture:    m.bodyCapture,
+		}
+
+		var reqBody *cappedBuffer
+		if m.bodyCapture != nil && req.Body != nil &&
+			m.bodyCapture.captureContentType(req.Header.Get("Content-Type")) {
+			reqBody = &cappedBuffer{maxSize: m.bodyCapture.MaxSize}
+			req.Body = newCaptureReadCloser(req.Body, reqBody)
+		}
+
+		defer func() {
+			var abort bool
+
+			if value := recover(); value != nil {
+				if value == http.ErrAbortHandler {
+					panic(value)
+				}
+
+				abort = !m.handlePanic(w2, req, value)
+			}
+
+			m.logRequest(w2, req, reqBody, time.Since(start))
+
+			if abort {
+				panic(http.ErrAbortHandler)
+			}
+		}()
+
+		h.ServeHTTP(w2, req)
+	})
+}
+
+func (m *HTTPMiddleware) requestData(req *http.Request) Data {
+	return Data{
+		"method":      req.Method,
+		"path":        req.URL.Path,
+		"remote_addr": m.clientIPResolver.clientIP(req),
+	}
+}
+
+func (m *HTTPMiddleware) logRequest(w *httpResponseWriter, req *http.Request, reqBody *cappedBuffer, d time.Duration) {
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	data := Data{}
+
+	if status >= 400 && m.bodyCapture != nil {
+		if reqBody != nil {
+			contentType := req.Header.Get("Content-Type")
+			data["request_body"] = m.bodyCapture.bodyDatum(contentType, reqBody)
+			if reqBody.truncated {
+				data["request_body_truncated"] = true
+			}
+		}
+
+		if resBody := w.capturedBody; resBody != nil {
+			contentType := w.Header().Get("Content-Type")
+			data["response_body"] = m.bodyCapture.bodyDatum(contentType, resBody)
+			if resBody.truncated {
+				data["response_body_truncated"] = true
+			}
+		}
+	}
+
+	m.logResponse(req, status, w.size, d, data)
+}
+
+func (m *HTTPMiddleware) logResponse(req *http.Request, status, size int, d time.Duration, extraData Data) {
+	data := MergeData(m.requestData(req), extraData)
+	data["status"] = status
+	data["response_size"] = size
+	data["duration"] = d.Seconds()
+
+	message := fmt.Sprintf("%s %s %d %v", req.Method, req.URL.Path, status,
+		d.Round(time.Microsecond))
+
+	if status >= 500 {
+		m.Logger.ErrorData(data, "%s", message)
+	} else {
+		m.Logger.InfoData(data, "%s", message)
+	}
+}
+
+// Log a panic and send an error response. Return false if the response has
+// already been started, in which case the connection must be closed so that
+// the client does not take a truncated response for a complete one.
+func (m *HTTPMiddleware) handlePanic(w *httpResponseWriter, req *http.Request, value interface{}) bool {
+	incidentId := m.logPanic(req, value, 4)
+
+	if w.status != 0 {
+		return false
+	}
+
+	header := w.Header()
+	header.Set(m.Cfg.IncidentIdHeader, incidentId)
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	header.Del("Content-Length")
+
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(w, "internal server error (incident %s)\n", incidentId)
+
+	return true
+}
+
+// Log a panic and return the incident identifier. The stack trace starts
+// skip frames above the caller.
+func (m *HTTPMiddleware) logPanic(req *http.Request, value interface{}, skip int) string {
+	incidentId := generateId()
+
+	data := m.requestData(req)
+	data["incident_id"] = incidentId
+	data["stack_trace"] = CaptureStack(skip).String()
+
+	m.Logger.ErrorData(data, "panic in http handler: %v", value)
+
+	return incidentId
+}
+
+// HTTPRequestLog is used to log requests handled by web frameworks which do
+// not use net/http handlers; see the adapters directory. Body capture is not
+// supported.
+type HTTPRequestLog struct {
+	m     *HTTPMiddleware
+	req   *http.Request
+	start time.Time
+}
+
+// Start tracking a request. For frameworks which are not based on net/http,
+// the request must contain the method, the path, the remote address and the
+// headers of the original request.
+func (m *HTTPMiddleware) StartRequest(req *http.Request) *HTTPRequestLog {
+	return &HTTPRequestLog{
+		m:     m,
+		req:   req,
+		start: time.Now(),
+	}
+}
+
+// Log the request once the response has been sent.
+func (r *HTTPRequestLog) Finish(status, responseSize int) {
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	if responseSize < 0 {
+		responseSize = 0
+	}
+
+	r.m.logResponse(r.req, status, responseSize, time.Since(r.start), nil)
+}
+
+// Log a panic recovered while handling the request, and return the incident
+// identifier which should be sent to the client in the header whose name is
+// configured in the middleware. The function must be called from the
+// deferred function which recovered the panic.
+func (r *HTTPRequestLog) Panic(value interface{}) string {
+	return r.m.logPanic(r.req, value, 4)
+}
+
+type httpResponseWriter struct {
+	http.ResponseWriter
+
+	status int
+	size   int
+
+	bodyCapture  *HTTPBodyCaptureCfg
+	capturedBody *cappedBuffer
+}
+
+func (w *httpResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *httpResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	if w.bodyCapture != nil && w.capturedBody == nil {
+		contentType := w.Header().Get("Content-Type")
+		if w.bodyCapture.captureContentType(contentType) {
+			w.capturedBody = &cappedBuffer{maxSize: w.bodyCapture.MaxSize}
+		} else {
+			w.bodyCapture = nil
+		}
+	}
+
+	n, err := w.ResponseWriter.Write(data)
+	w.size += n
+
+	if w.capturedBody != nil {
+		w.capturedBody.Write(data[:n])
+	}
+
+	return n, err
+}
+
+func (w *httpResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *httpResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support " +
+			"hijacking")
+	}
+
+	return hijacker.Hijack()
+}
@@ -0,0 +1,259 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/exograd/go-log"
+	"github.com/exograd/go-log/logtest"
+)
+
+func newTestHTTPMiddleware(t *testing.T, cfg log.HTTPMiddlewareCfg) (*log.HTTPMiddleware, *logtest.Backend) {
+	logger, backend := logtest.NewLogger("http")
+
+	m, err := log.NewHTTPMiddleware(logger, cfg)
+	if err != nil {
+		t.Fatalf("cannot create middleware: %v", err)
+	}
+
+	return m, backend
+}
+
+// Serve a request and return the response and the value the middleware
+// panicked with, if any.
+func serveTestHTTPRequest(h http.Handler, req *http.Request) (res *httptest.ResponseRecorder, value interface{}) {
+	res = httptest.NewRecorder()
+
+	defer func() {
+		value = recover()
+	}()
+
+	h.ServeHTTP(res, req)
+
+	return
+}
+
+func TestHTTPMiddlewareRequest(t *testing.T) {
+	m, backend := newTestHTTPMiddleware(t, log.HTTPMiddlewareCfg{})
+
+	h := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, "created")
+	}))
+
+	req := httptest.NewRequest("POST", "/projects", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+
+	res, value := serveTestHTTPRequest(h, req)
+	if value != nil {
+		t.Fatalf("middleware panicked: %v", value)
+	}
+
+	if res.Code != http.StatusCreated {
+		t.Errorf("unexpected status %d", res.Code)
+	}
+
+	entries := backend.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 log message, got %v", entries)
+	}
+
+	msg := entries[0]
+
+	if msg.Level != log.LevelInfo ||
+		!strings.HasPrefix(msg.Message, "POST /projects 201 ") {
+		t.Errorf("unexpected log message %q at level %s", msg.Message,
+			msg.Level)
+	}
+
+	for key, value := range map[string]interface{}{
+		"method":        "POST",
+		"path":          "/projects",
+		"remote_addr":   "192.0.2.1",
+		"status":        201,
+		"response_size": 7,
+	} {
+		if msg.Data[key] != value {
+			t.Errorf("data key %q is %#v instead of %#v", key, msg.Data[key],
+				value)
+		}
+	}
+}
+
+func TestHTTPMiddlewarePanic(t *testing.T) {
+	m, backend := newTestHTTPMiddleware(t, log.HTTPMiddlewareCfg{
+		IncidentIdHeader: "X-Incident",
+	})
+
+	h := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Length", "42")
+		panic("boom")
+	}))
+
+	res, value := serveTestHTTPRequest(h, httptest.NewRequest("GET", "/", nil))
+	if value != nil {
+		t.Fatalf("middleware panicked: %v", value)
+	}
+
+	if res.Code != http.StatusInternalServerError {
+		t.Errorf("unexpected status %d", res.Code)
+	}
+
+	incidentId := res.Header().Get("X-Incident")
+	if incidentId == "" {
+		t.Fatalf("missing incident id header")
+	}
+
+	if res.Header().Get("Content-Length") != "" {
+		t.Errorf("content length of the handler was not removed")
+	}
+
+	body := fmt.Sprintf("internal server error (incident %s)\n", incidentId)
+	if res.Body.String() != body {
+		t.Errorf("unexpected body %q", res.Body.String())
+	}
+
+	entries := backend.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 log messages, got %v", entries)
+	}
+
+	panicMsg, requestMsg := entries[0], entries[1]
+
+	if panicMsg.Message != "panic in http handler: boom" ||
+		panicMsg.Level != log.LevelError {
+		t.Errorf("unexpected panic message %q at level %s",
+			panicMsg.Message, panicMsg.Level)
+	}
+
+	if panicMsg.Data["incident_id"] != incidentId {
+		t.Errorf("incident id %v was logged instead of %q",
+			panicMsg.Data["incident_id"], incidentId)
+	}
+
+	if stackTrace, _ := panicMsg.Data["stack_trace"].(string); stackTrace == "" {
+		t.Errorf("missing stack trace")
+	}
+
+	if requestMsg.Data["status"] != http.StatusInternalServerError ||
+		requestMsg.Level != log.LevelError {
+		t.Errorf("unexpected request message %q at level %s",
+			requestMsg.Message, requestMsg.Level)
+	}
+}
+
+func TestHTTPMiddlewarePanicAfterWrite(t *testing.T) {
+	m, backend := newTestHTTPMiddleware(t, log.HTTPMiddlewareCfg{})
+
+	h := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, "partial")
+		panic("boom")
+	}))
+
+	res, value := serveTestHTTPRequest(h, httptest.NewRequest("GET", "/", nil))
+
+	// The response has been started, the connection must be closed.
+	if value != http.ErrAbortHandler {
+		t.Fatalf("middleware panicked with %v instead of aborting the "+
+			"handler", value)
+	}
+
+	if res.Header().Get("X-Incident-Id") != "" {
+		t.Errorf("incident id header set after the response was started")
+	}
+
+	if res.Body.String() != "partial" {
+		t.Errorf("unexpected body %q", res.Body.String())
+	}
+
+	entries := backend.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 log messages, got %v", entries)
+	}
+
+	if entries[0].Message != "panic in http handler: boom" {
+		t.Errorf("unexpected panic message %q", entries[0].Message)
+	}
+
+	if entries[1].Data["status"] != http.StatusOK {
+		t.Errorf("unexpected request status %v", entries[1].Data["status"])
+	}
+}
+
+func TestHTTPMiddlewareAbortHandler(t *testing.T) {
+	m, backend := newTestHTTPMiddleware(t, log.HTTPMiddlewareCfg{})
+
+	h := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	_, value := serveTestHTTPRequest(h, httptest.NewRequest("GET", "/", nil))
+	if value != http.ErrAbortHandler {
+		t.Fatalf("middleware panicked with %v instead of %v", value,
+			http.ErrAbortHandler)
+	}
+
+	if entries := backend.Entries(); len(entries) != 0 {
+		t.Errorf("aborted handler was logged: %v", entries)
+	}
+}
+
+func TestHTTPMiddlewareBodyCapture(t *testing.T) {
+	m, backend := newTestHTTPMiddleware(t, log.HTTPMiddlewareCfg{
+		BodyCapture: &log.HTTPBodyCaptureCfg{},
+	})
+
+	h := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, err := io.ReadAll(req.Body); err != nil {
+			t.Errorf("cannot read request body: %v", err)
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "invalid name")
+	}))
+
+	req := httptest.NewRequest("POST", "/users",
+		strings.NewReader(`{"name":"bob","password":"hunter2"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	if _, value := serveTestHTTPRequest(h, req); value != nil {
+		t.Fatalf("middleware panicked: %v", value)
+	}
+
+	entries := backend.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 log message, got %v", entries)
+	}
+
+	data := entries[0].Data
+
+	requestBody := fmt.Sprintf(`{"name":"bob","password":%q}`,
+		log.RedactedValue)
+	if data["request_body"] != requestBody {
+		t.Errorf("request body %#v was logged instead of %#v",
+			data["request_body"], requestBody)
+	}
+
+	if data["response_body"] != "invalid name" {
+		t.Errorf("unexpected response body %#v", data["response_body"])
+	}
+}
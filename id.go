@@ -0,0 +1,170 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The function used to generate identifiers, e.g. incident and connection
+// identifiers. It can be replaced during initialization, before any logger is
+// used. Generators must be safe for concurrent use.
+var IdGenerator func() string = GenerateUUIDv4
+
+func generateId() string {
+	return IdGenerator()
+}
+
+// Generate a random (version 4) UUID.
+func GenerateUUIDv4() string {
+	var data [16]byte
+	randomBytes(data[:])
+
+	data[6] = (data[6] & 0x0f) | 0x40
+	data[8] = (data[8] & 0x3f) | 0x80
+
+	return formatUUID(data)
+}
+
+var uuidv7Generator struct {
+	sync.Mutex
+	lastMs  int64
+	counter uint16
+}
+
+// Generate a time-ordered (version 7) UUID. Identifiers generated by the
+// process are strictly increasing: the 12 bit rand_a field is used as a
+// counter for identifiers generated during the same millisecond
+// (RFC 9562 section 6.2 method 1).
+func GenerateUUIDv7() string {
+	var data [16]byte
+	randomBytes(data[6:])
+
+	g := &uuidv7Generator
+	g.Lock()
+
+	ms := time.Now().UnixNano() / int64(time.Millisecond)
+	if ms <= g.lastMs {
+		ms = g.lastMs
+		g.counter++
+
+		if g.counter > 0xfff {
+			ms++
+			g.counter = 0
+		}
+	} else {
+		// Start with a random counter value, leaving room for increments
+		g.counter = binary.BigEndian.Uint16(data[6:8]) & 0x7ff
+	}
+
+	g.lastMs = ms
+	counter := g.counter
+
+	g.Unlock()
+
+	putUint48(data[0:6], ms)
+
+	data[6] = 0x70 | byte(counter>>8)
+	data[7] = byte(counter)
+	data[8] = (data[8] & 0x3f) | 0x80
+
+	return formatUUID(data)
+}
+
+var ulidGenerator struct {
+	sync.Mutex
+	lastMs     int64
+	lastRandom [10]byte
+}
+
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// Generate a ULID (https://github.com/ulid/spec). As for UUIDv7, identifiers
+// are strictly increasing: the random part is incremented for identifiers
+// generated during the same millisecond.
+func GenerateULID() string {
+	var random [10]byte
+	randomBytes(random[:])
+
+	g := &ulidGenerator
+	g.Lock()
+
+	ms := time.Now().UnixNano() / int64(time.Millisecond)
+	if ms <= g.lastMs {
+		ms = g.lastMs
+		random = g.lastRandom
+
+		if !incrementBytes(random[:]) {
+			ms++
+		}
+	}
+
+	g.lastMs = ms
+	g.lastRandom = random
+
+	g.Unlock()
+
+	var data [16]byte
+	putUint48(data[0:6], ms)
+	copy(data[6:], random[:])
+
+	// 128 bits encoded as 26 characters of 5 bits, the first character
+	// only containing 3 bits.
+	hi := binary.BigEndian.Uint64(data[0:8])
+	lo := binary.BigEndian.Uint64(data[8:16])
+
+	var s [26]byte
+	for i := 25; i >= 0; i-- {
+		s[i] = crockfordBase32[lo&0x1f]
+		lo = (lo >> 5) | (hi << 59)
+		hi >>= 5
+	}
+
+	return string(s[:])
+}
+
+func randomBytes(data []byte) {
+	if _, err := rand.Read(data); err != nil {
+		panic(fmt.Sprintf("cannot generate random data: %v", err))
+	}
+}
+
+func formatUUID(data [16]byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x",
+		data[0:4], data[4:6], data[6:8], data[8:10], data[10:16])
+}
+
+func putUint48(data []byte, v int64) {
+	for i := 5; i >= 0; i-- {
+		data[i] = byte(v)
+		v >>= 8
+	}
+}
+
+// Increment a big endian integer, returning false on overflow.
+func incrementBytes(data []byte) bool {
+	for i := len(data) - 1; i >= 0; i-- {
+		data[i]++
+		if data[i] != 0 {
+			return true
+		}
+	}
+
+	return false
+}
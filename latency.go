@@ -0,0 +1,144 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Delivery latency is the time between the moment a message is passed to the
+// logger and the moment the backend has written it. Synchronous backends have
+// written the message when their Log method returns; asynchronous backends
+// implement AsyncBackend and call Message.Delivered once the message has been
+// written.
+type DeliveryLatencyCfg struct {
+	// Messages delivered after this delay are counted as delayed and passed
+	// to the handler if there is one.
+	Threshold time.Duration                `json:"threshold"`
+	Handler   func(Message, time.Duration) `json:"-"`
+}
+
+type AsyncBackend interface {
+	Backend
+
+	// Return true if the backend calls Message.Delivered for every message.
+	ReportsDelivery() bool
+}
+
+// Upper bounds of the buckets of the latency distribution. The last bucket
+// contains all values above the last bound.
+var DeliveryLatencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+type DeliveryLatencyStats struct {
+	Count   int64         `json:"count"`
+	Delayed int64         `json:"delayed"`
+	Total   time.Duration `json:"total"`
+	Max     time.Duration `json:"max"`
+
+	// Buckets contains one more element than DeliveryLatencyBuckets.
+	Buckets []int64 `json:"buckets"`
+}
+
+type latencyTracker struct {
+	// Counters are accessed atomically and must stay 64 bit aligned on 32
+	// bit platforms.
+	count   int64
+	delayed int64
+	total   int64
+	max     int64
+	buckets []int64
+
+	Cfg DeliveryLatencyCfg
+}
+
+func newLatencyTracker(cfg DeliveryLatencyCfg) *latencyTracker {
+	return &latencyTracker{
+		Cfg: cfg,
+
+		buckets: make([]int64, len(DeliveryLatencyBuckets)+1),
+	}
+}
+
+func (t *latencyTracker) record(msg Message, latency time.Duration) {
+	atomic.AddInt64(&t.count, 1)
+	atomic.AddInt64(&t.total, int64(latency))
+
+	for {
+		max := atomic.LoadInt64(&t.max)
+		if int64(latency) <= max ||
+			atomic.CompareAndSwapInt64(&t.max, max, int64(latency)) {
+			break
+		}
+	}
+
+	i := 0
+	for i < len(DeliveryLatencyBuckets) && latency > DeliveryLatencyBuckets[i] {
+		i++
+	}
+	atomic.AddInt64(&t.buckets[i], 1)
+
+	if t.Cfg.Threshold > 0 && latency > t.Cfg.Threshold {
+		atomic.AddInt64(&t.delayed, 1)
+
+		if t.Cfg.Handler != nil {
+			t.Cfg.Handler(msg, latency)
+		}
+	}
+}
+
+func (t *latencyTracker) stats() *DeliveryLatencyStats {
+	stats := DeliveryLatencyStats{
+		Count:   atomic.LoadInt64(&t.count),
+		Delayed: atomic.LoadInt64(&t.delayed),
+		Total:   time.Duration(atomic.LoadInt64(&t.total)),
+		Max:     time.Duration(atomic.LoadInt64(&t.max)),
+
+		Buckets: make([]int64, len(t.buckets)),
+	}
+
+	for i := range t.buckets {
+		stats.Buckets[i] = atomic.LoadInt64(&t.buckets[i])
+	}
+
+	return &stats
+}
+
+// Return the delivery latency distribution, or nil if latency tracking is not
+// enabled.
+func (l *Logger) DeliveryLatency() *DeliveryLatencyStats {
+	if l.latencyTracker == nil {
+		return nil
+	}
+
+	return l.latencyTracker.stats()
+}
+
+// Signal that the message has been written. Backends which do not implement
+// AsyncBackend do not have to call this method.
+func (msg Message) Delivered() {
+	if msg.latencyTracker == nil {
+		return
+	}
+
+	msg.latencyTracker.record(msg, time.Since(msg.birth))
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Locales only affect the way the terminal backend renders numbers and times
+// in message data. They are meant for tools whose output is read by people
+// rather than programs.
+type locale struct {
+	ThousandsSeparator string
+	DecimalSeparator   string
+	DateLayout         string
+	Clock12h           bool
+}
+
+var locales = map[string]locale{
+	"en-US": {",", ".", "01/02/2006", true},
+	"en-GB": {",", ".", "02/01/2006", false},
+	"fr-FR": {"\u202f", ",", "02/01/2006", false},
+	"de-DE": {".", ",", "02.01.2006", false},
+	"es-ES": {".", ",", "02/01/2006", false},
+	"it-IT": {".", ",", "02/01/2006", false},
+	"pt-BR": {".", ",", "02/01/2006", false},
+	"ja-JP": {",", ".", "2006/01/02", false},
+}
+
+func newLocale(name, clock string) (*locale, error) {
+	l, found := locales[name]
+	if !found {
+		return nil, fmt.Errorf("unknown locale %q", name)
+	}
+
+	switch clock {
+	case "":
+	case "12h":
+		l.Clock12h = true
+	case "24h":
+		l.Clock12h = false
+	default:
+		return nil, fmt.Errorf("invalid clock %q", clock)
+	}
+
+	return &l, nil
+}
+
+// Return the localized representation of a datum if it is a number or a
+// time.
+func (l *locale) formatDatum(datum Datum) (string, bool) {
+	switch v := datum.(type) {
+	case int:
+		return l.formatInteger(strconv.FormatInt(int64(v), 10)), true
+	case int8:
+		return l.formatInteger(strconv.FormatInt(int64(v), 10)), true
+	case int16:
+		return l.formatInteger(strconv.FormatInt(int64(v), 10)), true
+	case int32:
+		return l.formatInteger(strconv.FormatInt(int64(v), 10)), true
+	case int64:
+		return l.formatInteger(strconv.FormatInt(v, 10)), true
+	case uint:
+		return l.formatInteger(strconv.FormatUint(uint64(v), 10)), true
+	case uint8:
+		return l.formatInteger(strconv.FormatUint(uint64(v), 10)), true
+	case uint16:
+		return l.formatInteger(strconv.FormatUint(uint64(v), 10)), true
+	case uint32:
+		return l.formatInteger(strconv.FormatUint(uint64(v), 10)), true
+	case uint64:
+		return l.formatInteger(strconv.FormatUint(v, 10)), true
+	case float32:
+		return l.formatFloat(float64(v), 32)
+	case float64:
+		return l.formatFloat(v, 64)
+	case time.Time:
+		return l.formatTime(v), true
+	}
+
+	return "", false
+}
+
+func (l *locale) formatInteger(s string) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+
+	if len(s) <= 3 {
+		return sign + s
+	}
+
+	var buf strings.Builder
+	buf.WriteString(sign)
+
+	first := len(s) % 3
+	if first == 0 {
+		first = 3
+	}
+	buf.WriteString(s[:first])
+
+	for i := first; i < len(s); i += 3 {
+		buf.WriteString(l.ThousandsSeparator)
+		buf.WriteString(s[i : i+3])
+	}
+
+	return buf.String()
+}
+
+func (l *locale) formatFloat(f float64, bitSize int) (string, bool) {
+	// Very large or small numbers are better represented with an exponent
+	if math.IsNaN(f) || math.IsInf(f, 0) || math.Abs(f) >= 1e21 ||
+		(f != 0 && math.Abs(f) < 1e-6) {
+		return "", false
+	}
+
+	s := strconv.FormatFloat(f, 'f', -1, bitSize)
+
+	intPart, fracPart := s, ""
+	if idx := strings.IndexByte(s, '.'); idx >= 0 {
+		intPart, fracPart = s[:idx], s[idx+1:]
+	}
+
+	s = l.formatInteger(intPart)
+	if fracPart != "" {
+		s += l.DecimalSeparator + fracPart
+	}
+
+	return s, true
+}
+
+func (l *locale) formatTime(t time.Time) string {
+	layout := l.DateLayout + " 15:04:05"
+	if l.Clock12h {
+		layout = l.DateLayout + " 3:04:05 PM"
+	}
+
+	return t.Format(layout)
+}
@@ -34,6 +34,24 @@ type Message struct {
 	Data       Data
 
 	domain string
+
+	// The format string of messages logged with a format, e.g. with
+	// Logger.Info; see SamplingCfg.
+	format string
+
+	// The program counter of the call to the logger, only set for error
+	// messages; see AggregationKey.
+	callSite uintptr
+
+	// Used to track delivery latency
+	birth          time.Time
+	latencyTracker *latencyTracker
+}
+
+// The domain is set by the logger, and is available to backends and encoders
+// which are not part of this package.
+func (msg Message) Domain() string {
+	return msg.domain
 }
 
 type Datum interface{}
@@ -0,0 +1,228 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Package logadmin provides a client for the HTTP API exposed by
+// log.AdminHandler.
+package logadmin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/exograd/go-log"
+)
+
+type Client struct {
+	// The URL the admin handler is mounted on, e.g.
+	// "http://10.0.0.1:8081/log".
+	BaseURL string
+
+	HTTPClient *http.Client
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+
+		HTTPClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+func (c *Client) DebugLevel(ctx context.Context) (int, error) {
+	var value log.AdminDebugLevel
+	if err := c.call(ctx, "GET", "/debug_level", nil, &value); err != nil {
+		return 0, err
+	}
+
+	return value.DebugLevel, nil
+}
+
+// Change the debug level of the remote logger until ResetDebugLevel is
+// called.
+func (c *Client) SetDebugLevel(ctx context.Context, level int) error {
+	value := log.AdminDebugLevel{DebugLevel: level}
+	return c.call(ctx, "PUT", "/debug_level", &value, nil)
+}
+
+func (c *Client) ResetDebugLevel(ctx context.Context) error {
+	return c.call(ctx, "DELETE", "/debug_level", nil, nil)
+}
+
+// Raise the debug level of the remote logger for a limited duration.
+func (c *Client) BoostDebug(ctx context.Context, level int, d time.Duration) error {
+	value := log.AdminDebugBoost{DebugLevel: level, Duration: d}
+	return c.call(ctx, "PUT", "/debug_boost", &value, nil)
+}
+
+func (c *Client) CancelDebugBoost(ctx context.Context) error {
+	return c.call(ctx, "DELETE", "/debug_boost", nil, nil)
+}
+
+// Return the active debug level boost or nil if there is none.
+func (c *Client) DebugBoost(ctx context.Context) (*log.DebugBoost, error) {
+	var boost *log.DebugBoost
+	if err := c.call(ctx, "GET", "/debug_boost", nil, &boost); err != nil {
+		return nil, err
+	}
+
+	return boost, nil
+}
+
+func (c *Client) Health(ctx context.Context) (*log.AdminHealth, error) {
+	var health log.AdminHealth
+	if err := c.call(ctx, "GET", "/health", nil, &health); err != nil {
+		return nil, err
+	}
+
+	return &health, nil
+}
+
+func (c *Client) CapturedMessages(ctx context.Context) ([]log.AdminMessage, error) {
+	var messages []log.AdminMessage
+	if err := c.call(ctx, "GET", "/capture", nil, &messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func (c *Client) call(ctx context.Context, method, path string,
+	reqValue, resValue interface{}) error {
+	var body io.Reader
+	if reqValue != nil {
+		data, err := json.Marshal(reqValue)
+		if err != nil {
+			return fmt.Errorf("cannot encode request body: %w", err)
+		}
+
+		body = bytes.NewReader(data)
+	}
+
+	uri := c.BaseURL + path
+
+	req, err := http.NewRequestWithContext(ctx, method, uri, body)
+	if err != nil {
+		return fmt.Errorf("cannot create http request: %w", err)
+	}
+
+	if reqValue != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot send http request: %w", err)
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("cannot read response body: %w", err)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("request failed with status %d: %s",
+			res.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	if resValue != nil {
+		if err := json.Unmarshal(data, resValue); err != nil {
+			return fmt.Errorf("cannot decode response body: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// A fleet is a set of clients used to apply the same operation to multiple
+// programs concurrently. Errors are indexed by base URL.
+type Fleet []*Client
+
+func (f Fleet) SetDebugLevel(ctx context.Context, level int) map[string]error {
+	return f.each(func(c *Client) error {
+		return c.SetDebugLevel(ctx, level)
+	})
+}
+
+func (f Fleet) ResetDebugLevel(ctx context.Context) map[string]error {
+	return f.each(func(c *Client) error {
+		return c.ResetDebugLevel(ctx)
+	})
+}
+
+func (f Fleet) BoostDebug(ctx context.Context, level int, d time.Duration) map[string]error {
+	return f.each(func(c *Client) error {
+		return c.BoostDebug(ctx, level, d)
+	})
+}
+
+func (f Fleet) CancelDebugBoost(ctx context.Context) map[string]error {
+	return f.each(func(c *Client) error {
+		return c.CancelDebugBoost(ctx)
+	})
+}
+
+func (f Fleet) Health(ctx context.Context) (map[string]*log.AdminHealth, map[string]error) {
+	var mut sync.Mutex
+	healths := make(map[string]*log.AdminHealth)
+
+	errs := f.each(func(c *Client) error {
+		health, err := c.Health(ctx)
+		if err != nil {
+			return err
+		}
+
+		mut.Lock()
+		healths[c.BaseURL] = health
+		mut.Unlock()
+
+		return nil
+	})
+
+	return healths, errs
+}
+
+func (f Fleet) each(fn func(*Client) error) map[string]error {
+	var mut sync.Mutex
+	var wg sync.WaitGroup
+
+	errs := make(map[string]error)
+
+	for _, c := range f {
+		wg.Add(1)
+
+		go func(c *Client) {
+			defer wg.Done()
+
+			if err := fn(c); err != nil {
+				mut.Lock()
+				errs[c.BaseURL] = err
+				mut.Unlock()
+			}
+		}(c)
+	}
+
+	wg.Wait()
+
+	return errs
+}
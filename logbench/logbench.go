@@ -0,0 +1,268 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Package logbench runs identical workloads against backend configurations
+// and reports their throughput, the latency of logging calls and memory
+// allocations, so that backends can be compared:
+//
+//	cmp, err := logbench.Compare(logbench.Workload{},
+//		logbench.Target{Name: "json", Cfg: jsonCfg},
+//		logbench.Target{Name: "syslog", Cfg: syslogCfg})
+//	if err != nil {
+//		...
+//	}
+//
+//	cmp.Write(os.Stdout)
+package logbench
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/exograd/go-log"
+)
+
+type Workload struct {
+	// The total number of messages logged, 100000 by default.
+	Messages int
+
+	// The number of goroutines logging messages concurrently, the number of
+	// CPUs by default.
+	Concurrency int
+
+	// The number of data entries and the length of the text of each
+	// message. The default values are 4 and 64.
+	DataEntries   int
+	MessageLength int
+}
+
+type Target struct {
+	Name string
+	Cfg  log.LoggerCfg
+}
+
+type Result struct {
+	Name     string
+	Messages int
+
+	// The duration includes the final flush of the backend if it supports
+	// it, so that buffering backends are not unduly favored.
+	Duration   time.Duration
+	Throughput float64 // messages per second
+
+	// The latency of each logging call.
+	LatencyP50 time.Duration
+	LatencyP99 time.Duration
+	LatencyMax time.Duration
+
+	// Allocations are measured for the whole program and include those of
+	// goroutines started by the backend.
+	AllocsPerMessage float64
+	BytesPerMessage  float64
+}
+
+type Comparison struct {
+	A *Result
+	B *Result
+}
+
+func (w *Workload) setDefaults() {
+	if w.Messages <= 0 {
+		w.Messages = 100000
+	}
+
+	if w.Concurrency <= 0 {
+		w.Concurrency = runtime.NumCPU()
+	}
+
+	if w.DataEntries <= 0 {
+		w.DataEntries = 4
+	}
+
+	if w.MessageLength <= 0 {
+		w.MessageLength = 64
+	}
+}
+
+func Compare(w Workload, a, b Target) (*Comparison, error) {
+	resultA, err := Run(w, a)
+	if err != nil {
+		return nil, fmt.Errorf("cannot run workload for %q: %w", a.Name, err)
+	}
+
+	resultB, err := Run(w, b)
+	if err != nil {
+		return nil, fmt.Errorf("cannot run workload for %q: %w", b.Name, err)
+	}
+
+	c := Comparison{
+		A: resultA,
+		B: resultB,
+	}
+
+	return &c, nil
+}
+
+func Run(w Workload, target Target) (*Result, error) {
+	w.setDefaults()
+
+	logger, err := log.NewLogger("logbench", target.Cfg)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create logger: %w", err)
+	}
+
+	text := strings.Repeat("x", w.MessageLength)
+
+	data := make(log.Data, w.DataEntries)
+	for i := 0; i < w.DataEntries; i++ {
+		data[fmt.Sprintf("key%d", i)] = i
+	}
+
+	latencies := make([][]time.Duration, w.Concurrency)
+
+	var wg sync.WaitGroup
+	var memStats1, memStats2 runtime.MemStats
+
+	runtime.GC()
+	runtime.ReadMemStats(&memStats1)
+
+	start := time.Now()
+
+	for i := 0; i < w.Concurrency; i++ {
+		n := w.Messages / w.Concurrency
+		if i < w.Messages%w.Concurrency {
+			n++
+		}
+
+		latencies[i] = make([]time.Duration, n)
+
+		wg.Add(1)
+		go func(latencies []time.Duration) {
+			defer wg.Done()
+
+			for j := range latencies {
+				t := time.Now()
+				logger.InfoData(data, "%s", text)
+				latencies[j] = time.Since(t)
+			}
+		}(latencies[i])
+	}
+
+	wg.Wait()
+
+	if backend, ok := logger.Backend.(interface{ Flush() error }); ok {
+		if err := backend.Flush(); err != nil {
+			return nil, fmt.Errorf("cannot flush backend: %w", err)
+		}
+	}
+
+	duration := time.Since(start)
+
+	runtime.ReadMemStats(&memStats2)
+
+	if backend, ok := logger.Backend.(io.Closer); ok {
+		backend.Close()
+	}
+
+	var allLatencies []time.Duration
+	for _, l := range latencies {
+		allLatencies = append(allLatencies, l...)
+	}
+
+	sort.Slice(allLatencies, func(i, j int) bool {
+		return allLatencies[i] < allLatencies[j]
+	})
+
+	percentile := func(p float64) time.Duration {
+		return allLatencies[int(p*float64(len(allLatencies)-1))]
+	}
+
+	nbMessages := float64(w.Messages)
+
+	r := Result{
+		Name:     target.Name,
+		Messages: w.Messages,
+
+		Duration:   duration,
+		Throughput: nbMessages / duration.Seconds(),
+
+		LatencyP50: percentile(0.5),
+		LatencyP99: percentile(0.99),
+		LatencyMax: allLatencies[len(allLatencies)-1],
+
+		AllocsPerMessage: float64(memStats2.Mallocs-memStats1.Mallocs) /
+			nbMessages,
+		BytesPerMessage: float64(memStats2.TotalAlloc-memStats1.TotalAlloc) /
+			nbMessages,
+	}
+
+	return &r, nil
+}
+
+// Write a table comparing both results; ratios are the values of B divided
+// by those of A.
+func (c *Comparison) Write(w io.Writer) error {
+	a, b := c.A, c.B
+
+	rows := []struct {
+		label  string
+		format func(*Result) string
+		value  func(*Result) float64
+	}{
+		{"throughput (msg/s)",
+			func(r *Result) string { return fmt.Sprintf("%.0f", r.Throughput) },
+			func(r *Result) float64 { return r.Throughput }},
+		{"latency p50",
+			func(r *Result) string { return r.LatencyP50.String() },
+			func(r *Result) float64 { return float64(r.LatencyP50) }},
+		{"latency p99",
+			func(r *Result) string { return r.LatencyP99.String() },
+			func(r *Result) float64 { return float64(r.LatencyP99) }},
+		{"latency max",
+			func(r *Result) string { return r.LatencyMax.String() },
+			func(r *Result) float64 { return float64(r.LatencyMax) }},
+		{"allocs/msg",
+			func(r *Result) string { return fmt.Sprintf("%.1f", r.AllocsPerMessage) },
+			func(r *Result) float64 { return r.AllocsPerMessage }},
+		{"bytes/msg",
+			func(r *Result) string { return fmt.Sprintf("%.0f", r.BytesPerMessage) },
+			func(r *Result) float64 { return r.BytesPerMessage }},
+	}
+
+	_, err := fmt.Fprintf(w, "%-20s  %16s  %16s  %8s\n", "", a.Name, b.Name,
+		"ratio")
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		ratio := "-"
+		if va := row.value(a); va != 0 {
+			ratio = fmt.Sprintf("%.2f", row.value(b)/va)
+		}
+
+		_, err := fmt.Fprintf(w, "%-20s  %16s  %16s  %8s\n", row.label,
+			row.format(a), row.format(b), ratio)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -19,15 +19,69 @@ import (
 	"encoding/json"
 	"fmt"
 	stdlog "log"
+	"runtime"
 	"strings"
 	"time"
 )
 
 type LoggerCfg struct {
-	BackendType BackendType      `json:"backend_type"`
+	ConfigVersion int `json:"config_version"`
+
+	// Messages are sent to all backends. BackendType, BackendData and
+	// Backend are used when there is no backend in the list; they
+	// correspond to the first version of the configuration format.
+	Backends []BackendCfg `json:"backends,omitempty"`
+
+	BackendType BackendType      `json:"backend_type,omitempty"`
 	BackendData *json.RawMessage `json:"backend,omitempty"`
 	Backend     interface{}      `json:"-"`
-	DebugLevel  int              `json:"debug_level"`
+
+	DebugLevel int `json:"debug_level"`
+
+	CallSiteRateLimit *CallSiteRateLimitCfg `json:"call_site_rate_limit,omitempty"`
+	Sampling          *SamplingCfg          `json:"sampling,omitempty"`
+
+	// Make Assert and Unreachable panic after logging, which is useful
+	// during development.
+	StrictAssertions bool `json:"strict_assertions"`
+
+	// The list of feature flags whose current variant is added to error
+	// messages. Variants are obtained from the flag provider of the logger,
+	// see Logger.Flags and WithFlagRecorder.
+	ErrorFlags []string `json:"error_flags"`
+
+	DeliveryLatency *DeliveryLatencyCfg `json:"delivery_latency,omitempty"`
+
+	// The list of baggage entries copied to message data by WithContext.
+	BaggageKeys []string `json:"baggage_keys"`
+
+	// See DryRun.
+	DryRun bool `json:"dry_run"`
+
+	// See ReservedKeysCfg.
+	ReservedKeys *ReservedKeysCfg `json:"reserved_keys,omitempty"`
+
+	// See MessageScrubbingCfg.
+	MessageScrubbing *MessageScrubbingCfg `json:"message_scrubbing,omitempty"`
+
+	// See ProfilerLabelsCfg.
+	ProfilerLabels *ProfilerLabelsCfg `json:"profiler_labels,omitempty"`
+
+	// See DegradationCfg.
+	Degradation *DegradationCfg `json:"degradation,omitempty"`
+
+	// See AdaptiveDebugCfg.
+	AdaptiveDebug *AdaptiveDebugCfg `json:"adaptive_debug,omitempty"`
+
+	// See SelfCheckCfg.
+	SelfCheck *SelfCheckCfg `json:"self_check,omitempty"`
+
+	// Log the effective configuration, with secrets redacted (see
+	// LoggerCfg.Redacted), when the logger is created.
+	LogConfiguration bool `json:"log_configuration"`
+
+	// Named partial configurations, see LoggerCfg.ApplyProfile.
+	Profiles map[string]json.RawMessage `json:"profiles,omitempty"`
 }
 
 type Logger struct {
@@ -36,6 +90,17 @@ type Logger struct {
 	Domain     string
 	Data       Data
 	DebugLevel int
+	Flags      FlagProvider
+	Baggage    BaggageFunc
+
+	callSiteLimiter *callSiteLimiter
+	sampler         *sampler
+	degradation     *degradation
+	adaptiveDebug   *adaptiveDebug
+	reservedKeys    *reservedKeyChecker
+	scrubber        *messageScrubber
+	latencyTracker  *latencyTracker
+	state           *runtimeState
 }
 
 func DefaultLogger(name string) *Logger {
@@ -50,6 +115,8 @@ func DefaultLogger(name string) *Logger {
 		Backend: backend,
 		Domain:  name,
 		Data:    Data{},
+
+		state: newRuntimeState(),
 	}
 }
 
@@ -60,55 +127,118 @@ func NewLogger(name string, cfg LoggerCfg) (*Logger, error) {
 		Domain:     name,
 		Data:       Data{},
 		DebugLevel: cfg.DebugLevel,
+
+		state: newRuntimeState(),
 	}
 
-	backendCfg := func(cfgObj interface{}) (interface{}, error) {
-		switch {
-		case cfg.Backend != nil:
-			return cfg.Backend, nil
+	if cfg.CallSiteRateLimit != nil {
+		l.callSiteLimiter = newCallSiteLimiter(*cfg.CallSiteRateLimit)
+	}
 
-		case cfg.BackendData != nil:
-			if err := json.Unmarshal(*cfg.BackendData, cfgObj); err != nil {
-				return nil,
-					fmt.Errorf("invalid backend configuration: %w", err)
-			}
+	if cfg.Sampling != nil {
+		sampler, err := newSampler(*cfg.Sampling)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sampling configuration: %w", err)
+		}
+
+		l.sampler = sampler
+	}
 
-			return cfgObj, nil
+	if cfg.Degradation != nil {
+		l.degradation = newDegradation(*cfg.Degradation)
+	}
+
+	if cfg.AdaptiveDebug != nil {
+		adaptive, err := newAdaptiveDebug(*cfg.AdaptiveDebug)
+		if err != nil {
+			return nil, fmt.Errorf("invalid adaptive debug configuration: %w",
+				err)
 		}
 
-		return cfgObj, nil
+		l.adaptiveDebug = adaptive
 	}
 
-	switch cfg.BackendType {
-	case BackendTypeTerminal:
-		bcfg, err := backendCfg(&TerminalBackendCfg{})
+	if cfg.ReservedKeys != nil {
+		checker, err := newReservedKeyChecker(*cfg.ReservedKeys)
 		if err != nil {
 			return nil, err
 		}
-		bcfg2 := bcfg.(*TerminalBackendCfg)
-		l.Backend = NewTerminalBackend(*bcfg2)
 
-	case BackendTypeSyslog:
-		bcfg, err := backendCfg(&SyslogBackendCfg{})
+		l.reservedKeys = checker
+	}
+
+	if cfg.MessageScrubbing != nil {
+		scrubber, err := newMessageScrubber(*cfg.MessageScrubbing)
 		if err != nil {
 			return nil, err
 		}
-		bcfg2 := bcfg.(*SyslogBackendCfg)
-		l.Backend, err = NewSyslogBackend(*bcfg2)
+
+		l.scrubber = scrubber
+	}
+
+	if cfg.DeliveryLatency != nil {
+		l.latencyTracker = newLatencyTracker(*cfg.DeliveryLatency)
+	}
+
+	backendCfgs := cfg.Backends
+	if len(backendCfgs) == 0 {
+		backendCfgs = []BackendCfg{{
+			Type:    cfg.BackendType,
+			Data:    cfg.BackendData,
+			Backend: cfg.Backend,
+		}}
+	}
+
+	dryRun := DryRun || cfg.DryRun
+
+	backends := make([]Backend, len(backendCfgs))
+	for i, backendCfg := range backendCfgs {
+		backend, err := newBackend(backendCfg, dryRun)
 		if err != nil {
-			return nil, fmt.Errorf("cannot create syslog backend: %w", err)
+			for _, backend := range backends[:i] {
+				closeBackend(backend)
+			}
+
+			return nil, err
 		}
 
-	case "":
-		return nil, fmt.Errorf("missing or empty backend type")
+		backends[i] = backend
+	}
+
+	if len(backends) == 1 {
+		l.Backend = backends[0]
+	} else {
+		l.Backend = NewMultiBackend(backends...)
+	}
+
+	if cfg.SelfCheck != nil {
+		StartSelfCheck(*cfg.SelfCheck, l.Backend)
+	}
 
-	default:
-		return nil, fmt.Errorf("invalid backend type %q", cfg.BackendType)
+	if cfg.LogConfiguration {
+		if value, err := cfg.Redacted(); err != nil {
+			l.Error("cannot redact logging configuration: %v", err)
+		} else {
+			l.InfoData(Data{"configuration": value},
+				"effective logging configuration")
+		}
 	}
 
 	return l, nil
 }
 
+// Close the backend of the logger, releasing connections and other
+// resources. The logger and its children must not be used afterward.
+func (l *Logger) Close() error {
+	stopSelfCheckFor(l.Backend)
+
+	if closer, ok := l.Backend.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
 func (l *Logger) Child(domain string, data Data) *Logger {
 	childDomain := l.Domain
 	if domain != "" {
@@ -122,19 +252,79 @@ func (l *Logger) Child(domain string, data Data) *Logger {
 		Domain:     childDomain,
 		Data:       MergeData(l.Data, data),
 		DebugLevel: l.DebugLevel,
+		Flags:      l.Flags,
+		Baggage:    l.Baggage,
+
+		callSiteLimiter: l.callSiteLimiter,
+		sampler:         l.sampler,
+		degradation:     l.degradation,
+		adaptiveDebug:   l.adaptiveDebug,
+		reservedKeys:    l.reservedKeys,
+		scrubber:        l.scrubber,
+		latencyTracker:  l.latencyTracker,
+		state:           l.state,
 	}
 
 	return child
 }
 
 func (l *Logger) Log(msg Message) {
-	if msg.Level == LevelDebug && l.DebugLevel < msg.DebugLevel {
+	l.log(msg, 1)
+}
+
+// Log a message on behalf of another function. The depth is the number of
+// stack frames to skip above the caller of LogDepth to reach the call site
+// of the message; a depth of 0 is equivalent to calling Log. Wrappers use it
+// so that call site rate limiting and aggregation keys refer to their own
+// callers.
+func (l *Logger) LogDepth(depth int, msg Message) {
+	l.log(msg, depth+1)
+}
+
+// The depth is the number of stack frames between the function which called
+// the logger and log itself; it is used to identify call sites.
+func (l *Logger) log(msg Message, depth int) {
+	if msg.Level == LevelDebug && l.CurrentDebugLevel() < msg.DebugLevel {
 		return
 	}
 
+	now := time.Now()
+
+	if l.adaptiveDebug != nil && msg.Level == LevelError {
+		l.adaptiveDebug.countError(l.Domain, now, l.Backend)
+	}
+
+	if l.sampler != nil && !l.sampler.sample(msg, l.Domain, now) {
+		return
+	}
+
+	backend := l.Backend
+	if l.degradation != nil {
+		if backend = l.degradation.route(msg, backend, now); backend == nil {
+			return
+		}
+	}
+
+	var callSite uintptr
+	if l.callSiteLimiter != nil || msg.Level == LevelError {
+		var pcs [1]uintptr
+		if runtime.Callers(depth+2, pcs[:]) > 0 {
+			callSite = pcs[0]
+		}
+	}
+
+	var suppressed int
+	if l.callSiteLimiter != nil && callSite != 0 {
+		var allowed bool
+		allowed, suppressed = l.callSiteLimiter.allow(callSite, now)
+		if !allowed {
+			return
+		}
+	}
+
 	var t time.Time
 	if msg.Time == nil {
-		t = time.Now()
+		t = now
 	} else {
 		t = *msg.Time
 	}
@@ -144,60 +334,98 @@ func (l *Logger) Log(msg Message) {
 
 	msg.domain = l.Domain
 
+	if l.scrubber != nil {
+		msg.Message = l.scrubber.scrub(msg.Message)
+	}
+
 	if msg.Data == nil {
 		msg.Data = make(Data)
 	}
 
 	msg.Data = MergeData(l.Data, msg.Data)
 
-	l.Backend.Log(msg)
-}
+	if l.reservedKeys != nil {
+		l.reservedKeys.check(msg.Data, backend)
+	}
 
-func (l *Logger) Debug(level int, format string, args ...interface{}) {
-	l.Log(Message{
-		Level:      LevelDebug,
-		DebugLevel: level,
-		Message:    fmt.Sprintf(format, args...),
-	})
-}
+	if suppressed > 0 {
+		msg.Data["suppressed_messages"] = suppressed
+	}
+
+	if msg.Level == LevelError {
+		if flags := l.errorFlags(); flags != nil {
+			msg.Data["feature_flags"] = flags
+		}
+
+		msg.callSite = callSite
+	}
+
+	if buffer, ok := backend.(*transactionBuffer); ok {
+		// Messages of transactions are captured and counted once they
+		// are committed.
+		buffer.Log(msg)
+		return
+	}
+
+	if ring := l.captureRing(); ring != nil {
+		ring.add(msg)
+	}
 
-func (l *Logger) DebugData(data Data, level int, format string, args ...interface{}) {
-	l.Log(Message{
-		Level:      LevelDebug,
-		DebugLevel: level,
-		Message:    fmt.Sprintf(format, args...),
-		Data:       data,
-	})
+	if l.state != nil {
+		l.state.countMessage(msg.Level)
+	}
+
+	if l.latencyTracker == nil {
+		backend.Log(msg)
+		return
+	}
+
+	msg.birth = now
+	msg.latencyTracker = l.latencyTracker
+
+	backend.Log(msg)
+
+	if b, ok := backend.(AsyncBackend); !ok || !b.ReportsDelivery() {
+		msg.Delivered()
+	}
 }
 
 func (l *Logger) Info(format string, args ...interface{}) {
-	l.Log(Message{
+	l.log(Message{
 		Level:   LevelInfo,
 		Message: fmt.Sprintf(format, args...),
-	})
+
+		format: format,
+	}, 1)
 }
 
 func (l *Logger) InfoData(data Data, format string, args ...interface{}) {
-	l.Log(Message{
+	l.log(Message{
 		Level:   LevelInfo,
 		Message: fmt.Sprintf(format, args...),
 		Data:    data,
-	})
+
+		format: format,
+	}, 1)
 }
 
 func (l *Logger) Error(format string, args ...interface{}) {
-	l.Log(Message{
+	l.log(Message{
 		Level:   LevelError,
 		Message: fmt.Sprintf(format, args...),
-	})
+
+		format: format,
+	}, 1)
 }
 
 func (l *Logger) ErrorData(data Data, format string, args ...interface{}) {
-	l.Log(Message{
+	l.log(Message{
 		Level:   LevelError,
 		Message: fmt.Sprintf(format, args...),
 		Data:    data,
-	})
+
+		format: format,
+	}, 1)
 }
 
 func (l *Logger) StdLogger(level Level) *stdlog.Logger {
@@ -239,10 +467,12 @@ func (l *Logger) Write(data []byte) (int, error) {
 
 	msg = strings.TrimSpace(msg)
 
-	l.Log(Message{
+	// Messages written by standard loggers go through Output and one of the
+	// Print, Fatal or Panic functions.
+	l.log(Message{
 		Level:   level,
 		Message: msg,
-	})
+	}, 3)
 
 	return len(data), nil
 }
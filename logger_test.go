@@ -0,0 +1,78 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log_test
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/exograd/go-log"
+)
+
+func TestLoggerCloseReconfiguration(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	newBackendCfg := func() log.BackendCfg {
+		return log.BackendCfg{
+			Type: log.BackendTypeSyslog,
+			Backend: &log.SyslogBackendCfg{
+				Transport: log.SyslogTransportTCP,
+				Addr:      listener.Addr().String(),
+			},
+		}
+	}
+
+	baseline := log.CurrentResourceUsage().Connections["syslog"]
+
+	for i := 0; i < 10; i++ {
+		logger, err := log.NewLogger("test", log.LoggerCfg{
+			Backends: []log.BackendCfg{newBackendCfg(), newBackendCfg()},
+		})
+		if err != nil {
+			t.Fatalf("cannot create logger: %v", err)
+		}
+
+		logger.Info("configuration %d", i)
+
+		if err := logger.Close(); err != nil {
+			t.Fatalf("cannot close logger: %v", err)
+		}
+
+		connections := log.CurrentResourceUsage().Connections["syslog"]
+		if connections != baseline {
+			t.Fatalf("%d syslog connections after reconfiguration %d "+
+				"instead of %d", connections, i, baseline)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Package logtest provides a backend recording messages in memory, so that
+// tests can check what was logged:
+//
+//	logger, backend := logtest.NewLogger("test")
+//	doSomething(logger)
+//	if !backend.ContainsMessage("connection established") {
+//		t.Errorf("missing connection message")
+//	}
+package logtest
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/exograd/go-log"
+)
+
+type Backend struct {
+	mut     sync.Mutex
+	entries []log.Message
+}
+
+func NewBackend() *Backend {
+	return &Backend{}
+}
+
+// Return a logger writing all messages, including debug messages, to a new
+// recording backend.
+func NewLogger(domain string) (*log.Logger, *Backend) {
+	backend := NewBackend()
+
+	logger := &log.Logger{
+		Backend:    backend,
+		Domain:     domain,
+		Data:       log.Data{},
+		DebugLevel: 9,
+	}
+
+	return logger, backend
+}
+
+func (b *Backend) Log(msg log.Message) {
+	b.mut.Lock()
+	b.entries = append(b.entries, msg)
+	b.mut.Unlock()
+}
+
+func (b *Backend) LogBatch(msgs []log.Message) {
+	b.mut.Lock()
+	b.entries = append(b.entries, msgs...)
+	b.mut.Unlock()
+}
+
+// Return all messages recorded so far, oldest first.
+func (b *Backend) Entries() []log.Message {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	entries := make([]log.Message, len(b.entries))
+	copy(entries, b.entries)
+
+	return entries
+}
+
+// Remove all recorded messages.
+func (b *Backend) Reset() {
+	b.mut.Lock()
+	b.entries = nil
+	b.mut.Unlock()
+}
+
+// Return the messages recorded with a specific level.
+func (b *Backend) FilterLevel(level log.Level) []log.Message {
+	return b.Filter(func(msg log.Message) bool {
+		return msg.Level == level
+	})
+}
+
+// Return the messages recorded by a logger whose domain is either the
+// given domain or one of its children.
+func (b *Backend) FilterDomain(domain string) []log.Message {
+	return b.Filter(func(msg log.Message) bool {
+		msgDomain := msg.Domain()
+		return msgDomain == domain || strings.HasPrefix(msgDomain, domain+".")
+	})
+}
+
+// Return the messages for which a function returns true.
+func (b *Backend) Filter(fn func(log.Message) bool) []log.Message {
+	var msgs []log.Message
+
+	for _, msg := range b.Entries() {
+		if fn(msg) {
+			msgs = append(msgs, msg)
+		}
+	}
+
+	return msgs
+}
+
+// Return whether a recorded message contains a string.
+func (b *Backend) ContainsMessage(s string) bool {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	for _, msg := range b.entries {
+		if strings.Contains(msg.Message, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return whether a recorded message has a specific data entry.
+func (b *Backend) ContainsData(key string, value log.Datum) bool {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	for _, msg := range b.entries {
+		if v, found := msg.Data[key]; found && reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"strconv"
+)
+
+// Measurements are numeric observations emitted as regular info messages.
+// They are identified by the presence of the measurement name in message
+// data, so that downstream pipelines can extract and aggregate them.
+const (
+	MeasurementNameKey  = "measurement"
+	MeasurementValueKey = "measurement_value"
+	MeasurementUnitKey  = "measurement_unit"
+)
+
+type Measurement struct {
+	Name  string
+	Value float64
+	Unit  string
+}
+
+func (l *Logger) Measure(name string, value float64, unit string, data Data) {
+	mdata := Data{
+		MeasurementNameKey:  name,
+		MeasurementValueKey: value,
+	}
+
+	if unit != "" {
+		mdata[MeasurementUnitKey] = unit
+	}
+
+	text := name + ": " + strconv.FormatFloat(value, 'g', -1, 64)
+	if unit != "" {
+		text += " " + unit
+	}
+
+	l.log(Message{
+		Level:   LevelInfo,
+		Message: text,
+		Data:    MergeData(data, mdata),
+	}, 1)
+}
+
+// Return the measurement contained in a message if there is one.
+func MessageMeasurement(msg Message) (Measurement, bool) {
+	var m Measurement
+
+	name, ok := msg.Data[MeasurementNameKey].(string)
+	if !ok {
+		return m, false
+	}
+
+	value, ok := msg.Data[MeasurementValueKey].(float64)
+	if !ok {
+		return m, false
+	}
+
+	m.Name = name
+	m.Value = value
+	m.Unit, _ = msg.Data[MeasurementUnitKey].(string)
+
+	return m, true
+}
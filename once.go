@@ -0,0 +1,107 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Once loggers emit a message identified by a key at most once per process,
+// or once per interval. Keys are global to the process: two loggers using the
+// same key share the same state.
+type OnceLogger struct {
+	Logger   *Logger
+	Key      string
+	Interval time.Duration
+}
+
+var (
+	onceKeysMut sync.Mutex
+	onceKeys    = make(map[string]time.Time)
+)
+
+func (l *Logger) Once(key string) *OnceLogger {
+	return &OnceLogger{
+		Logger: l,
+		Key:    key,
+	}
+}
+
+func (l *Logger) OncePer(key string, interval time.Duration) *OnceLogger {
+	return &OnceLogger{
+		Logger:   l,
+		Key:      key,
+		Interval: interval,
+	}
+}
+
+func claimOnceKey(key string, interval time.Duration, now time.Time) bool {
+	onceKeysMut.Lock()
+	defer onceKeysMut.Unlock()
+
+	last, found := onceKeys[key]
+	if found && (interval <= 0 || now.Sub(last) < interval) {
+		return false
+	}
+
+	onceKeys[key] = now
+	return true
+}
+
+func (o *OnceLogger) log(msg Message) {
+	l := o.Logger
+
+	if msg.Level == LevelDebug && l.CurrentDebugLevel() < msg.DebugLevel {
+		return
+	}
+
+	if !claimOnceKey(o.Key, o.Interval, time.Now()) {
+		return
+	}
+
+	l.log(msg, 2)
+}
+
+func (o *OnceLogger) Info(format string, args ...interface{}) {
+	o.log(Message{
+		Level:   LevelInfo,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (o *OnceLogger) InfoData(data Data, format string, args ...interface{}) {
+	o.log(Message{
+		Level:   LevelInfo,
+		Message: fmt.Sprintf(format, args...),
+		Data:    data,
+	})
+}
+
+func (o *OnceLogger) Error(format string, args ...interface{}) {
+	o.log(Message{
+		Level:   LevelError,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (o *OnceLogger) ErrorData(data Data, format string, args ...interface{}) {
+	o.log(Message{
+		Level:   LevelError,
+		Message: fmt.Sprintf(format, args...),
+		Data:    data,
+	})
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"os"
+	"runtime"
+	"time"
+)
+
+// Process lifecycle messages share a common schema: the "process_event" data
+// entry contains the type of event, and "pid" the process identifier. This
+// makes it possible to track restarts and shutdown durations across services.
+const (
+	ProcessEventStart              = "start"
+	ProcessEventSignal             = "signal"
+	ProcessEventShutdownStart      = "shutdown_start"
+	ProcessEventShutdownPhaseStart = "shutdown_phase_start"
+	ProcessEventShutdownPhaseEnd   = "shutdown_phase_end"
+	ProcessEventStop               = "stop"
+)
+
+var processStart = time.Now()
+
+func processEventData(event string, data Data) Data {
+	return MergeData(data, Data{
+		"process_event": event,
+		"pid":           os.Getpid(),
+	})
+}
+
+// Log the start of the process. The data should contain a summary of the
+// configuration of the program.
+func (l *Logger) ProcessStarted(cfgData Data) {
+	data := processEventData(ProcessEventStart, cfgData)
+	data["ppid"] = os.Getppid()
+	data["go_version"] = runtime.Version()
+
+	if hostname, err := os.Hostname(); err == nil {
+		data["hostname"] = hostname
+	}
+
+	if executable, err := os.Executable(); err == nil {
+		data["executable"] = executable
+	}
+
+	l.InfoData(data, "process started")
+}
+
+func (l *Logger) SignalReceived(signal os.Signal) {
+	data := processEventData(ProcessEventSignal, nil)
+	data["signal"] = signal.String()
+
+	l.InfoData(data, "received signal %q", signal.String())
+}
+
+func (l *Logger) ShutdownStarted(reason string) {
+	data := processEventData(ProcessEventShutdownStart, nil)
+	data["reason"] = reason
+	data["uptime"] = time.Since(processStart).Seconds()
+
+	l.InfoData(data, "shutting down: %s", reason)
+}
+
+// Log the start of a shutdown phase and return a function which logs its end
+// and duration, e.g.:
+//
+//	end := logger.ShutdownPhase("http_server")
+//	server.Shutdown(ctx)
+//	end()
+func (l *Logger) ShutdownPhase(phase string) func() {
+	start := time.Now()
+
+	data := processEventData(ProcessEventShutdownPhaseStart, nil)
+	data["phase"] = phase
+
+	l.InfoData(data, "shutdown phase %q started", phase)
+
+	return func() {
+		duration := time.Since(start)
+
+		data := processEventData(ProcessEventShutdownPhaseEnd, nil)
+		data["phase"] = phase
+		data["duration"] = duration.Seconds()
+
+		l.InfoData(data, "shutdown phase %q completed in %v", phase,
+			duration.Round(time.Millisecond))
+	}
+}
+
+func (l *Logger) ProcessStopped() {
+	uptime := time.Since(processStart)
+
+	data := processEventData(ProcessEventStop, nil)
+	data["uptime"] = uptime.Seconds()
+
+	l.InfoData(data, "process stopped after %v", uptime.Round(time.Second))
+}
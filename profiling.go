@@ -0,0 +1,70 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// Profiler labels make it possible to correlate CPU profiles with logs: when
+// enabled, Logger.Do sets pprof labels containing the domain of the logger and
+// the request attributes of the context (see ContextData), i.e. the same
+// identifiers as the ones found in messages.
+type ProfilerLabelsCfg struct {
+	// The label containing the domain of the logger, "domain" by default.
+	DomainLabel string `json:"domain_label"`
+
+	// Additional data entries of the logger copied to labels when their
+	// value is a string.
+	DataKeys []string `json:"data_keys"`
+}
+
+// Run a function with a logger whose messages contain the request attributes
+// stored in the context (see WithContext). If profiler labels are enabled,
+// labels are set for the duration of the function, including on goroutines
+// it starts with the context passed to the function.
+func (l *Logger) Do(ctx context.Context, fn func(context.Context, *Logger)) {
+	logger := l.WithContext(ctx)
+
+	cfg := l.Cfg.ProfilerLabels
+	if cfg == nil {
+		fn(ctx, logger)
+		return
+	}
+
+	domainLabel := cfg.DomainLabel
+	if domainLabel == "" {
+		domainLabel = "domain"
+	}
+
+	labels := []string{domainLabel, logger.Domain}
+
+	for _, k := range contextDataKeys {
+		if value, ok := logger.Data[k.dataKey].(string); ok {
+			labels = append(labels, k.dataKey, value)
+		}
+	}
+
+	for _, key := range cfg.DataKeys {
+		if value, ok := logger.Data[key].(string); ok {
+			labels = append(labels, key, value)
+		}
+	}
+
+	pprof.Do(ctx, pprof.Labels(labels...), func(ctx context.Context) {
+		fn(ctx, logger)
+	})
+}
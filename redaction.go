@@ -0,0 +1,83 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import "strings"
+
+const RedactedValue = "REDACTED"
+
+// Keys whose normalized form (lower case, dashes replaced by underscores)
+// contains one of these words are considered sensitive.
+var DefaultSensitiveKeys = []string{
+	"password",
+	"passwd",
+	"secret",
+	"token",
+	"api_key",
+	"apikey",
+	"authorization",
+	"cookie",
+	"private_key",
+	"credential",
+}
+
+func normalizeSensitiveKey(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "-", "_")
+}
+
+func isSensitiveKey(key string, extraKeys []string) bool {
+	key = normalizeSensitiveKey(key)
+
+	for _, sensitiveKey := range DefaultSensitiveKeys {
+		if strings.Contains(key, sensitiveKey) {
+			return true
+		}
+	}
+
+	for _, sensitiveKey := range extraKeys {
+		if strings.Contains(key, normalizeSensitiveKey(sensitiveKey)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return a copy of a value decoded from JSON where the values associated with
+// sensitive keys are redacted.
+func redactJSONValue(value interface{}, extraKeys []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		v2 := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			if isSensitiveKey(key, extraKeys) {
+				v2[key] = RedactedValue
+			} else {
+				v2[key] = redactJSONValue(child, extraKeys)
+			}
+		}
+		return v2
+
+	case []interface{}:
+		v2 := make([]interface{}, len(v))
+		for i, child := range v {
+			v2[i] = redactJSONValue(child, extraKeys)
+		}
+		return v2
+
+	default:
+		return v
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type ReservedKeyAction string
+
+const (
+	// Rename colliding keys by adding a prefix.
+	ReservedKeyActionRename ReservedKeyAction = "rename"
+
+	// Keep colliding keys, but log an error the first time each key is
+	// used.
+	ReservedKeyActionReport ReservedKeyAction = "report"
+)
+
+// Several backends write data entries next to the fields of the message
+// itself, and a data entry whose key is the name of one of these fields can
+// silently replace it or be dropped. In strict mode, loggers detect such
+// collisions and either rename the keys or report them.
+type ReservedKeysCfg struct {
+	// The action performed on collisions, ReservedKeyActionRename by
+	// default.
+	Action ReservedKeyAction `json:"action"`
+
+	// The prefix added to keys being renamed, "data_" by default.
+	Prefix string `json:"prefix"`
+
+	// Additional reserved keys.
+	Keys []string `json:"keys"`
+}
+
+// The fields used by encoders and backends for the message itself.
+var DefaultReservedKeys = []string{"time", "level", "message", "domain"}
+
+type reservedKeyChecker struct {
+	Cfg ReservedKeysCfg
+
+	keys map[string]struct{}
+
+	reportedMut sync.Mutex
+	reported    map[string]struct{}
+}
+
+func newReservedKeyChecker(cfg ReservedKeysCfg) (*reservedKeyChecker, error) {
+	switch cfg.Action {
+	case ReservedKeyActionRename, ReservedKeyActionReport:
+	case "":
+		cfg.Action = ReservedKeyActionRename
+	default:
+		return nil, fmt.Errorf("invalid reserved key action %q", cfg.Action)
+	}
+
+	if cfg.Prefix == "" {
+		cfg.Prefix = "data_"
+	}
+
+	keys := make(map[string]struct{})
+	for _, key := range DefaultReservedKeys {
+		keys[key] = struct{}{}
+	}
+	for _, key := range cfg.Keys {
+		keys[key] = struct{}{}
+	}
+
+	return &reservedKeyChecker{
+		Cfg: cfg,
+
+		keys:     keys,
+		reported: make(map[string]struct{}),
+	}, nil
+}
+
+// Check the data of a message, renaming colliding keys in place. Reports are
+// logged with the backend.
+func (c *reservedKeyChecker) check(data Data, backend Backend) {
+	for key := range data {
+		if _, found := c.keys[key]; !found {
+			continue
+		}
+
+		switch c.Cfg.Action {
+		case ReservedKeyActionRename:
+			newKey := c.Cfg.Prefix + key
+			if _, found := data[newKey]; !found {
+				data[newKey] = data[key]
+			}
+			delete(data, key)
+
+		case ReservedKeyActionReport:
+			c.report(key, backend)
+		}
+	}
+}
+
+func (c *reservedKeyChecker) report(key string, backend Backend) {
+	c.reportedMut.Lock()
+	_, reported := c.reported[key]
+	c.reported[key] = struct{}{}
+	c.reportedMut.Unlock()
+
+	if reported {
+		return
+	}
+
+	t := time.Now().UTC()
+
+	backend.Log(Message{
+		Time:    &t,
+		Level:   LevelError,
+		Message: fmt.Sprintf("data key %q collides with a reserved field", key),
+		Data:    Data{"key": key},
+
+		domain: InternalDomain,
+	})
+}
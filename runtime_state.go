@@ -0,0 +1,232 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The runtime state is shared by a logger and all its children. It is used
+// to inspect and adjust loggers while the program is running, usually through
+// the admin handler.
+type runtimeState struct {
+	// Counters are accessed atomically and must stay 64 bit aligned on 32
+	// bit platforms.
+	nbDebugMessages uint64
+	nbInfoMessages  uint64
+	nbErrorMessages uint64
+
+	// The debug level used instead of the debug level of each logger, or -1
+	// if there is none.
+	debugLevel int64
+
+	// The minimal debug level set by BoostDebug, or -1 if there is no
+	// active boost.
+	boostLevel int64
+
+	boostMut   sync.Mutex
+	boostUntil time.Time
+	boostTimer *time.Timer
+
+	// The capture ring (*captureRing) if capture is enabled, see
+	// Logger.EnableCapture.
+	capture atomic.Value
+}
+
+type DebugBoost struct {
+	DebugLevel int       `json:"debug_level"`
+	Until      time.Time `json:"until"`
+}
+
+type MessageCounts struct {
+	Debug uint64 `json:"debug"`
+	Info  uint64 `json:"info"`
+	Error uint64 `json:"error"`
+}
+
+func newRuntimeState() *runtimeState {
+	s := &runtimeState{
+		debugLevel: -1,
+		boostLevel: -1,
+	}
+
+	s.capture.Store((*captureRing)(nil))
+
+	return s
+}
+
+func (s *runtimeState) countMessage(level Level) {
+	switch level {
+	case LevelDebug:
+		atomic.AddUint64(&s.nbDebugMessages, 1)
+	case LevelInfo:
+		atomic.AddUint64(&s.nbInfoMessages, 1)
+	case LevelError:
+		atomic.AddUint64(&s.nbErrorMessages, 1)
+	}
+}
+
+// Return the debug level used to filter messages, taking into account the
+// level set with SetDebugLevel, the active boost if there is one, and the
+// level raised by the adaptive debug controller.
+func (l *Logger) CurrentDebugLevel() int {
+	if l.state == nil {
+		return l.DebugLevel
+	}
+
+	level := int64(l.DebugLevel)
+	if override := atomic.LoadInt64(&l.state.debugLevel); override >= 0 {
+		level = override
+	}
+
+	if boost := atomic.LoadInt64(&l.state.boostLevel); boost > level {
+		level = boost
+	}
+
+	if l.adaptiveDebug != nil {
+		if raised := int64(l.adaptiveDebug.debugLevel(l.Domain)); raised > level {
+			level = raised
+		}
+	}
+
+	return int(level)
+}
+
+// Change the debug level of the logger and of all loggers sharing the same
+// root logger, overriding their own debug level until ResetDebugLevel is
+// called.
+func (l *Logger) SetDebugLevel(level int) {
+	if level < 0 {
+		level = 0
+	}
+
+	if l.state == nil {
+		l.DebugLevel = level
+		return
+	}
+
+	atomic.StoreInt64(&l.state.debugLevel, int64(level))
+}
+
+func (l *Logger) ResetDebugLevel() {
+	if l.state == nil {
+		return
+	}
+
+	atomic.StoreInt64(&l.state.debugLevel, -1)
+}
+
+// Raise the debug level of the logger and of all loggers sharing the same root
+// logger to at least a specific level for a limited duration, after which the
+// previous level is automatically restored. A new boost replaces the current
+// one. The function has no effect on loggers not created with NewLogger or
+// DefaultLogger.
+func (l *Logger) BoostDebug(level int, d time.Duration) {
+	s := l.state
+	if s == nil || d <= 0 {
+		return
+	}
+
+	s.boostMut.Lock()
+
+	if s.boostTimer != nil {
+		s.boostTimer.Stop()
+	}
+
+	atomic.StoreInt64(&s.boostLevel, int64(level))
+	s.boostUntil = time.Now().Add(d)
+
+	var timer *time.Timer
+	timer = time.AfterFunc(d, func() {
+		s.boostMut.Lock()
+
+		// The boost may have been replaced while the timer was firing
+		if s.boostTimer != timer {
+			s.boostMut.Unlock()
+			return
+		}
+
+		s.clearBoost()
+		s.boostMut.Unlock()
+
+		l.Info("debug level boost to level %d expired", level)
+	})
+
+	s.boostTimer = timer
+
+	s.boostMut.Unlock()
+
+	l.Info("debug level boosted to level %d for %v", level, d)
+}
+
+func (l *Logger) CancelDebugBoost() {
+	s := l.state
+	if s == nil {
+		return
+	}
+
+	s.boostMut.Lock()
+	defer s.boostMut.Unlock()
+
+	if s.boostTimer != nil {
+		s.boostTimer.Stop()
+	}
+
+	s.clearBoost()
+}
+
+// Return the active debug level boost or nil if there is none.
+func (l *Logger) DebugBoost() *DebugBoost {
+	s := l.state
+	if s == nil {
+		return nil
+	}
+
+	s.boostMut.Lock()
+	defer s.boostMut.Unlock()
+
+	level := atomic.LoadInt64(&s.boostLevel)
+	if level < 0 {
+		return nil
+	}
+
+	return &DebugBoost{
+		DebugLevel: int(level),
+		Until:      s.boostUntil,
+	}
+}
+
+// The function is unsafe and MUST be called with s.boostMut held.
+func (s *runtimeState) clearBoost() {
+	atomic.StoreInt64(&s.boostLevel, -1)
+	s.boostUntil = time.Time{}
+	s.boostTimer = nil
+}
+
+// Return the number of messages sent to the backend by the logger and all
+// loggers sharing the same root logger.
+func (l *Logger) MessageCounts() MessageCounts {
+	if l.state == nil {
+		return MessageCounts{}
+	}
+
+	return MessageCounts{
+		Debug: atomic.LoadUint64(&l.state.nbDebugMessages),
+		Info:  atomic.LoadUint64(&l.state.nbInfoMessages),
+		Error: atomic.LoadUint64(&l.state.nbErrorMessages),
+	}
+}
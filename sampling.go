@@ -0,0 +1,122 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+)
+
+// Sampling logs the first messages of each period for a key made of the
+// level, domain and message, then only one message out of n. First and
+// Thereafter cannot both be zero since no message would ever be logged.
+//
+// Messages logged with a format string, e.g. with Logger.Info, are keyed by
+// their format string so that messages only differing by their arguments are
+// sampled together. Other messages are keyed by their text.
+//
+// Counters are stored in a fixed size table so that memory usage is bounded
+// whatever the number of distinct keys. Keys sharing a counter are sampled
+// together: this is negligible for a few hundred distinct keys, but sampling
+// becomes more aggressive as the number of keys approaches the size of the
+// table.
+type SamplingCfg struct {
+	Interval   time.Duration `json:"interval"`
+	First      int           `json:"first"`
+	Thereafter int           `json:"thereafter"`
+}
+
+const nbSamplerCounters = 4096
+
+type sampler struct {
+	// The counter table must be the first field so that counters are 64 bit
+	// aligned on 32 bit platforms.
+	counters [nbSamplerCounters]samplerCounter
+
+	Cfg SamplingCfg
+}
+
+type samplerCounter struct {
+	resetAt int64
+	count   uint64
+}
+
+func newSampler(cfg SamplingCfg) (*sampler, error) {
+	if cfg.First < 0 || cfg.Thereafter < 0 {
+		return nil, fmt.Errorf("first and thereafter must not be negative")
+	}
+
+	if cfg.First == 0 && cfg.Thereafter == 0 {
+		return nil, fmt.Errorf("first and thereafter cannot both be zero")
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+
+	s := &sampler{
+		Cfg: cfg,
+	}
+
+	return s, nil
+}
+
+func (s *sampler) sample(msg Message, domain string, now time.Time) bool {
+	hash := fnv.New32a()
+	hash.Write([]byte(msg.Level))
+	hash.Write([]byte{0})
+	hash.Write([]byte(domain))
+	hash.Write([]byte{0})
+	if msg.format != "" {
+		hash.Write([]byte(msg.format))
+	} else {
+		hash.Write([]byte(msg.Message))
+	}
+
+	counter := &s.counters[hash.Sum32()%nbSamplerCounters]
+	n := counter.inc(now, s.Cfg.Interval)
+
+	first := uint64(s.Cfg.First)
+	if n <= first {
+		return true
+	}
+
+	if s.Cfg.Thereafter <= 0 {
+		return false
+	}
+
+	return (n-first)%uint64(s.Cfg.Thereafter) == 0
+}
+
+func (c *samplerCounter) inc(now time.Time, interval time.Duration) uint64 {
+	t := now.UnixNano()
+
+	resetAt := atomic.LoadInt64(&c.resetAt)
+	if resetAt > t {
+		return atomic.AddUint64(&c.count, 1)
+	}
+
+	atomic.StoreUint64(&c.count, 1)
+
+	if !atomic.CompareAndSwapInt64(&c.resetAt, resetAt,
+		t+interval.Nanoseconds()) {
+		// Another goroutine started a new period concurrently
+		return atomic.AddUint64(&c.count, 1)
+	}
+
+	return 1
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestSampler(t *testing.T, cfg SamplingCfg) *sampler {
+	s, err := newSampler(cfg)
+	if err != nil {
+		t.Fatalf("cannot create sampler: %v", err)
+	}
+
+	return s
+}
+
+// Return the indexes of the messages kept by a sampler.
+func sampleTestMessages(s *sampler, msgs []Message, domain string, now time.Time) []int {
+	var kept []int
+
+	for i, msg := range msgs {
+		if s.sample(msg, domain, now) {
+			kept = append(kept, i)
+		}
+	}
+
+	return kept
+}
+
+func TestSampler(t *testing.T) {
+	s := newTestSampler(t, SamplingCfg{
+		Interval:   time.Second,
+		First:      2,
+		Thereafter: 3,
+	})
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	msgs := make([]Message, 10)
+	for i := range msgs {
+		msgs[i] = Message{Level: LevelInfo, Message: "hello"}
+	}
+
+	expected := []int{0, 1, 4, 7}
+
+	if kept := sampleTestMessages(s, msgs, "test", now); !reflect.DeepEqual(
+		kept, expected) {
+		t.Errorf("expected messages %v to be kept, got %v", expected, kept)
+	}
+
+	// Counters are reset at the end of the interval.
+	now = now.Add(time.Second)
+
+	if kept := sampleTestMessages(s, msgs, "test", now); !reflect.DeepEqual(
+		kept, expected) {
+		t.Errorf("expected messages %v to be kept after the interval, got %v",
+			expected, kept)
+	}
+}
+
+func TestSamplerFirstOnly(t *testing.T) {
+	s := newTestSampler(t, SamplingCfg{First: 3})
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	msgs := make([]Message, 10)
+	for i := range msgs {
+		msgs[i] = Message{Level: LevelInfo, Message: "hello"}
+	}
+
+	expected := []int{0, 1, 2}
+
+	if kept := sampleTestMessages(s, msgs, "test", now); !reflect.DeepEqual(
+		kept, expected) {
+		t.Errorf("expected messages %v to be kept, got %v", expected, kept)
+	}
+}
+
+func TestSamplerKeys(t *testing.T) {
+	s := newTestSampler(t, SamplingCfg{First: 1})
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Messages logged with the same format string share a counter whatever
+	// their arguments.
+	var formatted []Message
+	for i := 0; i < 3; i++ {
+		formatted = append(formatted, Message{
+			Level:   LevelInfo,
+			Message: fmt.Sprintf("request %d", i),
+
+			format: "request %d",
+		})
+	}
+
+	if kept := sampleTestMessages(s, formatted, "test", now); !reflect.DeepEqual(
+		kept, []int{0}) {
+		t.Errorf("formatted messages %v were kept", kept)
+	}
+
+	// Other messages are keyed by their text.
+	texts := []Message{
+		{Level: LevelInfo, Message: "request 0"},
+		{Level: LevelInfo, Message: "request 1"},
+		{Level: LevelInfo, Message: "request 1"},
+	}
+
+	if kept := sampleTestMessages(s, texts, "test", now); !reflect.DeepEqual(
+		kept, []int{0, 1}) {
+		t.Errorf("messages %v were kept instead of [0 1]", kept)
+	}
+
+	// Levels and domains have their own counters.
+	if !s.sample(formatted[0], "other", now) {
+		t.Errorf("message of another domain was dropped")
+	}
+
+	msg := formatted[0]
+	msg.Level = LevelError
+
+	if !s.sample(msg, "test", now) {
+		t.Errorf("message of another level was dropped")
+	}
+}
+
+func TestSamplerInvalidCfg(t *testing.T) {
+	cfgs := []SamplingCfg{
+		{},
+		{Interval: time.Second},
+		{First: -1, Thereafter: 1},
+		{First: 1, Thereafter: -1},
+	}
+
+	for _, cfg := range cfgs {
+		if _, err := newSampler(cfg); err == nil {
+			t.Errorf("invalid configuration %#v was accepted", cfg)
+		}
+	}
+}
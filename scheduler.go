@@ -0,0 +1,113 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"sync"
+	"time"
+)
+
+// Asynchronous components (batchers, the queue, dedup, rate limit and
+// failover backends, periodic flushes of the file backend, chunk rotation
+// and retries of the S3 backend) read the time, wait and run background work
+// through a scheduler, so that tests can replace real time by virtual time
+// (see SimScheduler).
+type scheduler interface {
+	now() time.Time
+	sleep(time.Duration)
+
+	// Run a function every interval (never if the interval is zero) and
+	// each time the wakeup function is called, until the stop function is
+	// called. Calls never overlap, and the stop function waits for the
+	// current call to return.
+	loop(name string, interval time.Duration, fn func()) (wakeup, stop func())
+}
+
+var (
+	currentSchedulerMut sync.Mutex
+	currentScheduler    scheduler = realScheduler{}
+)
+
+// Return the scheduler used by components being created.
+func getScheduler() scheduler {
+	currentSchedulerMut.Lock()
+	defer currentSchedulerMut.Unlock()
+
+	return currentScheduler
+}
+
+type realScheduler struct{}
+
+func (realScheduler) now() time.Time {
+	return time.Now()
+}
+
+func (realScheduler) sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (realScheduler) loop(name string, interval time.Duration, fn func()) (func(), func()) {
+	wakeupChan := make(chan struct{}, 1)
+	stopChan := make(chan struct{})
+
+	var ticker *time.Ticker
+	var tickChan <-chan time.Time
+
+	if interval > 0 {
+		ticker = time.NewTicker(interval)
+		tickChan = ticker.C
+	}
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer trackGoroutine(name)()
+
+		if ticker != nil {
+			defer ticker.Stop()
+		}
+
+		for {
+			select {
+			case <-stopChan:
+				return
+
+			case <-tickChan:
+				fn()
+
+			case <-wakeupChan:
+				fn()
+			}
+		}
+	}()
+
+	wakeup := func() {
+		select {
+		case wakeupChan <- struct{}{}:
+		default:
+		}
+	}
+
+	var stopOnce sync.Once
+
+	stop := func() {
+		stopOnce.Do(func() { close(stopChan) })
+		wg.Wait()
+	}
+
+	return wakeup, stop
+}
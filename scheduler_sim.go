@@ -0,0 +1,199 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"sync"
+	"time"
+)
+
+// The simulated scheduler replaces real time by virtual time for asynchronous
+// components: batchers used by network backends, the queue, dedup, rate
+// limit and failover backends, periodic flushes of the file backend and
+// chunk rotation in the S3 backend (chunks are still uploaded by a separate
+// goroutine). Background work never runs on its own; it runs in the
+// goroutine calling Tick or Advance, so that tests can check ordering, flush
+// and drop behaviors deterministically instead of sleeping. Sleeping, e.g.
+// before retrying a request, returns immediately and advances virtual time.
+//
+// It is meant for tests only, and only applies to components created after
+// the call to SetSimScheduler. Note that with the block drop policy, the
+// queue backend waits until Tick is called from another goroutine when the
+// queue is full.
+type SimScheduler struct {
+	mut   sync.Mutex
+	t     time.Time
+	loops []*simLoop
+}
+
+type simLoop struct {
+	fn       func()
+	interval time.Duration
+	next     time.Time
+	woken    bool
+	stopped  bool
+}
+
+func NewSimScheduler(start time.Time) *SimScheduler {
+	return &SimScheduler{
+		t: start,
+	}
+}
+
+// Install a simulated scheduler and return a function restoring the
+// previous one.
+func SetSimScheduler(s *SimScheduler) func() {
+	currentSchedulerMut.Lock()
+	previous := currentScheduler
+	currentScheduler = s
+	currentSchedulerMut.Unlock()
+
+	return func() {
+		currentSchedulerMut.Lock()
+		currentScheduler = previous
+		currentSchedulerMut.Unlock()
+	}
+}
+
+// Return the current virtual time.
+func (s *SimScheduler) Now() time.Time {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	return s.t
+}
+
+// Run pending background work without advancing virtual time, e.g. to send
+// a full batch or write queued messages. Return the number of functions
+// run.
+func (s *SimScheduler) Tick() int {
+	n := 0
+
+	for {
+		s.mut.Lock()
+
+		var l *simLoop
+		for _, l2 := range s.loops {
+			if l2.woken {
+				l = l2
+				break
+			}
+		}
+
+		if l == nil {
+			s.mut.Unlock()
+			return n
+		}
+
+		l.woken = false
+		s.mut.Unlock()
+
+		l.fn()
+		n++
+	}
+}
+
+// Advance virtual time, running periodic functions in chronological order
+// each time their interval elapses, and pending background work after each
+// of them.
+func (s *SimScheduler) Advance(d time.Duration) {
+	s.Tick()
+
+	s.mut.Lock()
+	end := s.t.Add(d)
+	s.mut.Unlock()
+
+	for {
+		s.mut.Lock()
+
+		var l *simLoop
+		for _, l2 := range s.loops {
+			if l2.interval > 0 && !l2.next.After(end) &&
+				(l == nil || l2.next.Before(l.next)) {
+				l = l2
+			}
+		}
+
+		if l == nil {
+			if s.t.Before(end) {
+				s.t = end
+			}
+
+			s.mut.Unlock()
+			return
+		}
+
+		if s.t.Before(l.next) {
+			s.t = l.next
+		}
+
+		l.next = l.next.Add(l.interval)
+		s.mut.Unlock()
+
+		l.fn()
+		s.Tick()
+	}
+}
+
+func (s *SimScheduler) now() time.Time {
+	return s.Now()
+}
+
+func (s *SimScheduler) sleep(d time.Duration) {
+	s.mut.Lock()
+	s.t = s.t.Add(d)
+	s.mut.Unlock()
+}
+
+func (s *SimScheduler) loop(name string, interval time.Duration, fn func()) (func(), func()) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	l := &simLoop{
+		fn:       fn,
+		interval: interval,
+		next:     s.t.Add(interval),
+	}
+
+	s.loops = append(s.loops, l)
+
+	wakeup := func() {
+		s.mut.Lock()
+		if !l.stopped {
+			l.woken = true
+		}
+		s.mut.Unlock()
+	}
+
+	stop := func() {
+		s.mut.Lock()
+		defer s.mut.Unlock()
+
+		if l.stopped {
+			return
+		}
+
+		l.stopped = true
+
+		for i, l2 := range s.loops {
+			if l2 == l {
+				s.loops = append(s.loops[:i], s.loops[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return wakeup, stop
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Message scrubbing masks secrets in the text of messages. Data entries whose
+// key is sensitive can be redacted, but secrets most often leak through
+// values interpolated in the message itself, e.g. an URI containing a
+// password or a token included in an error message.
+type MessageScrubbingCfg struct {
+	// Additional regular expressions; each match is replaced by
+	// RedactedValue.
+	Patterns []string `json:"patterns"`
+
+	// Only use the additional patterns and not DefaultScrubPatterns.
+	NoDefaultPatterns bool `json:"no_default_patterns"`
+}
+
+type ScrubPattern struct {
+	Name   string
+	Regexp *regexp.Regexp
+
+	// The replacement string, see regexp.Regexp.Expand.
+	Replacement string
+}
+
+var DefaultScrubPatterns = []ScrubPattern{
+	{
+		Name: "private_key",
+		Regexp: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----` +
+			`[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+		Replacement: RedactedValue,
+	},
+	{
+		Name:        "aws_access_key_id",
+		Regexp:      regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+		Replacement: RedactedValue,
+	},
+	{
+		Name: "jwt",
+		Regexp: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+` +
+			`\.[A-Za-z0-9_-]*`),
+		Replacement: RedactedValue,
+	},
+	{
+		Name:        "bearer_token",
+		Regexp:      regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9._~+/-]+=*`),
+		Replacement: "${1}" + RedactedValue,
+	},
+	{
+		Name:        "uri_password",
+		Regexp:      regexp.MustCompile(`(\w://[^/\s:@]+:)[^/\s@]+@`),
+		Replacement: "${1}" + RedactedValue + "@",
+	},
+	{
+		Name:        "key_value",
+		Regexp:      sensitiveKeyValueRegexp(),
+		Replacement: "${1}${2}" + RedactedValue,
+	},
+}
+
+// Match "<key>=<value>" and "<key>: <value>" where the key contains one of
+// the default sensitive keys.
+func sensitiveKeyValueRegexp() *regexp.Regexp {
+	words := make([]string, len(DefaultSensitiveKeys))
+	for i, key := range DefaultSensitiveKeys {
+		words[i] = strings.ReplaceAll(regexp.QuoteMeta(key), "_", "[_-]?")
+	}
+
+	return regexp.MustCompile(`(?i)(\b[\w.-]*(?:` + strings.Join(words, "|") +
+		`)[\w.-]*)(\s*[=:]\s*)("[^"]*"|'[^']*'|[^\s"',;&]+)`)
+}
+
+type messageScrubber struct {
+	patterns []ScrubPattern
+}
+
+var defaultMessageScrubber = &messageScrubber{patterns: DefaultScrubPatterns}
+
+func newMessageScrubber(cfg MessageScrubbingCfg) (*messageScrubber, error) {
+	var patterns []ScrubPattern
+
+	if !cfg.NoDefaultPatterns {
+		patterns = append(patterns, DefaultScrubPatterns...)
+	}
+
+	for _, s := range cfg.Patterns {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scrubbing pattern %q: %w", s, err)
+		}
+
+		patterns = append(patterns, ScrubPattern{
+			Regexp:      re,
+			Replacement: RedactedValue,
+		})
+	}
+
+	return &messageScrubber{patterns: patterns}, nil
+}
+
+func (s *messageScrubber) scrub(text string) string {
+	for _, pattern := range s.patterns {
+		text = pattern.Regexp.ReplaceAllString(text, pattern.Replacement)
+	}
+
+	return text
+}
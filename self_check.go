@@ -0,0 +1,355 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Resources owned by the logging subsystem (goroutines, network connections
+// and pending messages) are tracked so that leaks can be detected in
+// long-running processes.
+type ResourceUsage struct {
+	Goroutines      map[string]int `json:"goroutines"`
+	Connections     map[string]int `json:"connections"`
+	PendingMessages map[string]int `json:"pending_messages"`
+
+	// The number of file descriptors open in the process, including the
+	// ones which are not owned by the logging subsystem, or -1 if it is not
+	// available on the platform.
+	FileDescriptors int `json:"file_descriptors"`
+}
+
+type resourceTracker struct {
+	mut             sync.Mutex
+	goroutines      map[string]int
+	connections     map[string]int
+	queues          map[*func() int]string
+	failingBackends int
+}
+
+var resources = resourceTracker{
+	goroutines:  make(map[string]int),
+	connections: make(map[string]int),
+	queues:      make(map[*func() int]string),
+}
+
+// Track a goroutine until the returned function is called, usually with
+// defer trackGoroutine(name)().
+func trackGoroutine(name string) func() {
+	resources.mut.Lock()
+	resources.goroutines[name]++
+	resources.mut.Unlock()
+
+	return func() {
+		resources.mut.Lock()
+		resources.goroutines[name]--
+		resources.mut.Unlock()
+	}
+}
+
+type trackedConn struct {
+	net.Conn
+
+	closeOnce sync.Once
+	name      string
+}
+
+// Track a connection until it is closed.
+func trackConn(name string, conn net.Conn) net.Conn {
+	resources.mut.Lock()
+	resources.connections[name]++
+	resources.mut.Unlock()
+
+	return &trackedConn{Conn: conn, name: name}
+}
+
+func (c *trackedConn) Close() error {
+	c.closeOnce.Do(func() {
+		resources.mut.Lock()
+		resources.connections[c.name]--
+		resources.mut.Unlock()
+	})
+
+	return c.Conn.Close()
+}
+
+// Track the size of a queue until the returned function is called.
+func trackQueue(name string, size func() int) func() {
+	key := &size
+
+	resources.mut.Lock()
+	resources.queues[key] = name
+	resources.mut.Unlock()
+
+	return func() {
+		resources.mut.Lock()
+		delete(resources.queues, key)
+		resources.mut.Unlock()
+	}
+}
+
+// Return the total number of messages waiting in tracked queues.
+func pendingMessageCount() int {
+	resources.mut.Lock()
+	sizes := make([]*func() int, 0, len(resources.queues))
+	for size := range resources.queues {
+		sizes = append(sizes, size)
+	}
+	resources.mut.Unlock()
+
+	n := 0
+	for _, size := range sizes {
+		n += (*size)()
+	}
+
+	return n
+}
+
+func failingBackendCount() int {
+	resources.mut.Lock()
+	defer resources.mut.Unlock()
+
+	return resources.failingBackends
+}
+
+func CurrentResourceUsage() ResourceUsage {
+	usage := ResourceUsage{
+		Goroutines:      make(map[string]int),
+		Connections:     make(map[string]int),
+		PendingMessages: make(map[string]int),
+		FileDescriptors: countFileDescriptors(),
+	}
+
+	resources.mut.Lock()
+
+	for name, n := range resources.goroutines {
+		if n != 0 {
+			usage.Goroutines[name] = n
+		}
+	}
+
+	for name, n := range resources.connections {
+		if n != 0 {
+			usage.Connections[name] = n
+		}
+	}
+
+	queues := make(map[*func() int]string, len(resources.queues))
+	for key, name := range resources.queues {
+		queues[key] = name
+	}
+
+	resources.mut.Unlock()
+
+	// Size functions acquire the locks of their queue; they are not called
+	// with the tracker locked.
+	for size, name := range queues {
+		usage.PendingMessages[name] += (*size)()
+	}
+
+	return usage
+}
+
+func countFileDescriptors() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+
+	return len(entries)
+}
+
+// In self-check mode, resource usage is checked at regular intervals. A
+// resource whose usage increases during a number of consecutive checks is
+// reported as a possible leak with an error message in the internal domain.
+type SelfCheckCfg struct {
+	Interval     time.Duration `json:"interval"`
+	GrowthChecks int           `json:"growth_checks"`
+}
+
+type selfChecker struct {
+	Cfg SelfCheckCfg
+
+	backend Backend
+
+	growth   map[string]int
+	last     map[string]int
+	reported map[string]bool
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+var (
+	selfCheckMut sync.Mutex
+	selfCheck    *selfChecker
+)
+
+// Start the self-check mode, reporting leaks to a backend. Only one
+// self-check can run at the same time; a previous self-check is stopped.
+func StartSelfCheck(cfg SelfCheckCfg, backend Backend) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+
+	if cfg.GrowthChecks <= 0 {
+		cfg.GrowthChecks = 5
+	}
+
+	c := &selfChecker{
+		Cfg: cfg,
+
+		backend: backend,
+
+		growth:   make(map[string]int),
+		last:     make(map[string]int),
+		reported: make(map[string]bool),
+
+		stopChan: make(chan struct{}),
+	}
+
+	selfCheckMut.Lock()
+	defer selfCheckMut.Unlock()
+
+	if selfCheck != nil {
+		selfCheck.stop()
+	}
+
+	selfCheck = c
+
+	c.wg.Add(1)
+	go c.main()
+}
+
+func StopSelfCheck() {
+	selfCheckMut.Lock()
+	defer selfCheckMut.Unlock()
+
+	if selfCheck != nil {
+		selfCheck.stop()
+		selfCheck = nil
+	}
+}
+
+// Stop the self-check if it reports to a specific backend.
+func stopSelfCheckFor(backend Backend) {
+	selfCheckMut.Lock()
+	defer selfCheckMut.Unlock()
+
+	if selfCheck != nil && selfCheck.backend == backend {
+		selfCheck.stop()
+		selfCheck = nil
+	}
+}
+
+func (c *selfChecker) stop() {
+	close(c.stopChan)
+	c.wg.Wait()
+}
+
+func (c *selfChecker) main() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.Cfg.Interval)
+	defer ticker.Stop()
+
+	c.check()
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+
+		case <-ticker.C:
+			c.check()
+		}
+	}
+}
+
+func (c *selfChecker) check() {
+	usage := CurrentResourceUsage()
+
+	values := make(map[string]int)
+	for name, n := range usage.Goroutines {
+		values["goroutines."+name] = n
+	}
+	for name, n := range usage.Connections {
+		values["connections."+name] = n
+	}
+	for name, n := range usage.PendingMessages {
+		values["pending_messages."+name] = n
+	}
+	if usage.FileDescriptors >= 0 {
+		values["file_descriptors"] = usage.FileDescriptors
+	}
+
+	for name := range c.last {
+		if _, found := values[name]; !found {
+			values[name] = 0
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := values[name]
+
+		// Only strictly consecutive increases count; a plateau resets
+		// growth so that a counter moving by occasional steps is not
+		// reported as a leak.
+		if last, found := c.last[name]; found && value > last {
+			c.growth[name]++
+		} else {
+			c.growth[name] = 0
+			c.reported[name] = false
+		}
+
+		c.last[name] = value
+
+		if c.growth[name] >= c.Cfg.GrowthChecks && !c.reported[name] {
+			c.reported[name] = true
+			c.report(name, value, usage)
+		}
+	}
+}
+
+func (c *selfChecker) report(name string, value int, usage ResourceUsage) {
+	t := time.Now().UTC()
+
+	c.backend.Log(Message{
+		Time:  &t,
+		Level: LevelError,
+		Message: fmt.Sprintf("possible resource leak in the logging "+
+			"subsystem: %s increased during %d consecutive checks",
+			name, c.growth[name]),
+		Data: Data{
+			"resource":       name,
+			"value":          value,
+			"resource_usage": usage,
+		},
+
+		domain: InternalDomain,
+	})
+}
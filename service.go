@@ -0,0 +1,200 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"sync"
+)
+
+// A ServiceNotifier reports the state of the program to the service manager
+// running it. Status strings are short descriptions displayed by the
+// service manager; they can be ignored on some platforms.
+type ServiceNotifier interface {
+	Ready(status string) error
+	Status(status string) error
+	Stopping() error
+}
+
+// Return the notifier of the service manager running the program, or nil if
+// there is none. On Linux, programs started by systemd with Type=notify are
+// detected. Windows services must use NewWindowsServiceNotifier with the
+// status channel of their handler.
+func DetectServiceNotifier() ServiceNotifier {
+	return detectServiceNotifier()
+}
+
+// Service ties a logger to the service manager. Messages logged before
+// backends are started are written to the standard error output, which is
+// collected by service managers, and are sent again to the backends once
+// they are started so that they are not missing from the final
+// destination.
+type Service struct {
+	// The notifier can be nil, in which case notifications are ignored.
+	Notifier ServiceNotifier
+
+	// The logger to use until the service is started. Its children keep
+	// working once the service is started, logging messages to the new
+	// backends.
+	Logger *Logger
+
+	early *EarlyBackend
+}
+
+func NewService(name string, notifier ServiceNotifier) *Service {
+	early := NewEarlyBackend(NewTerminalBackend(TerminalBackendCfg{}), 0)
+
+	logger := DefaultLogger(name)
+	logger.Backend = early
+
+	return &Service{
+		Notifier: notifier,
+		Logger:   logger,
+
+		early: early,
+	}
+}
+
+// Create a logger and its backends. If backends cannot be created, the
+// error is reported to the service manager and early messages keep being
+// written to the standard error output.
+func (s *Service) Start(cfg LoggerCfg) (*Logger, error) {
+	logger, err := NewLogger(s.Logger.Domain, cfg)
+	if err != nil {
+		err = fmt.Errorf("cannot create logger: %w", err)
+		s.notify(func(n ServiceNotifier) error {
+			return n.Status(err.Error())
+		})
+
+		return nil, err
+	}
+
+	s.early.SetBackend(logger.Backend)
+	s.Logger = logger
+
+	return logger, nil
+}
+
+// Notify the service manager that the program is ready.
+func (s *Service) Ready(status string) error {
+	s.Logger.Info("service ready")
+
+	return s.notify(func(n ServiceNotifier) error {
+		return n.Ready(status)
+	})
+}
+
+func (s *Service) Status(status string) error {
+	return s.notify(func(n ServiceNotifier) error {
+		return n.Status(status)
+	})
+}
+
+// Notify the service manager that the program is stopping and flush the
+// backend of the logger.
+func (s *Service) Stopping() error {
+	s.Logger.Info("service stopping")
+
+	err := s.notify(func(n ServiceNotifier) error {
+		return n.Stopping()
+	})
+
+	if backend, ok := s.Logger.Backend.(interface{ Flush() error }); ok {
+		backend.Flush()
+	}
+
+	return err
+}
+
+func (s *Service) notify(fn func(ServiceNotifier) error) error {
+	if s.Notifier == nil {
+		return nil
+	}
+
+	if err := fn(s.Notifier); err != nil {
+		return fmt.Errorf("cannot notify service manager: %w", err)
+	}
+
+	return nil
+}
+
+// The early backend writes messages to a fallback backend until the actual
+// backend is set. The last messages, up to a maximum number, are kept and
+// sent to the actual backend when it is set.
+type EarlyBackend struct {
+	Fallback   Backend
+	MaxPending int
+
+	mut     sync.Mutex
+	backend Backend
+	pending []Message
+}
+
+const DefaultEarlyBackendMaxPending = 1000
+
+func NewEarlyBackend(fallback Backend, maxPending int) *EarlyBackend {
+	if maxPending <= 0 {
+		maxPending = DefaultEarlyBackendMaxPending
+	}
+
+	return &EarlyBackend{
+		Fallback:   fallback,
+		MaxPending: maxPending,
+	}
+}
+
+func (b *EarlyBackend) Log(msg Message) {
+	b.mut.Lock()
+
+	if backend := b.backend; backend != nil {
+		b.mut.Unlock()
+		backend.Log(msg)
+		return
+	}
+
+	if len(b.pending) >= b.MaxPending {
+		b.pending = b.pending[1:]
+	}
+	b.pending = append(b.pending, msg)
+
+	b.mut.Unlock()
+
+	b.Fallback.Log(msg)
+}
+
+// Set the actual backend and send pending messages to it.
+func (b *EarlyBackend) SetBackend(backend Backend) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if len(b.pending) > 0 {
+		logBatch(backend, b.pending)
+	}
+
+	b.backend = backend
+	b.pending = nil
+}
+
+func (b *EarlyBackend) Flush() error {
+	b.mut.Lock()
+	backend := b.backend
+	b.mut.Unlock()
+
+	if flusher, ok := backend.(interface{ Flush() error }); ok {
+		return flusher.Flush()
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build linux
+// +build linux
+
+package log
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// The systemd notifier implements the notification protocol of systemd,
+// see sd_notify(3).
+type SystemdNotifier struct {
+	addr *net.UnixAddr
+}
+
+func NewSystemdNotifier(socketPath string) *SystemdNotifier {
+	// Abstract socket names start with '@'
+	if strings.HasPrefix(socketPath, "@") {
+		socketPath = "\x00" + socketPath[1:]
+	}
+
+	return &SystemdNotifier{
+		addr: &net.UnixAddr{Name: socketPath, Net: "unixgram"},
+	}
+}
+
+func detectServiceNotifier() ServiceNotifier {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if socketPath == "" {
+		return nil
+	}
+
+	return NewSystemdNotifier(socketPath)
+}
+
+func (n *SystemdNotifier) Ready(status string) error {
+	state := "READY=1"
+	if status != "" {
+		state += "\nSTATUS=" + status
+	}
+
+	return n.Notify(state)
+}
+
+func (n *SystemdNotifier) Status(status string) error {
+	return n.Notify("STATUS=" + status)
+}
+
+func (n *SystemdNotifier) Stopping() error {
+	return n.Notify("STOPPING=1")
+}
+
+// Signal systemd that the program is alive when the watchdog is enabled
+// (WatchdogSec).
+func (n *SystemdNotifier) Watchdog() error {
+	return n.Notify("WATCHDOG=1")
+}
+
+// Send a list of newline-separated assignments.
+func (n *SystemdNotifier) Notify(state string) error {
+	conn, err := net.DialUnix("unixgram", nil, n.addr)
+	if err != nil {
+		return fmt.Errorf("cannot connect to %q: %w", n.addr.Name, err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("cannot write to %q: %w", n.addr.Name, err)
+	}
+
+	return nil
+}
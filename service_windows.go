@@ -0,0 +1,58 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build windows
+// +build windows
+
+package log
+
+import (
+	"golang.org/x/sys/windows/svc"
+)
+
+// The Windows service notifier sends status updates to the service control
+// manager through the status channel of a service handler (see
+// svc.Handler). The service control manager does not support status
+// strings.
+type WindowsServiceNotifier struct {
+	changes chan<- svc.Status
+	accepts svc.Accepted
+}
+
+// The notifier must be created in the Execute method of the handler, the
+// accepted commands being the ones reported once the service is running.
+func NewWindowsServiceNotifier(changes chan<- svc.Status, accepts svc.Accepted) *WindowsServiceNotifier {
+	return &WindowsServiceNotifier{
+		changes: changes,
+		accepts: accepts,
+	}
+}
+
+func detectServiceNotifier() ServiceNotifier {
+	return nil
+}
+
+func (n *WindowsServiceNotifier) Ready(status string) error {
+	n.changes <- svc.Status{State: svc.Running, Accepts: n.accepts}
+	return nil
+}
+
+func (n *WindowsServiceNotifier) Status(status string) error {
+	return nil
+}
+
+func (n *WindowsServiceNotifier) Stopping() error {
+	n.changes <- svc.Status{State: svc.StopPending}
+	return nil
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWS Signature Version 4, see
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_aws-signing.html.
+
+type awsCredentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// Sign a request whose URL path is already encoded. All headers set in the
+// request, and the host, are signed.
+func signAWSRequest(req *http.Request, payloadHash string, creds awsCredentials, region, service string, now time.Time) {
+	req.Header.Set("X-Amz-Date", now.UTC().Format(awsTimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	signature := newAWSSignature(req, payloadHash, creds, region, service,
+		now)
+
+	req.Header.Set("Authorization", signature.authorization)
+}
+
+const awsTimeFormat = "20060102T150405Z"
+
+// The intermediate values of the signature of a request are kept so that
+// they can be compared with the ones of the AWS test suite.
+type awsSignature struct {
+	canonicalRequest string
+	stringToSign     string
+	signature        string
+	authorization    string
+}
+
+// Compute the signature of a request whose headers, including X-Amz-Date,
+// are already set.
+func newAWSSignature(req *http.Request, payloadHash string, creds awsCredentials, region, service string, now time.Time) *awsSignature {
+	now = now.UTC()
+	amzDate := now.Format(awsTimeFormat)
+	date := now.Format("20060102")
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(
+			strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name)
+		canonicalHeaders.WriteByte(':')
+		canonicalHeaders.WriteString(headers[name])
+		canonicalHeaders.WriteByte('\n')
+	}
+
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	var s awsSignature
+
+	s.canonicalRequest = strings.Join([]string{
+		req.Method,
+		path,
+		awsCanonicalQuery(req),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+
+	s.stringToSign = "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" +
+		sha256Hex([]byte(s.canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+
+	s.signature = hex.EncodeToString(hmacSHA256(key, s.stringToSign))
+
+	s.authorization = "AWS4-HMAC-SHA256 Credential=" + creds.AccessKeyId +
+		"/" + scope + ", SignedHeaders=" + signedHeaders +
+		", Signature=" + s.signature
+
+	return &s
+}
+
+func awsCanonicalQuery(req *http.Request) string {
+	query := req.URL.Query()
+
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+
+		for _, value := range values {
+			parts = append(parts,
+				awsURIEncode(key, true)+"="+awsURIEncode(value, true))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// Encode a string as required by AWS: all characters except unreserved ones
+// (RFC 3986) are percent-encoded, with slashes optionally kept as is.
+func awsURIEncode(s string, encodeSlash bool) string {
+	var buf strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z',
+			c >= '0' && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			buf.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			buf.WriteByte(c)
+		default:
+			buf.WriteByte('%')
+			buf.WriteString(strings.ToUpper(hex.EncodeToString([]byte{c})))
+		}
+	}
+
+	return buf.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Test cases of the AWS Signature Version 4 test suite, see
+// https://docs.aws.amazon.com/general/latest/gr/signature-v4-test-suite.html.
+func TestAWSSignatureTestSuite(t *testing.T) {
+	creds := awsCredentials{
+		AccessKeyId:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	emptyPayloadHash := sha256Hex(nil)
+
+	tests := []struct {
+		name             string
+		method           string
+		uri              string
+		canonicalRequest string
+		stringToSign     string
+		signature        string
+	}{
+		{
+			name:   "get-vanilla",
+			method: "GET",
+			uri:    "https://example.amazonaws.com/",
+			canonicalRequest: "GET\n" +
+				"/\n" +
+				"\n" +
+				"host:example.amazonaws.com\n" +
+				"x-amz-date:20150830T123600Z\n" +
+				"\n" +
+				"host;x-amz-date\n" +
+				"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			stringToSign: "AWS4-HMAC-SHA256\n" +
+				"20150830T123600Z\n" +
+				"20150830/us-east-1/service/aws4_request\n" +
+				"bb579772317eb040ac9ed261061d46c1f17a8133879d6129b6e1c25292927e63",
+			signature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:   "get-vanilla-query-order-key-case",
+			method: "GET",
+			uri:    "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			canonicalRequest: "GET\n" +
+				"/\n" +
+				"Param1=value1&Param2=value2\n" +
+				"host:example.amazonaws.com\n" +
+				"x-amz-date:20150830T123600Z\n" +
+				"\n" +
+				"host;x-amz-date\n" +
+				"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			stringToSign: "AWS4-HMAC-SHA256\n" +
+				"20150830T123600Z\n" +
+				"20150830/us-east-1/service/aws4_request\n" +
+				"816cd5b414d056048ba4f7c5386d6e0533120fb1fcfa93762cf0fc39e2cf19e0",
+			signature: "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name:   "post-vanilla",
+			method: "POST",
+			uri:    "https://example.amazonaws.com/",
+			canonicalRequest: "POST\n" +
+				"/\n" +
+				"\n" +
+				"host:example.amazonaws.com\n" +
+				"x-amz-date:20150830T123600Z\n" +
+				"\n" +
+				"host;x-amz-date\n" +
+				"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			stringToSign: "AWS4-HMAC-SHA256\n" +
+				"20150830T123600Z\n" +
+				"20150830/us-east-1/service/aws4_request\n" +
+				"553f88c9e4d10fc9e109e2aeb65f030801b70c2f6468faca261d401ae622fc87",
+			signature: "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, test.uri, nil)
+			if err != nil {
+				t.Fatalf("cannot create request: %v", err)
+			}
+
+			req.Header.Set("X-Amz-Date", "20150830T123600Z")
+
+			s := newAWSSignature(req, emptyPayloadHash, creds, "us-east-1",
+				"service", now)
+
+			if s.canonicalRequest != test.canonicalRequest {
+				t.Errorf("canonical request is\n%s\ninstead of\n%s",
+					s.canonicalRequest, test.canonicalRequest)
+			}
+
+			if s.stringToSign != test.stringToSign {
+				t.Errorf("string to sign is\n%s\ninstead of\n%s",
+					s.stringToSign, test.stringToSign)
+			}
+
+			if s.signature != test.signature {
+				t.Errorf("signature is %s instead of %s", s.signature,
+					test.signature)
+			}
+
+			authorization := "AWS4-HMAC-SHA256 " +
+				"Credential=AKIDEXAMPLE/20150830/us-east-1/service/" +
+				"aws4_request, SignedHeaders=host;x-amz-date, " +
+				"Signature=" + test.signature
+			if s.authorization != authorization {
+				t.Errorf("authorization is %s instead of %s",
+					s.authorization, authorization)
+			}
+		})
+	}
+}
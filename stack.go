@@ -0,0 +1,75 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+type StackFrame struct {
+	Function string
+	File     string
+	Line     int
+}
+
+type Stack []StackFrame
+
+const maxStackDepth = 64
+
+// Capture the stack of the calling goroutine, skipping the given number of
+// frames above the caller of CaptureStack.
+func CaptureStack(skip int) Stack {
+	var pcs [maxStackDepth]uintptr
+	n := runtime.Callers(skip+2, pcs[:])
+
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var stack Stack
+	for {
+		frame, more := frames.Next()
+
+		stack = append(stack, StackFrame{
+			Function: frame.Function,
+			File:     frame.File,
+			Line:     frame.Line,
+		})
+
+		if !more {
+			break
+		}
+	}
+
+	return stack
+}
+
+func (f StackFrame) String() string {
+	return fmt.Sprintf("%s\n\t%s:%d", f.Function, f.File, f.Line)
+}
+
+func (s Stack) String() string {
+	var buf strings.Builder
+
+	for i, frame := range s {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+
+		buf.WriteString(frame.String())
+	}
+
+	return buf.String()
+}
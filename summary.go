@@ -0,0 +1,168 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// A summary logger aggregates high-frequency events and periodically logs a
+// single message for each event instead of one message per occurrence.
+type SummaryLogger struct {
+	Logger   *Logger
+	Interval time.Duration
+
+	mut    sync.Mutex
+	events map[string]*summaryEvent
+	start  time.Time
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+type summaryEvent struct {
+	count     int64
+	hasValues bool
+	nbValues  int64
+	sum       float64
+	min       float64
+	max       float64
+}
+
+func NewSummaryLogger(logger *Logger, interval time.Duration) *SummaryLogger {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	s := &SummaryLogger{
+		Logger:   logger,
+		Interval: interval,
+
+		events: make(map[string]*summaryEvent),
+		start:  time.Now(),
+
+		stopChan: make(chan struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.main()
+
+	return s
+}
+
+func (s *SummaryLogger) Stop() {
+	close(s.stopChan)
+	s.wg.Wait()
+
+	s.Flush()
+}
+
+func (s *SummaryLogger) main() {
+	defer s.wg.Done()
+	defer trackGoroutine("summary")()
+
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+
+		case <-ticker.C:
+			s.Flush()
+		}
+	}
+}
+
+// Record an occurrence of an event.
+func (s *SummaryLogger) Inc(name string) {
+	s.mut.Lock()
+	s.event(name).count++
+	s.mut.Unlock()
+}
+
+// Record an occurrence of an event associated with a value, e.g. the size of
+// a payload or the duration of an operation.
+func (s *SummaryLogger) Add(name string, value float64) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	event := s.event(name)
+
+	if !event.hasValues || value < event.min {
+		event.min = value
+	}
+
+	if !event.hasValues || value > event.max {
+		event.max = value
+	}
+
+	event.count++
+	event.nbValues++
+	event.sum += value
+	event.hasValues = true
+}
+
+// The function is unsafe and MUST be called with s.mut held.
+func (s *SummaryLogger) event(name string) *summaryEvent {
+	event, found := s.events[name]
+	if !found {
+		event = &summaryEvent{}
+		s.events[name] = event
+	}
+
+	return event
+}
+
+// Log a summary for each event recorded since the last flush.
+func (s *SummaryLogger) Flush() {
+	s.mut.Lock()
+	events := s.events
+	start := s.start
+	s.events = make(map[string]*summaryEvent)
+	s.start = time.Now()
+	s.mut.Unlock()
+
+	period := time.Since(start)
+
+	names := make([]string, 0, len(events))
+	for name := range events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		event := events[name]
+
+		data := Data{
+			"event":  name,
+			"count":  event.count,
+			"period": period.Seconds(),
+		}
+
+		if event.hasValues {
+			data["sum"] = event.sum
+			data["min"] = event.min
+			data["max"] = event.max
+			data["mean"] = event.sum / float64(event.nbValues)
+		}
+
+		s.Logger.InfoData(data, "%s: %d occurrences in %v",
+			name, event.count, period.Round(time.Millisecond))
+	}
+}
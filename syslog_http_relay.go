@@ -0,0 +1,97 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// The HTTP relay receives each RFC 5424 frame (without octet counting) as the
+// body of a POST request. Any 2xx status is considered a success.
+type SyslogHTTPRelayCfg struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Timeout time.Duration     `json:"timeout"`
+
+	// How long to use the relay after a failure before trying to reach the
+	// syslog daemon again.
+	RetryInterval time.Duration `json:"retry_interval"`
+}
+
+type syslogHTTPRelay struct {
+	Cfg SyslogHTTPRelayCfg
+
+	client *http.Client
+}
+
+func newSyslogHTTPRelay(cfg SyslogHTTPRelayCfg) (*syslogHTTPRelay, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("missing or empty url")
+	}
+
+	if _, err := url.Parse(cfg.URL); err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = time.Minute
+	}
+
+	r := &syslogHTTPRelay{
+		Cfg: cfg,
+
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+	}
+
+	return r, nil
+}
+
+func (r *syslogHTTPRelay) post(frame []byte) error {
+	req, err := http.NewRequest("POST", r.Cfg.URL, bytes.NewReader(frame))
+	if err != nil {
+		return fmt.Errorf("cannot create http request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	for name, value := range r.Cfg.Headers {
+		req.Header.Set(name, value)
+	}
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot send log message to http relay: %w", err)
+	}
+	defer res.Body.Close()
+
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("cannot send log message to http relay: "+
+			"request failed with status %d", res.StatusCode)
+	}
+
+	return nil
+}
@@ -16,6 +16,8 @@ package log
 
 import "fmt"
 
+// Colors 0 to 7 are the standard terminal colors and colors 8 to 15 their
+// bright variants. ColorDefault is the default color of the terminal.
 type Color int
 
 var (
@@ -27,8 +29,41 @@ var (
 	ColorMagenta = Color(5)
 	ColorCyan    = Color(6)
 	ColorWhite   = Color(7)
+
+	ColorBrightBlack   = Color(8)
+	ColorBrightRed     = Color(9)
+	ColorBrightGreen   = Color(10)
+	ColorBrightYellow  = Color(11)
+	ColorBrightBlue    = Color(12)
+	ColorBrightMagenta = Color(13)
+	ColorBrightCyan    = Color(14)
+	ColorBrightWhite   = Color(15)
+
+	ColorDefault = Color(16)
 )
 
+const colorBold Color = 0x100
+
+// Return the same color rendered with a bold font.
+func (c Color) Bold() Color {
+	return c | colorBold
+}
+
 func Colorize(color Color, text string) string {
-	return fmt.Sprintf("\033[%dm%s\033[0m", 30+int(color), text)
+	var code int
+
+	switch base := color &^ colorBold; {
+	case base >= 8 && base < 16:
+		code = 90 + int(base-8)
+	case base == ColorDefault:
+		code = 39
+	default:
+		code = 30 + int(base)
+	}
+
+	if color&colorBold != 0 {
+		return fmt.Sprintf("\033[1;%dm%s\033[0m", code, text)
+	}
+
+	return fmt.Sprintf("\033[%dm%s\033[0m", code, text)
 }
@@ -0,0 +1,220 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+)
+
+type TLSLoggingCfg struct {
+	// Certificates expiring in less than this duration are reported, at most
+	// once a day. The default threshold is 30 days.
+	ExpiryWarningThreshold time.Duration `json:"expiry_warning_threshold"`
+
+	// The debug level used for successful handshakes. The default level is
+	// 1.
+	HandshakeDebugLevel int `json:"handshake_debug_level"`
+}
+
+// Return a copy of a TLS configuration whose callbacks log handshakes,
+// verification failures and certificates about to expire. Handshake errors
+// which happen before certificate verification are not visible to callbacks;
+// they are logged by TLSHandshake, or by an HTTP server whose ErrorLog field
+// is set to a standard logger obtained with StdLogger.
+func (l *Logger) InstrumentTLSConfig(cfg *tls.Config, lcfg TLSLoggingCfg) *tls.Config {
+	if lcfg.ExpiryWarningThreshold <= 0 {
+		lcfg.ExpiryWarningThreshold = 30 * 24 * time.Hour
+	}
+
+	if lcfg.HandshakeDebugLevel <= 0 {
+		lcfg.HandshakeDebugLevel = 1
+	}
+
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+
+	cfg2 := cfg.Clone()
+
+	for _, cert := range cfg2.Certificates {
+		l.checkTLSCertificate(&cert, lcfg)
+	}
+
+	if getCertificate := cfg.GetCertificate; getCertificate != nil {
+		cfg2.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, err := getCertificate(hello)
+			if err != nil {
+				l.ErrorData(Data{"server_name": hello.ServerName},
+					"cannot obtain tls certificate: %v", err)
+				return nil, err
+			}
+
+			if cert != nil {
+				l.checkTLSCertificate(cert, lcfg)
+			}
+
+			return cert, nil
+		}
+	}
+
+	verifyConnection := cfg.VerifyConnection
+	cfg2.VerifyConnection = func(state tls.ConnectionState) error {
+		data := tlsConnectionStateData(state)
+
+		if verifyConnection != nil {
+			if err := verifyConnection(state); err != nil {
+				l.ErrorData(data, "tls connection verification failed: %v",
+					err)
+				return err
+			}
+		}
+
+		for _, cert := range state.PeerCertificates {
+			l.checkX509Certificate(cert, lcfg)
+		}
+
+		l.DebugData(data, lcfg.HandshakeDebugLevel,
+			"tls handshake completed (%s, %s)",
+			data["tls_version"], data["tls_cipher_suite"])
+
+		return nil
+	}
+
+	return cfg2
+}
+
+// Run the handshake of a TLS connection and log any failure.
+func (l *Logger) TLSHandshake(conn *tls.Conn) error {
+	if err := conn.Handshake(); err != nil {
+		l.ErrorData(Data{"remote_addr": conn.RemoteAddr().String()},
+			"tls handshake failed: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (l *Logger) checkTLSCertificate(cert *tls.Certificate, lcfg TLSLoggingCfg) {
+	leaf := cert.Leaf
+	if leaf == nil {
+		if len(cert.Certificate) == 0 {
+			return
+		}
+
+		var err error
+		leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return
+		}
+	}
+
+	l.checkX509Certificate(leaf, lcfg)
+}
+
+func (l *Logger) checkX509Certificate(cert *x509.Certificate, lcfg TLSLoggingCfg) {
+	remaining := time.Until(cert.NotAfter)
+	if remaining > lcfg.ExpiryWarningThreshold {
+		return
+	}
+
+	data := Data{
+		"certificate_subject":   cert.Subject.String(),
+		"certificate_issuer":    cert.Issuer.String(),
+		"certificate_serial":    cert.SerialNumber.Text(16),
+		"certificate_not_after": cert.NotAfter.UTC().Format(time.RFC3339),
+	}
+
+	once := l.OncePer("tls-certificate-expiry:"+cert.Issuer.String()+":"+
+		cert.SerialNumber.Text(16), 24*time.Hour)
+
+	if remaining <= 0 {
+		once.ErrorData(data, "tls certificate %q has expired",
+			cert.Subject.String())
+	} else {
+		once.InfoData(data, "tls certificate %q expires in %d days",
+			cert.Subject.String(), int(remaining.Hours()/24))
+	}
+}
+
+func tlsConnectionStateData(state tls.ConnectionState) Data {
+	data := Data{
+		"tls_version":      tlsVersionName(state.Version),
+		"tls_cipher_suite": tls.CipherSuiteName(state.CipherSuite),
+		"tls_resumed":      state.DidResume,
+	}
+
+	if state.ServerName != "" {
+		data["server_name"] = state.ServerName
+	}
+
+	if state.NegotiatedProtocol != "" {
+		data["tls_negotiated_protocol"] = state.NegotiatedProtocol
+	}
+
+	if len(state.PeerCertificates) > 0 {
+		data["peer_certificate_subject"] =
+			state.PeerCertificates[0].Subject.String()
+	}
+
+	return data
+}
+
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	default:
+		return fmt.Sprintf("0x%04x", version)
+	}
+}
+
+// Return the TLS configuration used by a backend connecting to a server. If a
+// CA certificate path is provided, the certificates it contains are used to
+// verify the server certificate instead of system certificates.
+func clientTLSConfig(cfg *tls.Config, caCertificatePath string) (*tls.Config, error) {
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+
+	if caCertificatePath == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(caCertificatePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %q: %w", caCertificatePath, err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("invalid ca certificate in %q",
+			caCertificatePath)
+	}
+
+	cfg = cfg.Clone()
+	cfg.RootCAs = pool
+
+	return cfg, nil
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"sync"
+	"time"
+)
+
+// A transaction is a logger whose messages are held until the transaction is
+// committed, and are then written contiguously. Messages which are rolled
+// back are never written, captured or counted.
+//
+// Messages are guaranteed not to be interleaved with any other message only
+// if the backend implements BatchBackend, as the terminal, file, JSON,
+// writer, ring, syslog, queue and batching backends do. Other backends
+// receive messages one by one while a global lock is held: messages will not
+// be interleaved with messages from other transactions, but may be
+// interleaved with other messages.
+type Transaction struct {
+	*Logger
+
+	backend Backend
+	buffer  *transactionBuffer
+}
+
+type transactionBuffer struct {
+	mut      sync.Mutex
+	messages []Message
+}
+
+func (l *Logger) Begin() *Transaction {
+	buffer := &transactionBuffer{}
+
+	logger := l.Child("", nil)
+	logger.Backend = buffer
+
+	t := Transaction{
+		Logger: logger,
+
+		backend: l.Backend,
+		buffer:  buffer,
+	}
+
+	return &t
+}
+
+// Write all messages logged since the beginning of the transaction or the
+// last commit.
+func (t *Transaction) Commit() {
+	messages := t.buffer.take()
+	if len(messages) == 0 {
+		return
+	}
+
+	t.Logger.commit(t.backend, messages)
+}
+
+func (l *Logger) commit(backend Backend, msgs []Message) {
+	if ring := l.captureRing(); ring != nil {
+		ring.addBatch(msgs)
+	}
+
+	if l.state != nil {
+		for _, msg := range msgs {
+			l.state.countMessage(msg.Level)
+		}
+	}
+
+	if l.latencyTracker != nil {
+		now := time.Now()
+
+		for i := range msgs {
+			msgs[i].birth = now
+			msgs[i].latencyTracker = l.latencyTracker
+		}
+	}
+
+	logBatch(backend, msgs)
+
+	if l.latencyTracker != nil {
+		if b, ok := backend.(AsyncBackend); !ok || !b.ReportsDelivery() {
+			for _, msg := range msgs {
+				msg.Delivered()
+			}
+		}
+	}
+}
+
+// Discard all messages logged since the beginning of the transaction or the
+// last commit.
+func (t *Transaction) Rollback() {
+	t.buffer.take()
+}
+
+func (b *transactionBuffer) Log(msg Message) {
+	b.mut.Lock()
+	b.messages = append(b.messages, msg)
+	b.mut.Unlock()
+}
+
+func (b *transactionBuffer) take() []Message {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	messages := b.messages
+	b.messages = nil
+
+	return messages
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Column alignment on terminals depends on the number of cells used to
+// display each character, which is not the number of runes: East Asian wide
+// characters and most emojis use two cells, while combining marks do not use
+// any.
+
+var wideRuneRanges = []struct{ first, last rune }{
+	{0x1100, 0x115f},   // Hangul Jamo
+	{0x2e80, 0x303e},   // CJK radicals, Kangxi radicals, CJK symbols
+	{0x3041, 0x33ff},   // Hiragana, Katakana, CJK compatibility
+	{0x3400, 0x4dbf},   // CJK unified ideographs extension A
+	{0x4e00, 0x9fff},   // CJK unified ideographs
+	{0xa000, 0xa4cf},   // Yi
+	{0xac00, 0xd7a3},   // Hangul syllables
+	{0xf900, 0xfaff},   // CJK compatibility ideographs
+	{0xfe30, 0xfe4f},   // CJK compatibility forms
+	{0xff00, 0xff60},   // Fullwidth forms
+	{0xffe0, 0xffe6},   // Fullwidth signs
+	{0x1f300, 0x1f64f}, // Miscellaneous symbols and pictographs, emoticons
+	{0x1f680, 0x1f6ff}, // Transport and map symbols
+	{0x1f900, 0x1f9ff}, // Supplemental symbols and pictographs
+	{0x20000, 0x2fffd}, // CJK unified ideographs extensions
+	{0x30000, 0x3fffd},
+}
+
+func isZeroWidthSpace(r rune) bool {
+	switch r {
+	case '\u200b', '\u200c', '\u200d', '\u2060', '\ufeff':
+		return true
+	}
+
+	return false
+}
+
+func runeWidth(r rune) int {
+	if r < 0x20 || (r >= 0x7f && r < 0xa0) {
+		return 0
+	}
+
+	if r < 0x1100 && !unicode.In(r, unicode.Mn, unicode.Me) {
+		return 1
+	}
+
+	if isZeroWidthSpace(r) || unicode.In(r, unicode.Mn, unicode.Me) {
+		return 0
+	}
+
+	for _, wideRange := range wideRuneRanges {
+		if r < wideRange.first {
+			break
+		}
+
+		if r <= wideRange.last {
+			return 2
+		}
+	}
+
+	return 1
+}
+
+func stringWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		width += runeWidth(r)
+	}
+
+	return width
+}
+
+func stripZeroWidthSpaces(s string) string {
+	if strings.IndexFunc(s, isZeroWidthSpace) == -1 {
+		return s
+	}
+
+	return strings.Map(func(r rune) rune {
+		if isZeroWidthSpace(r) {
+			return -1
+		}
+
+		return r
+	}, s)
+}
+
+// Pad a string with space characters so that it is displayed using at least
+// width cells.
+func padRight(s string, width int) string {
+	n := width - stringWidth(s)
+	if n <= 0 {
+		return s
+	}
+
+	return s + strings.Repeat(" ", n)
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Messages generated by the library itself, e.g. to report backend errors,
+// use a dedicated domain.
+const InternalDomain = "go-log"
+
+type WriteFailure struct {
+	BackendType         BackendType
+	Endpoint            string
+	ConsecutiveFailures int
+	Err                 error
+
+	// The messages which could not be written, if the backend knows them.
+	// Backends writing encoded data, e.g. S3 chunks, and
+	// messages dropped because too many messages were pending, are not
+	// reported.
+	Messages []Message
+}
+
+type WriteFailureCfg struct {
+	// The level used to report isolated write failures. Once the number of
+	// consecutive failures reaches the escalation threshold, failures are
+	// reported with the error level.
+	Level               Level `json:"level"`
+	EscalationThreshold int   `json:"escalation_threshold"`
+
+	// After escalation, reports are sent at most once per interval.
+	ReportInterval time.Duration `json:"report_interval"`
+
+	// The backend reports are sent to; messages are printed on stderr by
+	// default.
+	Backend Backend `json:"-"`
+
+	// If set, the handler is called for each write failure in addition to
+	// the report being logged.
+	Handler func(WriteFailure) `json:"-"`
+}
+
+type writeFailureReporter struct {
+	Cfg WriteFailureCfg
+
+	backendType BackendType
+	endpoint    string
+
+	mut         sync.Mutex
+	consecutive int
+	lastReport  time.Time
+}
+
+// WriteFailureReporter reports write failures of backends implemented outside
+// of this package the same way built-in backends do.
+type WriteFailureReporter struct {
+	r *writeFailureReporter
+}
+
+func NewWriteFailureReporter(backendType BackendType, endpoint string, cfg *WriteFailureCfg) *WriteFailureReporter {
+	return &WriteFailureReporter{
+		r: newWriteFailureReporter(backendType, endpoint, cfg),
+	}
+}
+
+func (r *WriteFailureReporter) Failure(err error) {
+	r.r.failure(err)
+}
+
+func (r *WriteFailureReporter) Success() {
+	r.r.success()
+}
+
+func newWriteFailureReporter(backendType BackendType, endpoint string, cfg *WriteFailureCfg) *writeFailureReporter {
+	var cfg2 WriteFailureCfg
+	if cfg != nil {
+		cfg2 = *cfg
+	}
+
+	if cfg2.Level == "" {
+		cfg2.Level = LevelInfo
+	}
+
+	if cfg2.EscalationThreshold <= 0 {
+		cfg2.EscalationThreshold = 3
+	}
+
+	if cfg2.ReportInterval <= 0 {
+		cfg2.ReportInterval = 10 * time.Second
+	}
+
+	if cfg2.Backend == nil {
+		cfg2.Backend = NewTerminalBackend(TerminalBackendCfg{})
+	}
+
+	r := writeFailureReporter{
+		Cfg: cfg2,
+
+		backendType: backendType,
+		endpoint:    endpoint,
+	}
+
+	return &r
+}
+
+func (r *writeFailureReporter) failure(err error) {
+	r.failureMessages(err, nil)
+}
+
+// Report a failure to write a list of messages.
+func (r *writeFailureReporter) failureMessages(err error, msgs []Message) {
+	now := time.Now()
+
+	r.mut.Lock()
+	r.consecutive++
+	consecutive := r.consecutive
+
+	if consecutive == r.Cfg.EscalationThreshold {
+		resources.mut.Lock()
+		resources.failingBackends++
+		resources.mut.Unlock()
+	}
+
+	report := consecutive <= r.Cfg.EscalationThreshold ||
+		now.Sub(r.lastReport) >= r.Cfg.ReportInterval
+	if report {
+		r.lastReport = now
+	}
+	r.mut.Unlock()
+
+	failure := WriteFailure{
+		BackendType:         r.backendType,
+		Endpoint:            r.endpoint,
+		ConsecutiveFailures: consecutive,
+		Err:                 err,
+		Messages:            msgs,
+	}
+
+	if r.Cfg.Handler != nil {
+		r.Cfg.Handler(failure)
+	}
+
+	if !report {
+		return
+	}
+
+	level := r.Cfg.Level
+	if consecutive >= r.Cfg.EscalationThreshold {
+		level = LevelError
+	}
+
+	r.report(now, level, "cannot write log messages to the %s backend", Data{
+		"consecutive_failures": consecutive,
+		"error":                err.Error(),
+	})
+}
+
+func (r *writeFailureReporter) success() {
+	r.mut.Lock()
+	consecutive := r.consecutive
+	r.consecutive = 0
+	r.mut.Unlock()
+
+	if consecutive < r.Cfg.EscalationThreshold {
+		return
+	}
+
+	resources.mut.Lock()
+	resources.failingBackends--
+	resources.mut.Unlock()
+
+	r.report(time.Now(), LevelInfo,
+		"log messages written again to the %s backend", Data{
+			"consecutive_failures": consecutive,
+		})
+}
+
+func (r *writeFailureReporter) report(now time.Time, level Level, format string, data Data) {
+	t := now.UTC()
+
+	data["backend"] = string(r.backendType)
+	if r.endpoint != "" {
+		data["endpoint"] = r.endpoint
+	}
+
+	r.Cfg.Backend.Log(Message{
+		Time:    &t,
+		Level:   level,
+		Message: fmt.Sprintf(format, r.backendType),
+		Data:    data,
+
+		domain: InternalDomain,
+	})
+}
+
+// Backend configurations able to report write failures implement this
+// interface so that another write failure handler can be installed, for
+// example by the failover backend. The method returns a copy of the
+// configuration, leaving the original one untouched.
+type writeFailureHandlerCfg interface {
+	withWriteFailureHandler(func(WriteFailure)) interface{}
+}
+
+// Return a copy of a backend configuration whose write failure handler also
+// calls another handler. Configurations which cannot report write failures
+// are returned as is, and the function indicates that the handler could not
+// be installed.
+func withWriteFailureHandler(cfgObj interface{}, handler func(WriteFailure)) (interface{}, bool) {
+	handlerCfg, ok := cfgObj.(writeFailureHandlerCfg)
+	if !ok {
+		return cfgObj, false
+	}
+
+	return handlerCfg.withWriteFailureHandler(handler), true
+}
+
+// Return a copy of the configuration whose handler also calls another
+// handler.
+func (cfg *WriteFailureCfg) withHandler(handler func(WriteFailure)) *WriteFailureCfg {
+	var cfgCopy WriteFailureCfg
+	if cfg != nil {
+		cfgCopy = *cfg
+	}
+
+	if previousHandler := cfgCopy.Handler; previousHandler != nil {
+		cfgCopy.Handler = func(failure WriteFailure) {
+			previousHandler(failure)
+			handler(failure)
+		}
+	} else {
+		cfgCopy.Handler = handler
+	}
+
+	return &cfgCopy
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package log
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWithWriteFailureHandler(t *testing.T) {
+	var calls []string
+
+	cfg := &FileBackendCfg{
+		Path: "/tmp/test.log",
+		WriteFailures: &WriteFailureCfg{
+			Handler: func(WriteFailure) { calls = append(calls, "previous") },
+		},
+	}
+
+	cfgObj, ok := withWriteFailureHandler(cfg, func(WriteFailure) {
+		calls = append(calls, "new")
+	})
+	if !ok {
+		t.Fatalf("handler was not installed")
+	}
+
+	cfg2 := cfgObj.(*FileBackendCfg)
+	if cfg2 == cfg || cfg2.WriteFailures == cfg.WriteFailures {
+		t.Fatalf("configuration was not copied")
+	}
+
+	if cfg2.Path != cfg.Path {
+		t.Errorf("path was not copied")
+	}
+
+	cfg2.WriteFailures.Handler(WriteFailure{})
+	if expected := []string{"previous", "new"}; !reflect.DeepEqual(calls,
+		expected) {
+		t.Errorf("handlers were called as %v instead of %v", calls, expected)
+	}
+
+	calls = nil
+	cfg.WriteFailures.Handler(WriteFailure{})
+	if expected := []string{"previous"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("original handler was modified: called as %v", calls)
+	}
+
+	terminalCfg := &TerminalBackendCfg{}
+	if cfgObj, ok := withWriteFailureHandler(terminalCfg,
+		func(WriteFailure) {}); ok || cfgObj != terminalCfg {
+		t.Errorf("handler was installed on a terminal backend configuration")
+	}
+}